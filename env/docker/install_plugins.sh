@@ -0,0 +1,18 @@
+#!/bin/bash
+
+BASE_DIR="/home/mindfulbytes/src/plugins"
+PLUGIN_DEST_BASE_DIR="/home/mindfulbytes/bin/plugins"
+
+set -e
+
+for plugin_path in "$BASE_DIR"/*/; do
+	name=$(basename "$plugin_path")
+	if [ -f "$plugin_path/install.sh" ]; then
+		echo "Running install.sh in $plugin_path"
+		mkdir -p "$PLUGIN_DEST_BASE_DIR/$name"
+		chmod u+rx "$plugin_path/install.sh"
+		(cd "$plugin_path" && PLUGIN_DEST="$PLUGIN_DEST_BASE_DIR/$name" ./install.sh)
+	else
+		echo "no install script found in folder $plugin_path"
+	fi
+done
@@ -0,0 +1,196 @@
+package activity
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//mean radius of the earth in meters
+const earthRadius = 6371000.0
+
+//changes in elevation below this threshold (in meters) are treated as GPS noise
+const elevationThreshold = 3.0
+
+var ErrUnsupportedFormat = errors.New("Unsupported format")
+
+type Point struct {
+	Latitude float64
+	Longitude float64
+	//indoor activities (e.g on a treadmill) have no positions, only times (and sometimes elevations)
+	HasPosition bool
+	Elevation float64
+	HasElevation bool
+	//zero, if the point has no time (e.g a planned route)
+	Time time.Time
+}
+
+type Activity struct {
+	Name string
+	//e.g "running", "cycling" or "hiking", empty if unknown
+	Sport string
+	Start time.Time
+	Points []Point
+	//in meters
+	Distance float64
+	Duration time.Duration
+	//in meters
+	ElevationGain float64
+}
+
+//returns true for the files that can be read, i.e GPX and FIT files (optionally compressed with gzip, as in Strava's exports)
+func IsActivityFile(path string) bool {
+	ext := filepath.Ext(strings.TrimSuffix(strings.ToLower(path), ".gz"))
+	return ext == ".gpx" || ext == ".fit"
+}
+
+//reads a GPX or FIT file, the format is determined by the extension
+func Read(path string) (*Activity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	name := strings.ToLower(filepath.Base(path))
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+		name = strings.TrimSuffix(name, ".gz")
+	}
+
+	switch filepath.Ext(name) {
+	case ".gpx":
+		return ParseGPX(r)
+	case ".fit":
+		return ParseFIT(r)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+//great circle distance in meters
+func haversine(a Point, b Point) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat / 2) * math.Sin(dLat / 2) + math.Cos(lat1) * math.Cos(lat2) * math.Sin(dLon / 2) * math.Sin(dLon / 2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+//fills the start and the statistics that aren't stored in the file itself (GPX files only contain the points)
+func (a *Activity) complete() {
+	var first, last time.Time
+	var distance, gain float64
+	var previous, reference *Point
+	for i := range a.Points {
+		point := &a.Points[i]
+		if !point.Time.IsZero() {
+			if first.IsZero() {
+				first = point.Time
+			}
+			last = point.Time
+		}
+
+		if point.HasPosition {
+			if previous != nil {
+				distance += haversine(*previous, *point)
+			}
+			previous = point
+		}
+
+		if point.HasElevation {
+			if reference == nil {
+				reference = point
+			} else if point.Elevation - reference.Elevation >= elevationThreshold {
+				gain += point.Elevation - reference.Elevation
+				reference = point
+			} else if reference.Elevation - point.Elevation >= elevationThreshold {
+				reference = point
+			}
+		}
+	}
+
+	if a.Start.IsZero() {
+		a.Start = first
+	}
+	if a.Distance == 0 {
+		a.Distance = distance
+	}
+	if a.Duration == 0 && !first.IsZero() {
+		a.Duration = last.Sub(first)
+	}
+	if a.ElevationGain == 0 {
+		a.ElevationGain = gain
+	}
+}
+
+//returns the points with a position, thinned out evenly to at most max points. The first and the last point are always kept.
+func Simplify(points []Point, max int) []Point {
+	positions := []Point{}
+	for _, point := range points {
+		if point.HasPosition {
+			positions = append(positions, point)
+		}
+	}
+	if len(positions) <= max || max < 2 {
+		return positions
+	}
+
+	simplified := make([]Point, 0, max)
+	step := float64(len(positions) - 1) / float64(max - 1)
+	for i := 0; i < max; i++ {
+		simplified = append(simplified, positions[int(math.Round(float64(i) * step))])
+	}
+	return simplified
+}
+
+//projects the positions of the points into an area of the given size (in pixels), keeping the aspect ratio and leaving
+//the given margin. The y axis points down, the track is centered.
+func Project(points []Point, width float64, height float64, margin float64) [][2]float64 {
+	projected := [][2]float64{}
+	if len(points) == 0 {
+		return projected
+	}
+
+	//equirectangular projection, which is precise enough for the size of a track
+	minLat, maxLat := points[0].Latitude, points[0].Latitude
+	for _, point := range points {
+		minLat = math.Min(minLat, point.Latitude)
+		maxLat = math.Max(maxLat, point.Latitude)
+	}
+	scaleX := math.Cos((minLat + maxLat) / 2 * math.Pi / 180)
+
+	minX, maxX := points[0].Longitude * scaleX, points[0].Longitude * scaleX
+	for _, point := range points {
+		minX = math.Min(minX, point.Longitude * scaleX)
+		maxX = math.Max(maxX, point.Longitude * scaleX)
+	}
+
+	availableWidth := width - 2 * margin
+	availableHeight := height - 2 * margin
+	scale := 0.0
+	if maxX > minX || maxLat > minLat {
+		scale = math.Min(availableWidth / math.Max(maxX - minX, 1e-12), availableHeight / math.Max(maxLat - minLat, 1e-12))
+	}
+
+	offsetX := margin + (availableWidth - (maxX - minX) * scale) / 2
+	offsetY := margin + (availableHeight - (maxLat - minLat) * scale) / 2
+	for _, point := range points {
+		x := offsetX + (point.Longitude * scaleX - minX) * scale
+		y := offsetY + (maxLat - point.Latitude) * scale
+		projected = append(projected, [2]float64{x, y})
+	}
+	return projected
+}
@@ -0,0 +1,235 @@
+package activity
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error, expected not nil, but got nil: \033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+const gpxActivity = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+ <metadata><time>2019-07-04T06:00:00Z</time></metadata>
+ <trk>
+  <name>Morning Run</name>
+  <type>Running</type>
+  <trkseg>
+   <trkpt lat="48.2000" lon="16.3000"><ele>200.0</ele><time>2019-07-04T06:30:00Z</time></trkpt>
+   <trkpt lat="48.2010" lon="16.3000"><ele>201.0</ele><time>2019-07-04T06:31:00Z</time></trkpt>
+   <trkpt lat="48.2020" lon="16.3000"><ele>210.0</ele><time>2019-07-04T06:32:00Z</time></trkpt>
+  </trkseg>
+  <trkseg>
+   <trkpt lat="48.2030" lon="16.3000"><ele>205.0</ele><time>2019-07-04T06:33:30Z</time></trkpt>
+  </trkseg>
+ </trk>
+</gpx>`
+
+func TestParseGPX(t *testing.T) {
+	a, err := ParseGPX(strings.NewReader(gpxActivity))
+	ok(t, err)
+	equals(t, "Morning Run", a.Name)
+	equals(t, "running", a.Sport)
+	equals(t, time.Date(2019, 7, 4, 6, 30, 0, 0, time.UTC), a.Start.UTC())
+	equals(t, 4, len(a.Points))
+	equals(t, 210 * time.Second, a.Duration)
+	//0.003° of latitude are ~333.6m
+	equals(t, 334.0, math.Round(a.Distance))
+	//the climb of 1m is below the threshold, but counted together with the following 9m
+	equals(t, 10.0, a.ElevationGain)
+
+	route := `<gpx><metadata><time>2020-01-02T10:00:00Z</time></metadata><rte><name>Plan</name>` +
+				`<rtept lat="1" lon="1"/><rtept lat="1" lon="2"/></rte></gpx>`
+	a, err = ParseGPX(strings.NewReader(route))
+	ok(t, err)
+	equals(t, "Plan", a.Name)
+	equals(t, time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC), a.Start.UTC())
+	equals(t, time.Duration(0), a.Duration)
+
+	_, err = ParseGPX(strings.NewReader(`<gpx><trk><trkseg></trkseg></trk></gpx>`))
+	notOk(t, err)
+}
+
+//builds a FIT file with the given records (timestamp, latitude and longitude in degrees, altitude) and a session
+func buildFIT(records [][4]float64, compressLast bool) []byte {
+	var body bytes.Buffer
+	le := binary.LittleEndian
+
+	//definition of the record message (local message 0): timestamp, position_lat, position_long, altitude
+	body.Write([]byte{0x40, 0, 0})
+	binary.Write(&body, le, uint16(fitMessageRecord))
+	body.Write([]byte{4, 253, 4, 0x86, 0, 4, 0x85, 1, 4, 0x85, 2, 2, 0x84})
+
+	//definition of a record message without timestamp (local message 1), used with compressed timestamp headers
+	body.Write([]byte{0x41, 0, 0})
+	binary.Write(&body, le, uint16(fitMessageRecord))
+	body.Write([]byte{3, 0, 4, 0x85, 1, 4, 0x85, 2, 2, 0x84})
+
+	toSemicircles := func(degrees float64) int32 {
+		return int32(math.Round(degrees * (1 << 31) / 180))
+	}
+	start := time.Date(2021, 7, 4, 5, 30, 0, 0, time.UTC)
+
+	for i, record := range records {
+		timestamp := uint32(start.Sub(fitEpoch).Seconds() + record[0])
+		if compressLast && i == len(records) - 1 {
+			body.WriteByte(0x80 | 1 << 5 | byte(timestamp & 0x1F))
+		} else {
+			body.WriteByte(0x00)
+			binary.Write(&body, le, timestamp)
+		}
+		binary.Write(&body, le, toSemicircles(record[1]))
+		binary.Write(&body, le, toSemicircles(record[2]))
+		binary.Write(&body, le, uint16((record[3] + 500) * 5))
+	}
+
+	//session (local message 2, with a developer field): start_time, sport, total_timer_time, total_distance, total_ascent
+	body.Write([]byte{0x62, 0, 0})
+	binary.Write(&body, le, uint16(fitMessageSession))
+	body.Write([]byte{5, 2, 4, 0x86, 5, 1, 0x00, 8, 4, 0x86, 9, 4, 0x86, 22, 2, 0x84, 1, 0, 2, 0})
+	body.WriteByte(0x02)
+	binary.Write(&body, le, uint32(start.Sub(fitEpoch).Seconds()))
+	body.WriteByte(2)
+	binary.Write(&body, le, uint32(3600500))
+	binary.Write(&body, le, uint32(2500000))
+	//no ascent recorded
+	binary.Write(&body, le, uint16(0xFFFF))
+	body.Write([]byte{0xAB, 0xCD})
+
+	var file bytes.Buffer
+	file.Write([]byte{14, 0x10})
+	binary.Write(&file, le, uint16(2100))
+	binary.Write(&file, le, uint32(body.Len()))
+	file.WriteString(".FIT")
+	file.Write([]byte{0, 0})
+	file.Write(body.Bytes())
+	//the CRC isn't checked
+	file.Write([]byte{0, 0})
+	return file.Bytes()
+}
+
+func TestParseFIT(t *testing.T) {
+	data := buildFIT([][4]float64{{0, 48.2, 16.3, 200}, {30, 48.201, 16.3, 205}, {50, 48.202, 16.3, 201.2}}, true)
+	a, err := ParseFIT(bytes.NewReader(data))
+	ok(t, err)
+	equals(t, "cycling", a.Sport)
+	equals(t, time.Date(2021, 7, 4, 5, 30, 0, 0, time.UTC), a.Start)
+	equals(t, 3600500 * time.Millisecond, a.Duration)
+	equals(t, 25000.0, a.Distance)
+	//the ascent isn't stored in the session, so it's calculated from the records
+	equals(t, 5.0, a.ElevationGain)
+
+	equals(t, 3, len(a.Points))
+	equals(t, 48.201, math.Round(a.Points[1].Latitude * 1e6) / 1e6)
+	equals(t, 16.3, math.Round(a.Points[1].Longitude * 1e6) / 1e6)
+	equals(t, 205.0, a.Points[1].Elevation)
+	//the last record has a compressed timestamp
+	equals(t, time.Date(2021, 7, 4, 5, 30, 50, 0, time.UTC), a.Points[2].Time)
+
+	_, err = ParseFIT(bytes.NewReader(data[:len(data) - 10]))
+	notOk(t, err)
+
+	_, err = ParseFIT(strings.NewReader("not a fit file"))
+	notOk(t, err)
+}
+
+func TestRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "activity")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, err = gz.Write(buildFIT([][4]float64{{0, 1, 1, 0}}, false))
+	ok(t, err)
+	ok(t, gz.Close())
+	ok(t, ioutil.WriteFile(filepath.Join(dir, "ride.FIT.gz"), compressed.Bytes(), 0644))
+	ok(t, ioutil.WriteFile(filepath.Join(dir, "run.gpx"), []byte(gpxActivity), 0644))
+
+	equals(t, true, IsActivityFile(filepath.Join(dir, "ride.FIT.gz")))
+	equals(t, true, IsActivityFile(filepath.Join(dir, "run.gpx")))
+	equals(t, false, IsActivityFile(filepath.Join(dir, "run.tcx")))
+
+	a, err := Read(filepath.Join(dir, "ride.FIT.gz"))
+	ok(t, err)
+	equals(t, "cycling", a.Sport)
+
+	a, err = Read(filepath.Join(dir, "run.gpx"))
+	ok(t, err)
+	equals(t, "Morning Run", a.Name)
+
+	_, err = Read(filepath.Join(dir, "missing.gpx"))
+	notOk(t, err)
+}
+
+func TestSimplify(t *testing.T) {
+	points := []Point{}
+	for i := 0; i < 10; i++ {
+		points = append(points, Point{Latitude: float64(i), HasPosition: true})
+	}
+	points = append(points, Point{HasElevation: true})
+
+	latitudes := func(points []Point) []float64 {
+		result := []float64{}
+		for _, point := range points {
+			result = append(result, point.Latitude)
+		}
+		return result
+	}
+
+	equals(t, []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, latitudes(Simplify(points, 20)))
+	equals(t, []float64{0, 3, 6, 9}, latitudes(Simplify(points, 4)))
+	equals(t, 0, len(Simplify([]Point{Point{}}, 4)))
+}
+
+func TestProject(t *testing.T) {
+	points := []Point{Point{Latitude: 0, Longitude: 0}, Point{Latitude: 1, Longitude: 2}, Point{Latitude: 0.5, Longitude: 1}}
+	projected := Project(points, 220, 120, 10)
+	round := func(p [2]float64) [2]float64 {
+		return [2]float64{math.Round(p[0]), math.Round(p[1])}
+	}
+
+	//the track is twice as wide as it is high (close to the equator), so it fills the area
+	equals(t, [2]float64{10, 110}, round(projected[0]))
+	equals(t, [2]float64{210, 10}, round(projected[1]))
+	equals(t, [2]float64{110, 60}, round(projected[2]))
+
+	//a single point ends up in the center
+	equals(t, [][2]float64{{110, 60}}, Project(points[:1], 220, 120, 10))
+	equals(t, [][2]float64{}, Project([]Point{}, 220, 120, 10))
+}
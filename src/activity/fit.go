@@ -0,0 +1,248 @@
+package activity
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+//global message numbers and field numbers of the FIT profile that are needed for an activity
+const (
+	fitMessageFileId = 0
+	fitMessageSession = 18
+	fitMessageRecord = 20
+
+	fitFieldTimestamp = 253
+
+	fitFieldFileIdTimeCreated = 4
+
+	fitFieldSessionStartTime = 2
+	fitFieldSessionSport = 5
+	fitFieldSessionTotalTimerTime = 8
+	fitFieldSessionTotalDistance = 9
+	fitFieldSessionTotalAscent = 22
+
+	fitFieldRecordLatitude = 0
+	fitFieldRecordLongitude = 1
+	fitFieldRecordAltitude = 2
+	fitFieldRecordEnhancedAltitude = 78
+)
+
+//FIT timestamps are seconds since 1989-12-31T00:00:00Z
+var fitEpoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+var fitSports = map[uint64]string{
+	1: "running", 2: "cycling", 4: "fitness equipment", 5: "swimming", 10: "training", 11: "walking",
+	12: "cross country skiing", 13: "alpine skiing", 14: "snowboarding", 15: "rowing", 16: "mountaineering",
+	17: "hiking", 18: "multisport", 19: "paddling",
+}
+
+var ErrInvalidFIT = errors.New("Invalid FIT file")
+
+type fitFieldDefinition struct {
+	Number byte
+	Size int
+	BaseType byte
+}
+
+type fitDefinition struct {
+	GlobalMessage uint16
+	ByteOrder binary.ByteOrder
+	Fields []fitFieldDefinition
+	//the developer fields are skipped, only their total size is needed
+	DeveloperSize int
+}
+
+//the values of the fields of a data message, invalid values are left out
+type fitMessage map[byte]uint64
+
+//the value of a field with a single value (arrays and strings aren't needed). Signed values are returned as their bits.
+func readFitValue(data []byte, baseType byte, byteOrder binary.ByteOrder) (uint64, bool) {
+	var value, invalid uint64
+	switch len(data) {
+	case 1:
+		value, invalid = uint64(data[0]), 0xFF
+	case 2:
+		value, invalid = uint64(byteOrder.Uint16(data)), 0xFFFF
+	case 4:
+		value, invalid = uint64(byteOrder.Uint32(data)), 0xFFFFFFFF
+	default:
+		return 0, false
+	}
+
+	//the invalid value of signed types is the largest positive value
+	if baseType & 0x1F == 0x01 || baseType & 0x1F == 0x03 || baseType & 0x1F == 0x05 {
+		invalid >>= 1
+	}
+	return value, value != invalid
+}
+
+func semicirclesToDegrees(value uint64) float64 {
+	return float64(int32(uint32(value))) * 180 / (1 << 31)
+}
+
+func fitTime(value uint64) time.Time {
+	return fitEpoch.Add(time.Duration(value) * time.Second)
+}
+
+//parses the records (the points) and the session (the sport and the totals) of a FIT activity file
+func ParseFIT(r io.Reader) (*Activity, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || string(data[8:12]) != ".FIT" {
+		return nil, ErrInvalidFIT
+	}
+
+	headerSize := int(data[0])
+	end := headerSize + int(binary.LittleEndian.Uint32(data[4:8]))
+	if headerSize < 12 || end > len(data) {
+		return nil, ErrInvalidFIT
+	}
+
+	a := &Activity{}
+	var created time.Time
+	definitions := make(map[byte]*fitDefinition)
+	var lastTimestamp uint64
+	pos := headerSize
+
+	for pos < end {
+		header := data[pos]
+		pos += 1
+
+		var localMessage byte
+		compressedTimestamp := header & 0x80 != 0
+		if compressedTimestamp {
+			localMessage = (header >> 5) & 0x03
+		} else {
+			localMessage = header & 0x0F
+		}
+
+		//definition message
+		if !compressedTimestamp && header & 0x40 != 0 {
+			if pos + 5 > end {
+				return nil, ErrInvalidFIT
+			}
+			definition := &fitDefinition{ByteOrder: binary.LittleEndian}
+			if data[pos + 1] == 1 {
+				definition.ByteOrder = binary.BigEndian
+			}
+			definition.GlobalMessage = definition.ByteOrder.Uint16(data[pos + 2:pos + 4])
+			numFields := int(data[pos + 4])
+			pos += 5
+
+			if pos + 3 * numFields > end {
+				return nil, ErrInvalidFIT
+			}
+			for i := 0; i < numFields; i++ {
+				definition.Fields = append(definition.Fields, fitFieldDefinition{Number: data[pos], Size: int(data[pos + 1]),
+																		BaseType: data[pos + 2]})
+				pos += 3
+			}
+
+			if header & 0x20 != 0 {
+				if pos + 1 > end {
+					return nil, ErrInvalidFIT
+				}
+				numDeveloperFields := int(data[pos])
+				pos += 1
+				if pos + 3 * numDeveloperFields > end {
+					return nil, ErrInvalidFIT
+				}
+				for i := 0; i < numDeveloperFields; i++ {
+					definition.DeveloperSize += int(data[pos + 1])
+					pos += 3
+				}
+			}
+			definitions[localMessage] = definition
+			continue
+		}
+
+		//data message
+		definition, ok := definitions[localMessage]
+		if !ok {
+			return nil, ErrInvalidFIT
+		}
+
+		message := make(fitMessage)
+		for _, field := range definition.Fields {
+			if pos + field.Size > end {
+				return nil, ErrInvalidFIT
+			}
+			if value, valid := readFitValue(data[pos:pos + field.Size], field.BaseType, definition.ByteOrder); valid {
+				message[field.Number] = value
+			}
+			pos += field.Size
+		}
+		pos += definition.DeveloperSize
+
+		if timestamp, ok := message[fitFieldTimestamp]; ok {
+			lastTimestamp = timestamp
+		} else if compressedTimestamp {
+			//the header contains the lower 5 bits of the timestamp, which is later than the last full timestamp
+			offset := uint64(header & 0x1F)
+			timestamp = (lastTimestamp &^ 0x1F) + offset
+			if offset < lastTimestamp & 0x1F {
+				timestamp += 0x20
+			}
+			message[fitFieldTimestamp] = timestamp
+			lastTimestamp = timestamp
+		}
+
+		switch definition.GlobalMessage {
+		case fitMessageFileId:
+			if value, ok := message[fitFieldFileIdTimeCreated]; ok {
+				created = fitTime(value)
+			}
+		case fitMessageSession:
+			//the first session determines the sport and start of multisport activities, the totals are summed up
+			if value, ok := message[fitFieldSessionStartTime]; ok && a.Start.IsZero() {
+				a.Start = fitTime(value)
+			}
+			if value, ok := message[fitFieldSessionSport]; ok && a.Sport == "" {
+				a.Sport = fitSports[value]
+			}
+			if value, ok := message[fitFieldSessionTotalTimerTime]; ok {
+				a.Duration += time.Duration(value) * time.Millisecond
+			}
+			if value, ok := message[fitFieldSessionTotalDistance]; ok {
+				a.Distance += float64(value) / 100
+			}
+			if value, ok := message[fitFieldSessionTotalAscent]; ok {
+				a.ElevationGain += float64(value)
+			}
+		case fitMessageRecord:
+			point := Point{}
+			if value, ok := message[fitFieldTimestamp]; ok {
+				point.Time = fitTime(value)
+			}
+			latitude, hasLatitude := message[fitFieldRecordLatitude]
+			longitude, hasLongitude := message[fitFieldRecordLongitude]
+			if hasLatitude && hasLongitude {
+				point.Latitude = semicirclesToDegrees(latitude)
+				point.Longitude = semicirclesToDegrees(longitude)
+				point.HasPosition = true
+			}
+			if value, ok := message[fitFieldRecordEnhancedAltitude]; ok {
+				point.Elevation = float64(value) / 5 - 500
+				point.HasElevation = true
+			} else if value, ok := message[fitFieldRecordAltitude]; ok {
+				point.Elevation = float64(value) / 5 - 500
+				point.HasElevation = true
+			}
+			a.Points = append(a.Points, point)
+		}
+	}
+
+	a.complete()
+	if a.Start.IsZero() {
+		a.Start = created
+	}
+	if a.Start.IsZero() {
+		return nil, errors.New("FIT file doesn't contain any times")
+	}
+	return a, nil
+}
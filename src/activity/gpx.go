@@ -0,0 +1,106 @@
+package activity
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+type gpxPoint struct {
+	Latitude float64 `xml:"lat,attr"`
+	Longitude float64 `xml:"lon,attr"`
+	Elevation *float64 `xml:"ele"`
+	Time string `xml:"time"`
+}
+
+type gpxFile struct {
+	Metadata struct {
+		Name string `xml:"name"`
+		Time string `xml:"time"`
+	} `xml:"metadata"`
+	Tracks []struct {
+		Name string `xml:"name"`
+		Type string `xml:"type"`
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+	Routes []struct {
+		Name string `xml:"name"`
+		Type string `xml:"type"`
+		Points []gpxPoint `xml:"rtept"`
+	} `xml:"rte"`
+}
+
+func parseGPXTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func (p gpxPoint) toPoint() Point {
+	point := Point{Latitude: p.Latitude, Longitude: p.Longitude, HasPosition: true, Time: parseGPXTime(p.Time)}
+	if p.Elevation != nil {
+		point.Elevation = *p.Elevation
+		point.HasElevation = true
+	}
+	return point
+}
+
+//parses the tracks (or, if there are none, the routes) of a GPX file, several tracks are joined into one activity
+func ParseGPX(r io.Reader) (*Activity, error) {
+	var file gpxFile
+	decoder := xml.NewDecoder(r)
+	//some devices write GPX files in other encodings than UTF-8, the coordinates and times are ASCII anyway
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	err := decoder.Decode(&file)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Activity{Name: strings.TrimSpace(file.Metadata.Name)}
+	for _, track := range file.Tracks {
+		if a.Name == "" {
+			a.Name = strings.TrimSpace(track.Name)
+		}
+		if a.Sport == "" {
+			a.Sport = strings.ToLower(strings.TrimSpace(track.Type))
+		}
+		for _, segment := range track.Segments {
+			for _, point := range segment.Points {
+				a.Points = append(a.Points, point.toPoint())
+			}
+		}
+	}
+
+	if len(file.Tracks) == 0 {
+		for _, route := range file.Routes {
+			if a.Name == "" {
+				a.Name = strings.TrimSpace(route.Name)
+			}
+			if a.Sport == "" {
+				a.Sport = strings.ToLower(strings.TrimSpace(route.Type))
+			}
+			for _, point := range route.Points {
+				a.Points = append(a.Points, point.toPoint())
+			}
+		}
+	}
+
+	if len(a.Points) == 0 {
+		return nil, errors.New("GPX file doesn't contain any points")
+	}
+
+	a.complete()
+	//planned routes only have the time of the file
+	if a.Start.IsZero() {
+		a.Start = parseGPXTime(file.Metadata.Time)
+	}
+	return a, nil
+}
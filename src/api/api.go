@@ -3,6 +3,7 @@ package api
 import (
 	"github.com/gomodule/redigo/redis"
 	"github.com/bbernhard/mindfulbytes/utils"
+	"github.com/bbernhard/mindfulbytes/entrymeta"
 	"io/ioutil"
 	"strings"
 	"github.com/gofrs/uuid"
@@ -11,7 +12,9 @@ import (
 	"encoding/json"
 	"github.com/gabriel-vasile/mimetype"
 	"bytes"
-	//
+	"crypto/sha1"
+	"encoding/hex"
+	"path/filepath"
 )
 
 type InternalServerError struct {
@@ -30,11 +33,26 @@ func (e *ItemNotFoundError) Error() string {
 	return e.Description
 }
 
+type BadRequestError struct {
+	Description string
+}
+
+func (e *BadRequestError) Error() string {
+	return e.Description
+}
+
 type Entry struct {
 	Uri string `json:"uri"`
 	Uuid string `json:"uuid"`
 	Plugin string `json:"plugin"`
 	FullDate string `json:"fulldate,omitempty"`
+	DateSource string `json:"datesource,omitempty"`
+	//what the entry refers to (see utils.KindImage, ...), entries of plugins that don't set it get the plugin's default kind
+	Kind string `json:"kind,omitempty"`
+	//additional information about the item (e.g the title, the camera or the location), see entrymeta for the well-known keys
+	Metadata map[string]string `json:"metadata,omitempty"`
+	//the version of the metadata model (see entrymeta.Version), 0 for entries of plugins that don't use it yet
+	MetadataVersion int `json:"metadataversion,omitempty"`
 }
 
 type Api struct {
@@ -42,6 +60,7 @@ type Api struct {
 	imageMagickWrapper *utils.ImageMagickWrapper
 	plugins *utils.Plugins
 	tmpDir string
+	itemCache *itemCache
 }
 
 type CacheEntryRequest struct {
@@ -50,15 +69,28 @@ type CacheEntryRequest struct {
 }
 
 func NewApi(redisPool *redis.Pool, imageMagickWrapper *utils.ImageMagickWrapper, plugins *utils.Plugins, tmpDir string) *Api {
+	itemCache := newItemCache(filepath.Join(tmpDir, "items"), tmpDir, itemCacheDuration, itemCacheMaxSize)
+	go itemCache.runCleanup(itemCacheCleanupInterval)
+
 	return &Api{
 		redisPool: redisPool,
 		imageMagickWrapper: imageMagickWrapper,
 		plugins: plugins,
 		tmpDir: tmpDir,
+		itemCache: itemCache,
 	}
 }
 
 
+//the kind of the plugin's entries that don't specify one
+func (a *Api) getDefaultKind(plugin string) string {
+	p, err := a.plugins.GetPlugin(plugin)
+	if err != nil {
+		return utils.KindImage
+	}
+	return p.DefaultKind()
+}
+
 func (a *Api) GetDataForDate(plugins []string, date string) ([]Entry, error) {
 	redisConn := a.redisPool.Get()
 	defer redisConn.Close()
@@ -84,9 +116,13 @@ func (a *Api) GetDataForDate(plugins []string, date string) ([]Entry, error) {
 			return allEntries, &InternalServerError{Description: "Couldn't parse json: " + err.Error()}
 		}
 		
+		defaultKind := a.getDefaultKind(plugin)
 		for i := 0; i < len(entries); i++ {
 			entry := &entries[i]
 			entry.Plugin = plugin
+			if entry.Kind == "" {
+				entry.Kind = defaultKind
+			}
 		}
 
 		allEntries = append(allEntries, entries...)
@@ -121,9 +157,13 @@ func (a *Api) GetDataForFullDate(plugins []string, day string) ([]Entry, error)
 			return allEntries, &InternalServerError{Description: "Couldn't parse json: " + err.Error()}
 		}
 		
+		defaultKind := a.getDefaultKind(plugin)
 		for i := 0; i < len(entries); i++ {
 			entry := &entries[i]
 			entry.Plugin = plugin
+			if entry.Kind == "" {
+				entry.Kind = defaultKind
+			}
 		}
 
 		allEntries = append(allEntries, entries...)
@@ -132,12 +172,27 @@ func (a *Api) GetDataForFullDate(plugins []string, day string) ([]Entry, error)
 	return allEntries, nil
 }
 
+//returns the entries whose metadata matches all filters
+func FilterEntries(entries []Entry, filters []entrymeta.Filter) []Entry {
+	if len(filters) == 0 {
+		return entries
+	}
+
+	filteredEntries := []Entry{}
+	for _, entry := range entries {
+		if entrymeta.MatchesAll(filters, entry.Metadata) {
+			filteredEntries = append(filteredEntries, entry)
+		}
+	}
+	return filteredEntries
+}
+
 func removeFiles(files []string) error {
 	var err error = nil
 	for _, file := range files {
 		e := os.Remove(file)
 		if e != nil {
-			log.Error("Couldn't remove file ", file, ": ", err.Error())
+			log.Error("Couldn't remove file ", file, ": ", e.Error())
 			err = e
 		}
 	}
@@ -145,13 +200,51 @@ func removeFiles(files []string) error {
 	return err
 }
 
-func (a *Api) GetImage(plugin string, imageId string, convertOptions utils.ConvertOptions) ([]byte, string, error) {
+//the variant of an item that is rendered as image. Plugins with the 'poster' capability return a still image of the items
+//that aren't images (e.g a frame of a video or a card of an event), the other plugins return the item itself.
+func getPreviewVariant(p utils.Plugin) string {
+	if p.HasCapability(utils.CapabilityPoster) {
+		return utils.FetchVariantPoster
+	}
+	return utils.FetchVariantOriginal
+}
+
+//the label that is rendered in case there is no still image of an item (e.g of an audio file)
+func getPlaceholderLabel(kind string) string {
+	switch kind {
+	case utils.KindVideo:
+		return "Video"
+	case utils.KindText:
+		return "Text"
+	case utils.KindAudio:
+		return "Audio"
+	case utils.KindEvent:
+		return "Event"
+	}
+	return "Image"
+}
+
+//returns a preview of the item as image with the given options. The item is rendered depending on the content the plugin
+//returns: images are converted, text (e.g a note) is rendered and for other content (e.g an audio file) a placeholder is shown.
+//An empty kind means the plugin's default kind.
+func (a *Api) GetImage(plugin string, imageId string, kind string, convertOptions utils.ConvertOptions) ([]byte, string, error) {
 	uri := imageId
 
 	p, err := a.plugins.GetPlugin(plugin)
 	if err != nil {
 		return []byte(""), "", &ItemNotFoundError{Description: "No plugin with that name found: " + err.Error()}
 	}
+
+	if !p.HasCapability(utils.CapabilityFetch) {
+		return []byte(""), "", &ItemNotFoundError{Description: "Plugin " + plugin + " doesn't support fetching items"}
+	}
+
+	if kind == "" {
+		kind = p.DefaultKind()
+	}
+	if !p.SupportsKind(kind) {
+		return []byte(""), "", &BadRequestError{Description: "Plugin " + plugin + " doesn't support items of kind " + kind}
+	}
 	
 	tmpFileName, err := uuid.NewV4()
 	if err != nil {
@@ -159,7 +252,7 @@ func (a *Api) GetImage(plugin string, imageId string, convertOptions utils.Conve
 	}
 
 	tmpDestination := a.tmpDir + "/" + tmpFileName.String()
-	err = a.plugins.ExecFetch(uri, tmpDestination, p.Exec.FetchExec)
+	err = a.plugins.ExecFetch(uri, tmpDestination, getPreviewVariant(p), p.Exec.FetchExec)
 	if err != nil {
 		return []byte(""), "", &InternalServerError{Description: "Couldn't fetch image: " + err.Error()}
 	}
@@ -172,6 +265,36 @@ func (a *Api) GetImage(plugin string, imageId string, convertOptions utils.Conve
 		return []byte(""), "", err
 	}
 
+	fetchedMime, err := mimetype.DetectFile(tmpDestination)
+	if err != nil {
+		removeFiles(tmpFilesToCleanup) //no need to check return code, it's just cleanup
+		return []byte(""), "", &InternalServerError{Description: "Couldn't detect mime type of item: " + err.Error()}
+	}
+
+	//not all image formats ImageMagick can read are detected (e.g some RAW formats), so images are always converted
+	isImage := strings.HasPrefix(fetchedMime.String(), "image/") || kind == utils.KindImage
+	isText := strings.HasPrefix(fetchedMime.String(), "text/") || p.HasCapability(utils.CapabilityText)
+	if !isImage && !isText {
+		placeholderTmpDestination := tmpDestination + "-placeholder"
+		err = ioutil.WriteFile(placeholderTmpDestination, []byte(getPlaceholderLabel(kind)), 0600)
+		if err != nil {
+			removeFiles(tmpFilesToCleanup) //no need to check return code, it's just cleanup
+			return []byte(""), "", &InternalServerError{Description: "Couldn't write placeholder: " + err.Error()}
+		}
+		tmpFilesToCleanup = append(tmpFilesToCleanup, placeholderTmpDestination)
+		tmpDestination = placeholderTmpDestination
+	}
+
+	if !isImage {
+		renderedTmpDestination, err := a.imageMagickWrapper.RenderText(tmpDestination, u.String() + "-text", convertOptions)
+		if err != nil {
+			removeFiles(tmpFilesToCleanup) //no need to check return code, it's just cleanup
+			return []byte(""), "", &InternalServerError{Description: "Couldn't render text: " + err.Error()}
+		}
+		tmpFilesToCleanup = append(tmpFilesToCleanup, renderedTmpDestination)
+		tmpDestination = renderedTmpDestination
+	}
+
 	convertedTmpDestination, err := a.imageMagickWrapper.Convert(tmpDestination, u.String(), convertOptions)
 	if err != nil {
 		removeFiles(tmpFilesToCleanup) //no need to check return code, it's just cleanup
@@ -197,6 +320,34 @@ func (a *Api) GetImage(plugin string, imageId string, convertOptions utils.Conve
 	return imgBytes, mime.String(), nil
 }
 
+//fetches the original item (e.g a video, a note or a calendar event) and returns the path to the (cached) file together with its mime type
+func (a *Api) GetItem(plugin string, itemId string) (string, string, error) {
+	p, err := a.plugins.GetPlugin(plugin)
+	if err != nil {
+		return "", "", &ItemNotFoundError{Description: "No plugin with that name found: " + err.Error()}
+	}
+
+	if !p.HasCapability(utils.CapabilityFetch) {
+		return "", "", &ItemNotFoundError{Description: "Plugin " + plugin + " doesn't support fetching items"}
+	}
+
+	//the item id comes from the request, so it's not used as filename directly
+	hash := sha1.Sum([]byte(plugin + "/" + itemId))
+	itemPath, err := a.itemCache.get(hex.EncodeToString(hash[:]), func(destination string) error {
+		return a.plugins.ExecFetch(itemId, destination, utils.FetchVariantOriginal, p.Exec.FetchExec)
+	})
+	if err != nil {
+		return "", "", &InternalServerError{Description: "Couldn't fetch item: " + err.Error()}
+	}
+
+	mime, err := mimetype.DetectFile(itemPath)
+	if err != nil {
+		return "", "", &InternalServerError{Description: "Couldn't detect mime type of item: " + err.Error()}
+	}
+
+	return itemPath, mime.String(), nil
+}
+
 func (a *Api) GetDates(plugins []string) ([]string, error) {
 	redisConn := a.redisPool.Get()
 	defer redisConn.Close()
@@ -307,3 +458,143 @@ func (a *Api) GetCacheEntries() ([]string, error) {
 
 	return cacheEntries, nil
 }
+
+func (a *Api) TriggerCrawl(plugin string) (utils.CrawlJob, error) {
+	p, err := a.plugins.GetPlugin(plugin)
+	if err != nil {
+		return utils.CrawlJob{}, &ItemNotFoundError{Description: "No plugin with that name found: " + err.Error()}
+	}
+
+	if !p.Config.Enabled {
+		return utils.CrawlJob{}, &BadRequestError{Description: "Plugin " + plugin + " is disabled"}
+	}
+
+	job, err := utils.EnqueueCrawlJob(a.redisPool, plugin)
+	if err != nil {
+		return job, &InternalServerError{Description: "Couldn't enqueue crawl job: " + err.Error()}
+	}
+
+	return job, nil
+}
+
+func (a *Api) GetCrawlJobs(plugin string) ([]utils.CrawlJob, error) {
+	_, err := a.plugins.GetPlugin(plugin)
+	if err != nil {
+		return []utils.CrawlJob{}, &ItemNotFoundError{Description: "No plugin with that name found: " + err.Error()}
+	}
+
+	jobs, err := utils.GetCrawlJobs(a.redisPool, plugin)
+	if err != nil {
+		return jobs, &InternalServerError{Description: "Couldn't get crawl jobs: " + err.Error()}
+	}
+
+	return jobs, nil
+}
+
+func (a *Api) GetCrawlJob(plugin string, jobId string) (utils.CrawlJob, error) {
+	job, err := utils.GetCrawlJob(a.redisPool, jobId)
+	if err != nil {
+		if err == redis.ErrNil {
+			return job, &ItemNotFoundError{Description: "No crawl job with that id found"}
+		}
+		return job, &InternalServerError{Description: "Couldn't get crawl job: " + err.Error()}
+	}
+
+	if job.Plugin != plugin {
+		return utils.CrawlJob{}, &ItemNotFoundError{Description: "No crawl job with that id found"}
+	}
+
+	return job, nil
+}
+
+func (a *Api) GetPluginLogs(plugin string, runId string, phase string, limit int) ([]utils.PluginLogEntry, error) {
+	_, err := a.plugins.GetPlugin(plugin)
+	if err != nil {
+		return []utils.PluginLogEntry{}, &ItemNotFoundError{Description: "No plugin with that name found: " + err.Error()}
+	}
+
+	if phase != "" && phase != utils.PluginPhaseCrawl && phase != utils.PluginPhaseFetch {
+		return []utils.PluginLogEntry{}, &BadRequestError{Description: "Invalid phase '" + phase + "'"}
+	}
+
+	logBuffer := a.plugins.GetLogBuffer()
+	if logBuffer == nil {
+		return []utils.PluginLogEntry{}, nil
+	}
+
+	entries, err := logBuffer.Get(plugin, runId, phase, limit)
+	if err != nil {
+		return entries, &InternalServerError{Description: "Couldn't get plugin logs: " + err.Error()}
+	}
+
+	return entries, nil
+}
+
+type PluginStatus struct {
+	Name string `json:"name"`
+	Enabled bool `json:"enabled"`
+	Healthy bool `json:"healthy"`
+	LastSuccess int64 `json:"lastsuccess,omitempty"`
+	LastFailure int64 `json:"lastfailure,omitempty"`
+	Items int `json:"items"`
+	Alert string `json:"alert,omitempty"`
+	Runs []utils.CrawlJob `json:"runs"`
+}
+
+func (a *Api) GetPluginStatus(plugin string) (PluginStatus, error) {
+	p, err := a.plugins.GetPlugin(plugin)
+	if err != nil {
+		return PluginStatus{}, &ItemNotFoundError{Description: "No plugin with that name found: " + err.Error()}
+	}
+
+	pluginStatus := PluginStatus{Name: p.Name, Enabled: p.Config.Enabled}
+
+	lastSuccess, err := utils.GetLastSuccessfulCrawlExecutionTimestamp(a.redisPool, p.Name)
+	if err != nil {
+		return pluginStatus, &InternalServerError{Description: "Couldn't get last successful crawl: " + err.Error()}
+	}
+	if !lastSuccess.IsZero() {
+		pluginStatus.LastSuccess = lastSuccess.Unix()
+	}
+
+	lastFailure, err := utils.GetLastFailedCrawlExecutionTimestamp(a.redisPool, p.Name)
+	if err != nil {
+		return pluginStatus, &InternalServerError{Description: "Couldn't get last failed crawl: " + err.Error()}
+	}
+	if !lastFailure.IsZero() {
+		pluginStatus.LastFailure = lastFailure.Unix()
+	}
+
+	pluginStatus.Alert, err = utils.GetPluginAlert(a.redisPool, p.Name)
+	if err != nil {
+		return pluginStatus, &InternalServerError{Description: "Couldn't get plugin alert: " + err.Error()}
+	}
+
+	//a plugin is considered healthy as long as the most recent crawl didn't fail
+	pluginStatus.Healthy = (lastFailure.IsZero() || lastSuccess.After(lastFailure)) && pluginStatus.Alert == ""
+
+	pluginStatus.Items, err = utils.GetIndexedItemsCount(a.redisPool, p.Name)
+	if err != nil {
+		return pluginStatus, &InternalServerError{Description: "Couldn't count indexed items: " + err.Error()}
+	}
+
+	pluginStatus.Runs, err = utils.GetCrawlJobs(a.redisPool, p.Name)
+	if err != nil {
+		return pluginStatus, &InternalServerError{Description: "Couldn't get crawl jobs: " + err.Error()}
+	}
+
+	return pluginStatus, nil
+}
+
+func (a *Api) GetPluginsStatus() ([]PluginStatus, error) {
+	pluginsStatus := []PluginStatus{}
+	for _, plugin := range a.plugins.GetPlugins() {
+		pluginStatus, err := a.GetPluginStatus(plugin.Name)
+		if err != nil {
+			return pluginsStatus, err
+		}
+		pluginsStatus = append(pluginsStatus, pluginStatus)
+	}
+
+	return pluginsStatus, nil
+}
@@ -142,6 +142,7 @@ func (e *ExternalApiClient) GetImage(plugin string, imageId string) ([]byte, err
 type ImageData struct {
 	Image []byte
 	FullDate string
+	Metadata map[string]string
 }
 
 func (e *ExternalApiClient) GetImageTodayOrRandomWithData(topic string) (ImageData, error) {
@@ -171,6 +172,7 @@ func (e *ExternalApiClient) GetImageTodayOrRandomWithData(topic string) (ImageDa
 			imageId = entry.Uuid
 			plugin = entry.Plugin
 			imageData.FullDate = fullDates[randomNum]
+			imageData.Metadata = entry.Metadata
 		} else {
 			return imageData, errors.New("No images found")
 		}
@@ -179,6 +181,7 @@ func (e *ExternalApiClient) GetImageTodayOrRandomWithData(topic string) (ImageDa
 		imageId = entries[randomNum].Uuid
 		plugin = entries[randomNum].Plugin
 		imageData.FullDate = entries[randomNum].FullDate
+		imageData.Metadata = entries[randomNum].Metadata
 	}
 
 	imageData.Image, err = e.GetImage(plugin, imageId)
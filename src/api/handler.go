@@ -3,6 +3,7 @@ package api
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/bbernhard/mindfulbytes/utils"
+	"github.com/bbernhard/mindfulbytes/entrymeta"
 	log "github.com/sirupsen/logrus"
 	"strings"
 	"strconv"
@@ -11,6 +12,8 @@ import (
 	"github.com/gabriel-vasile/mimetype"
 	"bytes"
 	"github.com/go-resty/resty/v2"
+	"net/http"
+	"os"
 )
 
 type ImageFetchError struct {
@@ -22,7 +25,7 @@ func (e *ImageFetchError) Error() string {
 	return e.Description
 }
 
-func parseGetImageRequest(c *gin.Context, apiClient *Api, plugins []string, imageId string) (string, string, utils.ConvertOptions, error) {
+func parseGetImageRequest(c *gin.Context, apiClient *Api, plugins []string, imageId string) (string, string, string, utils.ConvertOptions, error) {
 	mode := c.DefaultQuery("mode", "rgb")
 	
 	grayscale := false
@@ -37,17 +40,17 @@ func parseGetImageRequest(c *gin.Context, apiClient *Api, plugins []string, imag
 		sizes := strings.Split(size, "x")
 
 		if len(sizes) != 2 {
-			return "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 400, Description: "Couldn't process request - invalid image size"}
+			return "", "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 400, Description: "Couldn't process request - invalid image size"}
 		}
 
 		_, err := strconv.Atoi(sizes[0])
 		if err != nil {
-			return "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 400, Description: "Couldn't process request - invalid image width"}
+			return "", "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 400, Description: "Couldn't process request - invalid image width"}
 		}
 
 		_, err = strconv.Atoi(sizes[1])
 		if err != nil {
-			return "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 400, Description: "Couldn't process request - invalid image height"}
+			return "", "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 400, Description: "Couldn't process request - invalid image height"}
 		}
 	}
 
@@ -68,19 +71,24 @@ func parseGetImageRequest(c *gin.Context, apiClient *Api, plugins []string, imag
 		plugin = plugins[0]
 	}
 
+	//the kind of an explicitly requested item isn't known, it can be passed along (the plugin's default kind is used otherwise)
+	kind := c.DefaultQuery("kind", "")
 	fullDate := ""
+	var metadata map[string]string
 	if imageId == "today-or-random" {
 		currentDate := time.Now()
 		currentDateStr := currentDate.Format("01-02")
 		todaysEntries, err := apiClient.GetDataForDate(plugins, currentDateStr)
 		if err != nil {
-			return "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 500, Description: "Couldn't process request - please try again later"}
+			return "", "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 500, Description: "Couldn't process request - please try again later"}
 		}
 		if len(todaysEntries) > 0 {
 			randomNum:= utils.GetRandomNumber(len(todaysEntries))
 			imageId = todaysEntries[randomNum].Uuid
 			plugin = todaysEntries[randomNum].Plugin
 			fullDate = todaysEntries[randomNum].FullDate
+			metadata = todaysEntries[randomNum].Metadata
+			kind = todaysEntries[randomNum].Kind
 		} else {
 			imageId = "random"
 		}
@@ -91,11 +99,11 @@ func parseGetImageRequest(c *gin.Context, apiClient *Api, plugins []string, imag
 		fullDates, err := apiClient.GetFullDates(plugins)
 		if err != nil {
 			log.Error(err.Error())
-			return "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 500, Description: "Couldn't process request - please try again later"}
+			return "", "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 500, Description: "Couldn't process request - please try again later"}
 		}
 
 		if len(fullDates) == 0 {
-			return "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 400, Description: "No images for plugin(s) " + strings.Join(plugins, ",") + " found"}
+			return "", "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 400, Description: "No images for plugin(s) " + strings.Join(plugins, ",") + " found"}
 		}
 
 		randomNum := utils.GetRandomNumber(len(fullDates))
@@ -104,11 +112,11 @@ func parseGetImageRequest(c *gin.Context, apiClient *Api, plugins []string, imag
 		dataEntries, err := apiClient.GetDataForFullDate(plugins, randomFullDate)
 		if err != nil {
 			log.Error(err.Error())
-			return "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 500, Description: "Couldn't process request - please try again later"}
+			return "", "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 500, Description: "Couldn't process request - please try again later"}
 		}
 
 		if len(dataEntries) == 0 {
-			return "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 404, Description: "No images found"}
+			return "", "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 404, Description: "No images found"}
 		}
 
 		randomNum = utils.GetRandomNumber(len(dataEntries))
@@ -116,36 +124,45 @@ func parseGetImageRequest(c *gin.Context, apiClient *Api, plugins []string, imag
 		imageId = dataEntries[randomNum].Uuid
 		plugin = dataEntries[randomNum].Plugin
 		fullDate = dataEntries[randomNum].FullDate
+		metadata = dataEntries[randomNum].Metadata
+		kind = dataEntries[randomNum].Kind
 	}
 
 	if fullDate != "" && caption != "" {
 		d, err := utils.ConvertFullDateToTime(fullDate)
 		if err != nil {
-			return "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 500, Description: "Couldn't process request - please try again later"}
+			return "", "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 500, Description: "Couldn't process request - please try again later"}
 		}
 
 		caption, err = utils.ReplaceTagsInMessage(caption, d, language)
 		if err != nil {
-			return "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 500, Description: "Couldn't process request - please try again later"}
+			return "", "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 500, Description: "Couldn't process request - please try again later"}
 		}
+		//e.g {{ text }}, the text of a post
+		caption = utils.ReplaceMetadataTagsInMessage(caption, metadata)
 	}
 
 	if plugin == "" {
-		return "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 404, Description: "No plugin specified"}
+		return "", "", "", utils.ConvertOptions{}, &ImageFetchError{StatusCode: 404, Description: "No plugin specified"}
 	}
 
 	convertOptions := utils.ConvertOptions{Size: size, Caption: caption, Grayscale: grayscale, 
 			Format: format, Extent: extent, BackgroundColor: backgroundColor, TextColor: textColor}
-	return plugin, imageId, convertOptions, nil
+	return plugin, imageId, kind, convertOptions, nil
 }
 
-func getImage(apiClient *Api, plugin string, imageId string, convertOptions utils.ConvertOptions) ([]byte, string, error) {
-	imgBytes, mimeType, err := apiClient.GetImage(plugin, imageId, convertOptions)
+func getImage(apiClient *Api, plugin string, imageId string, kind string, convertOptions utils.ConvertOptions) ([]byte, string, error) {
+	imgBytes, mimeType, err := apiClient.GetImage(plugin, imageId, kind, convertOptions)
 	return imgBytes, mimeType, err
 }
 
+//the metadata filters of a request, e.g ?filter=camera=*pixel*&filter=width>=1920
+func parseFilters(c *gin.Context) ([]entrymeta.Filter, error) {
+	return entrymeta.ParseFilters(c.QueryArray("filter"))
+}
+
 func deliverImage(c *gin.Context, apiClient *Api, plugins []string, imageId string) {
-	plugin, imageId, convertOptions, err := parseGetImageRequest(c, apiClient, plugins, imageId)
+	plugin, imageId, kind, convertOptions, err := parseGetImageRequest(c, apiClient, plugins, imageId)
 	if err != nil {
 		switch err.(type) {
 		case *ImageFetchError:
@@ -157,13 +174,16 @@ func deliverImage(c *gin.Context, apiClient *Api, plugins []string, imageId stri
 	}
 
 
-	imgBytes, mimeType, err := getImage(apiClient, plugin, imageId, convertOptions)
+	imgBytes, mimeType, err := getImage(apiClient, plugin, imageId, kind, convertOptions)
 	if err != nil {
 		switch err.(type) {
 		case *InternalServerError:
 			log.Error(err.Error())
 			c.JSON(500, gin.H{"error": "Couldn't process request - please try again later"})
 			return
+		case *BadRequestError:
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
 		case *ItemNotFoundError:
 			c.JSON(404, gin.H{"error": "No item for that date found"})
 			return
@@ -288,6 +308,7 @@ func (h *RequestHandler) GetFullDatesForTopic(c *gin.Context) {
 // @Success 200 {object} []Entry
 // @Param topic path string true "Topic"
 // @Param fulldate path string true "Date (YYYY-MM-DD)"
+// @Param filter query []string false "Metadata filter, e.g camera=*pixel*, width>=1920 or description (can be repeated, all filters have to match)" collectionFormat(multi)
 // @Router /v1/topics/{topic}/fulldates/{fulldate} [get]
 func (h *RequestHandler) GetFullDateDataForTopic(c *gin.Context) {
 	topic := c.Param("topic")
@@ -300,6 +321,12 @@ func (h *RequestHandler) GetFullDateDataForTopic(c *gin.Context) {
 		return
 	}
 
+	filters, err := parseFilters(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
 	data, err := h.apiClient.GetDataForFullDate(plugins, fullDate)
 	if err != nil {
 		switch err.(type) {
@@ -316,7 +343,7 @@ func (h *RequestHandler) GetFullDateDataForTopic(c *gin.Context) {
 		}
 	}
 
-	c.JSON(200, data)
+	c.JSON(200, FilterEntries(data, filters))
 }
 
 // @Summary List all entries for a given date (MM-DD) and topic
@@ -326,6 +353,7 @@ func (h *RequestHandler) GetFullDateDataForTopic(c *gin.Context) {
 // @Success 200 {object} []Entry
 // @Param topic path string true "Topic"
 // @Param date path string true "Date (MM-DD)"
+// @Param filter query []string false "Metadata filter, e.g camera=*pixel*, width>=1920 or description (can be repeated, all filters have to match)" collectionFormat(multi)
 // @Router /v1/topics/{topic}/dates/{date} [get]
 func (h *RequestHandler) GetDateDataForTopic(c *gin.Context) {
 	topic := c.Param("topic")
@@ -338,6 +366,12 @@ func (h *RequestHandler) GetDateDataForTopic(c *gin.Context) {
 		return
 	}
 
+	filters, err := parseFilters(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
 	data, err := h.apiClient.GetDataForDate(plugins, date)
 	if err != nil {
 		switch err.(type) {
@@ -354,7 +388,7 @@ func (h *RequestHandler) GetDateDataForTopic(c *gin.Context) {
 		}
 	}
 
-	c.JSON(200, data)
+	c.JSON(200, FilterEntries(data, filters))
 }
 
 // @Summary Get random image for given topic
@@ -399,21 +433,38 @@ func (h *RequestHandler) GetTodayOrRandomImageForTopic(c *gin.Context) {
 
 type PluginEntry struct {
 	Name string `json:"name"`
+	Version string `json:"version"`
+	ProtocolVersion int `json:"protocolversion"`
+	Capabilities []string `json:"capabilities"`
+	Kinds []string `json:"kinds"`
+	Compatible bool `json:"compatible"`
+	Error string `json:"error,omitempty"`
 }
 
 // @Summary List all plugins 
 // @Tags General
-// @Description List all plugins.
+// @Description List all plugins (including the ones that were rejected as they are not compatible). The supported plugin protocol versions are returned in the X-Plugin-Protocol-Min and X-Plugin-Protocol-Max headers.
 // @Produce  json
-// @Success 200 {object} []PluginEntry
+// @Success 200 {array} PluginEntry
+// @Header 200 {integer} X-Plugin-Protocol-Min "Lowest supported plugin protocol version"
+// @Header 200 {integer} X-Plugin-Protocol-Max "Highest supported plugin protocol version"
 // @Router /v1/plugins [get]
 func (h *RequestHandler) GetPlugins(c *gin.Context) {
 	pluginEntries := []PluginEntry{}
 	for _, plugin := range h.plugins.GetPlugins() {
-		pluginEntry := PluginEntry{Name: plugin.Name}
+		pluginEntry := PluginEntry{Name: plugin.Name, Version: plugin.MetaData.Version, ProtocolVersion: plugin.MetaData.ProtocolVersion,
+									Capabilities: plugin.MetaData.Capabilities, Kinds: plugin.MetaData.Kinds, Compatible: true}
+		pluginEntries = append(pluginEntries, pluginEntry)
+	}
+
+	for _, plugin := range h.plugins.GetRejectedPlugins() {
+		pluginEntry := PluginEntry{Name: plugin.Name, Version: plugin.MetaData.Version, ProtocolVersion: plugin.MetaData.ProtocolVersion,
+									Capabilities: plugin.MetaData.Capabilities, Kinds: plugin.MetaData.Kinds, Compatible: false, Error: plugin.Reason}
 		pluginEntries = append(pluginEntries, pluginEntry)
 	}
 
+	c.Writer.Header().Set("X-Plugin-Protocol-Min", strconv.Itoa(utils.MinPluginProtocolVersion))
+	c.Writer.Header().Set("X-Plugin-Protocol-Max", strconv.Itoa(utils.MaxPluginProtocolVersion))
 	c.JSON(200, pluginEntries)
 }
 
@@ -424,10 +475,17 @@ func (h *RequestHandler) GetPlugins(c *gin.Context) {
 // @Success 200 {object} []Entry
 // @Param plugin path string true "Plugin"
 // @Param fulldate path string true "Date (YYYY-MM-DD)"
+// @Param filter query []string false "Metadata filter, e.g camera=*pixel*, width>=1920 or description (can be repeated, all filters have to match)" collectionFormat(multi)
 // @Router /v1/plugins/{plugin}/fulldates/{fulldate} [get]
 func (h *RequestHandler) GetFullDateDataForPlugin(c *gin.Context) {
 	plugin := c.Param("plugin")
 	fullDate := c.Param("fulldate")
+	filters, err := parseFilters(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
 	data, err := h.apiClient.GetDataForFullDate([]string{plugin}, fullDate)
 	if err != nil {
 		switch err.(type) {
@@ -444,7 +502,7 @@ func (h *RequestHandler) GetFullDateDataForPlugin(c *gin.Context) {
 		}
 	}
 
-	c.JSON(200, data)
+	c.JSON(200, FilterEntries(data, filters))
 }
 
 
@@ -513,11 +571,18 @@ func (h *RequestHandler) GetDatesForPlugin(c *gin.Context) {
 // @Success 200 {object} []Entry
 // @Param plugin path string true "Plugin"
 // @Param date path string true "Date"
+// @Param filter query []string false "Metadata filter, e.g camera=*pixel*, width>=1920 or description (can be repeated, all filters have to match)" collectionFormat(multi)
 // @Router /v1/plugins/{plugin}/dates/{date} [get]
 func (h *RequestHandler) GetDateDataForPlugin(c *gin.Context) {
 	plugin := c.Param("plugin")
 	date := c.Param("date")
 
+	filters, err := parseFilters(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
 	data, err := h.apiClient.GetDataForDate([]string{plugin}, date)
 	if err != nil {
 		switch err.(type) {
@@ -534,16 +599,17 @@ func (h *RequestHandler) GetDateDataForPlugin(c *gin.Context) {
 		}
 	}
 
-	c.JSON(200, data)
+	c.JSON(200, FilterEntries(data, filters))
 }
 
 // @Summary Get image with given identifier in plugin 
 // @Tags General
-// @Description Get image with given identifier in plugin.
+// @Description Get image with given identifier in plugin. Items that aren't images are rendered as preview: the poster frame of a video, the card of an event, the text of a note or a placeholder.
 // @Produce  json
 // @Success 200 {object} []byte
 // @Param plugin path string true "Plugin"
 // @Param imageid path string true "Image UUID"
+// @Param kind query string false "Kind of the item (image, video, text, audio or event), defaults to the plugin's first kind"
 // @Router /v1/plugins/{plugin}/images/{imageid} [get]
 func (h *RequestHandler) GetImageForPlugin(c *gin.Context) {
 	plugin := c.Param("plugin")
@@ -552,6 +618,259 @@ func (h *RequestHandler) GetImageForPlugin(c *gin.Context) {
 	deliverImage(c, h.apiClient, []string{plugin}, imageId)
 }
 
+//serves the original item, range requests are supported so that players can seek
+func serveItem(c *gin.Context, apiClient *Api, plugin string, itemId string) {
+	itemPath, mimeType, err := apiClient.GetItem(plugin, itemId)
+	if err != nil {
+		switch err.(type) {
+		case *InternalServerError:
+			log.Error(err.Error())
+			c.JSON(500, gin.H{"error": "Couldn't process request - please try again later"})
+			return
+		case *ItemNotFoundError:
+			c.JSON(404, gin.H{"error": "No item with that id found"})
+			return
+		default:
+			c.JSON(500, gin.H{"error": "Couldn't process request - please try again later"})
+			return
+		}
+	}
+
+	f, err := os.Open(itemPath)
+	if err != nil {
+		log.Error("Couldn't open item: ", err.Error())
+		c.JSON(500, gin.H{"error": "Couldn't process request - please try again later"})
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		log.Error("Couldn't open item: ", err.Error())
+		c.JSON(500, gin.H{"error": "Couldn't process request - please try again later"})
+		return
+	}
+
+	//takes care of the range requests
+	c.Writer.Header().Set("Content-Type", mimeType)
+	http.ServeContent(c.Writer, c.Request, "", info.ModTime(), f)
+}
+
+// @Summary Get the original item with given identifier in plugin
+// @Tags General
+// @Description Get the original item (e.g an image, a video, a note or a calendar event) with given identifier in plugin, with the content type of the item. Supports range requests, so that players can seek. Use /v1/plugins/{plugin}/images/{itemid} to get a preview image of the item.
+// @Produce  octet-stream
+// @Success 200 {object} []byte
+// @Success 206 {object} []byte
+// @Param plugin path string true "Plugin"
+// @Param itemid path string true "Item UUID"
+// @Router /v1/plugins/{plugin}/items/{itemid} [get]
+func (h *RequestHandler) GetItemForPlugin(c *gin.Context) {
+	serveItem(c, h.apiClient, c.Param("plugin"), c.Param("itemid"))
+}
+
+// @Summary Stream video with given identifier in plugin
+// @Tags General
+// @Description Stream the original video with given identifier in plugin. Supports range requests, so that players can seek. Use /v1/plugins/{plugin}/images/{videoid} to get the video's poster frame. Kept for existing clients, /v1/plugins/{plugin}/items/{itemid} serves all kinds of items.
+// @Produce  octet-stream
+// @Success 200 {object} []byte
+// @Success 206 {object} []byte
+// @Param plugin path string true "Plugin"
+// @Param videoid path string true "Video UUID"
+// @Router /v1/plugins/{plugin}/videos/{videoid} [get]
+func (h *RequestHandler) GetVideoForPlugin(c *gin.Context) {
+	serveItem(c, h.apiClient, c.Param("plugin"), c.Param("videoid"))
+}
+
+// @Summary Trigger a crawl of the given plugin
+// @Tags General
+// @Description Enqueue a crawl of the given plugin. The crawl is executed asynchronously by the crawler; use the returned job id to observe its state.
+// @Produce  json
+// @Success 202 {object} utils.CrawlJob
+// @Param plugin path string true "Plugin"
+// @Router /v1/plugins/{plugin}/crawl [post]
+func (h *RequestHandler) TriggerCrawlForPlugin(c *gin.Context) {
+	plugin := c.Param("plugin")
+
+	job, err := h.apiClient.TriggerCrawl(plugin)
+	if err != nil {
+		switch err.(type) {
+		case *InternalServerError:
+			log.Error(err.Error())
+			c.JSON(500, gin.H{"error": "Couldn't process request - please try again later"})
+			return
+		case *ItemNotFoundError:
+			c.JSON(404, gin.H{"error": "No plugin with that name found"})
+			return
+		case *BadRequestError:
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		default:
+			c.JSON(500, gin.H{"error": "Couldn't process request - please try again later"})
+			return
+		}
+	}
+
+	c.JSON(202, job)
+}
+
+// @Summary List the recent crawl jobs of the given plugin
+// @Tags General
+// @Description List the recent crawl jobs (newest first) of the given plugin.
+// @Produce  json
+// @Success 200 {object} []utils.CrawlJob
+// @Param plugin path string true "Plugin"
+// @Router /v1/plugins/{plugin}/crawl [get]
+func (h *RequestHandler) GetCrawlJobsForPlugin(c *gin.Context) {
+	plugin := c.Param("plugin")
+
+	jobs, err := h.apiClient.GetCrawlJobs(plugin)
+	if err != nil {
+		switch err.(type) {
+		case *InternalServerError:
+			log.Error(err.Error())
+			c.JSON(500, gin.H{"error": "Couldn't process request - please try again later"})
+			return
+		case *ItemNotFoundError:
+			c.JSON(404, gin.H{"error": "No plugin with that name found"})
+			return
+		default:
+			c.JSON(500, gin.H{"error": "Couldn't process request - please try again later"})
+			return
+		}
+	}
+
+	c.JSON(200, jobs)
+}
+
+// @Summary Get crawl job of the given plugin
+// @Tags General
+// @Description Get the state (queued, running, succeeded, failed), duration and error output of a crawl job.
+// @Produce  json
+// @Success 200 {object} utils.CrawlJob
+// @Param plugin path string true "Plugin"
+// @Param jobid path string true "Job ID"
+// @Router /v1/plugins/{plugin}/crawl/{jobid} [get]
+func (h *RequestHandler) GetCrawlJobForPlugin(c *gin.Context) {
+	plugin := c.Param("plugin")
+	jobId := c.Param("jobid")
+
+	job, err := h.apiClient.GetCrawlJob(plugin, jobId)
+	if err != nil {
+		switch err.(type) {
+		case *InternalServerError:
+			log.Error(err.Error())
+			c.JSON(500, gin.H{"error": "Couldn't process request - please try again later"})
+			return
+		case *ItemNotFoundError:
+			c.JSON(404, gin.H{"error": "No crawl job with that id found"})
+			return
+		default:
+			c.JSON(500, gin.H{"error": "Couldn't process request - please try again later"})
+			return
+		}
+	}
+
+	c.JSON(200, job)
+}
+
+// @Summary Get status of all plugins
+// @Tags General
+// @Description Get the health and crawl history of all plugins.
+// @Produce  json
+// @Success 200 {object} []PluginStatus
+// @Router /v1/plugins/status [get]
+func (h *RequestHandler) GetPluginsStatus(c *gin.Context) {
+	pluginsStatus, err := h.apiClient.GetPluginsStatus()
+	if err != nil {
+		switch err.(type) {
+		case *InternalServerError:
+			log.Error(err.Error())
+			c.JSON(500, gin.H{"error": "Couldn't process request - please try again later"})
+			return
+		default:
+			c.JSON(500, gin.H{"error": "Couldn't process request - please try again later"})
+			return
+		}
+	}
+
+	c.JSON(200, pluginsStatus)
+}
+
+// @Summary Get status of plugin
+// @Tags General
+// @Description Get the health (enabled state, last successful/failed crawl, number of indexed items) and the recent crawl runs of the given plugin.
+// @Produce  json
+// @Success 200 {object} PluginStatus
+// @Param plugin path string true "Plugin"
+// @Router /v1/plugins/{plugin}/status [get]
+func (h *RequestHandler) GetPluginStatus(c *gin.Context) {
+	plugin := c.Param("plugin")
+
+	pluginStatus, err := h.apiClient.GetPluginStatus(plugin)
+	if err != nil {
+		switch err.(type) {
+		case *InternalServerError:
+			log.Error(err.Error())
+			c.JSON(500, gin.H{"error": "Couldn't process request - please try again later"})
+			return
+		case *ItemNotFoundError:
+			c.JSON(404, gin.H{"error": "No plugin with that name found"})
+			return
+		default:
+			c.JSON(500, gin.H{"error": "Couldn't process request - please try again later"})
+			return
+		}
+	}
+
+	c.JSON(200, pluginStatus)
+}
+
+// @Summary Get the log output of the given plugin
+// @Tags General
+// @Description Get the most recent log lines (newest first) the plugin has written during crawling and fetching.
+// @Produce  json
+// @Success 200 {object} []utils.PluginLogEntry
+// @Param plugin path string true "Plugin"
+// @Param run query string false "Only return log lines of the given run (crawl job id)"
+// @Param phase query string false "Only return log lines of the given phase (crawl, fetch)"
+// @Param limit query int false "Maximum number of log lines"
+// @Router /v1/plugins/{plugin}/logs [get]
+func (h *RequestHandler) GetPluginLogs(c *gin.Context) {
+	plugin := c.Param("plugin")
+
+	limit := 100
+	if c.Query("limit") != "" {
+		var err error
+		limit, err = strconv.Atoi(c.Query("limit"))
+		if err != nil || limit <= 0 {
+			c.JSON(400, gin.H{"error": "Couldn't process request - invalid limit"})
+			return
+		}
+	}
+
+	entries, err := h.apiClient.GetPluginLogs(plugin, c.Query("run"), c.Query("phase"), limit)
+	if err != nil {
+		switch err.(type) {
+		case *InternalServerError:
+			log.Error(err.Error())
+			c.JSON(500, gin.H{"error": "Couldn't process request - please try again later"})
+			return
+		case *ItemNotFoundError:
+			c.JSON(404, gin.H{"error": "No plugin with that name found"})
+			return
+		case *BadRequestError:
+			c.JSON(400, gin.H{"error": "Couldn't process request - " + err.Error()})
+			return
+		default:
+			c.JSON(500, gin.H{"error": "Couldn't process request - please try again later"})
+			return
+		}
+	}
+
+	c.JSON(200, entries)
+}
+
 func (h *RequestHandler) CacheEntry(c *gin.Context) {
 	var cacheEntryRequest CacheEntryRequest
 	err := c.BindJSON(&cacheEntryRequest)
@@ -0,0 +1,129 @@
+package api
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/gofrs/uuid"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+//fetching an item (e.g a video) takes a while and players request it in several chunks (range requests), so
+//the fetched items are kept for some time after they were last requested
+const itemCacheDuration = 1 * time.Hour
+const itemCacheMaxSize = 2 * 1024 * 1024 * 1024
+const itemCacheCleanupInterval = 5 * time.Minute
+
+type itemFetch struct {
+	done chan struct{}
+	err error
+}
+
+//the fetched items on disk. Concurrent requests of the same item that isn't cached yet wait for a single fetch.
+type itemCache struct {
+	dir string
+	tmpDir string
+	maxAge time.Duration
+	maxSize int64
+	mutex sync.Mutex
+	fetches map[string]*itemFetch
+}
+
+func newItemCache(dir string, tmpDir string, maxAge time.Duration, maxSize int64) *itemCache {
+	return &itemCache{dir: dir, tmpDir: tmpDir, maxAge: maxAge, maxSize: maxSize, fetches: make(map[string]*itemFetch)}
+}
+
+//returns the path of the cached item, fetch is called to store the item at the given destination in case it isn't cached yet
+func (c *itemCache) get(key string, fetch func(destination string) error) (string, error) {
+	itemPath := filepath.Join(c.dir, key)
+
+	c.mutex.Lock()
+	if f, ok := c.fetches[key]; ok {
+		c.mutex.Unlock()
+		<-f.done
+		return itemPath, f.err
+	}
+
+	if _, err := os.Stat(itemPath); err == nil {
+		//the modification time is the time of the last request, which is used to expire the items
+		now := time.Now()
+		os.Chtimes(itemPath, now, now) //no need to check return code, the item expires a bit earlier at worst
+		c.mutex.Unlock()
+		return itemPath, nil
+	}
+
+	f := &itemFetch{done: make(chan struct{})}
+	c.fetches[key] = f
+	c.mutex.Unlock()
+
+	f.err = c.fetch(itemPath, fetch)
+
+	c.mutex.Lock()
+	delete(c.fetches, key)
+	c.mutex.Unlock()
+	close(f.done)
+
+	if f.err == nil {
+		c.cleanup()
+	}
+	return itemPath, f.err
+}
+
+func (c *itemCache) fetch(itemPath string, fetch func(destination string) error) error {
+	err := os.MkdirAll(c.dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	tmpFileName, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	//fetch into a temporary file first, so that a partial item is never served
+	tmpDestination := filepath.Join(c.tmpDir, tmpFileName.String())
+	err = fetch(tmpDestination)
+	if err == nil {
+		err = os.Rename(tmpDestination, itemPath)
+	}
+	if err != nil {
+		removeFiles([]string{tmpDestination}) //no need to check return code, it's just cleanup
+	}
+	return err
+}
+
+//removes the expired items and, in case the cache is too large, the least recently requested ones. The most
+//recently requested item is kept even if it's larger than the cache, as it's probably still being served.
+func (c *itemCache) cleanup() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+
+	var size int64
+	for i, file := range files {
+		size += file.Size()
+		if time.Since(file.ModTime()) > c.maxAge || (i > 0 && size > c.maxSize) {
+			log.Debug("Removing item ", file.Name(), " from the item cache")
+			removeFiles([]string{filepath.Join(c.dir, file.Name())}) //no need to check return code, it's just cleanup
+			size -= file.Size()
+		}
+	}
+}
+
+func (c *itemCache) runCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	for range ticker.C {
+		c.cleanup()
+	}
+}
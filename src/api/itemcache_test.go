@@ -0,0 +1,159 @@
+package api
+
+import (
+	"testing"
+	"fmt"
+	"runtime"
+	"path/filepath"
+	"reflect"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+	"errors"
+)
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+func newTestItemCache(t *testing.T, maxAge time.Duration, maxSize int64) (*itemCache, string) {
+	tmpDir, err := ioutil.TempDir("", "itemcache")
+	ok(t, err)
+	return newItemCache(filepath.Join(tmpDir, "items"), tmpDir, maxAge, maxSize), tmpDir
+}
+
+func writeItem(data string) func(destination string) error {
+	return func(destination string) error {
+		return ioutil.WriteFile(destination, []byte(data), 0600)
+	}
+}
+
+func getCachedItems(t *testing.T, cache *itemCache) []string {
+	files, err := ioutil.ReadDir(cache.dir)
+	ok(t, err)
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	return names
+}
+
+func TestItemCacheFetchesOnce(t *testing.T) {
+	cache, tmpDir := newTestItemCache(t, time.Hour, 1024)
+	defer os.RemoveAll(tmpDir)
+
+	var fetches int32
+	release := make(chan struct{})
+	fetch := func(destination string) error {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return ioutil.WriteFile(destination, []byte("video"), 0600)
+	}
+
+	requests := &sync.WaitGroup{}
+	paths := make([]string, 5)
+	for i := range paths {
+		requests.Add(1)
+		go func(i int) {
+			defer requests.Done()
+			path, err := cache.get("a", fetch)
+			ok(t, err)
+			paths[i] = path
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	requests.Wait()
+
+	equals(t, int32(1), atomic.LoadInt32(&fetches))
+	for _, path := range paths {
+		equals(t, filepath.Join(cache.dir, "a"), path)
+	}
+	data, err := ioutil.ReadFile(paths[0])
+	ok(t, err)
+	equals(t, "video", string(data))
+
+	//cached items aren't fetched again
+	_, err = cache.get("a", fetch)
+	ok(t, err)
+	equals(t, int32(1), atomic.LoadInt32(&fetches))
+}
+
+func TestItemCacheDoesNotCacheFailedFetches(t *testing.T) {
+	cache, tmpDir := newTestItemCache(t, time.Hour, 1024)
+	defer os.RemoveAll(tmpDir)
+
+	_, err := cache.get("a", func(destination string) error {
+		ioutil.WriteFile(destination, []byte("partial"), 0600)
+		return errors.New("Plugin failed")
+	})
+	equals(t, errors.New("Plugin failed"), err)
+	equals(t, []string{}, getCachedItems(t, cache))
+
+	//only the cache directory is left in the temp directory
+	files, err := ioutil.ReadDir(tmpDir)
+	ok(t, err)
+	equals(t, 1, len(files))
+
+	_, err = cache.get("a", writeItem("video"))
+	ok(t, err)
+	equals(t, []string{"a"}, getCachedItems(t, cache))
+}
+
+func setRequestTime(t *testing.T, cache *itemCache, key string, age time.Duration) {
+	requestTime := time.Now().Add(-age)
+	ok(t, os.Chtimes(filepath.Join(cache.dir, key), requestTime, requestTime))
+}
+
+func TestItemCacheCleanup(t *testing.T) {
+	cache, tmpDir := newTestItemCache(t, time.Hour, 10)
+	defer os.RemoveAll(tmpDir)
+
+	_, err := cache.get("a", writeItem("1234"))
+	ok(t, err)
+	setRequestTime(t, cache, "a", 2*time.Minute)
+	_, err = cache.get("b", writeItem("1234"))
+	ok(t, err)
+	setRequestTime(t, cache, "b", 1*time.Minute)
+
+	//the least recently requested item is removed once the cache is too large
+	_, err = cache.get("c", writeItem("1234"))
+	ok(t, err)
+	equals(t, []string{"b", "c"}, getCachedItems(t, cache))
+
+	//requesting a cached item again keeps it in the cache
+	setRequestTime(t, cache, "c", 1*time.Minute)
+	_, err = cache.get("b", writeItem("1234"))
+	ok(t, err)
+	_, err = cache.get("d", writeItem("1234"))
+	ok(t, err)
+	equals(t, []string{"b", "d"}, getCachedItems(t, cache))
+
+	//an item larger than the cache is kept as long as it's the most recently requested one
+	setRequestTime(t, cache, "b", 1*time.Minute)
+	setRequestTime(t, cache, "d", 1*time.Minute)
+	_, err = cache.get("e", writeItem("123456789012"))
+	ok(t, err)
+	equals(t, []string{"e"}, getCachedItems(t, cache))
+
+	//expired items are removed
+	setRequestTime(t, cache, "e", 2*time.Hour)
+	cache.cleanup()
+	equals(t, []string{}, getCachedItems(t, cache))
+}
@@ -0,0 +1,180 @@
+package chatexport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+//formats of the chat exports
+const (
+	FormatWhatsApp = "whatsapp"
+	FormatTelegram = "telegram"
+	FormatSignal = "signal"
+)
+
+//order of day, month and year in the dates of WhatsApp exports, which depends on the locale of the phone
+const (
+	DateOrderAuto = "auto"
+	DateOrderDMY = "dmy"
+	DateOrderMDY = "mdy"
+)
+
+var ErrUnknownFormat = errors.New("Unknown chat export format")
+
+type Message struct {
+	Chat string
+	Author string
+	Time time.Time
+	Text string
+	//paths of the attached images (only those that are part of the export)
+	Images []string
+}
+
+type Options struct {
+	//the time zone of the dates that are stored without one (WhatsApp and older Telegram exports)
+	Location *time.Location
+	DateOrder string
+}
+
+//a chat export, i.e a WhatsApp chat (.txt), a Telegram export (result.json) or the messages of a Signal conversation (.json)
+type Export struct {
+	Format string
+	Path string
+}
+
+func isImage(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp", ".heic":
+		return true
+	}
+	return false
+}
+
+//returns the path of a file that's referenced in an export, if it exists
+func resolveFile(dir string, name string) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+	p := filepath.Join(dir, filepath.FromSlash(name))
+	info, err := os.Stat(p)
+	if err != nil || info.IsDir() {
+		return "", false
+	}
+	return p, true
+}
+
+//determines the format by the content of the file, returns an empty string if it isn't a chat export
+func detectFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".txt":
+		f, err := os.Open(path)
+		if err != nil {
+			return ""
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		if scanner.Scan() && whatsAppLineRegex.MatchString(strings.TrimPrefix(scanner.Text(), "\ufeff")) {
+			return FormatWhatsApp
+		}
+	case ".json":
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return ""
+		}
+
+		var probe struct {
+			Messages json.RawMessage `json:"messages"`
+			Chats json.RawMessage `json:"chats"`
+			SentAt int64 `json:"sent_at"`
+		}
+		//Signal conversations are either an array of messages or one message per line
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+			if _, err := decoder.Token(); err != nil {
+				return ""
+			}
+		}
+		if decoder.Decode(&probe) != nil {
+			return ""
+		}
+		if probe.Messages != nil || probe.Chats != nil {
+			return FormatTelegram
+		}
+		if probe.SentAt != 0 {
+			return FormatSignal
+		}
+	}
+	return ""
+}
+
+//returns the chat exports below the given path (a file or a directory)
+func FindExports(root string) ([]Export, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return []Export{}, err
+	}
+
+	if !info.IsDir() {
+		format := detectFormat(root)
+		if format == "" {
+			return []Export{}, errors.New(root + " isn't a chat export")
+		}
+		return []Export{Export{Format: format, Path: root}}, nil
+	}
+
+	exports := []Export{}
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != root && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if format := detectFormat(path); format != "" {
+			exports = append(exports, Export{Format: format, Path: path})
+		}
+		return nil
+	})
+
+	sort.Slice(exports, func(i, j int) bool {
+		return exports[i].Path < exports[j].Path
+	})
+	return exports, err
+}
+
+//reads the messages of the export, the images are referenced relative to the export's directory
+func (e Export) Read(options Options) ([]Message, error) {
+	if options.Location == nil {
+		options.Location = time.Local
+	}
+
+	f, err := os.Open(e.Path)
+	if err != nil {
+		return []Message{}, err
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(e.Path)
+	switch e.Format {
+	case FormatWhatsApp:
+		return ParseWhatsApp(f, whatsAppChatName(e.Path), dir, options)
+	case FormatTelegram:
+		return ParseTelegram(f, dir, options)
+	case FormatSignal:
+		return ParseSignal(f, strings.TrimSuffix(filepath.Base(e.Path), filepath.Ext(e.Path)), dir)
+	}
+	return []Message{}, ErrUnknownFormat
+}
@@ -0,0 +1,215 @@
+package chatexport
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error, expected not nil, but got nil: \033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+const androidChat = "04/07/2019, 12:34 - Messages and calls are end-to-end encrypted.\n" +
+					"04/07/2019, 12:35 - Anna: Hello\n" +
+					"how are you?\n" +
+					"13/07/2019, 08:01 - Ben: IMG-20190713-WA0001.jpg (file attached)\n" +
+					"13/07/2019, 08:02 - Ben: <Media omitted>\n" +
+					"13/07/2019, 08:03 - Ben: PTT-20190713-WA0002.opus (file attached)\n"
+
+const iosChat = "\u200e[07/04/19, 9:15:02 PM] Anna: Fireworks!\n" +
+				"[07/04/19, 9:16:10 PM] Ben: \u200e<attached: 00000012-PHOTO-2019-07-04-21-16-10.jpg>\n" +
+				"[07/13/19, 12:00:00 AM] Ben: Midnight\n"
+
+const telegramChats = `{
+ "about": "Here is the data you requested.",
+ "chats": {
+  "list": [
+   {
+    "name": "Anna",
+    "type": "personal_chat",
+    "messages": [
+     {"id": 1, "type": "message", "date": "2019-07-04T12:34:56", "date_unixtime": "1562243696", "from": "Anna", "text": "Hello"},
+     {"id": 2, "type": "message", "date": "2019-07-04T12:35:00", "from": "Ben",
+      "text": ["Look at ", {"type": "link", "text": "https://example.com"}]},
+     {"id": 3, "type": "message", "date": "2019-07-04T12:36:00", "from": "Ben", "photo": "photos/photo_1@04-07-2019_12-36-00.jpg", "text": ""},
+     {"id": 4, "type": "message", "date": "2019-07-04T12:37:00", "from": "Ben", "file": "stickers/sticker.webp", "media_type": "sticker",
+      "mime_type": "image/webp", "text": ""},
+     {"id": 5, "type": "service", "date": "2019-07-04T12:38:00", "actor": "Anna", "action": "pin_message", "text": ""}
+    ]
+   },
+   {
+    "name": null,
+    "type": "personal_chat",
+    "messages": [
+     {"id": 6, "type": "message", "date": "2018-01-01T00:00:01", "from": null, "text": "Happy new year"}
+    ]
+   }
+  ]
+ }
+}`
+
+const signalConversation = `[
+ {"type": "incoming", "body": "See you tomorrow", "sent_at": 1562243696000, "source": "+4312345"},
+ {"type": "outgoing", "body": "", "sent_at": 1562243700000,
+  "attachments": [{"contentType": "image/jpeg", "fileName": "IMG_1.jpg", "path": "ab/abcdef"},
+                  {"contentType": "audio/aac", "fileName": "voice.aac", "path": "cd/cdef01"}]},
+ {"type": "call-history", "sent_at": 1562243800000}
+]`
+
+func writeFile(t *testing.T, path string, content string) {
+	ok(t, os.MkdirAll(filepath.Dir(path), 0755))
+	ok(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func TestParseWhatsApp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chatexport")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "IMG-20190713-WA0001.jpg"), "jpeg")
+	writeFile(t, filepath.Join(dir, "PTT-20190713-WA0002.opus"), "opus")
+	writeFile(t, filepath.Join(dir, "00000012-PHOTO-2019-07-04-21-16-10.jpg"), "jpeg")
+
+	location := time.FixedZone("CEST", 2 * 60 * 60)
+	messages, err := ParseWhatsApp(strings.NewReader(androidChat), "Anna", dir, Options{Location: location})
+	ok(t, err)
+	equals(t, 2, len(messages))
+	equals(t, Message{Chat: "Anna", Author: "Anna", Time: time.Date(2019, 7, 4, 12, 35, 0, 0, location), Text: "Hello\nhow are you?"},
+			messages[0])
+	equals(t, []string{filepath.Join(dir, "IMG-20190713-WA0001.jpg")}, messages[1].Images)
+	equals(t, time.Date(2019, 7, 13, 8, 1, 0, 0, location), messages[1].Time)
+
+	//month first and 12 hour clock
+	messages, err = ParseWhatsApp(strings.NewReader(iosChat), "Anna", dir, Options{Location: time.UTC})
+	ok(t, err)
+	equals(t, 3, len(messages))
+	equals(t, time.Date(2019, 7, 4, 21, 15, 2, 0, time.UTC), messages[0].Time)
+	equals(t, "Fireworks!", messages[0].Text)
+	equals(t, "Ben", messages[1].Author)
+	equals(t, []string{filepath.Join(dir, "00000012-PHOTO-2019-07-04-21-16-10.jpg")}, messages[1].Images)
+	equals(t, time.Date(2019, 7, 13, 0, 0, 0, 0, time.UTC), messages[2].Time)
+
+	//the order can't be detected from these dates
+	chat := "01/02/2019, 10:00 - Anna: Hi\n"
+	messages, err = ParseWhatsApp(strings.NewReader(chat), "Anna", dir, Options{Location: time.UTC})
+	ok(t, err)
+	equals(t, time.February, messages[0].Time.Month())
+	messages, err = ParseWhatsApp(strings.NewReader(chat), "Anna", dir, Options{Location: time.UTC, DateOrder: DateOrderMDY})
+	ok(t, err)
+	equals(t, time.January, messages[0].Time.Month())
+}
+
+func TestWhatsAppChatName(t *testing.T) {
+	equals(t, "Anna", whatsAppChatName("/chats/WhatsApp Chat with Anna.txt"))
+	equals(t, "Family Group", whatsAppChatName("/chats/WhatsApp Chat mit Family Group.txt"))
+	equals(t, "Anna", whatsAppChatName("/chats/WhatsApp Chat - Anna/_chat.txt"))
+	equals(t, "anna", whatsAppChatName("/chats/anna.txt"))
+}
+
+func TestParseTelegram(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chatexport")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "photos", "photo_1@04-07-2019_12-36-00.jpg"), "jpeg")
+	writeFile(t, filepath.Join(dir, "stickers", "sticker.webp"), "webp")
+
+	messages, err := ParseTelegram(strings.NewReader(telegramChats), dir, Options{Location: time.UTC})
+	ok(t, err)
+	equals(t, 4, len(messages))
+	equals(t, Message{Chat: "Anna", Author: "Anna", Time: time.Unix(1562243696, 0).UTC(), Text: "Hello"}, messages[0])
+	equals(t, "Look at https://example.com", messages[1].Text)
+	equals(t, []string{filepath.Join(dir, "photos", "photo_1@04-07-2019_12-36-00.jpg")}, messages[2].Images)
+	equals(t, Message{Chat: "Deleted Account", Time: time.Date(2018, 1, 1, 0, 0, 1, 0, time.UTC), Text: "Happy new year"}, messages[3])
+
+	//export of a single chat
+	messages, err = ParseTelegram(strings.NewReader(`{"name": "Ben", "messages": [{"type": "message", "date": "2019-07-04T12:00:00",
+														"from": "Ben", "text": "Hi"}]}`), dir, Options{Location: time.UTC})
+	ok(t, err)
+	equals(t, 1, len(messages))
+	equals(t, "Ben", messages[0].Chat)
+}
+
+func TestParseSignal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chatexport")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "attachments.noindex", "ab", "abcdef"), "jpeg")
+	writeFile(t, filepath.Join(dir, "attachments.noindex", "cd", "cdef01"), "aac")
+
+	messages, err := ParseSignal(strings.NewReader(signalConversation), "Anna", dir)
+	ok(t, err)
+	equals(t, 2, len(messages))
+	equals(t, "+4312345", messages[0].Author)
+	equals(t, int64(1562243696), messages[0].Time.Unix())
+	equals(t, SignalSelf, messages[1].Author)
+	equals(t, []string{filepath.Join(dir, "attachments.noindex", "ab", "abcdef")}, messages[1].Images)
+
+	//one message per line
+	lines := `{"type": "incoming", "body": "One", "sent_at": 1000, "source": "+1"}` + "\n" +
+				`{"type": "outgoing", "body": "Two", "sent_at": 2000}` + "\n"
+	messages, err = ParseSignal(strings.NewReader(lines), "Anna", dir)
+	ok(t, err)
+	equals(t, 2, len(messages))
+	equals(t, "Two", messages[1].Text)
+
+	_, err = ParseSignal(strings.NewReader(`[{"type": `), "Anna", dir)
+	notOk(t, err)
+}
+
+func TestFindExports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chatexport")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "whatsapp", "WhatsApp Chat with Anna.txt"), androidChat)
+	writeFile(t, filepath.Join(dir, "whatsapp", "WhatsApp Chat - Ben", "_chat.txt"), "\ufeff" + iosChat)
+	writeFile(t, filepath.Join(dir, "telegram", "result.json"), telegramChats)
+	writeFile(t, filepath.Join(dir, "signal", "Anna.json"), signalConversation)
+	writeFile(t, filepath.Join(dir, "notes.txt"), "Just a note\n")
+	writeFile(t, filepath.Join(dir, "other.json"), `[{"id": 1}]`)
+	writeFile(t, filepath.Join(dir, ".hidden", "result.json"), telegramChats)
+
+	exports, err := FindExports(dir)
+	ok(t, err)
+	equals(t, []Export{
+		Export{Format: FormatSignal, Path: filepath.Join(dir, "signal", "Anna.json")},
+		Export{Format: FormatTelegram, Path: filepath.Join(dir, "telegram", "result.json")},
+		Export{Format: FormatWhatsApp, Path: filepath.Join(dir, "whatsapp", "WhatsApp Chat - Ben", "_chat.txt")},
+		Export{Format: FormatWhatsApp, Path: filepath.Join(dir, "whatsapp", "WhatsApp Chat with Anna.txt")},
+	}, exports)
+
+	messages, err := exports[2].Read(Options{})
+	ok(t, err)
+	equals(t, "Ben", messages[0].Chat)
+
+	_, err = FindExports(filepath.Join(dir, "notes.txt"))
+	notOk(t, err)
+}
@@ -0,0 +1,115 @@
+package chatexport
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//the author of outgoing messages, Signal doesn't store the own name with the messages
+const SignalSelf = "Me"
+
+type signalAttachment struct {
+	ContentType string `json:"contentType"`
+	FileName string `json:"fileName"`
+	//relative to Signal Desktop's attachments directory
+	Path string `json:"path"`
+}
+
+type signalMessage struct {
+	Type string `json:"type"`
+	Body string `json:"body"`
+	//milliseconds since the epoch
+	SentAt int64 `json:"sent_at"`
+	Source string `json:"source"`
+	SourceUuid string `json:"sourceUuid"`
+	Attachments []signalAttachment `json:"attachments"`
+}
+
+//returns the attached file, which is either next to the export or in a copy of Signal Desktop's attachments directory
+func resolveSignalAttachment(dir string, attachment signalAttachment) (string, bool) {
+	if attachment.Path != "" {
+		for _, name := range []string{attachment.Path, filepath.Join("attachments.noindex", attachment.Path)} {
+			if p, ok := resolveFile(dir, name); ok {
+				return p, true
+			}
+		}
+	}
+	return resolveFile(dir, attachment.FileName)
+}
+
+//parses the messages of a Signal conversation as they are stored by Signal Desktop (e.g exported with sigtop), either as
+//an array or as one message per line. The chat is named after the file.
+func ParseSignal(r io.Reader, chat string, dir string) ([]Message, error) {
+	reader := bufio.NewReader(r)
+	var stored []signalMessage
+	first, err := peekNonSpace(reader)
+	if err != nil {
+		return []Message{}, err
+	}
+
+	decoder := json.NewDecoder(reader)
+	if first == '[' {
+		err = decoder.Decode(&stored)
+		if err != nil {
+			return []Message{}, err
+		}
+	} else {
+		for {
+			var m signalMessage
+			err = decoder.Decode(&m)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return []Message{}, err
+			}
+			stored = append(stored, m)
+		}
+	}
+
+	messages := []Message{}
+	for _, m := range stored {
+		//calls, group updates, ...
+		if (m.Type != "incoming" && m.Type != "outgoing") || m.SentAt == 0 {
+			continue
+		}
+
+		message := Message{Chat: chat, Author: SignalSelf, Time: time.Unix(0, m.SentAt * int64(time.Millisecond)),
+							Text: strings.TrimSpace(m.Body)}
+		if m.Type == "incoming" {
+			message.Author = m.Source
+			if message.Author == "" {
+				message.Author = m.SourceUuid
+			}
+		}
+		for _, attachment := range m.Attachments {
+			if !strings.HasPrefix(attachment.ContentType, "image/") {
+				continue
+			}
+			if p, ok := resolveSignalAttachment(dir, attachment); ok {
+				message.Images = append(message.Images, p)
+			}
+		}
+
+		if message.Text != "" || len(message.Images) > 0 {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, reader.UnreadByte()
+		}
+	}
+}
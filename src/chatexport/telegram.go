@@ -0,0 +1,122 @@
+package chatexport
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type telegramMessage struct {
+	Type string `json:"type"`
+	//the local time of the exporting computer, newer exports also contain the unix time
+	Date string `json:"date"`
+	DateUnixtime string `json:"date_unixtime"`
+	From *string `json:"from"`
+	Text json.RawMessage `json:"text"`
+	Photo string `json:"photo"`
+	File string `json:"file"`
+	MimeType string `json:"mime_type"`
+	MediaType string `json:"media_type"`
+}
+
+type telegramChat struct {
+	Name *string `json:"name"`
+	Messages []telegramMessage `json:"messages"`
+}
+
+//either the export of all chats or of a single chat
+type telegramExport struct {
+	telegramChat
+	Chats struct {
+		List []telegramChat `json:"list"`
+	} `json:"chats"`
+}
+
+//the text is either a string or a list of strings and formatted parts (e.g links or bold text)
+func telegramText(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+
+	var parts []json.RawMessage
+	if json.Unmarshal(raw, &parts) != nil {
+		return ""
+	}
+	var builder strings.Builder
+	for _, part := range parts {
+		var s string
+		if json.Unmarshal(part, &s) == nil {
+			builder.WriteString(s)
+			continue
+		}
+		var entity struct {
+			Text string `json:"text"`
+		}
+		if json.Unmarshal(part, &entity) == nil {
+			builder.WriteString(entity.Text)
+		}
+	}
+	return builder.String()
+}
+
+func (m telegramMessage) time(location *time.Location) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(m.DateUnixtime, 10, 64); err == nil {
+		return time.Unix(seconds, 0).In(location), nil
+	}
+	return time.ParseInLocation("2006-01-02T15:04:05", m.Date, location)
+}
+
+//parses a Telegram Desktop export (result.json). Photos and images that were sent as files are only part of the export if
+//they were selected when exporting.
+func ParseTelegram(r io.Reader, dir string, options Options) ([]Message, error) {
+	var export telegramExport
+	err := json.NewDecoder(r).Decode(&export)
+	if err != nil {
+		return []Message{}, err
+	}
+
+	chats := export.Chats.List
+	if export.Messages != nil {
+		chats = append(chats, export.telegramChat)
+	}
+
+	messages := []Message{}
+	for _, chat := range chats {
+		//chats with deleted accounts don't have a name
+		name := "Deleted Account"
+		if chat.Name != nil {
+			name = *chat.Name
+		}
+
+		for _, m := range chat.Messages {
+			if m.Type != "message" {
+				continue
+			}
+
+			t, err := m.time(options.Location)
+			if err != nil {
+				continue
+			}
+
+			message := Message{Chat: name, Time: t, Text: strings.TrimSpace(telegramText(m.Text))}
+			if m.From != nil {
+				message.Author = *m.From
+			}
+			if p, ok := resolveFile(dir, m.Photo); ok {
+				message.Images = append(message.Images, p)
+			}
+			//stickers are images as well, but they aren't indexed
+			if p, ok := resolveFile(dir, m.File); ok && m.MediaType != "sticker" && (strings.HasPrefix(m.MimeType, "image/") || isImage(p)) {
+				message.Images = append(message.Images, p)
+			}
+
+			if message.Text != "" || len(message.Images) > 0 {
+				messages = append(messages, message)
+			}
+		}
+	}
+	return messages, nil
+}
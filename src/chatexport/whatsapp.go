@@ -0,0 +1,156 @@
+package chatexport
+
+import (
+	"bufio"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//the first line of a message, e.g '04/07/2019, 12:34 - Anna: Hello' (Android) or '[04.07.19, 12:34:56] Anna: Hello' (iOS).
+//iOS puts a narrow no-break space before AM/PM.
+var whatsAppLineRegex = regexp.MustCompile(`^\x{200e}?\[?(\d{1,4})[./-](\d{1,2})[./-](\d{2,4}),? (\d{1,2}):(\d{2})(?::(\d{2}))?(?:[ \x{202f}]?([AaPp])\.?[Mm]\.?)?(?:\] | - )(.*)$`)
+
+//media as referenced by Android ('IMG-20190704-WA0001.jpg (file attached)') and iOS ('<attached: 00000012-PHOTO-2019-07-04-12-34-56.jpg>'),
+//the words depend on the language of the phone
+var whatsAppAndroidMediaRegex = regexp.MustCompile(`^([^\s/]+\.\w{2,5}) \([^)]+\)$`)
+var whatsAppIosMediaRegex = regexp.MustCompile(`^<[^:>]+: ([^>]+)>$`)
+
+//placeholders like '<Media omitted>' of exports without media
+var whatsAppPlaceholderRegex = regexp.MustCompile(`^<[^>]+>$`)
+
+//the chat name is part of the filename ('WhatsApp Chat with Anna.txt') or, for iOS exports ('_chat.txt'), of the name of the
+//directory the export was extracted to ('WhatsApp Chat - Anna')
+func whatsAppChatName(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if strings.EqualFold(name, "_chat") {
+		name = filepath.Base(filepath.Dir(path))
+	}
+
+	if strings.HasPrefix(name, "WhatsApp Chat - ") {
+		return strings.TrimPrefix(name, "WhatsApp Chat - ")
+	}
+	if strings.HasPrefix(name, "WhatsApp Chat ") {
+		//'WhatsApp Chat with Anna', 'WhatsApp Chat mit Anna', ...
+		parts := strings.SplitN(strings.TrimPrefix(name, "WhatsApp Chat "), " ", 2)
+		if len(parts) == 2 {
+			return parts[1]
+		}
+	}
+	return name
+}
+
+type whatsAppLine struct {
+	Numbers [3]int
+	Hour int
+	Minute int
+	Second int
+	Meridiem string
+	Rest string
+}
+
+//guesses the order of day and month, the day is the one that's greater than 12 in some message
+func detectDateOrder(lines []whatsAppLine) string {
+	for _, line := range lines {
+		//dates with the year first are always followed by the month
+		if line.Numbers[0] > 12 {
+			return DateOrderDMY
+		}
+		if line.Numbers[1] > 12 {
+			return DateOrderMDY
+		}
+	}
+	return DateOrderDMY
+}
+
+func (l whatsAppLine) time(dateOrder string, location *time.Location) time.Time {
+	day, month, year := l.Numbers[0], l.Numbers[1], l.Numbers[2]
+	if l.Numbers[0] > 31 {
+		year, month, day = l.Numbers[0], l.Numbers[1], l.Numbers[2]
+	} else if dateOrder == DateOrderMDY {
+		month, day = l.Numbers[0], l.Numbers[1]
+	}
+	if year < 100 {
+		year += 2000
+	}
+
+	hour := l.Hour
+	switch strings.ToLower(l.Meridiem) {
+	case "a":
+		if hour == 12 {
+			hour = 0
+		}
+	case "p":
+		if hour < 12 {
+			hour += 12
+		}
+	}
+	return time.Date(year, time.Month(month), day, hour, l.Minute, l.Second, 0, location)
+}
+
+//parses an exported WhatsApp chat. Messages can span several lines, system messages (e.g 'Anna added Ben') are skipped.
+func ParseWhatsApp(r io.Reader, chat string, dir string, options Options) ([]Message, error) {
+	lines := []whatsAppLine{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64 * 1024), 4 * 1024 * 1024)
+	for scanner.Scan() {
+		text := strings.TrimPrefix(scanner.Text(), "\ufeff")
+		match := whatsAppLineRegex.FindStringSubmatch(text)
+		if match == nil {
+			//continuation of the previous message
+			if len(lines) > 0 {
+				lines[len(lines) - 1].Rest += "\n" + text
+			}
+			continue
+		}
+
+		line := whatsAppLine{Meridiem: match[7], Rest: match[8]}
+		for i := 0; i < 3; i++ {
+			line.Numbers[i], _ = strconv.Atoi(match[i + 1])
+		}
+		line.Hour, _ = strconv.Atoi(match[4])
+		line.Minute, _ = strconv.Atoi(match[5])
+		line.Second, _ = strconv.Atoi(match[6])
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return []Message{}, err
+	}
+
+	dateOrder := options.DateOrder
+	if dateOrder == "" || dateOrder == DateOrderAuto {
+		dateOrder = detectDateOrder(lines)
+	}
+
+	messages := []Message{}
+	for _, line := range lines {
+		parts := strings.SplitN(line.Rest, ": ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		message := Message{Chat: chat, Author: strings.Trim(parts[0], "\u200e "), Time: line.time(dateOrder, options.Location)}
+		text := strings.TrimSpace(strings.Replace(parts[1], "\u200e", "", -1))
+		if match := whatsAppIosMediaRegex.FindStringSubmatch(text); match != nil {
+			if p, ok := resolveFile(dir, match[1]); ok && isImage(p) {
+				message.Images = append(message.Images, p)
+			}
+		} else if match := whatsAppAndroidMediaRegex.FindStringSubmatch(text); match != nil {
+			if p, ok := resolveFile(dir, match[1]); ok && isImage(p) {
+				message.Images = append(message.Images, p)
+			} else if !ok {
+				message.Text = text
+			}
+		} else if !whatsAppPlaceholderRegex.MatchString(text) {
+			message.Text = text
+		}
+
+		if message.Text != "" || len(message.Images) > 0 {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
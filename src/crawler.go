@@ -3,18 +3,117 @@ package main
 import (
 	"flag"
 	"github.com/bbernhard/mindfulbytes/utils"
+	"github.com/bbernhard/mindfulbytes/plugincmd"
 	"github.com/gomodule/redigo/redis"
 	log "github.com/sirupsen/logrus"
 	"time"
+	"sync"
+	"errors"
 )
 
-func handlePluginExec(plugin utils.Plugin, plugins *utils.Plugins) error {
+//makes sure that a scheduled crawl and an on-demand crawl of the same plugin do not run at the same time
+var crawlLocks = make(map[string]*sync.Mutex)
+
+//resumes the schedule of a plugin that was paused because of a configuration error
+var crawlResumeChannels = make(map[string]chan bool)
+
+const progressUpdateInterval = 1 * time.Second
+
+//executes the crawl of the given plugin and records the run in the plugin's crawl history
+func runCrawl(job utils.CrawlJob, plugin utils.Plugin, plugins *utils.Plugins, redisPool *redis.Pool) error {
+	crawlLocks[plugin.Name].Lock()
+	defer crawlLocks[plugin.Name].Unlock()
+
+	start := time.Now()
+	job.State = utils.CrawlJobRunning
+	job.Started = start.Unix()
+	err := utils.SetCrawlJob(redisPool, job)
+	if err != nil {
+		log.Error("Couldn't update crawl job ", job.Id, ": ", err.Error())
+	}
+
+	log.Info("Running crawl job ", job.Id, " for plugin ", plugin.Name)
+	lastProgressUpdate := time.Time{}
+	result, crawlErr := plugins.ExecCrawl(plugin.Exec.CrawlExec, job.Id, func(progress utils.CrawlProgress) {
+		job.Progress = &progress
+
+		//plugins might report the progress for every single item, so do not update the job too often
+		if time.Since(lastProgressUpdate) < progressUpdateInterval {
+			return
+		}
+		lastProgressUpdate = time.Now()
+
+		err := utils.SetCrawlJob(redisPool, job)
+		if err != nil {
+			log.Error("Couldn't update progress of crawl job ", job.Id, ": ", err.Error())
+		}
+	})
+	job.Finished = time.Now().Unix()
+	job.Duration = time.Since(start).Seconds()
+	job.ExitCode = result.ExitCode
+	job.Outcome = result.Outcome
+	job.Stderr = result.Stderr
+
+	if crawlErr != nil {
+		log.Error(crawlErr)
+		job.State = utils.CrawlJobFailed
+		job.Error = crawlErr.Error()
+		err = utils.SetLastFailedCrawlExecutionTimestamp(redisPool, plugin.Name, time.Now())
+		if err != nil {
+			log.Error("Couldn't update last failed crawl timestamp for plugin ", plugin.Name, ": ", err.Error())
+		}
+
+		if execErr, ok := crawlErr.(*utils.PluginExecError); ok && execErr.IsPermanent() {
+			err = utils.SetPluginAlert(redisPool, plugin.Name, "Plugin reported a configuration error, please check the plugin's config: " + crawlErr.Error())
+			if err != nil {
+				log.Error("Couldn't set alert for plugin ", plugin.Name, ": ", err.Error())
+			}
+		}
+	} else {
+		if result.Outcome == utils.PluginOutcomePartialSuccess {
+			log.Warn("Crawl job ", job.Id, " of plugin ", plugin.Name, " skipped some items")
+		}
+
+		job.State = utils.CrawlJobSucceeded
+		err = utils.SetLastSuccessfulCrawlExecutionTimestamp(redisPool, plugin.Name, time.Now())
+		if err != nil {
+			log.Error("Couldn't update last successful crawl timestamp for plugin ", plugin.Name, ": ", err.Error())
+		}
+
+		err = utils.ClearPluginAlert(redisPool, plugin.Name)
+		if err != nil {
+			log.Error("Couldn't clear alert for plugin ", plugin.Name, ": ", err.Error())
+		}
+
+		//no need to block, in case the schedule isn't paused there is no one waiting
+		select {
+		case crawlResumeChannels[plugin.Name] <- true:
+		default:
+		}
+	}
+
+	job.Items, err = utils.UpdateIndexedItemsCount(redisPool, plugin.Name)
+	if err != nil {
+		log.Error("Couldn't count indexed items of plugin ", plugin.Name, ": ", err.Error())
+	}
+
+	err = utils.SetCrawlJob(redisPool, job)
+	if err != nil {
+		log.Error("Couldn't update crawl job ", job.Id, ": ", err.Error())
+	}
+
+	return crawlErr
+}
+
+func handlePluginExec(plugin utils.Plugin, plugins *utils.Plugins, redisPool *redis.Pool) error {
 	if plugin.Config.Enabled {
-		err := plugins.ExecCrawl(plugin.Exec.CrawlExec)
+		job, err := utils.CreateCrawlJob(redisPool, plugin.Name, utils.CrawlTriggerSchedule)
 		if err != nil {
-			log.Error(err)
+			log.Error("Couldn't create crawl job for plugin ", plugin.Name, ": ", err.Error())
 			return err
 		}
+
+		return runCrawl(job, plugin, plugins, redisPool)
 	} else {
 		log.Debug("Not running plugin ", plugin.Name, " as it is disabled")
 	}
@@ -22,18 +121,64 @@ func handlePluginExec(plugin utils.Plugin, plugins *utils.Plugins) error {
 	return nil
 }
 
-func main() {
-	log.Info("Starting Plugin Runner")
+func handleCrawlJob(job utils.CrawlJob, plugins *utils.Plugins, redisPool *redis.Pool) {
+	plugin, err := plugins.GetPlugin(job.Plugin)
+	if err == nil && !plugin.Config.Enabled {
+		err = errors.New("Plugin " + plugin.Name + " is disabled")
+	}
+
+	if err != nil {
+		log.Error("Couldn't run crawl job ", job.Id, ": ", err.Error())
+		job.State = utils.CrawlJobFailed
+		job.Error = err.Error()
+		job.Finished = time.Now().Unix()
+		err = utils.SetCrawlJob(redisPool, job)
+		if err != nil {
+			log.Error("Couldn't update crawl job ", job.Id, ": ", err.Error())
+		}
+		return
+	}
+
+	runCrawl(job, plugin, plugins, redisPool) //no need to check the return code, the result is stored in the crawl job
+}
+
+func processCrawlJobs(plugins *utils.Plugins, redisPool *redis.Pool) {
+	for {
+		job, err := utils.WaitForCrawlJob(redisPool, 30*time.Second)
+		if err != nil {
+			if err != redis.ErrNil {
+				log.Error("Couldn't get crawl job: ", err.Error())
+				time.Sleep(5 * time.Second)
+			}
+			continue
+		}
 
+		handleCrawlJob(job, plugins, redisPool)
+	}
+}
+
+func main() {
 	configDir := flag.String("config-dir", "../config/", "Config Directory")
 	redisAddress := flag.String("redis-address", ":6379", "Address to the Redis server")
 	redisMaxConnections := flag.Int("redis-max-connections", 500, "Max connections to Redis")
+	dataDir := flag.String("data-dir", "../data/", "Directory where the plugins store their data")
+	cacheDir := flag.String("cache-dir", "../cache/", "Directory where the plugins store their cache")
+	pluginLogLines := flag.Int("plugin-log-lines", 1000, "Number of log lines that are kept per plugin")
 
 	flag.Parse()
 
-	log.SetLevel(log.DebugLevel)
 	log.SetOutput(&utils.LogOutputSplitter{})
 
+	//manages the installed plugins instead of running them
+	if flag.Arg(0) == "plugins" {
+		log.SetLevel(log.InfoLevel)
+		plugincmd.Run(*configDir, flag.Args()[1:])
+		return
+	}
+
+	log.SetLevel(log.DebugLevel)
+	log.Info("Starting Plugin Runner")
+
 	//create redis pool
 	redisPool := redis.NewPool(func() (redis.Conn, error) {
 		c, err := redis.Dial("tcp", *redisAddress)
@@ -46,15 +191,29 @@ func main() {
 	}, *redisMaxConnections)
 	defer redisPool.Close()
 
-	plugins := utils.NewPlugins("./plugins/", *configDir)
+	sandboxOptions := utils.SandboxOptions{RedisAddress: *redisAddress, DataDir: *dataDir, CacheDir: *cacheDir}
+	plugins := utils.NewPlugins("./plugins/", *configDir, sandboxOptions, utils.NewPluginLogBuffer(redisPool, *pluginLogLines))
 	err := plugins.Load()
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	for _, plugin := range plugins.GetPlugins() {
+		crawlLocks[plugin.Name] = &sync.Mutex{}
+		crawlResumeChannels[plugin.Name] = make(chan bool, 1)
+
+		//jobs that are still running were interrupted by the last shutdown (or crash) of the crawler
+		failedJobs, err := utils.FailInterruptedCrawlJobs(redisPool, plugin.Name)
+		if err != nil {
+			log.Error("Couldn't update interrupted crawl jobs of plugin ", plugin.Name, ": ", err.Error())
+		} else if failedJobs > 0 {
+			log.Warn("Marked ", failedJobs, " interrupted crawl job(s) of plugin ", plugin.Name, " as failed")
+		}
+	}
+
 	tickers := []*time.Ticker{}
 	for _, plugin := range plugins.GetPlugins() {
-		t, err := utils.SchedulePluginExecution(handlePluginExec, plugin, plugins, redisPool)
+		t, err := utils.SchedulePluginExecution(handlePluginExec, plugin, plugins, redisPool, crawlResumeChannels[plugin.Name])
 		if err !=nil {
 			log.Fatal(err.Error())
 		}
@@ -62,5 +221,7 @@ func main() {
 		
 	}
 
+	go processCrawlJobs(plugins, redisPool)
+
 	select {} //wait forever
 }
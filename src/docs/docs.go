@@ -26,7 +26,7 @@ var doc = `{
     "paths": {
         "/v1/plugins": {
             "get": {
-                "description": "List all plugins.",
+                "description": "List all plugins (including the ones that were rejected as they are not compatible). The supported plugin protocol versions are returned in the X-Plugin-Protocol-Min and X-Plugin-Protocol-Max headers.",
                 "produces": [
                     "application/json"
                 ],
@@ -42,6 +42,134 @@ var doc = `{
                             "items": {
                                 "$ref": "#/definitions/api.PluginEntry"
                             }
+                        },
+                        "headers": {
+                            "X-Plugin-Protocol-Max": {
+                                "type": "integer",
+                                "description": "Highest supported plugin protocol version"
+                            },
+                            "X-Plugin-Protocol-Min": {
+                                "type": "integer",
+                                "description": "Lowest supported plugin protocol version"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/plugins/status": {
+            "get": {
+                "description": "Get the health and crawl history of all plugins.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "General"
+                ],
+                "summary": "Get status of all plugins",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/api.PluginStatus"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/plugins/{plugin}/crawl": {
+            "get": {
+                "description": "List the recent crawl jobs (newest first) of the given plugin.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "General"
+                ],
+                "summary": "List the recent crawl jobs of the given plugin",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Plugin",
+                        "name": "plugin",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/utils.CrawlJob"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Enqueue a crawl of the given plugin. The crawl is executed asynchronously by the crawler; use the returned job id to observe its state.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "General"
+                ],
+                "summary": "Trigger a crawl of the given plugin",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Plugin",
+                        "name": "plugin",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/utils.CrawlJob"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/plugins/{plugin}/crawl/{jobid}": {
+            "get": {
+                "description": "Get the state (queued, running, succeeded, failed), duration and error output of a crawl job.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "General"
+                ],
+                "summary": "Get crawl job of the given plugin",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Plugin",
+                        "name": "plugin",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "jobid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/utils.CrawlJob"
                         }
                     }
                 }
@@ -103,6 +231,16 @@ var doc = `{
                         "name": "date",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Metadata filter, e.g camera=*pixel*, width>=1920 or description (can be repeated, all filters have to match)",
+                        "name": "filter",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -174,6 +312,16 @@ var doc = `{
                         "name": "fulldate",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Metadata filter, e.g camera=*pixel*, width>=1920 or description (can be repeated, all filters have to match)",
+                        "name": "filter",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -191,7 +339,7 @@ var doc = `{
         },
         "/v1/plugins/{plugin}/images/{imageid}": {
             "get": {
-                "description": "Get image with given identifier in plugin.",
+                "description": "Get image with given identifier in plugin. Items that aren't images are rendered as preview: the poster frame of a video, the card of an event, the text of a note or a placeholder.",
                 "produces": [
                     "application/json"
                 ],
@@ -213,6 +361,51 @@ var doc = `{
                         "name": "imageid",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Kind of the item (image, video, text, audio or event), defaults to the plugin's first kind",
+                        "name": "kind",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "integer"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/plugins/{plugin}/items/{itemid}": {
+            "get": {
+                "description": "Get the original item (e.g an image, a video, a note or a calendar event) with given identifier in plugin, with the content type of the item. Supports range requests, so that players can seek. Use /v1/plugins/{plugin}/images/{itemid} to get a preview image of the item.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "General"
+                ],
+                "summary": "Get the original item with given identifier in plugin",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Plugin",
+                        "name": "plugin",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Item UUID",
+                        "name": "itemid",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -224,6 +417,142 @@ var doc = `{
                                 "type": "integer"
                             }
                         }
+                    },
+                    "206": {
+                        "description": "Partial Content",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "integer"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/plugins/{plugin}/logs": {
+            "get": {
+                "description": "Get the most recent log lines (newest first) the plugin has written during crawling and fetching.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "General"
+                ],
+                "summary": "Get the log output of the given plugin",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Plugin",
+                        "name": "plugin",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only return log lines of the given run (crawl job id)",
+                        "name": "run",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only return log lines of the given phase (crawl, fetch)",
+                        "name": "phase",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of log lines",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/utils.PluginLogEntry"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/plugins/{plugin}/status": {
+            "get": {
+                "description": "Get the health (enabled state, last successful/failed crawl, number of indexed items) and the recent crawl runs of the given plugin.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "General"
+                ],
+                "summary": "Get status of plugin",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Plugin",
+                        "name": "plugin",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.PluginStatus"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/plugins/{plugin}/videos/{videoid}": {
+            "get": {
+                "description": "Stream the original video with given identifier in plugin. Supports range requests, so that players can seek. Use /v1/plugins/{plugin}/images/{videoid} to get the video's poster frame. Kept for existing clients, /v1/plugins/{plugin}/items/{itemid} serves all kinds of items.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "General"
+                ],
+                "summary": "Stream video with given identifier in plugin",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Plugin",
+                        "name": "plugin",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Video UUID",
+                        "name": "videoid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "integer"
+                            }
+                        }
+                    },
+                    "206": {
+                        "description": "Partial Content",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "integer"
+                            }
+                        }
                     }
                 }
             }
@@ -307,6 +636,16 @@ var doc = `{
                         "name": "date",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Metadata filter, e.g camera=*pixel*, width>=1920 or description (can be repeated, all filters have to match)",
+                        "name": "filter",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -378,6 +717,16 @@ var doc = `{
                         "name": "fulldate",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Metadata filter, e.g camera=*pixel*, width>=1920 or description (can be repeated, all filters have to match)",
+                        "name": "filter",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -462,6 +811,24 @@ var doc = `{
         "api.Entry": {
             "type": "object",
             "properties": {
+                "datesource": {
+                    "type": "string"
+                },
+                "fulldate": {
+                    "type": "string"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "metadata": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "metadataversion": {
+                    "type": "integer"
+                },
                 "plugin": {
                     "type": "string"
                 },
@@ -476,8 +843,158 @@ var doc = `{
         "api.PluginEntry": {
             "type": "object",
             "properties": {
+                "capabilities": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "compatible": {
+                    "type": "boolean"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "kinds": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "name": {
+                    "type": "string"
+                },
+                "protocolversion": {
+                    "type": "integer"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.PluginStatus": {
+            "type": "object",
+            "properties": {
+                "alert": {
+                    "type": "string"
+                },
+                "enabled": {
+                    "type": "boolean"
+                },
+                "healthy": {
+                    "type": "boolean"
+                },
+                "items": {
+                    "type": "integer"
+                },
+                "lastfailure": {
+                    "type": "integer"
+                },
+                "lastsuccess": {
+                    "type": "integer"
+                },
                 "name": {
                     "type": "string"
+                },
+                "runs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/utils.CrawlJob"
+                    }
+                }
+            }
+        },
+        "utils.CrawlJob": {
+            "type": "object",
+            "properties": {
+                "duration": {
+                    "type": "number"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "exitcode": {
+                    "type": "integer"
+                },
+                "finished": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "items": {
+                    "type": "integer"
+                },
+                "outcome": {
+                    "type": "string"
+                },
+                "plugin": {
+                    "type": "string"
+                },
+                "progress": {
+                    "$ref": "#/definitions/utils.CrawlProgress"
+                },
+                "queued": {
+                    "type": "integer"
+                },
+                "started": {
+                    "type": "integer"
+                },
+                "state": {
+                    "type": "string"
+                },
+                "stderr": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "trigger": {
+                    "type": "string"
+                }
+            }
+        },
+        "utils.CrawlProgress": {
+            "type": "object",
+            "properties": {
+                "discovered": {
+                    "type": "integer"
+                },
+                "errors": {
+                    "type": "integer"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "processed": {
+                    "type": "integer"
+                }
+            }
+        },
+        "utils.PluginLogEntry": {
+            "type": "object",
+            "properties": {
+                "fields": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "level": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "phase": {
+                    "type": "string"
+                },
+                "plugin": {
+                    "type": "string"
+                },
+                "runid": {
+                    "type": "string"
+                },
+                "time": {
+                    "type": "integer"
                 }
             }
         }
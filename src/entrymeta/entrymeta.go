@@ -0,0 +1,202 @@
+package entrymeta
+
+import (
+	"errors"
+	"mime"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//version of the metadata model, it's increased whenever a key is renamed or the format of a value changes. Entries
+//without a version were created before the keys below were defined.
+const Version = 1
+
+//the well-known keys, plugins can add their own keys (e.g "repository" or "chat"). All values are strings.
+const (
+	Title = "title"
+	Description = "description"
+	//e.g image/jpeg
+	MimeType = "mimetype"
+	//in pixels, as stored (i.e before the orientation is applied)
+	Width = "width"
+	Height = "height"
+	//EXIF orientation (1-8)
+	Orientation = "orientation"
+	//decimal degrees with 6 decimals
+	Latitude = "latitude"
+	Longitude = "longitude"
+	//make and model, e.g "Google Pixel 4a"
+	Camera = "camera"
+	//comma separated
+	Tags = "tags"
+	//the field the date was taken from, e.g DateTimeOriginal (EXIF) or DTSTART (iCalendar)
+	DateField = "datefield"
+)
+
+//keys whose values are comma separated lists, a filter matches if one of the items matches
+var listKeys = map[string]bool{Tags: true}
+
+//the MIME types of the formats Go doesn't know
+var mimeTypes = map[string]string{
+	".jpg": "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png": "image/png",
+	".gif": "image/gif",
+	".webp": "image/webp",
+	".heic": "image/heic",
+	".heif": "image/heif",
+	".tif": "image/tiff",
+	".tiff": "image/tiff",
+	".dng": "image/x-adobe-dng",
+	".cr2": "image/x-canon-cr2",
+	".nef": "image/x-nikon-nef",
+	".arw": "image/x-sony-arw",
+	".orf": "image/x-olympus-orf",
+	".rw2": "image/x-panasonic-rw2",
+	".pef": "image/x-pentax-pef",
+	".srw": "image/x-samsung-srw",
+	".raf": "image/x-fuji-raf",
+	".mp4": "video/mp4",
+	".m4v": "video/mp4",
+	".mov": "video/quicktime",
+	".3gp": "video/3gpp",
+	".mkv": "video/x-matroska",
+	".webm": "video/webm",
+	".md": "text/markdown",
+	".markdown": "text/markdown",
+	".txt": "text/plain",
+	".gpx": "application/gpx+xml",
+	".fit": "application/vnd.ant.fit",
+	".ics": "text/calendar",
+}
+
+var keyRegex = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+//the first operator in a filter is used, the longer ones come first so that e.g '>=' isn't taken for '>'
+var operators = []string{"!=", ">=", "<=", "=", ">", "<"}
+
+//returns the MIME type of a file based on its extension, an empty string if it's unknown
+func MimeTypeByExtension(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if mimeType, ok := mimeTypes[ext]; ok {
+		return mimeType
+	}
+	return strings.Split(mime.TypeByExtension(ext), ";")[0]
+}
+
+//a condition on the metadata of an entry
+type Filter struct {
+	Key string
+	//one of the operators, empty if the key just has to exist (or not exist if Negated is set)
+	Operator string
+	Value string
+	Negated bool
+}
+
+//parses a filter, e.g 'camera=*pixel*' (case insensitive glob pattern, see path.Match), 'width>=1920' (numeric),
+//'description' (the key exists) or '!description' (the key doesn't exist)
+func ParseFilter(s string) (Filter, error) {
+	filter := Filter{}
+	first := len(s)
+	for _, operator := range operators {
+		if pos := strings.Index(s, operator); pos != -1 && pos < first {
+			first = pos
+			filter = Filter{Key: strings.TrimSpace(s[:pos]), Operator: operator, Value: strings.TrimSpace(s[pos + len(operator):])}
+		}
+	}
+	if filter.Operator == "" {
+		filter.Key = strings.TrimSpace(s)
+		if strings.HasPrefix(filter.Key, "!") {
+			filter.Key, filter.Negated = strings.TrimPrefix(filter.Key, "!"), true
+		}
+	}
+
+	if !keyRegex.MatchString(filter.Key) {
+		return Filter{}, errors.New("Invalid metadata key in filter '" + s + "'")
+	}
+	switch filter.Operator {
+	case "=", "!=":
+		if _, err := path.Match(strings.ToLower(filter.Value), ""); err != nil {
+			return Filter{}, errors.New("Invalid pattern in filter '" + s + "'")
+		}
+	case ">", ">=", "<", "<=":
+		if _, err := strconv.ParseFloat(filter.Value, 64); err != nil {
+			return Filter{}, errors.New("Invalid number in filter '" + s + "'")
+		}
+	}
+	return filter, nil
+}
+
+//parses a list of filters, see ParseFilter
+func ParseFilters(filters []string) ([]Filter, error) {
+	parsedFilters := []Filter{}
+	for _, s := range filters {
+		filter, err := ParseFilter(s)
+		if err != nil {
+			return []Filter{}, err
+		}
+		parsedFilters = append(parsedFilters, filter)
+	}
+	return parsedFilters, nil
+}
+
+func (f Filter) matchesValue(value string) bool {
+	switch f.Operator {
+	case "=":
+		matched, _ := path.Match(strings.ToLower(f.Value), strings.ToLower(value))
+		return matched
+	case ">", ">=", "<", "<=":
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		//validated by ParseFilter
+		limit, _ := strconv.ParseFloat(f.Value, 64)
+		switch f.Operator {
+		case ">":
+			return number > limit
+		case ">=":
+			return number >= limit
+		case "<":
+			return number < limit
+		}
+		return number <= limit
+	}
+	return true
+}
+
+func (f Filter) Matches(metadata map[string]string) bool {
+	value, exists := metadata[f.Key]
+	if f.Operator == "" {
+		return exists != f.Negated
+	}
+	if f.Operator == "!=" {
+		return !Filter{Key: f.Key, Operator: "=", Value: f.Value}.Matches(metadata)
+	}
+	if !exists {
+		return false
+	}
+
+	values := []string{value}
+	if listKeys[f.Key] {
+		values = strings.Split(value, ",")
+	}
+	for _, v := range values {
+		if f.matchesValue(strings.TrimSpace(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+//returns true if the metadata matches all filters
+func MatchesAll(filters []Filter, metadata map[string]string) bool {
+	for _, filter := range filters {
+		if !filter.Matches(metadata) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package entrymeta
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error, expected not nil, but got nil: \033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	filter, err := ParseFilter("camera=*Pixel*")
+	ok(t, err)
+	equals(t, Filter{Key: "camera", Operator: "=", Value: "*Pixel*"}, filter)
+
+	filter, err = ParseFilter("width >= 1920")
+	ok(t, err)
+	equals(t, Filter{Key: "width", Operator: ">=", Value: "1920"}, filter)
+
+	filter, err = ParseFilter("title!=a=b")
+	ok(t, err)
+	equals(t, Filter{Key: "title", Operator: "!=", Value: "a=b"}, filter)
+
+	filter, err = ParseFilter("description")
+	ok(t, err)
+	equals(t, Filter{Key: "description"}, filter)
+
+	filter, err = ParseFilter("!latitude")
+	ok(t, err)
+	equals(t, Filter{Key: "latitude", Negated: true}, filter)
+
+	for _, invalid := range []string{"", "=value", "Camera=Pixel", "width>wide", "title=[a"} {
+		_, err = ParseFilter(invalid)
+		notOk(t, err)
+	}
+
+	_, err = ParseFilters([]string{"description", "width>"})
+	notOk(t, err)
+}
+
+func TestMatches(t *testing.T) {
+	metadata := map[string]string{Camera: "Google Pixel 4a", Width: "4032", Tags: "summer, Lake", Title: "At the lake"}
+
+	matches := func(s string) bool {
+		filter, err := ParseFilter(s)
+		ok(t, err)
+		return filter.Matches(metadata)
+	}
+
+	equals(t, true, matches("camera=*pixel*"))
+	equals(t, false, matches("camera=*iphone*"))
+	equals(t, true, matches("camera!=*iphone*"))
+	equals(t, true, matches("description!=*"))
+	equals(t, true, matches("width>1920"))
+	equals(t, true, matches("width<=4032"))
+	equals(t, false, matches("width<4032"))
+	equals(t, false, matches("height>0"))
+	equals(t, false, matches("title>1"))
+	equals(t, true, matches("tags=lake"))
+	equals(t, false, matches("tags=winter"))
+	equals(t, true, matches("title"))
+	equals(t, true, matches("!latitude"))
+	equals(t, false, matches("!title"))
+
+	filters, err := ParseFilters([]string{"camera=*pixel*", "width>1920"})
+	ok(t, err)
+	equals(t, true, MatchesAll(filters, metadata))
+	equals(t, false, MatchesAll(filters, nil))
+	equals(t, true, MatchesAll([]Filter{}, nil))
+}
+
+func TestMimeTypeByExtension(t *testing.T) {
+	equals(t, "image/jpeg", MimeTypeByExtension("/images/IMG_0001.JPG"))
+	equals(t, "image/heic", MimeTypeByExtension("IMG_0001.heic"))
+	equals(t, "video/quicktime", MimeTypeByExtension("holidays/IMG_0002.mov"))
+	equals(t, "", MimeTypeByExtension("README"))
+}
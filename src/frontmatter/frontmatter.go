@@ -0,0 +1,93 @@
+package frontmatter
+
+import (
+	"bytes"
+	"errors"
+	"gopkg.in/yaml.v2"
+	"strings"
+	"time"
+)
+
+//the front matter of a note is only searched at the beginning of the file
+const MaxSize = 16 * 1024
+
+var ErrNoDate = errors.New("No date found in front matter")
+
+//YAML front matter at the beginning of a Markdown note, as used by Jekyll, Hugo, Obsidian and most journaling apps:
+//
+//	---
+//	title: Holiday
+//	date: 2019-07-04
+//	tags: [lake, family]
+//	---
+type FrontMatter struct {
+	Title string `yaml:"title"`
+	Date string `yaml:"date"`
+	Created string `yaml:"created"`
+	Tags Tags `yaml:"tags"`
+}
+
+//the tags are either a list or a string, in which they are separated by commas or spaces (e.g "lake, family" or "#lake #family")
+type Tags []string
+
+func (t *Tags) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var items []string
+	if unmarshal(&items) != nil {
+		var s string
+		err := unmarshal(&s)
+		if err != nil {
+			return err
+		}
+		items = strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+
+	*t = nil
+	for _, item := range items {
+		//Obsidian allows tags with and without '#', commas separate the tags in the metadata
+		item = strings.TrimSpace(strings.Replace(strings.TrimPrefix(strings.TrimSpace(item), "#"), ",", " ", -1))
+		if item != "" {
+			*t = append(*t, item)
+		}
+	}
+	return nil
+}
+
+//returns the front matter and the remaining content. In case there is no (valid) front matter,
+//an empty front matter and the unchanged content is returned.
+func Parse(data []byte) (FrontMatter, []byte) {
+	var frontMatter FrontMatter
+
+	content := bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF")) //UTF-8 BOM
+	content = bytes.Replace(content, []byte("\r\n"), []byte("\n"), -1)
+	if !bytes.HasPrefix(content, []byte("---\n")) {
+		return frontMatter, data
+	}
+
+	//the front matter ends with a line that only contains '---' (or '...')
+	lines := bytes.SplitAfter(content[4:], []byte("\n"))
+	for i, line := range lines {
+		line = bytes.TrimSpace(line)
+		if bytes.Equal(line, []byte("---")) || bytes.Equal(line, []byte("...")) {
+			err := yaml.Unmarshal(bytes.Join(lines[:i], nil), &frontMatter)
+			if err != nil {
+				return FrontMatter{}, data
+			}
+			return frontMatter, bytes.TrimLeft(bytes.Join(lines[i + 1:], nil), "\n")
+		}
+	}
+	return frontMatter, data
+}
+
+//returns the date (or, if there is none, the creation date) of the front matter
+func (f FrontMatter) GetDate() (time.Time, error) {
+	for _, value := range []string{f.Date, f.Created} {
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05 -0700", "2006-01-02 15:04:05",
+											"2006-01-02 15:04", "2006-01-02"} {
+			t, err := time.Parse(layout, value)
+			if err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, ErrNoDate
+}
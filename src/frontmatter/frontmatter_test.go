@@ -0,0 +1,62 @@
+package frontmatter
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error, expected not nil, but got nil: \033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+func TestParse(t *testing.T) {
+	frontMatter, content := Parse([]byte("---\r\ntitle: Holiday\r\ndate: 2019-07-04 18:30\r\n---\r\n\r\nWe went to the lake."))
+	equals(t, "Holiday", frontMatter.Title)
+	equals(t, "We went to the lake.", string(content))
+
+	d, err := frontMatter.GetDate()
+	ok(t, err)
+	equals(t, "2019-07-04", d.Format("2006-01-02"))
+
+	//unquoted YAML timestamps are kept as they are
+	frontMatter, _ = Parse([]byte("---\ncreated: 2018-02-03T10:00:00+01:00\n...\ntext"))
+	d, err = frontMatter.GetDate()
+	ok(t, err)
+	equals(t, "2018-02-03", d.Format("2006-01-02"))
+
+	frontMatter, _ = Parse([]byte("---\ntags:\n  - lake\n  - '#family'\n---\ntext"))
+	equals(t, Tags{"lake", "family"}, frontMatter.Tags)
+	frontMatter, _ = Parse([]byte("---\ntags: \"#lake, family  summer\"\n---\ntext"))
+	equals(t, Tags{"lake", "family", "summer"}, frontMatter.Tags)
+
+	//without front matter (or without its end) the content isn't changed
+	frontMatter, content = Parse([]byte("---\ntitle: Unfinished"))
+	equals(t, FrontMatter{}, frontMatter)
+	equals(t, "---\ntitle: Unfinished", string(content))
+}
@@ -0,0 +1,162 @@
+package gitlog
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+//separators of the records and fields in the output of 'git log', they don't appear in commit messages
+const (
+	recordSeparator = "\x1e"
+	fieldSeparator = "\x1f"
+)
+
+//directories that never contain repositories worth walking into
+var skippedDirectories = map[string]bool{"node_modules": true, "vendor": true}
+
+type Commit struct {
+	Hash string
+	AuthorName string
+	AuthorEmail string
+	//in the time zone of the author
+	AuthorDate time.Time
+	Subject string
+	//e.g "3 files changed, 10 insertions(+), 2 deletions(-)", empty for commits without changes
+	DiffStat string
+}
+
+//returns the repositories below the given directory (including the directory itself). Repositories aren't
+//searched for nested repositories and the search stops at the given depth.
+func FindRepositories(root string, maxDepth int) ([]string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return []string{}, err
+	}
+	if !info.IsDir() {
+		return []string{}, errors.New(root + " is not a directory")
+	}
+
+	repositories := []string{}
+	var find func(dir string, depth int)
+	find = func(dir string, depth int) {
+		if isRepository(dir) {
+			repositories = append(repositories, dir)
+			return
+		}
+		if depth >= maxDepth {
+			return
+		}
+
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") && !skippedDirectories[entry.Name()] {
+				find(filepath.Join(dir, entry.Name()), depth + 1)
+			}
+		}
+	}
+	find(root, 0)
+
+	sort.Strings(repositories)
+	return repositories, nil
+}
+
+//either a working tree (with a .git directory or file) or a bare repository
+func isRepository(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		return true
+	}
+
+	_, headErr := os.Stat(filepath.Join(dir, "HEAD"))
+	info, objectsErr := os.Stat(filepath.Join(dir, "objects"))
+	return headErr == nil && objectsErr == nil && info.IsDir()
+}
+
+//returns the commits of all branches and tags (without merge commits)
+func Read(gitBinary string, repository string) ([]Commit, error) {
+	//repositories that belong to another user (e.g mounted into a container) are refused by newer git versions
+	cmd := exec.Command(gitBinary, "-c", "safe.directory=*", "-C", repository, "log", "--branches", "--tags", "--no-merges",
+						"--format=" + recordSeparator + "%H" + fieldSeparator + "%an" + fieldSeparator + "%ae" + fieldSeparator +
+						"%aI" + fieldSeparator + "%s", "--shortstat")
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+	output, err := cmd.Output()
+	if err != nil {
+		//a repository without any commits
+		if strings.Contains(errBuffer.String(), "does not have any commits") {
+			return []Commit{}, nil
+		}
+		return []Commit{}, errors.New(strings.TrimSpace(errBuffer.String()) + " (" + err.Error() + ")")
+	}
+	return parseLog(string(output))
+}
+
+func parseLog(output string) ([]Commit, error) {
+	commits := []Commit{}
+	for _, record := range strings.Split(output, recordSeparator) {
+		if strings.TrimSpace(record) == "" {
+			continue
+		}
+
+		lines := strings.SplitN(record, "\n", 2)
+		fields := strings.Split(lines[0], fieldSeparator)
+		if len(fields) != 5 {
+			return commits, errors.New("Invalid git log record '" + lines[0] + "'")
+		}
+
+		authorDate, err := time.Parse(time.RFC3339, fields[3])
+		if err != nil {
+			return commits, err
+		}
+
+		commit := Commit{Hash: fields[0], AuthorName: fields[1], AuthorEmail: fields[2], AuthorDate: authorDate, Subject: fields[4]}
+		if len(lines) == 2 {
+			commit.DiffStat = strings.TrimSpace(lines[1])
+		}
+		commits = append(commits, commit)
+	}
+	return commits, nil
+}
+
+//case insensitive glob patterns (see path.Match) that are matched against the name and the email address
+//of the author, e.g 'jane@example.com', '*@example.com' or 'Jane Doe'
+type Identities struct {
+	patterns []string
+}
+
+func NewIdentities(s string) (*Identities, error) {
+	identities := &Identities{}
+	for _, pattern := range strings.Split(strings.ToLower(s), ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.New("Invalid pattern '" + pattern + "'")
+		}
+		identities.patterns = append(identities.patterns, pattern)
+	}
+	return identities, nil
+}
+
+//without any patterns all commits match
+func (i *Identities) Matches(commit Commit) bool {
+	for _, pattern := range i.patterns {
+		for _, value := range []string{commit.AuthorName, commit.AuthorEmail} {
+			if matched, _ := path.Match(pattern, strings.ToLower(value)); matched {
+				return true
+			}
+		}
+	}
+	return len(i.patterns) == 0
+}
@@ -0,0 +1,156 @@
+package gitlog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error, expected not nil, but got nil: \033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+func TestParseLog(t *testing.T) {
+	output := "\x1eabc123\x1fJane Doe\x1fjane@example.com\x1f2019-03-04T22:15:00+01:00\x1fFix the parser\n\n" +
+				" 2 files changed, 10 insertions(+), 3 deletions(-)\n" +
+				"\x1edef456\x1fJohn\x1fjohn@example.com\x1f2018-12-31T23:59:59-05:00\x1fEmpty commit\n"
+	commits, err := parseLog(output)
+	ok(t, err)
+	equals(t, 2, len(commits))
+
+	equals(t, "abc123", commits[0].Hash)
+	equals(t, "Jane Doe", commits[0].AuthorName)
+	equals(t, "jane@example.com", commits[0].AuthorEmail)
+	equals(t, "Fix the parser", commits[0].Subject)
+	equals(t, "2 files changed, 10 insertions(+), 3 deletions(-)", commits[0].DiffStat)
+	//the date stays in the time zone of the author
+	equals(t, "2019-03-04 22:15", commits[0].AuthorDate.Format("2006-01-02 15:04"))
+
+	equals(t, "", commits[1].DiffStat)
+	equals(t, "2018-12-31", commits[1].AuthorDate.Format("2006-01-02"))
+
+	_, err = parseLog("\x1eabc123\x1fJane Doe\n")
+	notOk(t, err)
+
+	commits, err = parseLog("")
+	ok(t, err)
+	equals(t, 0, len(commits))
+}
+
+func TestIdentities(t *testing.T) {
+	commit := Commit{AuthorName: "Jane Doe", AuthorEmail: "Jane@Example.com"}
+
+	identities, err := NewIdentities("")
+	ok(t, err)
+	equals(t, true, identities.Matches(commit))
+
+	identities, err = NewIdentities("john@example.com, *@example.com")
+	ok(t, err)
+	equals(t, true, identities.Matches(commit))
+
+	identities, err = NewIdentities("jane doe")
+	ok(t, err)
+	equals(t, true, identities.Matches(commit))
+
+	identities, err = NewIdentities("john@example.com,*@example.org")
+	ok(t, err)
+	equals(t, false, identities.Matches(commit))
+
+	_, err = NewIdentities("[jane")
+	notOk(t, err)
+}
+
+func TestFindRepositories(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitlog")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, d := range []string{"projects/app/.git", "projects/app/lib/.git", "bare.git/objects", ".hidden/repo/.git",
+								"deep/a/b/c/.git", "empty"} {
+		ok(t, os.MkdirAll(filepath.Join(dir, d), 0755))
+	}
+	ok(t, ioutil.WriteFile(filepath.Join(dir, "bare.git", "HEAD"), []byte("ref: refs/heads/master\n"), 0644))
+
+	repositories, err := FindRepositories(dir, 2)
+	ok(t, err)
+	equals(t, []string{filepath.Join(dir, "bare.git"), filepath.Join(dir, "projects", "app")}, repositories)
+
+	repositories, err = FindRepositories(filepath.Join(dir, "projects", "app"), 0)
+	ok(t, err)
+	equals(t, []string{filepath.Join(dir, "projects", "app")}, repositories)
+
+	_, err = FindRepositories(filepath.Join(dir, "missing"), 2)
+	notOk(t, err)
+}
+
+func TestRead(t *testing.T) {
+	git, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git isn't installed")
+	}
+
+	dir, err := ioutil.TempDir("", "gitlog")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	run := func(date string, args ...string) {
+		cmd := exec.Command(git, append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=Jane Doe", "GIT_AUTHOR_EMAIL=jane@example.com",
+							"GIT_COMMITTER_NAME=Jane Doe", "GIT_COMMITTER_EMAIL=jane@example.com",
+							"GIT_AUTHOR_DATE=" + date, "GIT_COMMITTER_DATE=" + date)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatal(string(output))
+		}
+	}
+
+	run("2020-01-01T00:00:00Z", "init", "-q")
+	commits, err := Read(git, dir)
+	ok(t, err)
+	equals(t, 0, len(commits))
+
+	ok(t, ioutil.WriteFile(filepath.Join(dir, "README"), []byte("hello\nworld\n"), 0644))
+	run("2020-05-17T09:30:00+02:00", "add", "README")
+	run("2020-05-17T09:30:00+02:00", "commit", "-q", "-m", "Initial commit\n\nWith a body")
+
+	commits, err = Read(git, dir)
+	ok(t, err)
+	equals(t, 1, len(commits))
+	equals(t, "Initial commit", commits[0].Subject)
+	equals(t, "jane@example.com", commits[0].AuthorEmail)
+	equals(t, "1 file changed, 2 insertions(+)", commits[0].DiffStat)
+	equals(t, time.Date(2020, 5, 17, 7, 30, 0, 0, time.UTC).Unix(), commits[0].AuthorDate.Unix())
+	equals(t, "2020-05-17 09:30", commits[0].AuthorDate.Format("2006-01-02 15:04"))
+
+	_, err = Read(git, filepath.Join(dir, "missing"))
+	notOk(t, err)
+}
@@ -18,5 +18,6 @@ require (
 	github.com/swaggo/gin-swagger v1.3.0
 	github.com/swaggo/swag v1.5.1
 	github.com/xeonx/timeago v1.0.0-rc4
+	golang.org/x/text v0.3.2
 	gopkg.in/yaml.v2 v2.3.0
 )
@@ -0,0 +1,196 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+//a single VEVENT of a calendar (RFC 5545). Only the properties that are needed to put the event
+//into the date index are parsed.
+type Event struct {
+	Uid string
+	Summary string
+	Location string
+	Start time.Time
+	//all-day events only have a date, no time
+	AllDay bool
+	//the start time has no time zone (i.e it's the same wall clock time everywhere), Start is in UTC then
+	Floating bool
+	Cancelled bool
+	Rule *Rule
+	//the recurrence rule isn't supported, only the first instance is known
+	IgnoredRule bool
+	ExDates []time.Time
+	//set in case the event overrides a single instance of a recurring event (same UID)
+	RecurrenceId time.Time
+}
+
+type property struct {
+	Name string
+	Params map[string]string
+	Value string
+}
+
+//lines that are longer than 75 octets are split, the continuation lines start with a space or tab
+func readUnfoldedLines(r io.Reader) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64 * 1024), 10 * 1024 * 1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines) - 1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+//parses a content line like DTSTART;TZID="Europe/Vienna":20190704T120000
+func parseProperty(line string) (property, error) {
+	inQuotes := false
+	for i, c := range line {
+		if c == '"' {
+			inQuotes = !inQuotes
+		} else if c == ':' && !inQuotes {
+			parts := strings.Split(line[:i], ";")
+			p := property{Name: strings.ToUpper(parts[0]), Params: make(map[string]string), Value: line[i + 1:]}
+			for _, param := range parts[1:] {
+				keyValue := strings.SplitN(param, "=", 2)
+				if len(keyValue) == 2 {
+					p.Params[strings.ToUpper(keyValue[0])] = strings.Trim(keyValue[1], "\"")
+				}
+			}
+			return p, nil
+		}
+	}
+	return property{}, errors.New("Invalid content line '" + line + "'")
+}
+
+func unescapeText(s string) string {
+	replacer := strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+	return replacer.Replace(s)
+}
+
+//parses a DATE or DATE-TIME value. Returns whether the value is a date only and whether it's a floating time.
+//Time zones that Go doesn't know (e.g the Windows names used by Outlook) are treated as floating time.
+func parseDateTime(value string, params map[string]string) (time.Time, bool, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.Parse("20060102", value)
+		return t, true, true, err
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, false, err
+	}
+
+	if tzid, ok := params["TZID"]; ok {
+		location, err := time.LoadLocation(strings.TrimPrefix(tzid, "/"))
+		if err == nil {
+			t, err := time.ParseInLocation("20060102T150405", value, location)
+			return t, false, false, err
+		}
+	}
+
+	t, err := time.Parse("20060102T150405", value)
+	return t, false, true, err
+}
+
+//parses all events of a calendar. Events that can't be parsed (e.g because of an invalid start date)
+//are skipped, the number of skipped events is returned.
+func Parse(r io.Reader) ([]Event, int, error) {
+	lines, err := readUnfoldedLines(r)
+	if err != nil {
+		return []Event{}, 0, err
+	}
+
+	events := []Event{}
+	skipped := 0
+	//the components (VCALENDAR, VEVENT, VALARM, ...) that are currently open
+	components := []string{}
+	var event *Event
+	var eventErr error
+	for _, line := range lines {
+		p, err := parseProperty(line)
+		if err != nil {
+			if event != nil {
+				eventErr = err
+			}
+			continue
+		}
+
+		switch p.Name {
+		case "BEGIN":
+			components = append(components, strings.ToUpper(p.Value))
+			if strings.ToUpper(p.Value) == "VEVENT" {
+				event = &Event{}
+				eventErr = nil
+			}
+			continue
+		case "END":
+			if len(components) > 0 {
+				components = components[:len(components) - 1]
+			}
+			if strings.ToUpper(p.Value) == "VEVENT" && event != nil {
+				if eventErr == nil && event.Start.IsZero() {
+					eventErr = errors.New("Event without start date")
+				}
+				if eventErr == nil {
+					events = append(events, *event)
+				} else {
+					skipped += 1
+				}
+				event = nil
+			}
+			continue
+		}
+
+		//properties of nested components (e.g VALARM) are ignored
+		if event == nil || len(components) == 0 || components[len(components) - 1] != "VEVENT" {
+			continue
+		}
+
+		switch p.Name {
+		case "UID":
+			event.Uid = p.Value
+		case "SUMMARY":
+			event.Summary = unescapeText(p.Value)
+		case "LOCATION":
+			event.Location = unescapeText(p.Value)
+		case "STATUS":
+			event.Cancelled = strings.ToUpper(p.Value) == "CANCELLED"
+		case "DTSTART":
+			event.Start, event.AllDay, event.Floating, err = parseDateTime(p.Value, p.Params)
+			if err != nil {
+				eventErr = err
+			}
+		case "RECURRENCE-ID":
+			event.RecurrenceId, _, _, err = parseDateTime(p.Value, p.Params)
+			if err != nil {
+				eventErr = err
+			}
+		case "RRULE":
+			event.Rule, err = ParseRule(p.Value)
+			if err == ErrUnsupportedRule {
+				event.IgnoredRule = true
+			} else if err != nil {
+				eventErr = err
+			}
+		case "EXDATE":
+			for _, value := range strings.Split(p.Value, ",") {
+				exDate, _, _, err := parseDateTime(value, p.Params)
+				if err == nil {
+					event.ExDates = append(event.ExDates, exDate)
+				}
+			}
+		}
+	}
+	return events, skipped, nil
+}
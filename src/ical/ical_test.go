@@ -0,0 +1,167 @@
+package ical
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error, expected not nil, but got nil: \033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+func formatTimes(times []time.Time, layout string) []string {
+	formatted := []string{}
+	for _, t := range times {
+		formatted = append(formatted, t.Format(layout))
+	}
+	return formatted
+}
+
+const testCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:birthday\r\n" +
+	"SUMMARY:Anna's birthday\\, party\r\n" +
+	"DTSTART;VALUE=DATE:20150704\r\n" +
+	"RRULE:FREQ=YEARLY\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"SUMMARY:Alarm\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:concert\r\n" +
+	"SUMMARY:Concert\r\n" +
+	"LOCATION:Wiener Stadthalle\\, Vienna\r\n" +
+	"DESCRIPTION:A very long description that is folded into the next line as it is longer than 75 o\r\n" +
+	" ctets\r\n" +
+	"DTSTART;TZID=Europe/Vienna:20190704T233000\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:outlook\r\n" +
+	"SUMMARY:Meeting\r\n" +
+	"DTSTART;TZID=\"W. Europe Standard Time\":20190705T090000\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:broken\r\n" +
+	"DTSTART:2019-07-06\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParse(t *testing.T) {
+	events, skipped, err := Parse(strings.NewReader(testCalendar))
+	ok(t, err)
+	equals(t, 1, skipped)
+	equals(t, 3, len(events))
+
+	equals(t, "Anna's birthday, party", events[0].Summary)
+	equals(t, true, events[0].AllDay)
+	equals(t, "YEARLY", events[0].Rule.Freq)
+
+	equals(t, "Wiener Stadthalle, Vienna", events[1].Location)
+	equals(t, false, events[1].Floating)
+	equals(t, "2019-07-04T21:30:00Z", events[1].Start.UTC().Format(time.RFC3339))
+
+	//unknown time zones are treated as floating time
+	equals(t, true, events[2].Floating)
+	equals(t, "2019-07-05T09:00:00Z", events[2].Start.Format(time.RFC3339))
+}
+
+func TestLocalStart(t *testing.T) {
+	events, _, err := Parse(strings.NewReader(testCalendar))
+	ok(t, err)
+
+	newYork, err := time.LoadLocation("America/New_York")
+	ok(t, err)
+	instances := Expand(events[1:3], time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	equals(t, 2, len(instances))
+	equals(t, "2019-07-04 17:30", instances[0].LocalStart(newYork).Format("2006-01-02 15:04"))
+	equals(t, "2019-07-05 09:00", instances[1].LocalStart(newYork).Format("2006-01-02 15:04"))
+}
+
+func TestOccurrencesOnlyIncludeHistoricInstances(t *testing.T) {
+	events, _, err := Parse(strings.NewReader(testCalendar))
+	ok(t, err)
+
+	occurrences := events[0].Occurrences(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	equals(t, []string{"2015-07-04", "2016-07-04", "2017-07-04", "2018-07-04"}, formatTimes(occurrences, "2006-01-02"))
+}
+
+func TestOccurrences(t *testing.T) {
+	before := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	start := time.Date(2019, 1, 25, 18, 0, 0, 0, time.UTC)
+
+	rule, err := ParseRule("FREQ=MONTHLY;BYDAY=-1FR;COUNT=3")
+	ok(t, err)
+	event := Event{Start: start, Rule: rule}
+	equals(t, []string{"2019-01-25", "2019-02-22", "2019-03-29"}, formatTimes(event.Occurrences(before), "2006-01-02"))
+
+	rule, err = ParseRule("FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR;UNTIL=20190215")
+	ok(t, err)
+	event = Event{Start: start, Rule: rule, ExDates: []time.Time{time.Date(2019, 2, 8, 18, 0, 0, 0, time.UTC)}}
+	equals(t, []string{"2019-01-25", "2019-02-04"}, formatTimes(event.Occurrences(before), "2006-01-02"))
+
+	//months without the 31st are skipped
+	rule, err = ParseRule("FREQ=MONTHLY;BYMONTHDAY=31;COUNT=3")
+	ok(t, err)
+	event = Event{Start: time.Date(2019, 1, 31, 0, 0, 0, 0, time.UTC), Rule: rule}
+	equals(t, []string{"2019-01-31", "2019-03-31", "2019-05-31"}, formatTimes(event.Occurrences(before), "2006-01-02"))
+
+	rule, err = ParseRule("FREQ=YEARLY;BYMONTH=11;BYDAY=4TH")
+	ok(t, err)
+	event = Event{Start: time.Date(2017, 11, 23, 0, 0, 0, 0, time.UTC), Rule: rule}
+	equals(t, []string{"2017-11-23", "2018-11-22", "2019-11-28"}, formatTimes(event.Occurrences(before), "2006-01-02"))
+
+	_, err = ParseRule("FREQ=HOURLY")
+	equals(t, ErrUnsupportedRule, err)
+	_, err = ParseRule("FREQ=MONTHLY;BYSETPOS=-1;BYDAY=MO,TU,WE,TH,FR")
+	equals(t, ErrUnsupportedRule, err)
+	_, err = ParseRule("INTERVAL=2")
+	notOk(t, err)
+}
+
+func TestExpandReplacesOverriddenInstances(t *testing.T) {
+	rule, err := ParseRule("FREQ=DAILY;COUNT=3")
+	ok(t, err)
+	start := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	events := []Event{
+		Event{Uid: "standup", Summary: "Standup", Start: start, Rule: rule},
+		Event{Uid: "standup", Summary: "Moved standup", Start: start.AddDate(0, 0, 3), RecurrenceId: start.AddDate(0, 0, 1)},
+		Event{Uid: "standup", Summary: "Cancelled standup", Start: start.AddDate(0, 0, 2), RecurrenceId: start.AddDate(0, 0, 2), Cancelled: true},
+		Event{Uid: "cancelled", Start: start, Cancelled: true},
+	}
+
+	instances := Expand(events, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	summaries := []string{}
+	for _, instance := range instances {
+		summaries = append(summaries, instance.Event.Summary + " " + instance.Start.Format("2006-01-02"))
+	}
+	equals(t, []string{"Standup 2019-07-01", "Moved standup 2019-07-04"}, summaries)
+}
@@ -0,0 +1,365 @@
+package ical
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//returned for rules that use parts we don't support (e.g BYSETPOS or an hourly frequency). Only the
+//first instance of those events is indexed.
+var ErrUnsupportedRule = errors.New("Unsupported recurrence rule")
+
+//a recurring event is never expanded beyond this number of periods (e.g days for a daily event)
+const maxPeriods = 100000
+
+var weekdays = map[string]time.Weekday{"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+										"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday}
+
+//e.g 2MO (the second monday) or -1FR (the last friday), the ordinal is 0 in case every weekday matches
+type weekdayNum struct {
+	Ordinal int
+	Weekday time.Weekday
+}
+
+//the subset of the RRULE syntax (RFC 5545, 3.3.10) that is used by the common calendar apps
+type Rule struct {
+	Freq string
+	Interval int
+	Count int
+	Until time.Time
+	ByDay []weekdayNum
+	ByMonthDay []int
+	ByMonth []time.Month
+	WeekStart time.Weekday
+}
+
+func parseInts(value string, min int, max int) ([]int, error) {
+	numbers := []int{}
+	for _, s := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n == 0 || n < min || n > max {
+			return numbers, errors.New("Invalid number '" + s + "' in recurrence rule")
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, nil
+}
+
+//parses a recurrence rule like FREQ=MONTHLY;INTERVAL=2;BYDAY=-1FR
+func ParseRule(value string) (*Rule, error) {
+	rule := &Rule{Interval: 1, WeekStart: time.Monday}
+	for _, part := range strings.Split(value, ";") {
+		keyValue := strings.SplitN(part, "=", 2)
+		if len(keyValue) != 2 {
+			return nil, errors.New("Invalid recurrence rule '" + value + "'")
+		}
+
+		key := strings.ToUpper(keyValue[0])
+		v := strings.ToUpper(keyValue[1])
+		var err error
+		switch key {
+		case "FREQ":
+			rule.Freq = v
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(v)
+			if err == nil && rule.Interval <= 0 {
+				err = errors.New("Invalid interval")
+			}
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(v)
+		case "UNTIL":
+			var dateOnly bool
+			rule.Until, dateOnly, _, err = parseDateTime(v, map[string]string{})
+			//the until date is inclusive
+			if dateOnly {
+				rule.Until = rule.Until.Add(24 * time.Hour - time.Second)
+			}
+		case "WKST":
+			weekday, ok := weekdays[v]
+			if !ok {
+				err = errors.New("Invalid week start")
+			}
+			rule.WeekStart = weekday
+		case "BYDAY":
+			for _, day := range strings.Split(v, ",") {
+				if len(day) < 2 {
+					return nil, errors.New("Invalid weekday '" + day + "' in recurrence rule")
+				}
+				weekday, ok := weekdays[day[len(day) - 2:]]
+				if !ok {
+					return nil, errors.New("Invalid weekday '" + day + "' in recurrence rule")
+				}
+				ordinal := 0
+				if len(day) > 2 {
+					ordinal, err = strconv.Atoi(day[:len(day) - 2])
+					if err != nil || ordinal == 0 {
+						return nil, errors.New("Invalid weekday '" + day + "' in recurrence rule")
+					}
+				}
+				rule.ByDay = append(rule.ByDay, weekdayNum{Ordinal: ordinal, Weekday: weekday})
+			}
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = parseInts(v, -31, 31)
+		case "BYMONTH":
+			var months []int
+			months, err = parseInts(v, 1, 12)
+			for _, month := range months {
+				rule.ByMonth = append(rule.ByMonth, time.Month(month))
+			}
+		default:
+			return nil, ErrUnsupportedRule
+		}
+
+		if err != nil {
+			return nil, errors.New("Invalid " + key + " in recurrence rule '" + value + "'")
+		}
+	}
+
+	switch rule.Freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	case "":
+		return nil, errors.New("Recurrence rule '" + value + "' without FREQ")
+	default:
+		return nil, ErrUnsupportedRule
+	}
+
+	//ordinal weekdays only make sense within a month
+	for _, day := range rule.ByDay {
+		if day.Ordinal != 0 && (rule.Freq == "DAILY" || rule.Freq == "WEEKLY" || (rule.Freq == "YEARLY" && len(rule.ByMonth) == 0)) {
+			return nil, ErrUnsupportedRule
+		}
+	}
+	return rule, nil
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month + 1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func containsMonth(months []time.Month, month time.Month) bool {
+	for _, m := range months {
+		if m == month {
+			return true
+		}
+	}
+	return len(months) == 0
+}
+
+func containsWeekday(days []weekdayNum, weekday time.Weekday) bool {
+	for _, day := range days {
+		if day.Weekday == weekday {
+			return true
+		}
+	}
+	return len(days) == 0
+}
+
+//negative month days count from the end of the month (-1 is the last day)
+func containsMonthDay(monthDays []int, t time.Time) bool {
+	for _, day := range monthDays {
+		if day == t.Day() || daysIn(t.Year(), t.Month()) + day + 1 == t.Day() {
+			return true
+		}
+	}
+	return len(monthDays) == 0
+}
+
+//the days of a month that match the BYMONTHDAY and BYDAY parts, or the day of the start date
+func (r *Rule) monthDays(year int, month time.Month, startDay int) []int {
+	days := []int{}
+	n := daysIn(year, month)
+	if len(r.ByMonthDay) > 0 {
+		for _, day := range r.ByMonthDay {
+			if day < 0 {
+				day = n + day + 1
+			}
+			if day >= 1 && day <= n && containsWeekday(r.ByDay, time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Weekday()) {
+				days = append(days, day)
+			}
+		}
+		return days
+	}
+
+	if len(r.ByDay) > 0 {
+		for _, byDay := range r.ByDay {
+			matching := []int{}
+			for day := 1; day <= n; day++ {
+				if time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Weekday() == byDay.Weekday {
+					matching = append(matching, day)
+				}
+			}
+
+			if byDay.Ordinal == 0 {
+				days = append(days, matching...)
+			} else if byDay.Ordinal > 0 && byDay.Ordinal <= len(matching) {
+				days = append(days, matching[byDay.Ordinal - 1])
+			} else if byDay.Ordinal < 0 && -byDay.Ordinal <= len(matching) {
+				days = append(days, matching[len(matching) + byDay.Ordinal])
+			}
+		}
+		return days
+	}
+
+	//months without that day (e.g the 31st) are skipped
+	if startDay <= n {
+		days = append(days, startDay)
+	}
+	return days
+}
+
+//returns the first day of the n-th period together with the candidates of that period
+func (r *Rule) candidates(start time.Time, n int) (time.Time, []time.Time) {
+	year, month, day := start.Date()
+	hour, min, sec := start.Clock()
+	location := start.Location()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, hour, min, sec, 0, location)
+	}
+
+	candidates := []time.Time{}
+	switch r.Freq {
+	case "DAILY":
+		t := at(year, month, day + n * r.Interval)
+		if containsMonth(r.ByMonth, t.Month()) && containsMonthDay(r.ByMonthDay, t) && containsWeekday(r.ByDay, t.Weekday()) {
+			candidates = append(candidates, t)
+		}
+		return t, candidates
+	case "WEEKLY":
+		weekStart := at(year, month, day - (int(start.Weekday()) - int(r.WeekStart) + 7) % 7 + 7 * n * r.Interval)
+		byDay := r.ByDay
+		if len(byDay) == 0 {
+			byDay = []weekdayNum{{Weekday: start.Weekday()}}
+		}
+		for _, d := range byDay {
+			t := weekStart.AddDate(0, 0, (int(d.Weekday) - int(r.WeekStart) + 7) % 7)
+			if containsMonth(r.ByMonth, t.Month()) {
+				candidates = append(candidates, t)
+			}
+		}
+		return weekStart, candidates
+	case "MONTHLY":
+		monthStart := at(year, month + time.Month(n * r.Interval), 1)
+		if containsMonth(r.ByMonth, monthStart.Month()) {
+			for _, d := range r.monthDays(monthStart.Year(), monthStart.Month(), day) {
+				candidates = append(candidates, at(monthStart.Year(), monthStart.Month(), d))
+			}
+		}
+		return monthStart, candidates
+	default:
+		y := year + n * r.Interval
+		months := r.ByMonth
+		if len(months) == 0 {
+			months = []time.Month{month}
+		}
+		for _, m := range months {
+			for _, d := range r.monthDays(y, m, day) {
+				candidates = append(candidates, at(y, m, d))
+			}
+		}
+		return at(y, time.January, 1), candidates
+	}
+}
+
+func containsTime(times []time.Time, t time.Time) bool {
+	for _, other := range times {
+		if other.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+//returns the start times of all instances that start before the given time (EXDATEs are left out).
+//Only historic instances are of interest, so the expansion stops at that time even if the rule doesn't end.
+func (e *Event) Occurrences(before time.Time) []time.Time {
+	occurrences := []time.Time{}
+	if e.Rule == nil {
+		if e.Start.Before(before) {
+			occurrences = append(occurrences, e.Start)
+		}
+		return occurrences
+	}
+
+	end := before
+	if !e.Rule.Until.IsZero() && e.Rule.Until.Before(end) {
+		end = e.Rule.Until.Add(time.Second)
+	}
+
+	//the start is always the first instance, even if it doesn't match the rule
+	count := 1
+	if e.Start.Before(end) && !containsTime(e.ExDates, e.Start) {
+		occurrences = append(occurrences, e.Start)
+	}
+
+	for n := 0; n < maxPeriods; n++ {
+		periodStart, candidates := e.Rule.candidates(e.Start, n)
+		if !periodStart.Before(end) {
+			break
+		}
+
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].Before(candidates[j])
+		})
+		for i, candidate := range candidates {
+			if !candidate.After(e.Start) || (i > 0 && candidate.Equal(candidates[i - 1])) {
+				continue
+			}
+			if !candidate.Before(end) {
+				return occurrences
+			}
+			count += 1
+			if e.Rule.Count > 0 && count > e.Rule.Count {
+				return occurrences
+			}
+			if !containsTime(e.ExDates, candidate) {
+				occurrences = append(occurrences, candidate)
+			}
+		}
+	}
+	return occurrences
+}
+
+//a single instance of a (possibly recurring) event
+type Instance struct {
+	Event *Event
+	Start time.Time
+}
+
+//the start of the instance in the given time zone. All-day events and events with a floating time
+//happen at the same date everywhere.
+func (i Instance) LocalStart(location *time.Location) time.Time {
+	if i.Event.AllDay || i.Event.Floating {
+		return i.Start
+	}
+	return i.Start.In(location)
+}
+
+//expands the recurring events into the instances that start before the given time. Instances that were
+//moved or cancelled (i.e that have an event with the same UID and a RECURRENCE-ID) are replaced.
+func Expand(events []Event, before time.Time) []Instance {
+	overridden := make(map[string][]time.Time)
+	for _, event := range events {
+		if !event.RecurrenceId.IsZero() {
+			overridden[event.Uid] = append(overridden[event.Uid], event.RecurrenceId)
+		}
+	}
+
+	instances := []Instance{}
+	for i := range events {
+		event := &events[i]
+		if event.Cancelled {
+			continue
+		}
+
+		for _, start := range event.Occurrences(before) {
+			if event.RecurrenceId.IsZero() && containsTime(overridden[event.Uid], start) {
+				continue
+			}
+			instances = append(instances, Instance{Event: event, Start: start})
+		}
+	}
+	return instances
+}
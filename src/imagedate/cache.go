@@ -0,0 +1,124 @@
+package imagedate
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+//implemented by images that know the version of their content (e.g the ETag of a file on a
+//WebDAV server). The EXIF date of those images is cached, so that it's only extracted once per version.
+type VersionedImage interface {
+	Image
+	Version() string
+}
+
+type exifDateCacheEntry struct {
+	Date string `json:"date,omitempty"` //empty in case the image doesn't contain an EXIF date
+	Details *ImageDetails `json:"details,omitempty"` //nil in case the details weren't read yet
+}
+
+//keeps the EXIF dates (and the details of the images) in a JSON file (usually in the plugin's cache directory). Entries which
+//weren't used during a crawl are dropped when the cache is saved, so the cache doesn't grow forever.
+type ExifDateCache struct {
+	path string
+	mutex sync.Mutex
+	entries map[string]exifDateCacheEntry
+	used map[string]bool
+}
+
+func LoadExifDateCache(path string) (*ExifDateCache, error) {
+	cache := &ExifDateCache{
+		path: path,
+		entries: make(map[string]exifDateCacheEntry),
+		used: make(map[string]bool),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cache, nil
+		}
+		return cache, err
+	}
+
+	err = json.Unmarshal(data, &cache.entries)
+	return cache, err
+}
+
+func (c *ExifDateCache) get(version string) (time.Time, error, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[version]
+	if !ok {
+		return time.Time{}, nil, false
+	}
+	c.used[version] = true
+
+	if entry.Date == "" {
+		return time.Time{}, errNoExifData, true
+	}
+
+	t, err := time.Parse(time.RFC3339, entry.Date)
+	if err != nil {
+		return time.Time{}, nil, false
+	}
+	return t, nil, true
+}
+
+func (c *ExifDateCache) set(version string, t time.Time, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	//the details are kept, they belong to the same version
+	entry := exifDateCacheEntry{Details: c.entries[version].Details}
+	if err == nil {
+		entry.Date = t.Format(time.RFC3339)
+	}
+	c.entries[version] = entry
+	c.used[version] = true
+}
+
+func (c *ExifDateCache) getDetails(version string) (ImageDetails, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[version]
+	if !ok || entry.Details == nil {
+		return ImageDetails{}, false
+	}
+	c.used[version] = true
+	return *entry.Details, true
+}
+
+//the details are read together with the EXIF date, so both are stored
+func (c *ExifDateCache) setDetails(version string, details ImageDetails, t time.Time, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry := exifDateCacheEntry{Details: &details}
+	if err == nil {
+		entry.Date = t.Format(time.RFC3339)
+	}
+	c.entries[version] = entry
+	c.used[version] = true
+}
+
+func (c *ExifDateCache) Save() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entries := make(map[string]exifDateCacheEntry)
+	for version := range c.used {
+		entries[version] = c.entries[version]
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path, data, 0600)
+}
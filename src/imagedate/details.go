@@ -0,0 +1,128 @@
+package imagedate
+
+import (
+	"github.com/bbernhard/mindfulbytes/entrymeta"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//technical details of an image, they are read from its EXIF data or (the dimensions) from its header
+type ImageDetails struct {
+	//make and model
+	Camera string `json:"camera,omitempty"`
+	Orientation int `json:"orientation,omitempty"`
+	Width int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	//the EXIF tag the date is taken from (e.g DateTimeOriginal)
+	DateField string `json:"datefield,omitempty"`
+}
+
+//the details as metadata of an entry, only the details that are known are added
+func (d ImageDetails) Metadata() map[string]string {
+	metadata := map[string]string{}
+	if d.Camera != "" {
+		metadata[entrymeta.Camera] = d.Camera
+	}
+	if d.Orientation != 0 {
+		metadata[entrymeta.Orientation] = strconv.Itoa(d.Orientation)
+	}
+	if d.Width != 0 && d.Height != 0 {
+		metadata[entrymeta.Width] = strconv.Itoa(d.Width)
+		metadata[entrymeta.Height] = strconv.Itoa(d.Height)
+	}
+	if d.DateField != "" {
+		metadata[entrymeta.DateField] = d.DateField
+	}
+	return metadata
+}
+
+//most cameras repeat the make in the model (e.g Canon, Canon EOS 5D), others don't (e.g Google, Pixel 4a)
+func getCamera(cameraMake string, model string) string {
+	cameraMake, model = trimExifString(cameraMake), trimExifString(model)
+	if cameraMake == "" || strings.HasPrefix(strings.ToLower(model), strings.ToLower(cameraMake)) {
+		return model
+	}
+	return strings.TrimSpace(cameraMake + " " + model)
+}
+
+func getImageDetailsFromTags(tags map[uint16]string) ImageDetails {
+	details := ImageDetails{Camera: getCamera(tags[tagMake], tags[tagModel])}
+	details.Orientation, _ = strconv.Atoi(tags[tagOrientation])
+	if details.Orientation < 1 || details.Orientation > 8 {
+		details.Orientation = 0
+	}
+	details.Width, _ = strconv.Atoi(tags[tagPixelXDimension])
+	details.Height, _ = strconv.Atoi(tags[tagPixelYDimension])
+	if _, tag, err := getExifDateFromTags(tags); err == nil {
+		details.DateField = exifDateTagNames[tag]
+	}
+	return details
+}
+
+//returns the details and the EXIF date of the image. The error is the one of reading the EXIF date.
+func getImageDetails(f io.ReadSeeker, ext string) (ImageDetails, time.Time, error) {
+	details := ImageDetails{}
+	tags, err := readExifTags(f, ext)
+	t := time.Time{}
+	if err == nil {
+		details = getImageDetailsFromTags(tags)
+		t, _, err = getExifDateFromTags(tags)
+	}
+
+	//not all cameras store the dimensions in the EXIF data, the header of JPEG, PNG and GIF images contains them as well
+	if details.Width == 0 || details.Height == 0 {
+		if _, seekErr := f.Seek(0, io.SeekStart); seekErr == nil {
+			if config, _, configErr := image.DecodeConfig(f); configErr == nil {
+				details.Width, details.Height = config.Width, config.Height
+			}
+		}
+	}
+	return details, t, err
+}
+
+func getImageDetailsOfImage(img Image) (ImageDetails, time.Time, error) {
+	f, err := img.Open()
+	if err != nil {
+		return ImageDetails{}, time.Time{}, err
+	}
+	defer f.Close()
+
+	return getImageDetails(f, strings.ToLower(path.Ext(img.Path())))
+}
+
+//returns the details of the image, they are cached together with the EXIF date (in case the image's version is known)
+func (e *Extractor) GetDetails(img Image) ImageDetails {
+	versionedImage, ok := img.(VersionedImage)
+	cached := e.exifDateCache != nil && ok && versionedImage.Version() != ""
+	if cached {
+		if details, found := e.exifDateCache.getDetails(versionedImage.Version()); found {
+			return details
+		}
+	}
+
+	details, t, err := getImageDetailsOfImage(img)
+	//only cache the results that won't change, but not e.g network errors
+	if cached && (err == nil || err == errNoExifData || err == errUnsupportedFormat) {
+		e.exifDateCache.setDetails(versionedImage.Version(), details, t, err)
+	}
+	return details
+}
+
+//returns the metadata of an entry for the image: the details from its sidecar files and its EXIF data and its MIME type
+func (e *Extractor) GetMetadata(img Image) map[string]string {
+	metadata := GetSidecarDetails(img).Metadata()
+	for key, value := range e.GetDetails(img).Metadata() {
+		metadata[key] = value
+	}
+	if mimeType := entrymeta.MimeTypeByExtension(img.Path()); mimeType != "" {
+		metadata[entrymeta.MimeType] = mimeType
+	}
+	return metadata
+}
@@ -0,0 +1,554 @@
+package imagedate
+
+import (
+	"github.com/bbernhard/mindfulbytes/isobmff"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errNoExifData = errors.New("No EXIF data found")
+var errUnsupportedFormat = errors.New("Unsupported file format")
+
+const (
+	tagMake = 0x010f
+	tagModel = 0x0110
+	tagOrientation = 0x0112
+	tagDateTime = 0x0132
+	tagExifIfdPointer = 0x8769
+	tagDateTimeOriginal = 0x9003
+	tagDateTimeDigitized = 0x9004
+	tagOffsetTime = 0x9010
+	tagOffsetTimeOriginal = 0x9011
+	tagOffsetTimeDigitized = 0x9012
+	tagPixelXDimension = 0xa002
+	tagPixelYDimension = 0xa003
+)
+
+//types of the values in an IFD entry
+const (
+	typeShort = 3
+	typeLong = 4
+)
+
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+//date tags in the order of preference and their corresponding time zone offset tag
+var exifDateTags = [][2]uint16{
+	{tagDateTimeOriginal, tagOffsetTimeOriginal},
+	{tagDateTimeDigitized, tagOffsetTimeDigitized},
+	{tagDateTime, tagOffsetTime},
+}
+
+var exifDateTagNames = map[uint16]string{
+	tagDateTimeOriginal: "DateTimeOriginal",
+	tagDateTimeDigitized: "DateTimeDigitized",
+	tagDateTime: "DateTime",
+}
+
+func trimExifString(value string) string {
+	return strings.TrimSpace(strings.TrimRight(value, "\x00"))
+}
+
+//returns the creation date that is stored in the EXIF data of the image. DateTimeOriginal is
+//preferred, followed by DateTimeDigitized and DateTime. In case the camera also stored the
+//time zone offset (e.g OffsetTimeOriginal), the returned time is in that time zone.
+func getExifDate(f io.ReadSeeker, ext string) (time.Time, error) {
+	tags, err := readExifTags(f, ext)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t, _, err := getExifDateFromTags(tags)
+	return t, err
+}
+
+func readExifTags(f io.ReadSeeker, ext string) (map[uint16]string, error) {
+	tiffOffset, err := findTiffHeader(f, ext)
+	if err != nil {
+		return map[uint16]string{}, err
+	}
+	return readTiffTags(f, tiffOffset)
+}
+
+//returns the date and the tag it was taken from
+func getExifDateFromTags(tags map[uint16]string) (time.Time, uint16, error) {
+	for _, dateTags := range exifDateTags {
+		value, ok := tags[dateTags[0]]
+		if !ok {
+			continue
+		}
+
+		t, err := time.Parse(exifTimeLayout, trimExifString(value))
+		if err != nil || t.Year() <= 1 {
+			continue
+		}
+
+		if offset, ok := tags[dateTags[1]]; ok {
+			tWithOffset, err := time.Parse(exifTimeLayout + "-07:00", trimExifString(value) + trimExifString(offset))
+			if err == nil {
+				return tWithOffset, dateTags[0], nil
+			}
+		}
+		return t, dateTags[0], nil
+	}
+	return time.Time{}, 0, errNoExifData
+}
+
+//returns the offset of the TIFF header (i.e the beginning of the EXIF structure) in the file
+func findTiffHeader(f io.ReadSeeker, ext string) (int64, error) {
+	header := make([]byte, 16)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8}):
+		return findTiffHeaderInJpeg(f, 0)
+	case bytes.HasPrefix(header, []byte("II")) || bytes.HasPrefix(header, []byte("MM")):
+		//TIFF and most of the RAW formats (DNG, CR2, NEF, ARW, ORF, RW2, ...) are TIFF based
+		return 0, nil
+	case bytes.HasPrefix(header, []byte("FUJIFILMCCD-RAW")):
+		return findTiffHeaderInRaf(f)
+	case bytes.HasPrefix(header, []byte("\x89PNG")):
+		return findTiffHeaderInPng(f)
+	case len(header) >= 12 && bytes.Equal(header[0:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WEBP")):
+		return findTiffHeaderInWebp(f)
+	case len(header) >= 8 && bytes.Equal(header[4:8], []byte("ftyp")):
+		return findTiffHeaderInHeif(f)
+	}
+
+	return 0, errUnsupportedFormat
+}
+
+func findTiffHeaderInJpeg(f io.ReadSeeker, start int64) (int64, error) {
+	offset := start + 2
+	for {
+		_, err := f.Seek(offset, io.SeekStart)
+		if err != nil {
+			return 0, err
+		}
+
+		segmentHeader := make([]byte, 4)
+		_, err = io.ReadFull(f, segmentHeader)
+		if err != nil {
+			return 0, errNoExifData
+		}
+
+		if segmentHeader[0] != 0xFF {
+			return 0, errors.New("Invalid JPEG segment")
+		}
+
+		marker := segmentHeader[1]
+		//start of scan or end of image, the EXIF data is always in front of the image data
+		if marker == 0xDA || marker == 0xD9 {
+			return 0, errNoExifData
+		}
+
+		length := int64(binary.BigEndian.Uint16(segmentHeader[2:4]))
+		if marker == 0xE1 && length >= 8 {
+			identifier := make([]byte, 6)
+			_, err = io.ReadFull(f, identifier)
+			if err != nil {
+				return 0, err
+			}
+			if bytes.Equal(identifier, []byte("Exif\x00\x00")) {
+				return offset + 4 + 6, nil
+			}
+		}
+		offset += 2 + length
+	}
+}
+
+//fujifilm's RAF files contain a JPEG preview which holds the EXIF data
+func findTiffHeaderInRaf(f io.ReadSeeker) (int64, error) {
+	_, err := f.Seek(84, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	var jpegOffset uint32
+	err = binary.Read(f, binary.BigEndian, &jpegOffset)
+	if err != nil {
+		return 0, err
+	}
+	return findTiffHeaderInJpeg(f, int64(jpegOffset))
+}
+
+func findTiffHeaderInPng(f io.ReadSeeker) (int64, error) {
+	offset := int64(8)
+	for {
+		_, err := f.Seek(offset, io.SeekStart)
+		if err != nil {
+			return 0, err
+		}
+
+		chunkHeader := make([]byte, 8)
+		_, err = io.ReadFull(f, chunkHeader)
+		if err != nil {
+			return 0, errNoExifData
+		}
+
+		length := int64(binary.BigEndian.Uint32(chunkHeader[0:4]))
+		switch string(chunkHeader[4:8]) {
+		case "eXIf":
+			return offset + 8, nil
+		case "IEND":
+			return 0, errNoExifData
+		}
+		offset += 8 + length + 4 //length + type, data, crc
+	}
+}
+
+func findTiffHeaderInWebp(f io.ReadSeeker) (int64, error) {
+	offset := int64(12)
+	for {
+		_, err := f.Seek(offset, io.SeekStart)
+		if err != nil {
+			return 0, err
+		}
+
+		chunkHeader := make([]byte, 8)
+		_, err = io.ReadFull(f, chunkHeader)
+		if err != nil {
+			return 0, errNoExifData
+		}
+
+		length := int64(binary.LittleEndian.Uint32(chunkHeader[4:8]))
+		if string(chunkHeader[0:4]) == "EXIF" {
+			//some encoders prepend the JPEG APP1 identifier
+			identifier := make([]byte, 6)
+			_, err = io.ReadFull(f, identifier)
+			if err != nil {
+				return 0, err
+			}
+			if bytes.Equal(identifier, []byte("Exif\x00\x00")) {
+				return offset + 8 + 6, nil
+			}
+			return offset + 8, nil
+		}
+		offset += 8 + length + (length % 2) //chunks are padded to an even size
+	}
+}
+
+//HEIC/HEIF files store the EXIF data as a separate item. The 'iinf' box of the 'meta' box
+//tells us which item contains the EXIF data and the 'iloc' box where that item is located.
+func findTiffHeaderInHeif(f io.ReadSeeker) (int64, error) {
+	fileSize, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	var meta *isobmff.Box
+	for offset := int64(0); offset < fileSize; {
+		box, err := isobmff.ReadBox(f, offset, fileSize)
+		if err != nil {
+			return 0, err
+		}
+		if box.Type == "meta" {
+			meta = &box
+			break
+		}
+		offset = box.End
+	}
+	if meta == nil {
+		return 0, errNoExifData
+	}
+
+	exifItemId := uint64(0)
+	var iloc *isobmff.Box
+	for offset := meta.Start + 4; offset < meta.End; { //'meta' is a full box (version + flags)
+		box, err := isobmff.ReadBox(f, offset, meta.End)
+		if err != nil {
+			return 0, err
+		}
+
+		switch box.Type {
+		case "iinf":
+			exifItemId, err = findHeifExifItemId(f, box)
+			if err != nil {
+				return 0, err
+			}
+		case "iloc":
+			b := box
+			iloc = &b
+		}
+		offset = box.End
+	}
+	if exifItemId == 0 || iloc == nil {
+		return 0, errNoExifData
+	}
+
+	exifItemOffset, err := findHeifItemOffset(f, *iloc, exifItemId)
+	if err != nil {
+		return 0, err
+	}
+
+	//the item starts with the offset to the TIFF header (usually 6, to skip the "Exif\0\0" identifier)
+	_, err = f.Seek(exifItemOffset, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	tiffHeaderOffset, err := isobmff.ReadUint(f, 4)
+	if err != nil {
+		return 0, err
+	}
+	return exifItemOffset + 4 + int64(tiffHeaderOffset), nil
+}
+
+func findHeifExifItemId(f io.ReadSeeker, iinf isobmff.Box) (uint64, error) {
+	_, err := f.Seek(iinf.Start, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	version, err := isobmff.ReadUint(f, 4)
+	if err != nil {
+		return 0, err
+	}
+
+	entryCountSize := 2
+	if version >> 24 != 0 {
+		entryCountSize = 4
+	}
+	if _, err = isobmff.ReadUint(f, entryCountSize); err != nil {
+		return 0, err
+	}
+
+	for offset := iinf.Start + 4 + int64(entryCountSize); offset < iinf.End; {
+		infe, err := isobmff.ReadBox(f, offset, iinf.End)
+		if err != nil {
+			return 0, err
+		}
+		offset = infe.End
+
+		if infe.Type != "infe" {
+			continue
+		}
+
+		infeVersion, err := isobmff.ReadUint(f, 4)
+		if err != nil {
+			return 0, err
+		}
+		infeVersion = infeVersion >> 24
+		if infeVersion < 2 {
+			continue
+		}
+
+		itemIdSize := 2
+		if infeVersion == 3 {
+			itemIdSize = 4
+		}
+
+		itemId, err := isobmff.ReadUint(f, itemIdSize)
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err = isobmff.ReadUint(f, 2); err != nil { //item protection index
+			return 0, err
+		}
+
+		itemType := make([]byte, 4)
+		if _, err = io.ReadFull(f, itemType); err != nil {
+			return 0, err
+		}
+
+		if string(itemType) == "Exif" {
+			return itemId, nil
+		}
+	}
+
+	return 0, errNoExifData
+}
+
+func findHeifItemOffset(f io.ReadSeeker, iloc isobmff.Box, itemId uint64) (int64, error) {
+	_, err := f.Seek(iloc.Start, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	versionAndFlags, err := isobmff.ReadUint(f, 4)
+	if err != nil {
+		return 0, err
+	}
+	version := versionAndFlags >> 24
+
+	sizes, err := isobmff.ReadUint(f, 2)
+	if err != nil {
+		return 0, err
+	}
+	offsetSize := int(sizes >> 12 & 0xF)
+	lengthSize := int(sizes >> 8 & 0xF)
+	baseOffsetSize := int(sizes >> 4 & 0xF)
+	indexSize := 0
+	if version == 1 || version == 2 {
+		indexSize = int(sizes & 0xF)
+	}
+
+	itemCountSize := 2
+	if version == 2 {
+		itemCountSize = 4
+	}
+	itemCount, err := isobmff.ReadUint(f, itemCountSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := uint64(0); i < itemCount; i++ {
+		id, err := isobmff.ReadUint(f, itemCountSize)
+		if err != nil {
+			return 0, err
+		}
+
+		if version == 1 || version == 2 {
+			if _, err = isobmff.ReadUint(f, 2); err != nil { //construction method
+				return 0, err
+			}
+		}
+
+		if _, err = isobmff.ReadUint(f, 2); err != nil { //data reference index
+			return 0, err
+		}
+
+		baseOffset, err := isobmff.ReadUint(f, baseOffsetSize)
+		if err != nil {
+			return 0, err
+		}
+
+		extentCount, err := isobmff.ReadUint(f, 2)
+		if err != nil {
+			return 0, err
+		}
+
+		for j := uint64(0); j < extentCount; j++ {
+			if _, err = isobmff.ReadUint(f, indexSize); err != nil {
+				return 0, err
+			}
+
+			extentOffset, err := isobmff.ReadUint(f, offsetSize)
+			if err != nil {
+				return 0, err
+			}
+
+			if _, err = isobmff.ReadUint(f, lengthSize); err != nil {
+				return 0, err
+			}
+
+			if id == itemId && j == 0 {
+				return int64(baseOffset + extentOffset), nil
+			}
+		}
+	}
+
+	return 0, errNoExifData
+}
+
+//reads the date (and time zone offset) tags, the camera, the orientation and the dimensions of IFD0 and the EXIF sub IFD.
+//Numbers are returned in decimal.
+func readTiffTags(f io.ReadSeeker, tiffOffset int64) (map[uint16]string, error) {
+	tags := make(map[uint16]string)
+
+	_, err := f.Seek(tiffOffset, io.SeekStart)
+	if err != nil {
+		return tags, err
+	}
+
+	header := make([]byte, 8)
+	_, err = io.ReadFull(f, header)
+	if err != nil {
+		return tags, err
+	}
+
+	var byteOrder binary.ByteOrder
+	switch string(header[0:2]) {
+	case "II":
+		byteOrder = binary.LittleEndian
+	case "MM":
+		byteOrder = binary.BigEndian
+	default:
+		return tags, errors.New("Invalid TIFF header")
+	}
+
+	ifdOffset := int64(byteOrder.Uint32(header[4:8]))
+	exifIfdOffset, err := readIfdTags(f, byteOrder, tiffOffset, ifdOffset, tags)
+	if err != nil {
+		return tags, err
+	}
+
+	if exifIfdOffset > 0 {
+		_, err = readIfdTags(f, byteOrder, tiffOffset, exifIfdOffset, tags)
+		if err != nil {
+			return tags, err
+		}
+	}
+	return tags, nil
+}
+
+//reads the tags of the given IFD and returns the offset of the EXIF sub IFD (if any)
+func readIfdTags(f io.ReadSeeker, byteOrder binary.ByteOrder, tiffOffset int64, ifdOffset int64, tags map[uint16]string) (int64, error) {
+	_, err := f.Seek(tiffOffset + ifdOffset, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	var entryCount uint16
+	err = binary.Read(f, byteOrder, &entryCount)
+	if err != nil {
+		return 0, err
+	}
+
+	entries := make([]byte, int(entryCount) * 12)
+	_, err = io.ReadFull(f, entries)
+	if err != nil {
+		return 0, err
+	}
+
+	exifIfdOffset := int64(0)
+	for i := 0; i < int(entryCount); i++ {
+		entry := entries[i*12 : (i+1)*12]
+		tag := byteOrder.Uint16(entry[0:2])
+		count := byteOrder.Uint32(entry[4:8])
+
+		switch tag {
+		case tagExifIfdPointer:
+			exifIfdOffset = int64(byteOrder.Uint32(entry[8:12]))
+		case tagOrientation, tagPixelXDimension, tagPixelYDimension:
+			switch byteOrder.Uint16(entry[2:4]) {
+			case typeShort:
+				tags[tag] = strconv.Itoa(int(byteOrder.Uint16(entry[8:10])))
+			case typeLong:
+				tags[tag] = strconv.FormatUint(uint64(byteOrder.Uint32(entry[8:12])), 10)
+			}
+		case tagMake, tagModel, tagDateTime, tagDateTimeOriginal, tagDateTimeDigitized, tagOffsetTime, tagOffsetTimeOriginal, tagOffsetTimeDigitized:
+			if count == 0 || count > 64 {
+				continue
+			}
+
+			//values of up to 4 bytes are stored in the entry itself
+			if count <= 4 {
+				tags[tag] = string(entry[8:8+count])
+				continue
+			}
+
+			value := make([]byte, count)
+			_, err = f.Seek(tiffOffset + int64(byteOrder.Uint32(entry[8:12])), io.SeekStart)
+			if err != nil {
+				return 0, err
+			}
+			_, err = io.ReadFull(f, value)
+			if err != nil {
+				return 0, err
+			}
+			tags[tag] = string(value)
+		}
+	}
+
+	return exifIfdOffset, nil
+}
@@ -0,0 +1,338 @@
+package imagedate
+
+import (
+	"github.com/bbernhard/mindfulbytes/frontmatter"
+	"github.com/bbernhard/mindfulbytes/videodate"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//the sources a date can be extracted from. The name of the source that provided the
+//date is recorded on every entry, so that wrongly dated images can be tracked down.
+const (
+	SourceExif = "exif"
+	SourceXmp = "xmp"
+	SourceFilename = "filename"
+	SourceSidecarJson = "sidecar-json"
+	SourceMtime = "mtime"
+	//creation time of a video container (MP4, MOV, MKV)
+	SourceContainer = "container"
+	//YAML front matter of a note (Markdown)
+	SourceFrontMatter = "front-matter"
+)
+
+var DefaultStrategies = []string{SourceExif, SourceXmp, SourceSidecarJson, SourceFilename, SourceMtime}
+
+var supportedStrategies = []string{SourceExif, SourceXmp, SourceSidecarJson, SourceFilename, SourceMtime, SourceContainer, SourceFrontMatter}
+
+var ErrNoDateFound = errors.New("No date found")
+
+//matches the dates most cameras and phones put into the filename, e.g IMG_20190704_123456.jpg,
+//PXL_20210704_123456789.jpg, IMG-20190704-WA0001.jpg or 2019-07-04 12.34.56.jpg
+var defaultFilenameRegex = regexp.MustCompile(`(?:^|[^0-9])(?P<year>(?:19|20)[0-9]{2})[-_.]?(?P<month>0[1-9]|1[0-2])[-_.]?(?P<day>0[1-9]|[12][0-9]|3[01])(?:[^0-9]|$)`)
+
+//matches the creation date in a XMP file, either as attribute or as element
+var xmpDateRegex = regexp.MustCompile(`(?:exif:DateTimeOriginal|photoshop:DateCreated|xmp:CreateDate)(?:="|>)([0-9]{4}-[0-9]{2}-[0-9]{2}(?:T[0-9]{2}:[0-9]{2}(?::[0-9]{2})?(?:\.[0-9]+)?(?:Z|[+-][0-9]{2}:[0-9]{2})?)?)`)
+
+type ReadSeekCloser interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+//gives the strategies access to an image, no matter whether it's stored on the local filesystem or somewhere else
+type Image interface {
+	//path of the image, used for the filename strategy and to locate the sidecar files
+	Path() string
+	ModTime() time.Time
+	Open() (ReadSeekCloser, error)
+	//reads a file that is stored next to the image (i.e a sidecar file). Returns os.ErrNotExist in case the file doesn't exist.
+	ReadSidecar(path string) ([]byte, error)
+}
+
+type LocalImage struct {
+	path string
+	info os.FileInfo
+}
+
+func NewLocalImage(path string, info os.FileInfo) *LocalImage {
+	return &LocalImage{
+		path: path,
+		info: info,
+	}
+}
+
+func (i *LocalImage) Path() string {
+	return i.path
+}
+
+func (i *LocalImage) ModTime() time.Time {
+	return i.info.ModTime()
+}
+
+func (i *LocalImage) Open() (ReadSeekCloser, error) {
+	return os.Open(i.path)
+}
+
+func (i *LocalImage) ReadSidecar(path string) ([]byte, error) {
+	return ioutil.ReadFile(path)
+}
+
+type Result struct {
+	Time time.Time
+	Source string
+}
+
+type Extractor struct {
+	strategies []string
+	filenameRegex *regexp.Regexp
+	exifDateCache *ExifDateCache
+}
+
+func NewExtractor(strategies []string) *Extractor {
+	return &Extractor{
+		strategies: strategies,
+		filenameRegex: defaultFilenameRegex,
+	}
+}
+
+//parses a comma separated list of strategies (e.g "exif,filename,mtime"). An empty string returns the default strategies.
+func ParseStrategies(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultStrategies, nil
+	}
+
+	strategies := []string{}
+	for _, strategy := range strings.Split(s, ",") {
+		strategy = strings.TrimSpace(strategy)
+		switch strategy {
+		case SourceExif, SourceXmp, SourceFilename, SourceSidecarJson, SourceMtime, SourceContainer, SourceFrontMatter:
+			strategies = append(strategies, strategy)
+		default:
+			return strategies, errors.New("Unknown date strategy '" + strategy + "' (supported strategies: " +
+							strings.Join(supportedStrategies, ", ") + ")")
+		}
+	}
+	return strategies, nil
+}
+
+//overrides the default filename pattern. The pattern needs to contain the named groups 'year', 'month' and 'day'.
+func (e *Extractor) SetFilenamePattern(pattern string) error {
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range []string{"year", "month", "day"} {
+		if subexpIndex(r, name) < 0 {
+			return errors.New("Filename pattern doesn't contain the named group '" + name + "'")
+		}
+	}
+
+	e.filenameRegex = r
+	return nil
+}
+
+func (e *Extractor) SetExifDateCache(cache *ExifDateCache) {
+	e.exifDateCache = cache
+}
+
+//tries the strategies in order and returns the first date that was found together with its source
+func (e *Extractor) GetDate(image Image) (Result, error) {
+	for _, strategy := range e.strategies {
+		var t time.Time
+		var err error
+		switch strategy {
+		case SourceExif:
+			t, err = e.getExifDate(image)
+		case SourceXmp:
+			t, err = getXmpSidecarDate(image)
+		case SourceContainer:
+			t, err = getContainerDateOfImage(image)
+		case SourceFrontMatter:
+			t, err = getFrontMatterDate(image)
+		case SourceSidecarJson:
+			t, err = getJsonSidecarDate(image)
+		case SourceFilename:
+			t, err = getFilenameDate(path.Base(image.Path()), e.filenameRegex)
+		case SourceMtime:
+			t = image.ModTime()
+			if t.IsZero() {
+				err = ErrNoDateFound
+			}
+		}
+
+		if err == nil {
+			return Result{Time: t, Source: strategy}, nil
+		}
+	}
+	return Result{}, ErrNoDateFound
+}
+
+//looks up the EXIF date in the cache first (in case the image's version is known)
+func (e *Extractor) getExifDate(image Image) (time.Time, error) {
+	versionedImage, ok := image.(VersionedImage)
+	if e.exifDateCache == nil || !ok || versionedImage.Version() == "" {
+		return getExifDateOfImage(image)
+	}
+
+	t, err, found := e.exifDateCache.get(versionedImage.Version())
+	if found {
+		return t, err
+	}
+
+	//the details are read at the same time, so that remote images don't have to be downloaded again for them
+	details, t, err := getImageDetailsOfImage(image)
+	//only cache the results that won't change, but not e.g network errors
+	if err == nil || err == errNoExifData || err == errUnsupportedFormat {
+		e.exifDateCache.setDetails(versionedImage.Version(), details, t, err)
+	}
+	return t, err
+}
+
+func getExifDateOfImage(image Image) (time.Time, error) {
+	f, err := image.Open()
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	return getExifDate(f, strings.ToLower(path.Ext(image.Path())))
+}
+
+func getContainerDateOfImage(image Image) (time.Time, error) {
+	f, err := image.Open()
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	return videodate.GetCreationTime(f, strings.ToLower(path.Ext(image.Path())))
+}
+
+func getFrontMatterDate(image Image) (time.Time, error) {
+	f, err := image.Open()
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(f, frontmatter.MaxSize))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	frontMatter, _ := frontmatter.Parse(data)
+	return frontMatter.GetDate()
+}
+
+func getFilenameDate(filename string, r *regexp.Regexp) (time.Time, error) {
+	match := r.FindStringSubmatch(filename)
+	if match == nil {
+		return time.Time{}, ErrNoDateFound
+	}
+
+	//time.Parse also rejects invalid dates like the 31st of February
+	return time.Parse("2006-01-02", match[subexpIndex(r, "year")] + "-" + match[subexpIndex(r, "month")] + "-" + match[subexpIndex(r, "day")])
+}
+
+func subexpIndex(r *regexp.Regexp, name string) int {
+	for i, n := range r.SubexpNames() {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+//sidecar files are either named after the image (IMG_1234.CR2.xmp) or replace the image's extension (IMG_1234.xmp)
+func getSidecarCandidates(imagePath string, ext string) []string {
+	base := strings.TrimSuffix(imagePath, path.Ext(imagePath))
+	return []string{imagePath + ext, imagePath + strings.ToUpper(ext), base + ext, base + strings.ToUpper(ext)}
+}
+
+func getXmpSidecarDate(image Image) (time.Time, error) {
+	for _, candidate := range getSidecarCandidates(image.Path(), ".xmp") {
+		data, err := image.ReadSidecar(candidate)
+		if err != nil {
+			continue
+		}
+
+		t, err := parseXmpDate(data)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, ErrNoDateFound
+}
+
+func parseXmpDate(data []byte) (time.Time, error) {
+	match := xmpDateRegex.FindSubmatch(data)
+	if match == nil {
+		return time.Time{}, ErrNoDateFound
+	}
+
+	value := string(match[1])
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, ErrNoDateFound
+}
+
+//the JSON sidecar files as they are created by Google Takeout
+type jsonSidecar struct {
+	PhotoTakenTime *struct {
+		Timestamp string `json:"timestamp"`
+	} `json:"photoTakenTime"`
+	CreationTime *struct {
+		Timestamp string `json:"timestamp"`
+	} `json:"creationTime"`
+}
+
+func getJsonSidecarDate(image Image) (time.Time, error) {
+	for _, candidate := range getJsonSidecarCandidates(image.Path()) {
+		data, err := image.ReadSidecar(candidate)
+		if err != nil {
+			continue
+		}
+
+		t, err := parseJsonSidecarDate(data, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, ErrNoDateFound
+}
+
+//the timestamps are in UTC, they're converted to the given location, so that the date is the day the photo was taken
+//on (like the local wall time of the EXIF data)
+func parseJsonSidecarDate(data []byte, location *time.Location) (time.Time, error) {
+	var sidecar jsonSidecar
+	err := json.Unmarshal(data, &sidecar)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	timestamp := ""
+	if sidecar.PhotoTakenTime != nil {
+		timestamp = sidecar.PhotoTakenTime.Timestamp
+	} else if sidecar.CreationTime != nil {
+		timestamp = sidecar.CreationTime.Timestamp
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}, ErrNoDateFound
+	}
+	return time.Unix(seconds, 0).In(location), nil
+}
@@ -0,0 +1,430 @@
+package imagedate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error, expected not nil, but got nil: \033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+type testImage struct {
+	path string
+	modTime time.Time
+	data []byte
+	sidecars map[string][]byte
+}
+
+func (i *testImage) Path() string {
+	return i.path
+}
+
+func (i *testImage) ModTime() time.Time {
+	return i.modTime
+}
+
+func (i *testImage) Open() (ReadSeekCloser, error) {
+	return nopCloser{bytes.NewReader(i.data)}, nil
+}
+
+func (i *testImage) ReadSidecar(path string) ([]byte, error) {
+	data, ok := i.sidecars[path]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return data, nil
+}
+
+type versionedTestImage struct {
+	testImage
+	version string
+	opened int
+}
+
+func (i *versionedTestImage) Version() string {
+	return i.version
+}
+
+func (i *versionedTestImage) Open() (ReadSeekCloser, error) {
+	i.opened += 1
+	return i.testImage.Open()
+}
+
+//builds a minimal JPEG with DateTimeOriginal and OffsetTimeOriginal in the EXIF sub IFD
+func buildJpegWithExif(dateTimeOriginal string, offsetTimeOriginal string) []byte {
+	le := binary.LittleEndian
+	tiff := []byte("II*\x00")
+	tiff = append(tiff, 8, 0, 0, 0)
+
+	//IFD0 with the pointer to the EXIF sub IFD at offset 26
+	ifd0 := make([]byte, 18)
+	le.PutUint16(ifd0[0:], 1)
+	le.PutUint16(ifd0[2:], tagExifIfdPointer)
+	le.PutUint16(ifd0[4:], 4)
+	le.PutUint32(ifd0[6:], 1)
+	le.PutUint32(ifd0[10:], 26)
+	tiff = append(tiff, ifd0...)
+
+	//EXIF sub IFD with two entries, the values start at offset 26 + 2 + 2*12 + 4 = 56
+	exifIfd := make([]byte, 30)
+	le.PutUint16(exifIfd[0:], 2)
+	le.PutUint16(exifIfd[2:], tagDateTimeOriginal)
+	le.PutUint16(exifIfd[4:], 2)
+	le.PutUint32(exifIfd[6:], 20)
+	le.PutUint32(exifIfd[10:], 56)
+	le.PutUint16(exifIfd[14:], tagOffsetTimeOriginal)
+	le.PutUint16(exifIfd[16:], 2)
+	le.PutUint32(exifIfd[18:], 7)
+	le.PutUint32(exifIfd[22:], 76)
+	tiff = append(tiff, exifIfd...)
+	tiff = append(tiff, []byte(dateTimeOriginal + "\x00")...)
+	tiff = append(tiff, []byte(offsetTimeOriginal + "\x00")...)
+
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xE1, byte((len(app1) + 2) >> 8), byte(len(app1) + 2)}
+	jpeg = append(jpeg, app1...)
+	return append(jpeg, 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9)
+}
+
+func TestGetExifDateWithOffset(t *testing.T) {
+	data := buildJpegWithExif("2019:07:04 23:30:00", "+02:00")
+	d, err := getExifDate(bytes.NewReader(data), ".jpg")
+	ok(t, err)
+	equals(t, "2019-07-04T23:30:00+02:00", d.Format(time.RFC3339))
+}
+
+func TestGetExifDateOfImageWithoutExif(t *testing.T) {
+	_, err := getExifDate(bytes.NewReader([]byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9}), ".jpg")
+	notOk(t, err)
+}
+
+func TestGetFilenameDate(t *testing.T) {
+	for filename, expected := range map[string]string{"IMG_20190704_123456.jpg": "2019-07-04", "PXL_20210131_101010123.jpg": "2021-01-31",
+		"IMG-20200215-WA0001.jpeg": "2020-02-15", "2018-12-24 18.00.00.jpg": "2018-12-24"} {
+		d, err := getFilenameDate(filename, defaultFilenameRegex)
+		ok(t, err)
+		equals(t, expected, d.Format("2006-01-02"))
+	}
+
+	_, err := getFilenameDate("IMG_20190231_123456.jpg", defaultFilenameRegex)
+	notOk(t, err)
+
+	_, err = getFilenameDate("DSC01234.jpg", defaultFilenameRegex)
+	notOk(t, err)
+}
+
+func TestParseStrategies(t *testing.T) {
+	strategies, err := ParseStrategies("exif, filename,mtime")
+	ok(t, err)
+	equals(t, []string{SourceExif, SourceFilename, SourceMtime}, strategies)
+
+	_, err = ParseStrategies("exif,foo")
+	notOk(t, err)
+}
+
+func TestExtractorRecordsSource(t *testing.T) {
+	image := &testImage{path: "/photos/IMG_20190704_123456.jpg", modTime: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		data: []byte{0xFF, 0xD8, 0xFF, 0xD9},
+		sidecars: map[string][]byte{"/photos/IMG_20190704_123456.jpg.json": []byte(`{"photoTakenTime": {"timestamp": "1341568800"}}`)}}
+
+	result, err := NewExtractor(DefaultStrategies).GetDate(image)
+	ok(t, err)
+	equals(t, SourceSidecarJson, result.Source)
+	equals(t, "2012-07-06", result.Time.Format("2006-01-02"))
+
+	result, err = NewExtractor([]string{SourceExif, SourceXmp, SourceFilename, SourceMtime}).GetDate(image)
+	ok(t, err)
+	equals(t, SourceFilename, result.Source)
+
+	result, err = NewExtractor([]string{SourceExif, SourceMtime}).GetDate(image)
+	ok(t, err)
+	equals(t, SourceMtime, result.Source)
+}
+
+func TestParseXmpDate(t *testing.T) {
+	d, err := parseXmpDate([]byte(`<rdf:Description exif:DateTimeOriginal="2012-05-06T10:00:00+01:00"/>`))
+	ok(t, err)
+	equals(t, "2012-05-06", d.Format("2006-01-02"))
+
+	d, err = parseXmpDate([]byte(`<xmp:CreateDate>2010-01-02</xmp:CreateDate>`))
+	ok(t, err)
+	equals(t, "2010-01-02", d.Format("2006-01-02"))
+}
+
+func TestSetFilenamePattern(t *testing.T) {
+	extractor := NewExtractor([]string{SourceFilename})
+	notOk(t, extractor.SetFilenamePattern(`(?P<year>\d{4})`))
+	ok(t, extractor.SetFilenamePattern(`^(?P<day>\d{2})\.(?P<month>\d{2})\.(?P<year>\d{4})`))
+
+	result, err := extractor.GetDate(&testImage{path: "/photos/24.12.2018 Christmas.jpg"})
+	ok(t, err)
+	equals(t, "2018-12-24", result.Time.Format("2006-01-02"))
+}
+
+func TestRangeReaderReadsExifDate(t *testing.T) {
+	//the image data is followed by a lot of padding, which shouldn't be downloaded
+	data := append(buildJpegWithExif("2019:07:04 23:30:00", ""), make([]byte, 1024*1024)...)
+	requests := 0
+	//stand-in for a WebDAV server, which supports range requests
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests += 1
+		equals(t, "Bearer secret", r.Header.Get("Authorization"))
+		http.ServeContent(w, r, "image.jpg", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	reader := NewRangeReader(server.Client(), server.URL+"/image.jpg", int64(len(data)), func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer secret")
+	})
+	d, err := getExifDate(reader, ".jpg")
+	ok(t, err)
+	equals(t, "2019-07-04 23:30:00", d.Format("2006-01-02 15:04:05"))
+	equals(t, 1, requests)
+	equals(t, 1, reader.Requests())
+}
+
+func TestRangeReaderWithoutRangeSupport(t *testing.T) {
+	data := buildJpegWithExif("2019:07:04 23:30:00", "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	reader := NewRangeReader(server.Client(), server.URL+"/image.jpg", int64(len(data)), nil)
+	d, err := getExifDate(reader, ".jpg")
+	ok(t, err)
+	equals(t, "2019-07-04", d.Format("2006-01-02"))
+	equals(t, 1, reader.Requests())
+}
+
+func TestExifDateCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imagedate")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	cachePath := filepath.Join(dir, "exif-dates.json")
+
+	withExif := &versionedTestImage{testImage: testImage{path: "/a.jpg", data: buildJpegWithExif("2019:07:04 23:30:00", "")}, version: "etag-a"}
+	withoutExif := &versionedTestImage{testImage: testImage{path: "/b.jpg", modTime: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		data: []byte{0xFF, 0xD8, 0xFF, 0xD9}}, version: "etag-b"}
+
+	for i := 0; i < 2; i++ {
+		cache, err := LoadExifDateCache(cachePath)
+		ok(t, err)
+		extractor := NewExtractor([]string{SourceExif, SourceMtime})
+		extractor.SetExifDateCache(cache)
+
+		result, err := extractor.GetDate(withExif)
+		ok(t, err)
+		equals(t, Result{Time: time.Date(2019, 7, 4, 23, 30, 0, 0, time.UTC), Source: SourceExif}, result)
+
+		result, err = extractor.GetDate(withoutExif)
+		ok(t, err)
+		equals(t, SourceMtime, result.Source)
+		ok(t, cache.Save())
+	}
+	//the second crawl was served from the cache
+	equals(t, 1, withExif.opened)
+	equals(t, 1, withoutExif.opened)
+
+	//entries which weren't used during a crawl are dropped
+	cache, err := LoadExifDateCache(cachePath)
+	ok(t, err)
+	_, _, found := cache.get("etag-a")
+	equals(t, true, found)
+	ok(t, cache.Save())
+	cache, err = LoadExifDateCache(cachePath)
+	ok(t, err)
+	_, _, found = cache.get("etag-b")
+	equals(t, false, found)
+}
+
+func TestExtractorWithFrontMatter(t *testing.T) {
+	note := &testImage{path: "/notes/2020-05-01.md", data: []byte("---\ndate: 2019-07-04\n---\nText")}
+	result, err := NewExtractor([]string{SourceFrontMatter, SourceFilename}).GetDate(note)
+	ok(t, err)
+	equals(t, SourceFrontMatter, result.Source)
+	equals(t, "2019-07-04", result.Time.Format("2006-01-02"))
+
+	note.data = []byte("Text without front matter")
+	result, err = NewExtractor([]string{SourceFrontMatter, SourceFilename}).GetDate(note)
+	ok(t, err)
+	equals(t, SourceFilename, result.Source)
+	equals(t, "2020-05-01", result.Time.Format("2006-01-02"))
+}
+
+func TestGetJsonSidecarCandidates(t *testing.T) {
+	candidates := getJsonSidecarCandidates("/takeout/IMG_1234(1).jpg")
+	equals(t, true, contains(candidates, "/takeout/IMG_1234.jpg(1).json"))
+	equals(t, true, contains(candidates, "/takeout/IMG_1234.jpg.supplemental-metadata(1).json"))
+
+	candidates = getJsonSidecarCandidates("/takeout/IMG_1234-edited.jpg")
+	equals(t, true, contains(candidates, "/takeout/IMG_1234.jpg.json"))
+
+	//the names are cut to 46 characters
+	candidates = getJsonSidecarCandidates("/takeout/PXL_20210704_123456789.PORTRAIT.ORIGINAL_EXPORT.jpg")
+	equals(t, true, contains(candidates, "/takeout/PXL_20210704_123456789.PORTRAIT.ORIGINAL_EXPOR.json"))
+	candidates = getJsonSidecarCandidates("/takeout/IMG_20190704_123456_HDR.jpg")
+	equals(t, true, contains(candidates, "/takeout/IMG_20190704_123456_HDR.jpg.supplemental-metad.json"))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestParseJsonSidecarDateNearMidnight(t *testing.T) {
+	//2019-07-04 03:30 UTC, taken in the evening of the day before west of UTC
+	data := []byte(`{"photoTakenTime": {"timestamp": "1562211000"}, "creationTime": {"timestamp": "1600000000"}}`)
+	date, err := parseJsonSidecarDate(data, time.FixedZone("UTC-7", -7 * 60 * 60))
+	ok(t, err)
+	equals(t, "2019-07-03 20:30", date.Format("2006-01-02 15:04"))
+
+	//2019-07-03 22:30 UTC, taken in the morning of the next day east of UTC
+	data = []byte(`{"photoTakenTime": {"timestamp": "1562193000"}}`)
+	date, err = parseJsonSidecarDate(data, time.FixedZone("UTC+9", 9 * 60 * 60))
+	ok(t, err)
+	equals(t, "2019-07-04 07:30", date.Format("2006-01-02 15:04"))
+
+	//the creation time is the time of the upload, it's only used without the time the photo was taken
+	date, err = parseJsonSidecarDate([]byte(`{"creationTime": {"timestamp": "1562193000"}}`), time.UTC)
+	ok(t, err)
+	equals(t, "2019-07-03 22:30", date.Format("2006-01-02 15:04"))
+
+	_, err = parseJsonSidecarDate([]byte(`{"photoTakenTime": {"timestamp": "0"}}`), time.UTC)
+	equals(t, ErrNoDateFound, err)
+}
+
+func TestGetSidecarDetails(t *testing.T) {
+	takeout := []byte(`{"title": "IMG_1234.jpg", "description": "Sunset at the lake ",
+		"photoTakenTime": {"timestamp": "1562243696"},
+		"geoData": {"latitude": 0.0, "longitude": 0.0, "altitude": 0.0},
+		"geoDataExif": {"latitude": 47.5, "longitude": -13.25, "altitude": 510.0}}`)
+	image := &testImage{path: "/takeout/IMG_1234(1).jpg", sidecars: map[string][]byte{"/takeout/IMG_1234.jpg.supplemental-metadata(1).json": takeout}}
+	details := GetSidecarDetails(image)
+	equals(t, Details{Description: "Sunset at the lake", Latitude: 47.5, Longitude: -13.25, HasLocation: true}, details)
+	equals(t, map[string]string{"description": "Sunset at the lake", "latitude": "47.500000", "longitude": "-13.250000"}, details.Metadata())
+
+	//the date is read from the same sidecar
+	result, err := NewExtractor([]string{SourceSidecarJson}).GetDate(image)
+	ok(t, err)
+	equals(t, int64(1562243696), result.Time.Unix())
+
+	xmp := []byte(`<rdf:Description exif:GPSLatitude="48,12.6N" exif:GPSLongitude="16,22,30E">
+		<dc:description><rdf:Alt><rdf:li xml:lang="x-default">Fish &amp; Chips</rdf:li></rdf:Alt></dc:description>
+		<dc:subject><rdf:Bag><rdf:li>food</rdf:li><rdf:li>London, UK</rdf:li></rdf:Bag></dc:subject>
+		</rdf:Description>`)
+	image = &testImage{path: "/photos/IMG_1.CR2", sidecars: map[string][]byte{"/photos/IMG_1.xmp": xmp}}
+	details = GetSidecarDetails(image)
+	equals(t, "Fish & Chips", details.Description)
+	equals(t, 48.21, details.Latitude)
+	equals(t, 16.375, details.Longitude)
+	equals(t, []string{"food", "London  UK"}, details.Tags)
+	equals(t, "food,London  UK", details.Metadata()["tags"])
+
+	//the JSON sidecar is preferred, the XMP sidecar fills the gaps
+	image = &testImage{path: "/photos/IMG_1.CR2", sidecars: map[string][]byte{"/photos/IMG_1.xmp": xmp,
+						"/photos/IMG_1.CR2.json": []byte(`{"description": "", "geoData": {"latitude": 1.5, "longitude": 2.5}}`)}}
+	details = GetSidecarDetails(image)
+	equals(t, Details{Description: "Fish & Chips", Latitude: 1.5, Longitude: 2.5, HasLocation: true, Tags: []string{"food", "London  UK"}}, details)
+
+	xmp = []byte(`<exif:GPSLatitude>33,51.5S</exif:GPSLatitude><exif:GPSLongitude>151,12.6W</exif:GPSLongitude>`)
+	details = parseXmpDetails(xmp)
+	equals(t, -33.858333, math.Round(details.Latitude * 1e6) / 1e6)
+	equals(t, -151.21, details.Longitude)
+
+	equals(t, Details{}, GetSidecarDetails(&testImage{path: "/photos/IMG_2.jpg"}))
+	equals(t, map[string]string{}, Details{}.Metadata())
+}
+
+func TestGetImageDetailsFromTags(t *testing.T) {
+	tags := map[uint16]string{tagMake: "Canon\x00", tagModel: "Canon EOS 5D", tagOrientation: "6", tagPixelXDimension: "4368",
+								tagPixelYDimension: "2912", tagDateTimeDigitized: "2019:07:04 23:30:00"}
+	details := getImageDetailsFromTags(tags)
+	equals(t, ImageDetails{Camera: "Canon EOS 5D", Orientation: 6, Width: 4368, Height: 2912, DateField: "DateTimeDigitized"}, details)
+	equals(t, map[string]string{"camera": "Canon EOS 5D", "orientation": "6", "width": "4368", "height": "2912", "datefield": "DateTimeDigitized"},
+			details.Metadata())
+
+	details = getImageDetailsFromTags(map[uint16]string{tagMake: "Google", tagModel: "Pixel 4a", tagOrientation: "9"})
+	equals(t, ImageDetails{Camera: "Google Pixel 4a"}, details)
+	equals(t, map[string]string{}, ImageDetails{}.Metadata())
+}
+
+func TestGetImageDetails(t *testing.T) {
+	details, d, err := getImageDetails(bytes.NewReader(buildJpegWithExif("2019:07:04 23:30:00", "")), ".jpg")
+	ok(t, err)
+	equals(t, ImageDetails{DateField: "DateTimeOriginal"}, details)
+	equals(t, time.Date(2019, 7, 4, 23, 30, 0, 0, time.UTC), d)
+
+	//the dimensions are taken from the header of images without EXIF data
+	var buffer bytes.Buffer
+	ok(t, png.Encode(&buffer, image.NewGray(image.Rect(0, 0, 40, 30))))
+	details, _, err = getImageDetails(bytes.NewReader(buffer.Bytes()), ".png")
+	notOk(t, err)
+	equals(t, ImageDetails{Width: 40, Height: 30}, details)
+
+	//the details are cached together with the EXIF date
+	dir, err := ioutil.TempDir("", "imagedate")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	cache, err := LoadExifDateCache(filepath.Join(dir, "exif-dates.json"))
+	ok(t, err)
+	extractor := NewExtractor([]string{SourceExif})
+	extractor.SetExifDateCache(cache)
+
+	withExif := &versionedTestImage{testImage: testImage{path: "/a.jpg", data: buildJpegWithExif("2019:07:04 23:30:00", "")}, version: "etag-a"}
+	equals(t, ImageDetails{DateField: "DateTimeOriginal"}, extractor.GetDetails(withExif))
+	equals(t, ImageDetails{DateField: "DateTimeOriginal"}, extractor.GetDetails(withExif))
+	result, err := extractor.GetDate(withExif)
+	ok(t, err)
+	equals(t, time.Date(2019, 7, 4, 23, 30, 0, 0, time.UTC), result.Time)
+	equals(t, 1, withExif.opened)
+}
@@ -0,0 +1,143 @@
+package imagedate
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+const rangeReaderBlockSize = 64 * 1024
+
+//reading the EXIF data usually only needs the first block, but some formats (e.g HEIC) store
+//it further back in the file. Give up after that many requests.
+const rangeReaderMaxRequests = 8
+
+//io.ReadSeeker on top of HTTP range requests, e.g to read the EXIF data of an image that's stored
+//on a WebDAV server without downloading the whole image. The file is read in blocks, so that the
+//small reads of the EXIF parser only result in a few requests.
+type RangeReader struct {
+	httpClient *http.Client
+	url string
+	size int64
+	prepareRequest func(req *http.Request)
+	offset int64
+	blocks map[int64][]byte
+	requests int
+	//in case the server doesn't support range requests, the whole file is kept in memory
+	content []byte
+}
+
+func NewRangeReader(httpClient *http.Client, url string, size int64, prepareRequest func(req *http.Request)) *RangeReader {
+	return &RangeReader{
+		httpClient: httpClient,
+		url: url,
+		size: size,
+		prepareRequest: prepareRequest,
+		blocks: make(map[int64][]byte),
+	}
+}
+
+func (r *RangeReader) Requests() int {
+	return r.requests
+}
+
+func (r *RangeReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return r.offset, errors.New("Invalid whence")
+	}
+
+	if offset < 0 {
+		return r.offset, errors.New("Negative offset")
+	}
+	r.offset = offset
+	return r.offset, nil
+}
+
+func (r *RangeReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.content != nil {
+		n := copy(p, r.content[r.offset:])
+		r.offset += int64(n)
+		return n, nil
+	}
+
+	blockStart := r.offset - (r.offset % rangeReaderBlockSize)
+	block, ok := r.blocks[blockStart]
+	if !ok {
+		var err error
+		block, err = r.fetchBlock(blockStart)
+		if err != nil {
+			return 0, err
+		}
+
+		//the server ignored the range header and sent the whole file
+		if r.content != nil {
+			return r.Read(p)
+		}
+		r.blocks[blockStart] = block
+	}
+
+	n := copy(p, block[r.offset-blockStart:])
+	if n == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	r.offset += int64(n)
+	return n, nil
+}
+
+func (r *RangeReader) fetchBlock(start int64) ([]byte, error) {
+	if r.requests >= rangeReaderMaxRequests {
+		return nil, errors.New("Too many range requests for " + r.url)
+	}
+	r.requests += 1
+
+	end := start + rangeReaderBlockSize - 1
+	if end >= r.size {
+		end = r.size - 1
+	}
+
+	req, err := http.NewRequest("GET", r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes=" + strconv.FormatInt(start, 10) + "-" + strconv.FormatInt(end, 10))
+	if r.prepareRequest != nil {
+		r.prepareRequest(req)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return ioutil.ReadAll(io.LimitReader(resp.Body, end - start + 1))
+	case http.StatusOK:
+		r.content, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		r.size = int64(len(r.content))
+		return nil, nil
+	}
+	return nil, errors.New("Couldn't read " + r.url + ": " + resp.Status)
+}
+
+func (r *RangeReader) Close() error {
+	r.blocks = nil
+	r.content = nil
+	return nil
+}
@@ -0,0 +1,204 @@
+package imagedate
+
+import (
+	"github.com/bbernhard/mindfulbytes/entrymeta"
+	"encoding/json"
+	"html"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//Google Takeout cuts the names of the sidecar files (without '.json') to this number of characters
+const maxTakeoutSidecarName = 46
+
+//duplicates are numbered by Google Photos, e.g IMG_1234(1).jpg
+var duplicateRegex = regexp.MustCompile(`^(.*)(\([0-9]+\))$`)
+
+//the description of an image in a XMP file (a language alternative, the first language is used)
+var xmpDescriptionRegex = regexp.MustCompile(`(?s)<dc:description>.*?<rdf:li[^>]*>(.*?)</rdf:li>`)
+
+//the keywords of an image in a XMP file (a bag of items)
+var xmpSubjectRegex = regexp.MustCompile(`(?s)<dc:subject>(.*?)</dc:subject>`)
+var xmpItemRegex = regexp.MustCompile(`(?s)<rdf:li[^>]*>(.*?)</rdf:li>`)
+
+//GPS coordinates in a XMP file, e.g exif:GPSLatitude="48,12.345N" or <exif:GPSLongitude>16,22,30.5E</exif:GPSLongitude>
+var xmpLatitudeRegex = regexp.MustCompile(`exif:GPSLatitude(?:="|>)([0-9]+),([0-9.]+)(?:,([0-9.]+))?([NS])`)
+var xmpLongitudeRegex = regexp.MustCompile(`exif:GPSLongitude(?:="|>)([0-9]+),([0-9.]+)(?:,([0-9.]+))?([EW])`)
+
+//details of an image that are stored in its sidecar files
+type Details struct {
+	Description string
+	Latitude float64
+	Longitude float64
+	HasLocation bool
+	Tags []string
+}
+
+//the details as metadata of an entry, only the details that are known are added
+func (d Details) Metadata() map[string]string {
+	metadata := map[string]string{}
+	if d.Description != "" {
+		metadata[entrymeta.Description] = d.Description
+	}
+	if d.HasLocation {
+		metadata[entrymeta.Latitude] = strconv.FormatFloat(d.Latitude, 'f', 6, 64)
+		metadata[entrymeta.Longitude] = strconv.FormatFloat(d.Longitude, 'f', 6, 64)
+	}
+	if len(d.Tags) > 0 {
+		metadata[entrymeta.Tags] = strings.Join(d.Tags, ",")
+	}
+	return metadata
+}
+
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) > max {
+		return string(runes[:max])
+	}
+	return s
+}
+
+//besides the usual names, Google Takeout names the sidecar files after the original image (IMG_1234-edited.jpg -> IMG_1234.jpg.json),
+//moves the number of duplicates to the end (IMG_1234(1).jpg -> IMG_1234.jpg(1).json), adds '.supplemental-metadata' (newer
+//exports) and cuts long names
+func getJsonSidecarCandidates(imagePath string) []string {
+	dir, name := path.Split(imagePath)
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	counter := ""
+	if match := duplicateRegex.FindStringSubmatch(base); match != nil {
+		base, counter = match[1], match[2]
+	}
+	original := strings.TrimSuffix(base, "-edited") + ext
+
+	candidates := getSidecarCandidates(imagePath, ".json")
+	seen := make(map[string]bool)
+	for _, candidate := range candidates {
+		seen[candidate] = true
+	}
+	for _, suffix := range []string{"", ".supplemental-metadata"} {
+		candidate := dir + truncateRunes(original + suffix, maxTakeoutSidecarName) + counter + ".json"
+		if !seen[candidate] {
+			seen[candidate] = true
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+type jsonSidecarGeoData struct {
+	Latitude float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+//the details in a JSON sidecar created by Google Takeout. The location is either the one set in Google Photos (geoData)
+//or the one from the EXIF data (geoDataExif), a location of 0,0 means there is none.
+func parseJsonSidecarDetails(data []byte) (Details, error) {
+	var sidecar struct {
+		Description string `json:"description"`
+		GeoData *jsonSidecarGeoData `json:"geoData"`
+		GeoDataExif *jsonSidecarGeoData `json:"geoDataExif"`
+	}
+	err := json.Unmarshal(data, &sidecar)
+	if err != nil {
+		return Details{}, err
+	}
+
+	details := Details{Description: strings.TrimSpace(sidecar.Description)}
+	for _, geoData := range []*jsonSidecarGeoData{sidecar.GeoData, sidecar.GeoDataExif} {
+		if geoData != nil && (geoData.Latitude != 0 || geoData.Longitude != 0) {
+			details.Latitude, details.Longitude, details.HasLocation = geoData.Latitude, geoData.Longitude, true
+			break
+		}
+	}
+	return details, nil
+}
+
+//converts a XMP GPS coordinate (degrees, minutes with fraction or minutes and seconds, direction) to decimal degrees
+func parseXmpCoordinate(match [][]byte) (float64, bool) {
+	degrees, err := strconv.ParseFloat(string(match[1]), 64)
+	if err != nil {
+		return 0, false
+	}
+	minutes, err := strconv.ParseFloat(string(match[2]), 64)
+	if err != nil {
+		return 0, false
+	}
+	seconds := 0.0
+	if len(match[3]) > 0 {
+		seconds, err = strconv.ParseFloat(string(match[3]), 64)
+		if err != nil {
+			return 0, false
+		}
+	}
+
+	value := degrees + minutes / 60 + seconds / 3600
+	if string(match[4]) == "S" || string(match[4]) == "W" {
+		value = -value
+	}
+	return value, true
+}
+
+func parseXmpDetails(data []byte) Details {
+	details := Details{}
+	if match := xmpDescriptionRegex.FindSubmatch(data); match != nil {
+		details.Description = strings.TrimSpace(html.UnescapeString(string(match[1])))
+	}
+
+	if match := xmpSubjectRegex.FindSubmatch(data); match != nil {
+		for _, item := range xmpItemRegex.FindAllSubmatch(match[1], -1) {
+			//commas separate the tags in the metadata
+			tag := strings.TrimSpace(strings.Replace(html.UnescapeString(string(item[1])), ",", " ", -1))
+			if tag != "" {
+				details.Tags = append(details.Tags, tag)
+			}
+		}
+	}
+
+	latitudeMatch := xmpLatitudeRegex.FindSubmatch(data)
+	longitudeMatch := xmpLongitudeRegex.FindSubmatch(data)
+	if latitudeMatch != nil && longitudeMatch != nil {
+		latitude, latitudeOk := parseXmpCoordinate(latitudeMatch)
+		longitude, longitudeOk := parseXmpCoordinate(longitudeMatch)
+		if latitudeOk && longitudeOk {
+			details.Latitude, details.Longitude, details.HasLocation = latitude, longitude, true
+		}
+	}
+	return details
+}
+
+//reads the description, the location and the tags of an image from its sidecar files. The JSON sidecar (Google Takeout) is
+//preferred, details that it doesn't contain are taken from the XMP sidecar.
+func GetSidecarDetails(image Image) Details {
+	details := Details{}
+	for _, candidate := range getJsonSidecarCandidates(image.Path()) {
+		data, err := image.ReadSidecar(candidate)
+		if err != nil {
+			continue
+		}
+		if details, err = parseJsonSidecarDetails(data); err == nil {
+			break
+		}
+	}
+
+	//Google Takeout doesn't export the tags, so the XMP sidecar is always read
+	for _, candidate := range getSidecarCandidates(image.Path(), ".xmp") {
+		data, err := image.ReadSidecar(candidate)
+		if err != nil {
+			continue
+		}
+
+		xmpDetails := parseXmpDetails(data)
+		if details.Description == "" {
+			details.Description = xmpDetails.Description
+		}
+		if !details.HasLocation {
+			details.Latitude, details.Longitude, details.HasLocation = xmpDetails.Latitude, xmpDetails.Longitude, xmpDetails.HasLocation
+		}
+		details.Tags = xmpDetails.Tags
+		break
+	}
+	return details
+}
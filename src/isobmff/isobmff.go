@@ -0,0 +1,69 @@
+package isobmff
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+//a box of an ISO base media file (MP4, MOV, HEIF,...)
+type Box struct {
+	Type string
+	Start int64 //start of the box' payload
+	End int64
+}
+
+//reads the header of the box at the given offset, the box must end before the limit (i.e the end of its parent)
+func ReadBox(f io.ReadSeeker, offset int64, limit int64) (Box, error) {
+	_, err := f.Seek(offset, io.SeekStart)
+	if err != nil {
+		return Box{}, err
+	}
+
+	header := make([]byte, 8)
+	_, err = io.ReadFull(f, header)
+	if err != nil {
+		return Box{}, err
+	}
+
+	box := Box{Type: string(header[4:8]), Start: offset + 8}
+	size := int64(binary.BigEndian.Uint32(header[0:4]))
+	switch size {
+	case 0: //box extends to the end of the parent
+		box.End = limit
+	case 1: //64 bit size
+		var largeSize uint64
+		err = binary.Read(f, binary.BigEndian, &largeSize)
+		if err != nil {
+			return box, err
+		}
+		box.Start += 8
+		box.End = offset + int64(largeSize)
+	default:
+		box.End = offset + size
+	}
+
+	if box.End <= offset || box.End > limit {
+		return box, errors.New("Invalid box size")
+	}
+	return box, nil
+}
+
+//reads a big endian unsigned integer of the given size (in bytes)
+func ReadUint(f io.Reader, size int) (uint64, error) {
+	if size == 0 {
+		return 0, nil
+	}
+
+	buf := make([]byte, size)
+	_, err := io.ReadFull(f, buf)
+	if err != nil {
+		return 0, err
+	}
+
+	var value uint64
+	for _, b := range buf {
+		value = value << 8 | uint64(b)
+	}
+	return value, nil
+}
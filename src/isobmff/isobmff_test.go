@@ -0,0 +1,77 @@
+package isobmff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error, expected not nil, but got nil: \033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+func TestReadBox(t *testing.T) {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data, 20)
+	copy(data[4:], "moov")
+	data = append(data, make([]byte, 12)...)
+
+	box, err := ReadBox(bytes.NewReader(data), 0, int64(len(data)))
+	ok(t, err)
+	equals(t, Box{Type: "moov", Start: 8, End: 20}, box)
+
+	//a size of 0 means that the box extends to the end of its parent
+	binary.BigEndian.PutUint32(data, 0)
+	box, err = ReadBox(bytes.NewReader(data), 0, int64(len(data)))
+	ok(t, err)
+	equals(t, Box{Type: "moov", Start: 8, End: 20}, box)
+
+	//64 bit size after the type
+	binary.BigEndian.PutUint32(data, 1)
+	binary.BigEndian.PutUint64(data[8:], 20)
+	box, err = ReadBox(bytes.NewReader(data), 0, int64(len(data)))
+	ok(t, err)
+	equals(t, Box{Type: "moov", Start: 16, End: 20}, box)
+
+	//the box must not be larger than its parent
+	binary.BigEndian.PutUint32(data, 100)
+	_, err = ReadBox(bytes.NewReader(data), 0, int64(len(data)))
+	notOk(t, err)
+}
+
+func TestReadUint(t *testing.T) {
+	value, err := ReadUint(bytes.NewReader([]byte{0x01, 0x02, 0x03}), 3)
+	ok(t, err)
+	equals(t, uint64(0x010203), value)
+
+	value, err = ReadUint(bytes.NewReader(nil), 0)
+	ok(t, err)
+	equals(t, uint64(0), value)
+}
@@ -0,0 +1,235 @@
+package mailarchive
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//a mail folder, either a mbox file or a Maildir directory (with 'cur' and 'new' subdirectories)
+type Folder struct {
+	Name string
+	Path string
+	Maildir bool
+}
+
+//where a message is stored. Messages in a Maildir are stored in a file of their own (Offset and Length are 0).
+type Location struct {
+	Path string `json:"path"`
+	Offset int64 `json:"offset,omitempty"`
+	Length int64 `json:"length,omitempty"`
+}
+
+//messages of a mbox file are read into memory, their length is taken from the location and therefore limited
+const maxMessageSize = 128 * 1024 * 1024
+
+var ErrMessageTooLarge = errors.New("Message too large")
+
+func isMaildir(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, "cur"))
+	return err == nil && info.IsDir()
+}
+
+//mbox files start with a "From " line, that's how they are told apart from other files (e.g Thunderbird's .msf index files)
+func isMbox(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	start := make([]byte, 5)
+	_, err = io.ReadFull(f, start)
+	return err == nil && string(start) == "From "
+}
+
+//returns the folders below the given path, which is either a mbox file, a Maildir (with its Maildir++ subfolders
+//like '.Sent') or a directory that contains mbox files or Maildirs (e.g a Thunderbird profile)
+func FindFolders(root string) ([]Folder, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return []Folder{}, err
+	}
+
+	if !info.IsDir() {
+		if !isMbox(root) {
+			return []Folder{}, errors.New(root + " is neither a mbox file nor a Maildir")
+		}
+		return []Folder{Folder{Name: filepath.Base(root), Path: root}}, nil
+	}
+
+	folders := []Folder{}
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(strings.TrimPrefix(path, root), string(filepath.Separator))
+		if info.IsDir() {
+			base := filepath.Base(path)
+			if base == "cur" || base == "new" || base == "tmp" {
+				return filepath.SkipDir
+			}
+			if isMaildir(path) {
+				if name == "" {
+					name = "INBOX"
+				}
+				//Maildir++ subfolders are named '.Sent' or '.Archive.2019'
+				components := strings.Split(filepath.ToSlash(name), "/")
+				for i := range components {
+					components[i] = strings.TrimPrefix(components[i], ".")
+				}
+				folders = append(folders, Folder{Name: strings.Join(components, "/"), Path: path, Maildir: true})
+			}
+			return nil
+		}
+
+		if isMbox(path) {
+			folders = append(folders, Folder{Name: name, Path: path})
+		}
+		return nil
+	})
+
+	sort.Slice(folders, func(i, j int) bool {
+		return folders[i].Name < folders[j].Name
+	})
+	return folders, err
+}
+
+//calls the handler for every message of the folder
+func (f Folder) Walk(handler func(location Location, data []byte) error) error {
+	if f.Maildir {
+		return walkMaildir(f.Path, handler)
+	}
+	return walkMbox(f.Path, handler)
+}
+
+func walkMaildir(dir string, handler func(location Location, data []byte) error) error {
+	for _, subdir := range []string{"cur", "new"} {
+		files, err := ioutil.ReadDir(filepath.Join(dir, subdir))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+
+		for _, file := range files {
+			if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+				continue
+			}
+
+			path := filepath.Join(dir, subdir, file.Name())
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			err = handler(Location{Path: path}, data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//lines that start with "From " are escaped as ">From " inside a message (mboxrd escapes ">From " as ">>From ")
+func unescapeFromLines(data []byte) []byte {
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	for i, line := range lines {
+		unquoted := bytes.TrimLeft(line, ">")
+		if len(unquoted) < len(line) && bytes.HasPrefix(unquoted, []byte("From ")) {
+			lines[i] = line[1:]
+		}
+	}
+	return bytes.Join(lines, nil)
+}
+
+func walkMbox(path string, handler func(location Location, data []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var message bytes.Buffer
+	var offset, start int64 = 0, -1
+	previousLineEmpty := true
+
+	flush := func() error {
+		if start < 0 {
+			return nil
+		}
+		data := unescapeFromLines(message.Bytes())
+		location := Location{Path: path, Offset: start, Length: int64(message.Len())}
+		message.Reset()
+		return handler(location, data)
+	}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			//a new message starts with a "From " line after an empty line, the "From " line itself isn't part of the message
+			if previousLineEmpty && bytes.HasPrefix(line, []byte("From ")) {
+				if e := flush(); e != nil {
+					return e
+				}
+				start = offset + int64(len(line))
+			} else if start >= 0 {
+				message.Write(line)
+			}
+			previousLineEmpty = len(bytes.TrimRight(line, "\r\n")) == 0
+			offset += int64(len(line))
+		}
+
+		if err == io.EOF {
+			return flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+//reads a single message. Messages in a Maildir are renamed when their flags change (e.g when they are read),
+//so they are also looked up by their unique name (the part before the ':').
+func ReadMessage(location Location) ([]byte, error) {
+	if location.Length == 0 {
+		data, err := ioutil.ReadFile(location.Path)
+		if os.IsNotExist(err) {
+			uniqueName := strings.SplitN(filepath.Base(location.Path), ":", 2)[0]
+			maildir := filepath.Dir(filepath.Dir(location.Path))
+			for _, subdir := range []string{"cur", "new"} {
+				matches, _ := filepath.Glob(filepath.Join(maildir, subdir, uniqueName + "*"))
+				if len(matches) > 0 {
+					return ioutil.ReadFile(matches[0])
+				}
+			}
+		}
+		return data, err
+	}
+
+	if location.Length < 0 || location.Length > maxMessageSize {
+		return nil, ErrMessageTooLarge
+	}
+
+	f, err := os.Open(location.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data := make([]byte, location.Length)
+	_, err = f.ReadAt(data, location.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return unescapeFromLines(data), nil
+}
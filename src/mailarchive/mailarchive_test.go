@@ -0,0 +1,172 @@
+package mailarchive
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error, expected not nil, but got nil: \033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+const textMessage = "From: Anna <anna@example.com>\n" +
+	"To: bob@example.com\n" +
+	"Subject: =?ISO-8859-1?Q?Gr=FC=DFe_aus_Wien?=\n" +
+	"Date: Thu, 04 Jul 2019 18:30:00 +0200\n" +
+	"Content-Type: text/plain; charset=iso-8859-1\n" +
+	"Content-Transfer-Encoding: quoted-printable\n" +
+	"\n" +
+	"Sch=F6ne Gr=FC=DFe\n" +
+	">From Vienna with love\n"
+
+const multipartMessage = "From: bob@example.com\n" +
+	"To: Anna <anna@example.com>\n" +
+	"Subject: Photos\n" +
+	"Message-ID: <1234@example.com>\n" +
+	"Date: Fri, 05 Jul 2019 10:00:00 +0000\n" +
+	"MIME-Version: 1.0\n" +
+	"Content-Type: multipart/mixed; boundary=\"b1\"\n" +
+	"\n" +
+	"--b1\n" +
+	"Content-Type: text/plain\n" +
+	"\n" +
+	"See the attached photos.\n" +
+	"--b1\n" +
+	"Content-Type: application/pdf; name=\"ticket.pdf\"\n" +
+	"Content-Transfer-Encoding: base64\n" +
+	"\n" +
+	"JVBERi0=\n" +
+	"--b1\n" +
+	"Content-Type: application/octet-stream\n" +
+	"Content-Disposition: attachment; filename=\"lake.jpg\"\n" +
+	"Content-Transfer-Encoding: base64\n" +
+	"\n" +
+	"/9j/\n" +
+	"4A==\n" +
+	"--b1--\n"
+
+func createArchive(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "mailarchive")
+	ok(t, err)
+
+	mbox := "From anna@example.com Thu Jul  4 18:30:00 2019\n" + textMessage[:len(textMessage) - len(">From Vienna with love\n")] +
+		">>From Vienna with love\n" + "\nFrom bob@example.com Fri Jul  5 10:00:00 2019\n" + multipartMessage
+	ok(t, os.MkdirAll(filepath.Join(dir, "Thunderbird"), 0700))
+	ok(t, ioutil.WriteFile(filepath.Join(dir, "Thunderbird", "Archive"), []byte(mbox), 0600))
+	ok(t, ioutil.WriteFile(filepath.Join(dir, "Thunderbird", "Archive.msf"), []byte("// <!-- <mdb:mork:z v=\"1.4\"/> -->"), 0600))
+
+	for _, subdir := range []string{"Maildir/cur", "Maildir/new", "Maildir/tmp", "Maildir/.Sent/cur"} {
+		ok(t, os.MkdirAll(filepath.Join(dir, subdir), 0700))
+	}
+	ok(t, ioutil.WriteFile(filepath.Join(dir, "Maildir", "cur", "1562257800.M1P1.host:2,S"), []byte(textMessage), 0600))
+	ok(t, ioutil.WriteFile(filepath.Join(dir, "Maildir", ".Sent", "cur", "1562320800.M2P1.host:2,S"), []byte(multipartMessage), 0600))
+	return dir
+}
+
+func TestFindFolders(t *testing.T) {
+	dir := createArchive(t)
+	defer os.RemoveAll(dir)
+
+	folders, err := FindFolders(dir)
+	ok(t, err)
+	equals(t, []Folder{
+		Folder{Name: "Maildir", Path: filepath.Join(dir, "Maildir"), Maildir: true},
+		Folder{Name: "Maildir/Sent", Path: filepath.Join(dir, "Maildir", ".Sent"), Maildir: true},
+		Folder{Name: "Thunderbird/Archive", Path: filepath.Join(dir, "Thunderbird", "Archive")},
+	}, folders)
+
+	folders, err = FindFolders(filepath.Join(dir, "Maildir"))
+	ok(t, err)
+	equals(t, []string{"INBOX", "Sent"}, []string{folders[0].Name, folders[1].Name})
+
+	_, err = FindFolders(filepath.Join(dir, "Thunderbird", "Archive.msf"))
+	notOk(t, err)
+}
+
+func TestWalkMbox(t *testing.T) {
+	dir := createArchive(t)
+	defer os.RemoveAll(dir)
+
+	locations := []Location{}
+	messages := [][]byte{}
+	folder := Folder{Name: "Archive", Path: filepath.Join(dir, "Thunderbird", "Archive")}
+	ok(t, folder.Walk(func(location Location, data []byte) error {
+		locations = append(locations, location)
+		messages = append(messages, data)
+		return nil
+	}))
+	equals(t, 2, len(messages))
+	equals(t, textMessage + "\n", string(messages[0]))
+	equals(t, multipartMessage, string(messages[1]))
+
+	data, err := ReadMessage(locations[1])
+	ok(t, err)
+	equals(t, multipartMessage, string(data))
+
+	//the length isn't trusted, e.g in case the mbox file was replaced after the crawl
+	_, err = ReadMessage(Location{Path: locations[1].Path, Offset: locations[1].Offset, Length: maxMessageSize + 1})
+	equals(t, ErrMessageTooLarge, err)
+}
+
+func TestReadRenamedMaildirMessage(t *testing.T) {
+	dir := createArchive(t)
+	defer os.RemoveAll(dir)
+
+	//the message was read after the last crawl, which removed the 'S' flag
+	data, err := ReadMessage(Location{Path: filepath.Join(dir, "Maildir", "cur", "1562257800.M1P1.host:2,")})
+	ok(t, err)
+	equals(t, textMessage, string(data))
+}
+
+func TestParseMessage(t *testing.T) {
+	message, err := ParseMessage([]byte(textMessage))
+	ok(t, err)
+	equals(t, "Grüße aus Wien", message.Subject)
+	equals(t, "Anna", message.From)
+	equals(t, "anna@example.com", message.FromAddress)
+	equals(t, "bob@example.com", message.To)
+	equals(t, "2019-07-04T16:30:00Z", message.Date.UTC().Format("2006-01-02T15:04:05Z"))
+	equals(t, "Schöne Grüße >From Vienna with love", message.Snippet)
+	equals(t, 0, len(message.Attachments))
+
+	message, err = ParseMessage([]byte(multipartMessage))
+	ok(t, err)
+	equals(t, "1234@example.com", message.MessageId)
+	equals(t, "See the attached photos.", message.Snippet)
+	equals(t, []Attachment{Attachment{Index: 0, Filename: "lake.jpg", ContentType: "application/octet-stream"}}, message.Attachments)
+
+	attachment, err := ExtractAttachment([]byte(multipartMessage), 0)
+	ok(t, err)
+	equals(t, []byte{0xFF, 0xD8, 0xFF, 0xE0}, attachment)
+
+	_, err = ExtractAttachment([]byte(multipartMessage), 1)
+	equals(t, ErrAttachmentNotFound, err)
+}
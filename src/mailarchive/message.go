@@ -0,0 +1,228 @@
+package mailarchive
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"golang.org/x/text/encoding/htmlindex"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+//max. number of characters of the text that is kept as snippet
+const maxSnippetLength = 300
+
+var ErrAttachmentNotFound = errors.New("Attachment not found")
+
+var whitespaceRegex = regexp.MustCompile(`\s+`)
+
+//an image that is attached to a message, the index counts the image attachments of the message
+type Attachment struct {
+	Index int
+	Filename string
+	ContentType string
+}
+
+type Message struct {
+	//the same message is often stored in several folders or archives
+	MessageId string
+	Subject string
+	From string
+	//the address of the sender, used to filter the messages
+	FromAddress string
+	To string
+	Date time.Time
+	//the beginning of the text of the message
+	Snippet string
+	Attachments []Attachment
+}
+
+//decodes text in other charsets than UTF-8 (e.g ISO-8859-15 or Windows-1252)
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, err
+	}
+	return encoding.NewDecoder().Reader(input), nil
+}
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+//returns the addresses as they are shown by mail clients (i.e the names if there are any)
+func formatAddresses(header mail.Header, key string) (string, string) {
+	parser := &mail.AddressParser{WordDecoder: wordDecoder}
+	addresses, err := parser.ParseList(header.Get(key))
+	if err != nil || len(addresses) == 0 {
+		return decodeHeader(header.Get(key)), ""
+	}
+
+	names := []string{}
+	for _, address := range addresses {
+		if address.Name != "" {
+			names = append(names, address.Name)
+		} else {
+			names = append(names, address.Address)
+		}
+	}
+	return strings.Join(names, ", "), strings.ToLower(addresses[0].Address)
+}
+
+func decodeBody(body io.Reader, transferEncoding string, charset string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(transferEncoding)) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		//multipart.Reader already decodes quoted-printable parts, but the body of a message isn't decoded
+		body = quotedprintable.NewReader(body)
+	}
+
+	if charset != "" && !strings.EqualFold(charset, "utf-8") && !strings.EqualFold(charset, "us-ascii") {
+		decoded, err := charsetReader(charset, body)
+		if err == nil {
+			body = decoded
+		}
+	}
+	return body
+}
+
+//the attachment's filename, either from the Content-Disposition or the Content-Type header
+func getFilename(header map[string][]string, params map[string]string) string {
+	_, dispositionParams, err := mime.ParseMediaType(strings.Join(header["Content-Disposition"], ""))
+	if err == nil && dispositionParams["filename"] != "" {
+		return decodeHeader(dispositionParams["filename"])
+	}
+	return decodeHeader(params["name"])
+}
+
+func isImage(contentType string, filename string) bool {
+	if strings.HasPrefix(contentType, "image/") {
+		return true
+	}
+
+	//some mail clients send every attachment as application/octet-stream
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".heic", ".webp":
+		return contentType == "application/octet-stream"
+	}
+	return false
+}
+
+//walks the MIME parts of a message. The handler is called with the decoded content of all parts that aren't multipart
+//themselves and stops the walk in case it returns false.
+func walkParts(header map[string][]string, body io.Reader, handler func(contentType string, filename string, content io.Reader) bool) (bool, error) {
+	contentType, params, err := mime.ParseMediaType(strings.Join(header["Content-Type"], ""))
+	if err != nil {
+		contentType = "text/plain"
+		params = map[string]string{}
+	}
+
+	if strings.HasPrefix(contentType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return true, nil
+			}
+			if err != nil {
+				return true, err
+			}
+
+			next, err := walkParts(part.Header, part, handler)
+			if err != nil || !next {
+				return next, err
+			}
+		}
+	}
+
+	if contentType == "message/rfc822" {
+		message, err := mail.ReadMessage(body)
+		if err != nil {
+			return true, nil
+		}
+		return walkParts(message.Header, message.Body, handler)
+	}
+
+	content := decodeBody(body, strings.Join(header["Content-Transfer-Encoding"], ""), params["charset"])
+	return handler(contentType, getFilename(header, params), content), nil
+}
+
+//parses the headers, the text and the image attachments of a message
+func ParseMessage(data []byte) (*Message, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	message := &Message{MessageId: strings.Trim(m.Header.Get("Message-Id"), " <>"), Subject: decodeHeader(m.Header.Get("Subject"))}
+	message.From, message.FromAddress = formatAddresses(m.Header, "From")
+	message.To, _ = formatAddresses(m.Header, "To")
+	message.Date, err = m.Header.Date()
+	if err != nil {
+		message.Date = time.Time{}
+	}
+
+	_, err = walkParts(m.Header, m.Body, func(contentType string, filename string, content io.Reader) bool {
+		if isImage(contentType, filename) {
+			message.Attachments = append(message.Attachments, Attachment{Index: len(message.Attachments), Filename: filename,
+																			ContentType: contentType})
+		} else if contentType == "text/plain" && message.Snippet == "" {
+			text, _ := ioutil.ReadAll(io.LimitReader(content, 4 * maxSnippetLength))
+			snippet := []rune(strings.TrimSpace(whitespaceRegex.ReplaceAllString(string(text), " ")))
+			if len(snippet) > maxSnippetLength {
+				snippet = append(snippet[:maxSnippetLength], '…')
+			}
+			message.Snippet = string(snippet)
+		}
+		return true
+	})
+	return message, err
+}
+
+//returns the decoded content of the image attachment with the given index
+func ExtractAttachment(data []byte, index int) ([]byte, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var attachment []byte
+	var readErr error
+	current := 0
+	_, err = walkParts(m.Header, m.Body, func(contentType string, filename string, content io.Reader) bool {
+		if !isImage(contentType, filename) {
+			return true
+		}
+		if current == index {
+			attachment, readErr = ioutil.ReadAll(content)
+			return false
+		}
+		current += 1
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	if attachment == nil {
+		return nil, ErrAttachmentNotFound
+	}
+	return attachment, nil
+}
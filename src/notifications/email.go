@@ -53,6 +53,7 @@ func (s *Email) Notify() error {
 			if err != nil {
 				return err
 			}
+			message = utils.ReplaceMetadataTagsInMessage(message, imageData.Metadata)
 
 			mime, err := mimetype.DetectReader(bytes.NewReader(imageData.Image))
 			if err != nil {
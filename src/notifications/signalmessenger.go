@@ -82,6 +82,7 @@ func (s *SignalMessenger) Notify() error {
 			if err != nil {
 				return err
 			}
+			message = utils.ReplaceMetadataTagsInMessage(message, imageData.Metadata)
 
 			err = s.sendMessage(message, imageData.Image, recipients)
 			if err != nil {
@@ -0,0 +1,394 @@
+package photoarchive
+
+import (
+	"github.com/bbernhard/mindfulbytes/imagedate"
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	FormatZip = "zip"
+	FormatTar = "tar"
+	FormatTarGz = "tar.gz"
+)
+
+//sidecar files bigger than that aren't kept in memory
+const maxSidecarSize = 1024 * 1024
+
+//compressed members are kept in memory while their date and details are read, the size is taken from
+//the archive's header and therefore limited
+const maxMemberSize = 256 * 1024 * 1024
+
+var ErrUnsupportedFormat = errors.New("Unsupported archive format")
+var ErrUnsupportedMethod = errors.New("Unsupported compression method")
+var ErrMemberTooLarge = errors.New("Archive member too large")
+
+//a file in an archive, with everything that's needed to read it without listing the archive again
+type Member struct {
+	Archive string `json:"archive"`
+	Format string `json:"format"`
+	Name string `json:"name"`
+	ModTime time.Time `json:"modtime"`
+	//position of the data in the archive. For compressed tar archives the position in the uncompressed stream.
+	Offset int64 `json:"offset"`
+	Size int64 `json:"size"`
+	//only set for zip archives
+	CompressedSize int64 `json:"compressedsize,omitempty"`
+	Method uint16 `json:"method,omitempty"`
+}
+
+//identifies the member, e.g /archives/2004.zip!/holidays/IMG_0001.jpg
+func (m Member) Uri() string {
+	return m.Archive + "!/" + m.Name
+}
+
+//returns the format of an archive, based on its name
+func GetFormat(path string) (string, bool) {
+	name := strings.ToLower(path)
+	switch {
+		case strings.HasSuffix(name, ".zip"):
+			return FormatZip, true
+		case strings.HasSuffix(name, ".tar"):
+			return FormatTar, true
+		case strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz"):
+			return FormatTarGz, true
+	}
+	return "", false
+}
+
+//returns the archives below the given directory, or the given path in case it's an archive. Hidden directories are skipped.
+func FindArchives(root string) ([]string, error) {
+	archives := []string{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != root && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if _, ok := GetFormat(path); ok {
+			archives = append(archives, path)
+		}
+		return nil
+	})
+	return archives, err
+}
+
+//opens the archive containing the member and streams its data, compressed tar archives are read up to the member
+func (m Member) Open() (io.ReadCloser, error) {
+	f, err := os.Open(m.Archive)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := m.reader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return readCloser{Reader: r, closer: f}, nil
+}
+
+func (m Member) reader(f *os.File) (io.Reader, error) {
+	switch m.Format {
+		case FormatZip:
+			switch m.Method {
+				case zip.Store:
+					return io.NewSectionReader(f, m.Offset, m.Size), nil
+				case zip.Deflate:
+					return io.LimitReader(flate.NewReader(io.NewSectionReader(f, m.Offset, m.CompressedSize)), m.Size), nil
+			}
+			return nil, ErrUnsupportedMethod
+		case FormatTar:
+			return io.NewSectionReader(f, m.Offset, m.Size), nil
+		case FormatTarGz:
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				return nil, err
+			}
+			_, err = io.CopyN(ioutil.Discard, gz, m.Offset)
+			if err != nil {
+				return nil, err
+			}
+			return io.LimitReader(gz, m.Size), nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+type readCloser struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (r readCloser) Close() error {
+	return r.closer.Close()
+}
+
+type Archive struct {
+	Path string
+	Format string
+	//the regular files in the order they are stored in the archive
+	Members []Member
+	file *os.File
+	//the content of the JSON and XMP files, so that the sidecars of the images can be read without reading the archive again
+	sidecars map[string][]byte
+	//compressed tar archives can only be read sequentially, the stream is kept open while the images are read in order
+	stream io.Reader
+	streamPosition int64
+	//the member that was read last, the strategies open an image several times
+	lastMember string
+	lastData []byte
+}
+
+//lists the members of an archive
+func Open(path string) (*Archive, error) {
+	format, ok := GetFormat(path)
+	if !ok {
+		return nil, ErrUnsupportedFormat
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &Archive{Path: path, Format: format, Members: []Member{}, file: f, sidecars: make(map[string][]byte)}
+	if format == FormatZip {
+		err = archive.listZip()
+	} else {
+		err = archive.listTar()
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return archive, nil
+}
+
+func (a *Archive) Close() error {
+	return a.file.Close()
+}
+
+func isSidecar(name string, size int64) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return (ext == ".json" || ext == ".xmp") && size <= maxSidecarSize
+}
+
+func (a *Archive) listZip() error {
+	info, err := a.file.Stat()
+	if err != nil {
+		return err
+	}
+	reader, err := zip.NewReader(a.file, info.Size())
+	if err != nil {
+		return err
+	}
+
+	for _, f := range reader.File {
+		//encrypted members can't be read
+		if f.FileInfo().IsDir() || f.Flags & 0x1 != 0 {
+			continue
+		}
+		offset, err := f.DataOffset()
+		if err != nil {
+			return err
+		}
+
+		modTime := f.Modified
+		if modTime.IsZero() {
+			modTime = f.ModTime()
+		}
+		a.Members = append(a.Members, Member{Archive: a.Path, Format: a.Format, Name: f.Name, ModTime: modTime, Offset: offset,
+												Size: int64(f.UncompressedSize64), CompressedSize: int64(f.CompressedSize64), Method: f.Method})
+
+		if isSidecar(f.Name, int64(f.UncompressedSize64)) {
+			r, err := f.Open()
+			if err != nil {
+				continue
+			}
+			data, err := ioutil.ReadAll(r)
+			r.Close()
+			if err == nil {
+				a.sidecars[f.Name] = data
+			}
+		}
+	}
+	return nil
+}
+
+//counts the bytes read from the uncompressed stream, which gives the position of the members
+type countingReader struct {
+	reader io.Reader
+	count int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+func (a *Archive) listTar() error {
+	var position func() (int64, error)
+	var reader *tar.Reader
+	if a.Format == FormatTarGz {
+		gz, err := gzip.NewReader(a.file)
+		if err != nil {
+			return err
+		}
+		counter := &countingReader{reader: gz}
+		position = func() (int64, error) { return counter.count, nil }
+		reader = tar.NewReader(counter)
+	} else {
+		//the tar reader reads whole blocks and doesn't read ahead, after the header the file is at the start of the data
+		position = func() (int64, error) { return a.file.Seek(0, io.SeekCurrent) }
+		reader = tar.NewReader(a.file)
+	}
+
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		offset, err := position()
+		if err != nil {
+			return err
+		}
+		a.Members = append(a.Members, Member{Archive: a.Path, Format: a.Format, Name: strings.TrimPrefix(header.Name, "./"),
+												ModTime: header.ModTime, Offset: offset, Size: header.Size})
+
+		if isSidecar(header.Name, header.Size) {
+			data, err := ioutil.ReadAll(reader)
+			if err != nil {
+				return err
+			}
+			a.sidecars[strings.TrimPrefix(header.Name, "./")] = data
+		}
+	}
+	return nil
+}
+
+//reads a member of a compressed tar archive. Reading the members in order continues the stream, otherwise it's read again from the start.
+func (a *Archive) readFromStream(member Member) ([]byte, error) {
+	if member.Size < 0 || member.Size > maxMemberSize {
+		return nil, ErrMemberTooLarge
+	}
+
+	if a.stream == nil || member.Offset < a.streamPosition {
+		_, err := a.file.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+		gz, err := gzip.NewReader(a.file)
+		if err != nil {
+			return nil, err
+		}
+		a.stream, a.streamPosition = gz, 0
+	}
+
+	_, err := io.CopyN(ioutil.Discard, a.stream, member.Offset - a.streamPosition)
+	if err != nil {
+		a.stream = nil
+		return nil, err
+	}
+	data := make([]byte, member.Size)
+	_, err = io.ReadFull(a.stream, data)
+	if err != nil {
+		a.stream = nil
+		return nil, err
+	}
+	a.streamPosition = member.Offset + member.Size
+	return data, nil
+}
+
+func (a *Archive) open(member Member) (imagedate.ReadSeekCloser, error) {
+	if member.Name == a.lastMember && a.lastData != nil {
+		return nopCloser{bytes.NewReader(a.lastData)}, nil
+	}
+
+	//uncompressed members are read directly from the archive
+	if a.Format == FormatTar || (a.Format == FormatZip && member.Method == zip.Store) {
+		return nopCloser{io.NewSectionReader(a.file, member.Offset, member.Size)}, nil
+	}
+
+	if member.Size < 0 || member.Size > maxMemberSize {
+		return nil, ErrMemberTooLarge
+	}
+
+	var data []byte
+	var err error
+	if a.Format == FormatTarGz {
+		data, err = a.readFromStream(member)
+	} else {
+		var r io.Reader
+		r, err = member.reader(a.file)
+		if err == nil {
+			data, err = ioutil.ReadAll(r)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.lastMember, a.lastData = member.Name, data
+	return nopCloser{bytes.NewReader(data)}, nil
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+//gives the strategies of imagedate access to a member of the archive. The images of compressed tar archives should be
+//processed in the order they are stored, an archive must not be used by several goroutines at once.
+func (a *Archive) Image(member Member) imagedate.Image {
+	return &memberImage{archive: a, member: member}
+}
+
+type memberImage struct {
+	archive *Archive
+	member Member
+}
+
+func (i *memberImage) Path() string {
+	return i.member.Name
+}
+
+func (i *memberImage) ModTime() time.Time {
+	return i.member.ModTime
+}
+
+func (i *memberImage) Open() (imagedate.ReadSeekCloser, error) {
+	return i.archive.open(i.member)
+}
+
+//the sidecar files are looked up in the archive
+func (i *memberImage) ReadSidecar(path string) ([]byte, error) {
+	data, ok := i.archive.sidecars[path]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return data, nil
+}
@@ -0,0 +1,231 @@
+package photoarchive
+
+import (
+	"github.com/bbernhard/mindfulbytes/imagedate"
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error, expected not nil, but got nil: \033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+type testFile struct {
+	Name string
+	Data string
+}
+
+var testModTime = time.Date(2004, 7, 4, 12, 34, 56, 0, time.UTC)
+
+var testFiles = []testFile{
+	{Name: "holidays/IMG_0001.jpg", Data: "first image"},
+	{Name: "holidays/IMG_0001.jpg.json", Data: `{"description": "At the lake", "geoData": {"latitude": 47.5, "longitude": 13.25}}`},
+	{Name: "holidays/IMG_0002.jpg", Data: "second image, a bit longer than the first one"},
+}
+
+func writeZip(t *testing.T, path string) {
+	f, err := os.Create(path)
+	ok(t, err)
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for i, file := range testFiles {
+		//stored and deflated members
+		method := zip.Deflate
+		if i % 2 == 0 {
+			method = zip.Store
+		}
+		header := &zip.FileHeader{Name: file.Name, Method: method, Modified: testModTime}
+		fw, err := w.CreateHeader(header)
+		ok(t, err)
+		_, err = fw.Write([]byte(file.Data))
+		ok(t, err)
+	}
+	ok(t, w.Close())
+}
+
+func writeTar(t *testing.T, path string, compressed bool) {
+	f, err := os.Create(path)
+	ok(t, err)
+	defer f.Close()
+
+	var buffer bytes.Buffer
+	w := tar.NewWriter(&buffer)
+	ok(t, w.WriteHeader(&tar.Header{Name: "./holidays/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: testModTime}))
+	for _, file := range testFiles {
+		ok(t, w.WriteHeader(&tar.Header{Name: "./" + file.Name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(file.Data)),
+										ModTime: testModTime}))
+		_, err = w.Write([]byte(file.Data))
+		ok(t, err)
+	}
+	ok(t, w.Close())
+
+	if compressed {
+		gz := gzip.NewWriter(f)
+		_, err = gz.Write(buffer.Bytes())
+		ok(t, err)
+		ok(t, gz.Close())
+	} else {
+		_, err = f.Write(buffer.Bytes())
+		ok(t, err)
+	}
+}
+
+func createArchives(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "photoarchive")
+	ok(t, err)
+	writeZip(t, filepath.Join(dir, "2004.zip"))
+	writeTar(t, filepath.Join(dir, "2005.tar"), false)
+	ok(t, os.Mkdir(filepath.Join(dir, "older"), 0755))
+	writeTar(t, filepath.Join(dir, "older", "2003.tar.gz"), true)
+	ok(t, os.Mkdir(filepath.Join(dir, ".trash"), 0755))
+	writeZip(t, filepath.Join(dir, ".trash", "deleted.zip"))
+	ok(t, ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not an archive"), 0644))
+	return dir
+}
+
+func readMember(t *testing.T, member Member) string {
+	r, err := member.Open()
+	ok(t, err)
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	ok(t, err)
+	return string(data)
+}
+
+func TestGetFormat(t *testing.T) {
+	for path, expected := range map[string]string{"a.zip": FormatZip, "a.ZIP": FormatZip, "a.tar": FormatTar, "a.tar.gz": FormatTarGz,
+													"a.tgz": FormatTarGz, "a.gz": "", "a.jpg": ""} {
+		format, found := GetFormat(path)
+		equals(t, expected, format)
+		equals(t, expected != "", found)
+	}
+}
+
+func TestFindArchives(t *testing.T) {
+	dir := createArchives(t)
+	defer os.RemoveAll(dir)
+
+	archives, err := FindArchives(dir)
+	ok(t, err)
+	equals(t, []string{filepath.Join(dir, "2004.zip"), filepath.Join(dir, "2005.tar"), filepath.Join(dir, "older", "2003.tar.gz")}, archives)
+
+	archives, err = FindArchives(filepath.Join(dir, "2004.zip"))
+	ok(t, err)
+	equals(t, []string{filepath.Join(dir, "2004.zip")}, archives)
+
+	_, err = FindArchives(filepath.Join(dir, "missing"))
+	notOk(t, err)
+}
+
+func TestOpen(t *testing.T) {
+	dir := createArchives(t)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"2004.zip", "2005.tar", "older/2003.tar.gz"} {
+		archive, err := Open(filepath.Join(dir, name))
+		ok(t, err)
+
+		equals(t, len(testFiles), len(archive.Members))
+		for i, member := range archive.Members {
+			equals(t, testFiles[i].Name, member.Name)
+			equals(t, int64(len(testFiles[i].Data)), member.Size)
+			equals(t, testModTime.Unix(), member.ModTime.Unix())
+			equals(t, filepath.Join(dir, name) + "!/" + testFiles[i].Name, member.Uri())
+			//the member can be read without listing the archive again
+			equals(t, testFiles[i].Data, readMember(t, member))
+		}
+		ok(t, archive.Close())
+	}
+
+	_, err := Open(filepath.Join(dir, "notes.txt"))
+	equals(t, ErrUnsupportedFormat, err)
+}
+
+func TestImage(t *testing.T) {
+	dir := createArchives(t)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"2004.zip", "2005.tar", "older/2003.tar.gz"} {
+		archive, err := Open(filepath.Join(dir, name))
+		ok(t, err)
+
+		//out of order, compressed tar archives have to be read again from the start
+		for _, i := range []int{2, 0, 0, 2} {
+			image := archive.Image(archive.Members[i])
+			equals(t, testFiles[i].Name, image.Path())
+			equals(t, testModTime.Unix(), image.ModTime().Unix())
+
+			f, err := image.Open()
+			ok(t, err)
+			data, err := ioutil.ReadAll(f)
+			ok(t, err)
+			equals(t, testFiles[i].Data, string(data))
+			ok(t, f.Close())
+		}
+
+		details := imagedate.GetSidecarDetails(archive.Image(archive.Members[0]))
+		equals(t, imagedate.Details{Description: "At the lake", Latitude: 47.5, Longitude: 13.25, HasLocation: true}, details)
+		equals(t, imagedate.Details{}, imagedate.GetSidecarDetails(archive.Image(archive.Members[2])))
+		ok(t, archive.Close())
+	}
+}
+
+func TestMemberTooLarge(t *testing.T) {
+	dir := createArchives(t)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"2004.zip", "older/2003.tar.gz"} {
+		archive, err := Open(filepath.Join(dir, name))
+		ok(t, err)
+
+		//the size is taken from the header, it must not be trusted when the member is read into memory
+		member := archive.Members[1]
+		member.Size = maxMemberSize + 1
+		if archive.Format == FormatZip {
+			member.Method = zip.Deflate
+		}
+		_, err = archive.Image(member).Open()
+		equals(t, ErrMemberTooLarge, err)
+		ok(t, archive.Close())
+	}
+}
+
+func TestUnsupportedMethod(t *testing.T) {
+	member := Member{Archive: "/tmp/missing.zip", Format: FormatZip, Method: 12}
+	_, err := member.reader(nil)
+	equals(t, ErrUnsupportedMethod, err)
+}
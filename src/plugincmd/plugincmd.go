@@ -0,0 +1,144 @@
+package plugincmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"github.com/bbernhard/mindfulbytes/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+func printUsage() {
+	fmt.Println("Usage: crawler [-config-dir <dir>] plugins [-plugin-dir <dir>] <command> [<args>]")
+	fmt.Println("")
+	fmt.Println("Commands:")
+	fmt.Println("  list                            List all installed plugins")
+	fmt.Println("  install <directory|tarball>     Install plugin from a local directory or tarball (.tar.gz)")
+	fmt.Println("  enable <plugin>                 Enable plugin")
+	fmt.Println("  disable <plugin>                Disable plugin")
+	fmt.Println("  remove [-purge] <plugin>        Remove plugin (and its config, if -purge is set)")
+	fmt.Println("  schema <plugin>                 Show the config schema of the plugin")
+	fmt.Println("  validate <plugin>               Validate the config of the plugin")
+}
+
+func getPluginNameArg(args []string) string {
+	if len(args) != 1 {
+		printUsage()
+		os.Exit(1)
+	}
+	return args[0]
+}
+
+func printSchema(pluginManager *utils.PluginManager, name string) error {
+	metaData, err := pluginManager.GetMetaData(name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(metaData.Name, metaData.Version, "-", metaData.Description)
+	fmt.Println("")
+	fmt.Println("enabled: true|false")
+	fmt.Println("refresh: daily|weekly|monthly")
+	fmt.Println("args:")
+	for _, argName := range utils.GetPluginArgNames(metaData) {
+		arg, ok := metaData.CrawlArgs[argName]
+		if !ok {
+			arg = metaData.FetchArgs[argName]
+		}
+
+		details := []string{arg.Type}
+		if arg.Required {
+			details = append(details, "required")
+		}
+		if arg.Default != "" {
+			details = append(details, "default: " + arg.Default)
+		}
+		fmt.Printf("  %s (%s)\n", argName, strings.Join(details, ", "))
+		if arg.Description != "" {
+			fmt.Printf("      %s\n", arg.Description)
+		}
+	}
+
+	return nil
+}
+
+//runs the 'plugins' subcommand of the crawler with the given arguments (everything after 'plugins')
+func Run(configDir string, args []string) {
+	pluginsCommand := flag.NewFlagSet("plugins", flag.ExitOnError)
+	pluginDir := pluginsCommand.String("plugin-dir", "./plugins/", "Plugin Directory")
+	pluginsCommand.Usage = printUsage
+	pluginsCommand.Parse(args)
+
+	if pluginsCommand.NArg() == 0 {
+		printUsage()
+		os.Exit(1)
+	}
+
+	pluginManager := utils.NewPluginManager(*pluginDir, configDir)
+
+	args = pluginsCommand.Args()[1:]
+	switch pluginsCommand.Arg(0) {
+		case "list":
+			installedPlugins, err := pluginManager.List()
+			if err != nil {
+				log.Fatal("Couldn't list plugins: ", err.Error())
+			}
+
+			for _, installedPlugin := range installedPlugins {
+				state := "not configured"
+				if installedPlugin.Configured {
+					state = "disabled"
+					if installedPlugin.Enabled {
+						state = "enabled"
+					}
+				}
+				fmt.Printf("%-20s %-8s %-16s %s\n", installedPlugin.Name, installedPlugin.MetaData.Version, state, installedPlugin.MetaData.Description)
+			}
+
+		case "install":
+			name, err := pluginManager.Install(getPluginNameArg(args))
+			if err != nil {
+				log.Fatal(err.Error())
+			}
+			log.Info("Installed plugin ", name, ". Configure the plugin in ", configDir, name, "/config.yaml and enable it with 'crawler plugins enable ", name, "'")
+
+		case "enable", "disable":
+			name := getPluginNameArg(args)
+			err := pluginManager.SetEnabled(name, pluginsCommand.Arg(0) == "enable")
+			if err != nil {
+				log.Fatal("Couldn't ", pluginsCommand.Arg(0), " plugin ", name, ": ", err.Error())
+			}
+			log.Info("Plugin ", name, " ", pluginsCommand.Arg(0), "d")
+
+		case "remove":
+			removeCommand := flag.NewFlagSet("remove", flag.ExitOnError)
+			purge := removeCommand.Bool("purge", false, "Also remove the plugin's config")
+			removeCommand.Parse(args)
+
+			name := getPluginNameArg(removeCommand.Args())
+			err := pluginManager.Remove(name, *purge)
+			if err != nil {
+				log.Fatal("Couldn't remove plugin ", name, ": ", err.Error())
+			}
+			log.Info("Removed plugin ", name)
+
+		case "schema":
+			err := printSchema(pluginManager, getPluginNameArg(args))
+			if err != nil {
+				log.Fatal(err.Error())
+			}
+
+		case "validate":
+			name := getPluginNameArg(args)
+			err := pluginManager.Validate(name)
+			if err != nil {
+				log.Fatal("Invalid config for plugin ", name, ": ", err.Error())
+			}
+			log.Info("Config of plugin ", name, " is valid")
+
+		default:
+			printUsage()
+			os.Exit(1)
+	}
+}
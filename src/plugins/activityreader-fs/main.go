@@ -0,0 +1,354 @@
+package main
+
+import (
+	"github.com/bbernhard/mindfulbytes/pluginsdk"
+	"github.com/bbernhard/mindfulbytes/entrymeta"
+	"github.com/bbernhard/mindfulbytes/activity"
+	log "github.com/sirupsen/logrus"
+	"github.com/gomodule/redigo/redis"
+	"github.com/gofrs/uuid"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var TOPIC string = "activityreader-fs"
+
+//the kind of the entries, as declared in meta.yaml
+const kindEvent = "event"
+
+//the variant is passed by mindfulbytes, the poster is the image of an item (e.g the card of an event)
+const (
+	variantOriginal = "original"
+	variantPoster = "poster"
+)
+
+type DataEntry struct {
+	Uri string `json:"uri"`
+	Uuid string `json:"uuid"`
+	FullDate string `json:"fulldate"`
+	DateSource string `json:"datesource,omitempty"`
+	Kind string `json:"kind,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	MetadataVersion int `json:"metadataversion,omitempty"`
+}
+
+//everything that's needed to render the track of an activity, so that fetch doesn't need to parse the file again
+type Track struct {
+	Name string `json:"name,omitempty"`
+	Sport string `json:"sport,omitempty"`
+	Start string `json:"start"`
+	//in meters and seconds
+	Distance float64 `json:"distance"`
+	Duration float64 `json:"duration"`
+	ElevationGain float64 `json:"elevationgain"`
+	//latitude and longitude of the simplified track
+	Points [][2]float64 `json:"points,omitempty"`
+	//the GPX or FIT file, which is the original of the activity
+	File string `json:"file,omitempty"`
+}
+
+//the number of points of a track that are kept for rendering
+const maxTrackPoints = 500
+
+//height of the area (at the top of the card) the track is drawn in
+const trackHeight = 350
+
+//returns all activity files, the paths are either files or directories (which are searched recursively)
+func findActivities(paths []string) ([]string, error) {
+	files := []string{}
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return files, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+
+		err = filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				log.Error("Skipping ", path, ": ", err.Error())
+				return nil
+			}
+			if !info.IsDir() && activity.IsActivityFile(path) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return files, err
+		}
+	}
+	return files, nil
+}
+
+//returns the number of files that couldn't be read
+func crawl(redisAddress string, redisMaxConnections int, paths []string, location *time.Location) int {
+	files, err := findActivities(paths)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't find activities: ", err.Error())
+	}
+
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	index := pluginsdk.NewIndex(TOPIC, "activity")
+	progress := pluginsdk.Progress{Discovered: len(files)}
+	//the same activity is often exported several times (e.g as GPX and FIT file)
+	seen := make(map[int64]bool)
+
+	for _, file := range files {
+		log.Debug("Processing activity ", file)
+		a, err := activity.Read(file)
+		if err != nil {
+			log.Error("Couldn't read activity ", file, ": ", err.Error())
+			progress.Errors += 1
+			progress.Processed += 1
+			continue
+		}
+
+		progress.Processed += 1
+		progress.Path = file
+		pluginsdk.ReportProgress(progress)
+
+		if a.Start.IsZero() {
+			log.Info("Skipping ", file, ", it doesn't contain any times (e.g a planned route)")
+			continue
+		}
+		if seen[a.Start.Unix()] {
+			continue
+		}
+		seen[a.Start.Unix()] = true
+
+		u, err := uuid.NewV4()
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't create UUID: ", err.Error())
+		}
+
+		start := a.Start.In(location)
+		metadata := map[string]string{"distance": strconv.Itoa(int(math.Round(a.Distance))),
+										"duration": strconv.Itoa(int(a.Duration.Seconds())),
+										"elevation-gain": strconv.Itoa(int(math.Round(a.ElevationGain)))}
+		if mimeType := entrymeta.MimeTypeByExtension(file); mimeType != "" {
+			metadata[entrymeta.MimeType] = mimeType
+		}
+		if a.Name != "" {
+			metadata["name"] = a.Name
+			metadata[entrymeta.Title] = a.Name
+		}
+		if a.Sport != "" {
+			metadata["sport"] = a.Sport
+		}
+		dataEntry := DataEntry{Uri: file, Uuid: u.String(), Kind: kindEvent, FullDate: start.Format("2006-01-02"), Metadata: metadata,
+								MetadataVersion: entrymeta.Version}
+		track := Track{Name: a.Name, Sport: a.Sport, Start: start.Format("2006-01-02T15:04:05"), Distance: a.Distance,
+						Duration: a.Duration.Seconds(), ElevationGain: a.ElevationGain, File: file}
+		for _, point := range activity.Simplify(a.Points, maxTrackPoints) {
+			track.Points = append(track.Points, [2]float64{point.Latitude, point.Longitude})
+		}
+		index.Add(dataEntry.Uuid, start, dataEntry, track)
+	}
+
+	pluginsdk.DeleteAllKeys(redisConn, TOPIC)
+
+	err = index.Write(redisConn)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't set data in redis: ", err.Error())
+	}
+
+	progress.Path = ""
+	pluginsdk.ReportProgress(progress)
+	return progress.Errors
+}
+
+//the name, the statistics and the date, shown below the track
+func (t Track) details() string {
+	details := t.Name
+	if details == "" {
+		details = "Activity"
+	}
+
+	stats := []string{}
+	if t.Sport != "" {
+		stats = append(stats, strings.Title(t.Sport))
+	}
+	if t.Distance > 0 {
+		stats = append(stats, fmt.Sprintf("%.2f km", t.Distance / 1000))
+	}
+	if t.Duration > 0 {
+		seconds := int(t.Duration)
+		stats = append(stats, fmt.Sprintf("%d:%02d:%02d", seconds / 3600, seconds / 60 % 60, seconds % 60))
+	}
+	if t.ElevationGain > 0 {
+		stats = append(stats, fmt.Sprintf("↑ %.0f m", t.ElevationGain))
+	}
+	if len(stats) > 0 {
+		details += "\n" + strings.Join(stats, " · ")
+	}
+
+	start, err := time.Parse("2006-01-02T15:04:05", t.Start)
+	if err == nil {
+		details += "\n" + start.Format("Monday, 2 January 2006, 15:04")
+	}
+	return details
+}
+
+//draws the track as a polyline with a marker at the start (green) and at the end (red)
+func (t Track) mvg() string {
+	points := []activity.Point{}
+	for _, p := range t.Points {
+		points = append(points, activity.Point{Latitude: p[0], Longitude: p[1], HasPosition: true})
+	}
+	projected := activity.Project(points, pluginsdk.CardWidth, trackHeight, 30)
+
+	var mvg strings.Builder
+	fmt.Fprintf(&mvg, "viewbox 0 0 %d %d\nfill #14213d\nrectangle 0,0 %d,%d\n", pluginsdk.CardWidth, pluginsdk.CardHeight, pluginsdk.CardWidth, pluginsdk.CardHeight)
+	if len(projected) == 0 {
+		return mvg.String()
+	}
+
+	if len(projected) > 1 {
+		mvg.WriteString("fill none\nstroke #fca311\nstroke-width 5\nstroke-linecap round\nstroke-linejoin round\npolyline")
+		for _, p := range projected {
+			fmt.Fprintf(&mvg, " %.1f,%.1f", p[0], p[1])
+		}
+		mvg.WriteString("\n")
+	}
+
+	first, last := projected[0], projected[len(projected) - 1]
+	fmt.Fprintf(&mvg, "stroke white\nstroke-width 2\nfill #2a9d8f\ncircle %.1f,%.1f %.1f,%.1f\n", first[0], first[1], first[0] + 9, first[1])
+	fmt.Fprintf(&mvg, "fill #e63946\ncircle %.1f,%.1f %.1f,%.1f\n", last[0], last[1], last[0] + 9, last[1])
+	return mvg.String()
+}
+
+//renders the track with ImageMagick, without any map tiles, so that no online service is needed
+func (t Track) render(magick string, destination string) error {
+	return pluginsdk.RenderCard(magick, pluginsdk.Card{Mvg: t.mvg(), Texts: []pluginsdk.CardText{
+		{Text: t.details(), Height: pluginsdk.CardHeight - trackHeight - 20, Color: "white", Align: "center", Position: "south", Offset: 10}}},
+		destination)
+}
+
+func fetch(redisAddress string, redisMaxConnections int, id string, destination string, variant string, magick string) {
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	serializedTrack, err := redis.Bytes(redisConn.Do("GET", TOPIC+":activity:"+id))
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read data from redis: ", err.Error())
+	}
+
+	var track Track
+	err = json.Unmarshal(serializedTrack, &track)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't parse activity: ", err.Error())
+	}
+
+	if variant == variantOriginal {
+		//activities that were crawled before the files were stored can only be rendered
+		if track.File == "" {
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "The file of activity ", id, " isn't known, please crawl again")
+		}
+		data, err := ioutil.ReadFile(track.File)
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read activity ", track.File, ": ", err.Error())
+		}
+		err = ioutil.WriteFile(destination, data, 0600)
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't write file ", destination, ": ", err.Error())
+		}
+		return
+	}
+
+	if _, err := exec.LookPath(magick); err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't find ImageMagick: ", err.Error())
+	}
+	err = track.render(magick, destination)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't render track: ", err.Error())
+	}
+}
+
+func main() {
+	crawlCommand := flag.NewFlagSet("crawl", flag.ExitOnError)
+	pathsCrawlCmd := crawlCommand.String("paths", "", "Comma separated list of activity files (GPX or FIT) or directories that contain activity files")
+	timezoneCrawlCmd := crawlCommand.String("timezone", "", "Time zone (e.g Europe/Vienna) the dates of the activities are determined in, defaults to the local time zone")
+
+	fetchCommand := flag.NewFlagSet("fetch", flag.ExitOnError)
+	fetchId := fetchCommand.String("id", "", "Identifier")
+	destinationFetchCmd := fetchCommand.String("destination", "", "Destination")
+	variantFetchCmd := fetchCommand.String("variant", variantOriginal, "Either the original item ('original') or an image of it ('poster')")
+	magickFetchCmd := fetchCommand.String("magick", "magick", "Path to the ImageMagick binary that renders the tracks")
+
+	redisMaxConnections := 10
+
+	flag.Parse()
+
+	pluginsdk.SetupLogging()
+
+	if len(os.Args) == 1 {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please use either 'crawl' or 'fetch'")
+	}
+
+	switch os.Args[1] {
+		case "crawl":
+			crawlCommand.Parse(os.Args[2:])
+			paths := []string{}
+			for _, p := range strings.Split(*pathsCrawlCmd, ",") {
+				if strings.TrimSpace(p) != "" {
+					paths = append(paths, strings.TrimSpace(p))
+				}
+			}
+			if len(paths) == 0 {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide at least one path")
+			}
+
+			location := time.Local
+			if *timezoneCrawlCmd != "" {
+				var err error
+				location, err = time.LoadLocation(*timezoneCrawlCmd)
+				if err != nil {
+					pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid time zone: ", err.Error())
+				}
+			}
+
+			failed := crawl(pluginsdk.GetRedisAddress(), redisMaxConnections, paths, location)
+			if failed > 0 {
+				os.Exit(pluginsdk.ExitPartialSuccess)
+			}
+
+		case "fetch":
+			fetchCommand.Parse(os.Args[2:])
+			if *fetchId == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a id")
+			}
+
+			if *destinationFetchCmd == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a destination")
+			}
+
+			if *variantFetchCmd != variantOriginal && *variantFetchCmd != variantPoster {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid variant '", *variantFetchCmd, "'")
+			}
+
+			fetch(pluginsdk.GetRedisAddress(), redisMaxConnections, *fetchId, *destinationFetchCmd, *variantFetchCmd, *magickFetchCmd)
+		default:
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, os.Args[1], " is not valid command.")
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"github.com/bbernhard/mindfulbytes/pluginsdk"
+	"github.com/bbernhard/mindfulbytes/entrymeta"
+	"github.com/bbernhard/mindfulbytes/imagedate"
+	"github.com/bbernhard/mindfulbytes/photoarchive"
+	log "github.com/sirupsen/logrus"
+	"github.com/gomodule/redigo/redis"
+	"github.com/gofrs/uuid"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+var TOPIC string = "archivereader-fs"
+
+//the kind of the entries, as declared in meta.yaml
+const kindImage = "image"
+
+var EXTENSIONS = []string{".jpg", ".jpeg", ".png", ".heic", ".heif", ".webp", ".tif", ".tiff",
+							".dng", ".cr2", ".nef", ".arw", ".orf", ".rw2", ".pef", ".srw", ".raf"}
+
+type DataEntry struct {
+	Uri string `json:"uri"`
+	Uuid string `json:"uuid"`
+	FullDate string `json:"fulldate"`
+	DateSource string `json:"datesource,omitempty"`
+	Kind string `json:"kind,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	MetadataVersion int `json:"metadataversion,omitempty"`
+}
+
+func isSupportedImage(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	for _, e := range EXTENSIONS {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+//returns the number of archives and images that were skipped
+func crawl(redisAddress string, redisMaxConnections int, paths []string, workers int, dateExtractor *imagedate.Extractor) int {
+	archives := []string{}
+	for _, p := range paths {
+		a, err := photoarchive.FindArchives(p)
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't find archives in ", p, ": ", err.Error())
+		}
+		archives = append(archives, a...)
+	}
+
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	stats := &pluginsdk.CrawlStats{}
+	var mutex sync.Mutex
+	//the position of every image in its archive is stored, so that fetch doesn't need to list the archive
+	index := pluginsdk.NewIndex(TOPIC, "member")
+	lastProgressReport := time.Time{}
+
+	archivePaths := make(chan string, len(archives))
+	for _, archive := range archives {
+		archivePaths <- archive
+	}
+	close(archivePaths)
+
+	//the archives are processed in parallel, the images of an archive in the order they are stored
+	processors := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		processors.Add(1)
+		go func() {
+			defer processors.Done()
+			for archivePath := range archivePaths {
+				log.Debug("Processing archive ", archivePath)
+				archive, err := photoarchive.Open(archivePath)
+				if err != nil {
+					log.Error("Couldn't read archive ", archivePath, ": ", err.Error())
+					stats.AddError()
+					continue
+				}
+
+				images := []photoarchive.Member{}
+				for _, member := range archive.Members {
+					if isSupportedImage(member.Name) {
+						images = append(images, member)
+					}
+				}
+				stats.AddDiscovered(len(images))
+
+				for _, member := range images {
+					image := archive.Image(member)
+					result, err := dateExtractor.GetDate(image)
+					if err != nil {
+						log.Error("Couldn't determine date of ", member.Uri(), ": ", err.Error())
+						stats.AddError()
+						stats.AddProcessed()
+						continue
+					}
+
+					u, err := uuid.NewV4()
+					if err != nil {
+						pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't create UUID: ", err.Error())
+					}
+
+					fullDate := result.Time.Format("2006-01-02")
+					metadata := dateExtractor.GetMetadata(image)
+					metadata["archive"] = archivePath
+					metadata["member"] = member.Name
+					dataEntry := DataEntry{Uri: member.Uri(), Uuid: u.String(), Kind: kindImage, FullDate: fullDate, DateSource: result.Source, Metadata: metadata,
+											MetadataVersion: entrymeta.Version}
+
+					mutex.Lock()
+					index.Add(dataEntry.Uuid, result.Time, dataEntry, member)
+					stats.AddProcessed()
+					if time.Since(lastProgressReport) > 500 * time.Millisecond {
+						lastProgressReport = time.Now()
+						pluginsdk.ReportProgress(stats.Progress(member.Uri()))
+					}
+					mutex.Unlock()
+				}
+				archive.Close()
+			}
+		}()
+	}
+	processors.Wait()
+
+	pluginsdk.DeleteAllKeys(redisConn, TOPIC)
+
+	err := index.Write(redisConn)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't set data in redis: ", err.Error())
+	}
+
+	pluginsdk.ReportProgress(stats.Progress(""))
+	return stats.Errors()
+}
+
+//streams the image out of its archive, nothing is extracted to disk
+func fetch(redisAddress string, redisMaxConnections int, id string, destination string) {
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	serializedMember, err := redis.Bytes(redisConn.Do("GET", TOPIC+":member:"+id))
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read data from redis: ", err.Error())
+	}
+
+	var member photoarchive.Member
+	err = json.Unmarshal(serializedMember, &member)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't parse member: ", err.Error())
+	}
+
+	src, err := member.Open()
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't open ", member.Uri(), ": ", err.Error())
+	}
+	defer src.Close()
+
+	dest, err := os.Create(destination)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't create file ", destination, ": ", err.Error())
+	}
+	defer dest.Close()
+
+	_, err = io.Copy(dest, src)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't write file ", destination, ": ", err.Error())
+	}
+}
+
+func main() {
+	crawlCommand := flag.NewFlagSet("crawl", flag.ExitOnError)
+	pathsCrawlCmd := crawlCommand.String("paths", "", "Comma separated list of archives or directories that contain archives (zip, tar, tar.gz)")
+	workersCrawlCmd := crawlCommand.Int("workers", runtime.NumCPU(), "Number of archives that are processed in parallel")
+	dateStrategiesCrawlCmd := crawlCommand.String("date-strategies", strings.Join(imagedate.DefaultStrategies, ","), "Comma separated list of sources the date of an image is taken from")
+	filenamePatternCrawlCmd := crawlCommand.String("filename-pattern", "", "Regular expression with the named groups 'year', 'month' and 'day' to extract the date from the filename")
+
+	fetchCommand := flag.NewFlagSet("fetch", flag.ExitOnError)
+	fetchId := fetchCommand.String("id", "", "Identifier")
+	destinationFetchCmd := fetchCommand.String("destination", "", "Destination")
+
+	redisMaxConnections := 10
+
+	flag.Parse()
+
+	pluginsdk.SetupLogging()
+
+	if len(os.Args) == 1 {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please use either 'crawl' or 'fetch'")
+	}
+
+	switch os.Args[1] {
+		case "crawl":
+			crawlCommand.Parse(os.Args[2:])
+			paths := pluginsdk.SplitList(*pathsCrawlCmd)
+			if len(paths) == 0 {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide at least one path")
+			}
+
+			if *workersCrawlCmd <= 0 {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a valid number of workers")
+			}
+
+			dateStrategies, err := imagedate.ParseStrategies(*dateStrategiesCrawlCmd)
+			if err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, err.Error())
+			}
+
+			dateExtractor := imagedate.NewExtractor(dateStrategies)
+			if *filenamePatternCrawlCmd != "" {
+				err = dateExtractor.SetFilenamePattern(*filenamePatternCrawlCmd)
+				if err != nil {
+					pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid filename pattern: ", err.Error())
+				}
+			}
+
+			skipped := crawl(pluginsdk.GetRedisAddress(), redisMaxConnections, paths, *workersCrawlCmd, dateExtractor)
+			if skipped > 0 {
+				os.Exit(pluginsdk.ExitPartialSuccess)
+			}
+
+		case "fetch":
+			fetchCommand.Parse(os.Args[2:])
+			if *fetchId == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a id")
+			}
+
+			if *destinationFetchCmd == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a destination")
+			}
+
+			fetch(pluginsdk.GetRedisAddress(), redisMaxConnections, *fetchId, *destinationFetchCmd)
+		default:
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, os.Args[1], " is not valid command.")
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"github.com/bbernhard/mindfulbytes/pluginsdk"
+	"github.com/bbernhard/mindfulbytes/entrymeta"
+	"github.com/bbernhard/mindfulbytes/ical"
+	log "github.com/sirupsen/logrus"
+	"github.com/gomodule/redigo/redis"
+	"github.com/gofrs/uuid"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var TOPIC string = "calreader-fs"
+
+//the kind of the entries, as declared in meta.yaml
+const kindEvent = "event"
+
+//the variant is passed by mindfulbytes, the poster is the image of an item (e.g the card of an event)
+const (
+	variantOriginal = "original"
+	variantPoster = "poster"
+)
+
+type DataEntry struct {
+	Uri string `json:"uri"`
+	Uuid string `json:"uuid"`
+	FullDate string `json:"fulldate"`
+	DateSource string `json:"datesource,omitempty"`
+	Kind string `json:"kind,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	MetadataVersion int `json:"metadataversion,omitempty"`
+}
+
+//everything that's needed to render the card of an event, so that fetch doesn't need to parse the calendars again
+type Card struct {
+	Summary string `json:"summary"`
+	Location string `json:"location,omitempty"`
+	Start string `json:"start"`
+	AllDay bool `json:"allday,omitempty"`
+}
+
+//returns all calendar files, the paths are either files or directories (which are searched recursively)
+func findCalendars(paths []string) ([]string, error) {
+	calendars := []string{}
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return calendars, err
+		}
+
+		if !info.IsDir() {
+			calendars = append(calendars, p)
+			continue
+		}
+
+		err = filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				log.Error("Skipping ", path, ": ", err.Error())
+				return nil
+			}
+			if !info.IsDir() && strings.ToLower(filepath.Ext(path)) == ".ics" {
+				calendars = append(calendars, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return calendars, err
+		}
+	}
+	return calendars, nil
+}
+
+//returns the number of calendars and events that were skipped
+func crawl(redisAddress string, redisMaxConnections int, paths []string, location *time.Location) int {
+	calendars, err := findCalendars(paths)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't find calendars: ", err.Error())
+	}
+
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	index := pluginsdk.NewIndex(TOPIC, "event")
+	progress := pluginsdk.Progress{Discovered: len(calendars)}
+	//the exports of a calendar from different years contain the same events
+	seen := make(map[string]bool)
+	now := time.Now()
+
+	for _, calendar := range calendars {
+		log.Debug("Processing calendar ", calendar)
+		f, err := os.Open(calendar)
+		if err != nil {
+			log.Error("Couldn't open calendar ", calendar, ": ", err.Error())
+			progress.Errors += 1
+			progress.Processed += 1
+			continue
+		}
+
+		events, skipped, err := ical.Parse(f)
+		f.Close()
+		if err != nil {
+			log.Error("Couldn't parse calendar ", calendar, ": ", err.Error())
+			progress.Errors += 1
+			progress.Processed += 1
+			continue
+		}
+		if skipped > 0 {
+			log.Error("Skipped ", skipped, " invalid events in ", calendar)
+			progress.Errors += skipped
+		}
+
+		for _, instance := range ical.Expand(events, now) {
+			if instance.Event.IgnoredRule {
+				log.Debug("Unsupported recurrence rule of event ", instance.Event.Uid, ", only the first instance is indexed")
+			}
+
+			key := instance.Event.Uid + "/" + instance.Start.UTC().Format(time.RFC3339)
+			if instance.Event.Uid != "" && seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			u, err := uuid.NewV4()
+			if err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't create UUID: ", err.Error())
+			}
+
+			start := instance.LocalStart(location)
+			metadata := map[string]string{"summary": instance.Event.Summary, entrymeta.Title: instance.Event.Summary,
+											entrymeta.MimeType: "text/calendar", entrymeta.DateField: "DTSTART"}
+			if instance.Event.Location != "" {
+				metadata["location"] = instance.Event.Location
+			}
+			dataEntry := DataEntry{Uri: calendar, Uuid: u.String(), Kind: kindEvent, FullDate: start.Format("2006-01-02"), Metadata: metadata,
+									MetadataVersion: entrymeta.Version}
+			index.Add(dataEntry.Uuid, start, dataEntry, Card{Summary: instance.Event.Summary, Location: instance.Event.Location,
+											Start: start.Format("2006-01-02T15:04:05"), AllDay: instance.Event.AllDay})
+		}
+
+		progress.Processed += 1
+		progress.Path = calendar
+		pluginsdk.ReportProgress(progress)
+	}
+
+	pluginsdk.DeleteAllKeys(redisConn, TOPIC)
+
+	err = index.Write(redisConn)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't set data in redis: ", err.Error())
+	}
+
+	progress.Path = ""
+	pluginsdk.ReportProgress(progress)
+	return progress.Errors
+}
+
+//the date (and time) together with the location, shown below the summary
+func (c Card) details() string {
+	start, err := time.Parse("2006-01-02T15:04:05", c.Start)
+	if err != nil {
+		return c.Location
+	}
+
+	details := start.Format("Monday, 2 January 2006")
+	if !c.AllDay {
+		details += ", " + start.Format("15:04")
+	}
+	if c.Location != "" {
+		details += "\n" + c.Location
+	}
+	return details
+}
+
+//escapes a text value of an iCalendar property (RFC 5545, section 3.3.11)
+func escapeICalendarText(s string) string {
+	return strings.NewReplacer("\\", "\\\\", ";", "\\;", ",", "\\,", "\r\n", "\\n", "\n", "\\n").Replace(s)
+}
+
+//the event as iCalendar file, with the start in the local time of the calendar (floating time)
+func toICalendar(id string, card Card) ([]byte, error) {
+	start, err := time.Parse("2006-01-02T15:04:05", card.Start)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []string{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//mindfulbytes//" + TOPIC + "//EN", "BEGIN:VEVENT",
+						"UID:" + id, "DTSTAMP:" + time.Now().UTC().Format("20060102T150405Z")}
+	if card.AllDay {
+		lines = append(lines, "DTSTART;VALUE=DATE:" + start.Format("20060102"))
+	} else {
+		lines = append(lines, "DTSTART:" + start.Format("20060102T150405"))
+	}
+	lines = append(lines, "SUMMARY:" + escapeICalendarText(card.Summary))
+	if card.Location != "" {
+		lines = append(lines, "LOCATION:" + escapeICalendarText(card.Location))
+	}
+	lines = append(lines, "END:VEVENT", "END:VCALENDAR")
+	return []byte(strings.Join(lines, "\r\n") + "\r\n"), nil
+}
+
+func (c Card) render(magick string, destination string) error {
+	return pluginsdk.RenderCard(magick, pluginsdk.Card{Background: "#1d3557", Texts: []pluginsdk.CardText{
+		{Text: c.Summary, Height: 260, Color: "white", Align: "center", Position: "north", Offset: 40},
+		{Text: c.details(), Height: 100, Color: "#a8dadc", Align: "center", Position: "south", Offset: 40}}}, destination)
+}
+
+func fetch(redisAddress string, redisMaxConnections int, id string, destination string, variant string, magick string) {
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	serializedCard, err := redis.Bytes(redisConn.Do("GET", TOPIC+":event:"+id))
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read data from redis: ", err.Error())
+	}
+
+	var card Card
+	err = json.Unmarshal(serializedCard, &card)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't parse event: ", err.Error())
+	}
+
+	if variant == variantOriginal {
+		data, err := toICalendar(id, card)
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't convert event: ", err.Error())
+		}
+		err = ioutil.WriteFile(destination, data, 0600)
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't write file ", destination, ": ", err.Error())
+		}
+		return
+	}
+
+	if _, err := exec.LookPath(magick); err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't find ImageMagick: ", err.Error())
+	}
+	err = card.render(magick, destination)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't render card: ", err.Error())
+	}
+}
+
+func main() {
+	crawlCommand := flag.NewFlagSet("crawl", flag.ExitOnError)
+	pathsCrawlCmd := crawlCommand.String("paths", "", "Comma separated list of calendar files (.ics) or directories that contain calendar files")
+	timezoneCrawlCmd := crawlCommand.String("timezone", "", "Time zone (e.g Europe/Vienna) the dates of the events are determined in, defaults to the local time zone")
+
+	fetchCommand := flag.NewFlagSet("fetch", flag.ExitOnError)
+	fetchId := fetchCommand.String("id", "", "Identifier")
+	destinationFetchCmd := fetchCommand.String("destination", "", "Destination")
+	variantFetchCmd := fetchCommand.String("variant", variantOriginal, "Either the original item ('original') or an image of it ('poster')")
+	magickFetchCmd := fetchCommand.String("magick", "magick", "Path to the ImageMagick binary that renders the cards")
+
+	redisMaxConnections := 10
+
+	flag.Parse()
+
+	pluginsdk.SetupLogging()
+
+	if len(os.Args) == 1 {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please use either 'crawl' or 'fetch'")
+	}
+
+	switch os.Args[1] {
+		case "crawl":
+			crawlCommand.Parse(os.Args[2:])
+			paths := []string{}
+			for _, p := range strings.Split(*pathsCrawlCmd, ",") {
+				if strings.TrimSpace(p) != "" {
+					paths = append(paths, strings.TrimSpace(p))
+				}
+			}
+			if len(paths) == 0 {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide at least one path")
+			}
+
+			location := time.Local
+			if *timezoneCrawlCmd != "" {
+				var err error
+				location, err = time.LoadLocation(*timezoneCrawlCmd)
+				if err != nil {
+					pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid time zone: ", err.Error())
+				}
+			}
+
+			skipped := crawl(pluginsdk.GetRedisAddress(), redisMaxConnections, paths, location)
+			if skipped > 0 {
+				os.Exit(pluginsdk.ExitPartialSuccess)
+			}
+
+		case "fetch":
+			fetchCommand.Parse(os.Args[2:])
+			if *fetchId == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a id")
+			}
+
+			if *destinationFetchCmd == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a destination")
+			}
+
+			if *variantFetchCmd != variantOriginal && *variantFetchCmd != variantPoster {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid variant '", *variantFetchCmd, "'")
+			}
+
+			fetch(pluginsdk.GetRedisAddress(), redisMaxConnections, *fetchId, *destinationFetchCmd, *variantFetchCmd, *magickFetchCmd)
+		default:
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, os.Args[1], " is not valid command.")
+	}
+}
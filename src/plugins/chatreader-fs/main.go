@@ -0,0 +1,334 @@
+package main
+
+import (
+	"github.com/bbernhard/mindfulbytes/pluginsdk"
+	"github.com/bbernhard/mindfulbytes/entrymeta"
+	"github.com/bbernhard/mindfulbytes/chatexport"
+	log "github.com/sirupsen/logrus"
+	"github.com/gomodule/redigo/redis"
+	"github.com/gofrs/uuid"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var TOPIC string = "chatreader-fs"
+
+//the kinds of the entries, as declared in meta.yaml
+const (
+	kindText = "text"
+	kindImage = "image"
+)
+
+//the variant is passed by mindfulbytes, the poster is the image of an item (e.g the card of an event)
+const (
+	variantOriginal = "original"
+	variantPoster = "poster"
+)
+
+const (
+	itemMessage = "message"
+	itemImage = "image"
+)
+
+type DataEntry struct {
+	Uri string `json:"uri"`
+	Uuid string `json:"uuid"`
+	FullDate string `json:"fulldate"`
+	DateSource string `json:"datesource,omitempty"`
+	Kind string `json:"kind,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	MetadataVersion int `json:"metadataversion,omitempty"`
+}
+
+//a message or one of its images, everything that's needed to fetch it
+type Item struct {
+	Kind string `json:"kind"`
+	//the image, empty for messages
+	Path string `json:"path,omitempty"`
+	Chat string `json:"chat,omitempty"`
+	Author string `json:"author,omitempty"`
+	Date string `json:"date,omitempty"`
+	Text string `json:"text,omitempty"`
+}
+
+//case insensitive glob patterns (see path.Match), e.g 'Family*' or '+43*'
+type Filter struct {
+	Chats pluginsdk.Patterns
+	Participants pluginsdk.Patterns
+}
+
+func NewFilter(chats string, participants string) (*Filter, error) {
+	filter := &Filter{}
+	var err error
+	filter.Chats, err = pluginsdk.ParsePatterns(chats)
+	if err == nil {
+		filter.Participants, err = pluginsdk.ParsePatterns(participants)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+func (f *Filter) includesChat(name string) bool {
+	return len(f.Chats) == 0 || f.Chats.MatchesAny(name)
+}
+
+//participants are matched by the author of a message
+func (f *Filter) includesParticipant(author string) bool {
+	return len(f.Participants) == 0 || f.Participants.MatchesAny(author)
+}
+
+//returns the number of exports that couldn't be read
+func crawl(redisAddress string, redisMaxConnections int, paths []string, filter *Filter, images bool, minLength int,
+			options chatexport.Options) int {
+	exports := []chatexport.Export{}
+	for _, p := range paths {
+		e, err := chatexport.FindExports(p)
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't find chat exports in ", p, ": ", err.Error())
+		}
+		exports = append(exports, e...)
+	}
+
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	index := pluginsdk.NewIndex(TOPIC, "item")
+	progress := pluginsdk.Progress{Discovered: len(exports)}
+	//exports of the same chat from different times contain the same messages
+	seen := make(map[string]bool)
+
+	addEntry := func(uri string, item Item, date time.Time, metadata map[string]string) {
+		u, err := uuid.NewV4()
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't create UUID: ", err.Error())
+		}
+
+		kind := kindText
+		if item.Kind == itemImage {
+			kind = kindImage
+		}
+		dataEntry := DataEntry{Uri: uri, Uuid: u.String(), Kind: kind, FullDate: date.Format("2006-01-02"), Metadata: metadata,
+								MetadataVersion: entrymeta.Version}
+		index.Add(dataEntry.Uuid, date, dataEntry, item)
+	}
+
+	for _, export := range exports {
+		log.Debug("Processing ", export.Format, " export ", export.Path)
+		messages, err := export.Read(options)
+		if err != nil {
+			log.Error("Couldn't read ", export.Format, " export ", export.Path, ": ", err.Error())
+			progress.Errors += 1
+			progress.Processed += 1
+			continue
+		}
+
+		for _, message := range messages {
+			if !filter.includesChat(message.Chat) || !filter.includesParticipant(message.Author) {
+				continue
+			}
+
+			key := message.Chat + "\x00" + message.Author + "\x00" + strconv.FormatInt(message.Time.Unix(), 10) + "\x00" + message.Text
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			date := message.Time.In(options.Location)
+			metadata := map[string]string{"chat": message.Chat, "author": message.Author, "format": export.Format}
+			if len([]rune(message.Text)) >= minLength {
+				messageMetadata := map[string]string{"text": message.Text}
+				for key, value := range metadata {
+					messageMetadata[key] = value
+				}
+				addEntry(export.Path, Item{Kind: itemMessage, Chat: message.Chat, Author: message.Author,
+											Date: date.Format("2006-01-02T15:04:05"), Text: message.Text}, date, messageMetadata)
+			}
+
+			if images {
+				for _, image := range message.Images {
+					imageMetadata := map[string]string{"filename": filepath.Base(image), entrymeta.MimeType: entrymeta.MimeTypeByExtension(image)}
+					for key, value := range metadata {
+						imageMetadata[key] = value
+					}
+					addEntry(image, Item{Kind: itemImage, Path: image}, date, imageMetadata)
+				}
+			}
+		}
+
+		progress.Processed += 1
+		progress.Path = export.Path
+		pluginsdk.ReportProgress(progress)
+	}
+
+	pluginsdk.DeleteAllKeys(redisConn, TOPIC)
+
+	err := index.Write(redisConn)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't set data in redis: ", err.Error())
+	}
+
+	progress.Path = ""
+	pluginsdk.ReportProgress(progress)
+	return progress.Errors
+}
+
+//the card of a message shows its text, the author and the chat
+func (item Item) renderCard(magick string, destination string) error {
+	details := item.Author
+	if item.Chat != "" && item.Chat != item.Author {
+		details += " in " + item.Chat
+	}
+	if date, err := time.Parse("2006-01-02T15:04:05", item.Date); err == nil {
+		details += "\n" + date.Format("Monday, 2 January 2006, 15:04")
+	}
+
+	return pluginsdk.RenderCard(magick, pluginsdk.Card{Background: "#075e54", Texts: []pluginsdk.CardText{
+		{Text: item.Text, Height: 320, Color: "white", Align: "center", Position: "north", Offset: 30},
+		{Text: details, Height: 70, Color: "#dcf8c6", Align: "west", Position: "south", Offset: 30}}}, destination)
+}
+
+func fetch(redisAddress string, redisMaxConnections int, id string, destination string, variant string, magick string) {
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	serializedItem, err := redis.Bytes(redisConn.Do("GET", TOPIC+":item:"+id))
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read data from redis: ", err.Error())
+	}
+
+	var item Item
+	err = json.Unmarshal(serializedItem, &item)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't parse item: ", err.Error())
+	}
+
+	//the original of a message is its text, images don't have a poster
+	if item.Kind == itemMessage && variant == variantOriginal {
+		err = ioutil.WriteFile(destination, []byte(item.Text), 0600)
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't write file ", destination, ": ", err.Error())
+		}
+		return
+	}
+
+	if item.Kind == itemMessage {
+		if _, err := exec.LookPath(magick); err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't find ImageMagick: ", err.Error())
+		}
+		err = item.renderCard(magick, destination)
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't render card: ", err.Error())
+		}
+		return
+	}
+
+	data, err := ioutil.ReadFile(item.Path)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read image ", item.Path, ": ", err.Error())
+	}
+
+	err = ioutil.WriteFile(destination, data, 0600)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't write file ", destination, ": ", err.Error())
+	}
+}
+
+func main() {
+	crawlCommand := flag.NewFlagSet("crawl", flag.ExitOnError)
+	pathsCrawlCmd := crawlCommand.String("paths", "", "Comma separated list of chat exports or directories that contain chat exports")
+	chatsCrawlCmd := crawlCommand.String("chats", "", "Comma separated list of patterns, only matching chats are indexed (e.g 'Family*')")
+	participantsCrawlCmd := crawlCommand.String("participants", "", "Comma separated list of patterns, only messages of matching authors are indexed")
+	imagesCrawlCmd := crawlCommand.String("images", "true", "Index the images of the chats")
+	minLengthCrawlCmd := crawlCommand.String("min-length", "10", "Messages with fewer characters aren't indexed")
+	dateOrderCrawlCmd := crawlCommand.String("date-order", chatexport.DateOrderAuto, "Order of day and month in WhatsApp exports (auto, dmy or mdy)")
+	timezoneCrawlCmd := crawlCommand.String("timezone", "", "Time zone (e.g Europe/Vienna) of the exports and the dates of the messages, defaults to the local time zone")
+
+	fetchCommand := flag.NewFlagSet("fetch", flag.ExitOnError)
+	fetchId := fetchCommand.String("id", "", "Identifier")
+	destinationFetchCmd := fetchCommand.String("destination", "", "Destination")
+	variantFetchCmd := fetchCommand.String("variant", variantOriginal, "Either the original item ('original') or an image of it ('poster')")
+	magickFetchCmd := fetchCommand.String("magick", "magick", "Path to the ImageMagick binary that renders the messages")
+
+	redisMaxConnections := 10
+
+	flag.Parse()
+
+	pluginsdk.SetupLogging()
+
+	if len(os.Args) == 1 {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please use either 'crawl' or 'fetch'")
+	}
+
+	switch os.Args[1] {
+		case "crawl":
+			crawlCommand.Parse(os.Args[2:])
+			paths := pluginsdk.SplitList(*pathsCrawlCmd)
+			if len(paths) == 0 {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide at least one path")
+			}
+
+			filter, err := NewFilter(*chatsCrawlCmd, *participantsCrawlCmd)
+			if err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid filter: ", err.Error())
+			}
+
+			images, err := strconv.ParseBool(*imagesCrawlCmd)
+			if err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid value for images: ", *imagesCrawlCmd)
+			}
+
+			minLength, err := strconv.Atoi(*minLengthCrawlCmd)
+			if err != nil || minLength < 1 {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid value for min-length: ", *minLengthCrawlCmd)
+			}
+
+			options := chatexport.Options{Location: time.Local, DateOrder: *dateOrderCrawlCmd}
+			if options.DateOrder != chatexport.DateOrderAuto && options.DateOrder != chatexport.DateOrderDMY &&
+					options.DateOrder != chatexport.DateOrderMDY {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid value for date-order: ", options.DateOrder)
+			}
+			if *timezoneCrawlCmd != "" {
+				options.Location, err = time.LoadLocation(*timezoneCrawlCmd)
+				if err != nil {
+					pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid time zone: ", err.Error())
+				}
+			}
+
+			failed := crawl(pluginsdk.GetRedisAddress(), redisMaxConnections, paths, filter, images, minLength, options)
+			if failed > 0 {
+				os.Exit(pluginsdk.ExitPartialSuccess)
+			}
+
+		case "fetch":
+			fetchCommand.Parse(os.Args[2:])
+			if *fetchId == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a id")
+			}
+
+			if *destinationFetchCmd == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a destination")
+			}
+
+			if *variantFetchCmd != variantOriginal && *variantFetchCmd != variantPoster {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid variant '", *variantFetchCmd, "'")
+			}
+
+			fetch(pluginsdk.GetRedisAddress(), redisMaxConnections, *fetchId, *destinationFetchCmd, *variantFetchCmd, *magickFetchCmd)
+		default:
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, os.Args[1], " is not valid command.")
+	}
+}
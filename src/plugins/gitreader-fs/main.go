@@ -0,0 +1,292 @@
+package main
+
+import (
+	"github.com/bbernhard/mindfulbytes/pluginsdk"
+	"github.com/bbernhard/mindfulbytes/entrymeta"
+	"github.com/bbernhard/mindfulbytes/gitlog"
+	log "github.com/sirupsen/logrus"
+	"github.com/gomodule/redigo/redis"
+	"github.com/gofrs/uuid"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var TOPIC string = "gitreader-fs"
+
+//the kind of the entries, as declared in meta.yaml
+const kindText = "text"
+
+//the variant is passed by mindfulbytes, the poster is the image of an item (e.g the card of an event)
+const (
+	variantOriginal = "original"
+	variantPoster = "poster"
+)
+
+type DataEntry struct {
+	Uri string `json:"uri"`
+	Uuid string `json:"uuid"`
+	FullDate string `json:"fulldate"`
+	DateSource string `json:"datesource,omitempty"`
+	Kind string `json:"kind,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	MetadataVersion int `json:"metadataversion,omitempty"`
+}
+
+//everything that's needed to render the card of a commit, so that fetch doesn't need to run git again
+type Card struct {
+	Repository string `json:"repository"`
+	Subject string `json:"subject"`
+	Hash string `json:"hash"`
+	Author string `json:"author"`
+	Date string `json:"date"`
+	DiffStat string `json:"diffstat,omitempty"`
+}
+
+//how deep the configured directories are searched for repositories
+const maxRepositoryDepth = 4
+
+//a repository together with the name it's shown with, i.e its path relative to the configured directory
+type Repository struct {
+	Name string
+	Path string
+}
+
+func findRepositories(paths []string) ([]Repository, error) {
+	repositories := []Repository{}
+	for _, p := range paths {
+		found, err := gitlog.FindRepositories(p, maxRepositoryDepth)
+		if err != nil {
+			return repositories, err
+		}
+		if len(found) == 0 {
+			log.Info("No repositories found in ", p)
+		}
+
+		for _, repository := range found {
+			name, err := filepath.Rel(p, repository)
+			if err != nil || name == "." {
+				name = filepath.Base(repository)
+			}
+			repositories = append(repositories, Repository{Name: strings.TrimSuffix(filepath.ToSlash(name), ".git"), Path: repository})
+		}
+	}
+	return repositories, nil
+}
+
+//returns the number of repositories that couldn't be read
+func crawl(redisAddress string, redisMaxConnections int, gitBinary string, paths []string, identities *gitlog.Identities,
+			location *time.Location) int {
+	repositories, err := findRepositories(paths)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't find repositories: ", err.Error())
+	}
+
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	index := pluginsdk.NewIndex(TOPIC, "commit")
+	progress := pluginsdk.Progress{Discovered: len(repositories)}
+	//forks and clones of the same repository contain the same commits
+	seen := make(map[string]bool)
+
+	for _, repository := range repositories {
+		log.Debug("Processing repository ", repository.Path)
+		commits, err := gitlog.Read(gitBinary, repository.Path)
+		if err != nil {
+			log.Error("Couldn't read repository ", repository.Path, ": ", err.Error())
+			progress.Errors += 1
+			progress.Processed += 1
+			continue
+		}
+
+		for _, commit := range commits {
+			if seen[commit.Hash] || !identities.Matches(commit) {
+				continue
+			}
+			seen[commit.Hash] = true
+
+			u, err := uuid.NewV4()
+			if err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't create UUID: ", err.Error())
+			}
+
+			date := commit.AuthorDate
+			if location != nil {
+				date = date.In(location)
+			}
+			metadata := map[string]string{"repository": repository.Name, "message": commit.Subject, "commit": commit.Hash[:7],
+											entrymeta.Title: commit.Subject, entrymeta.DateField: "AuthorDate"}
+			if commit.DiffStat != "" {
+				metadata["diffstat"] = commit.DiffStat
+			}
+			dataEntry := DataEntry{Uri: repository.Path, Uuid: u.String(), Kind: kindText, FullDate: date.Format("2006-01-02"), Metadata: metadata,
+									MetadataVersion: entrymeta.Version}
+			index.Add(dataEntry.Uuid, date, dataEntry, Card{Repository: repository.Name, Subject: commit.Subject, Hash: commit.Hash[:7],
+											Author: commit.AuthorName, Date: date.Format("2006-01-02T15:04:05"),
+											DiffStat: commit.DiffStat})
+		}
+
+		progress.Processed += 1
+		progress.Path = repository.Path
+		pluginsdk.ReportProgress(progress)
+	}
+
+	pluginsdk.DeleteAllKeys(redisConn, TOPIC)
+
+	err = index.Write(redisConn)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't set data in redis: ", err.Error())
+	}
+
+	progress.Path = ""
+	pluginsdk.ReportProgress(progress)
+	return progress.Errors
+}
+
+//the repository, commit, author and date together with the diffstat, shown below the subject
+func (c Card) details() string {
+	details := c.Repository + " @ " + c.Hash + "\n" + c.Author
+	date, err := time.Parse("2006-01-02T15:04:05", c.Date)
+	if err == nil {
+		details += ", " + date.Format("Monday, 2 January 2006, 15:04")
+	}
+	if c.DiffStat != "" {
+		details += "\n" + c.DiffStat
+	}
+	return details
+}
+
+func (c Card) render(magick string, destination string) error {
+	return pluginsdk.RenderCard(magick, pluginsdk.Card{Background: "#24292e", Texts: []pluginsdk.CardText{
+		{Text: c.Subject, Height: 240, Color: "white", Align: "center", Position: "north", Offset: 40},
+		{Text: c.details(), Height: 130, Color: "#79b8ff", Align: "center", Position: "south", Offset: 40}}}, destination)
+}
+
+func fetch(redisAddress string, redisMaxConnections int, id string, destination string, variant string, magick string) {
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	serializedCard, err := redis.Bytes(redisConn.Do("GET", TOPIC+":commit:"+id))
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read data from redis: ", err.Error())
+	}
+
+	var card Card
+	err = json.Unmarshal(serializedCard, &card)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't parse commit: ", err.Error())
+	}
+
+	//the original is the commit as shown by git log --stat
+	if variant == variantOriginal {
+		text := "commit " + card.Hash + " (" + card.Repository + ")\nAuthor: " + card.Author + "\nDate:   " + card.Date +
+					"\n\n    " + card.Subject + "\n"
+		if card.DiffStat != "" {
+			text += "\n " + card.DiffStat + "\n"
+		}
+		err = ioutil.WriteFile(destination, []byte(text), 0600)
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't write file ", destination, ": ", err.Error())
+		}
+		return
+	}
+
+	if _, err := exec.LookPath(magick); err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't find ImageMagick: ", err.Error())
+	}
+	err = card.render(magick, destination)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't render card: ", err.Error())
+	}
+}
+
+func main() {
+	crawlCommand := flag.NewFlagSet("crawl", flag.ExitOnError)
+	pathsCrawlCmd := crawlCommand.String("paths", "", "Comma separated list of repositories or directories that contain repositories")
+	authorsCrawlCmd := crawlCommand.String("authors", "", "Comma separated list of patterns, only commits of matching author names or email addresses are indexed (e.g 'jane@example.com,*@example.org')")
+	timezoneCrawlCmd := crawlCommand.String("timezone", "", "Time zone (e.g Europe/Vienna) the dates of the commits are determined in, defaults to the time zone of the author")
+	gitCrawlCmd := crawlCommand.String("git", "git", "Path to the git binary")
+
+	fetchCommand := flag.NewFlagSet("fetch", flag.ExitOnError)
+	fetchId := fetchCommand.String("id", "", "Identifier")
+	destinationFetchCmd := fetchCommand.String("destination", "", "Destination")
+	variantFetchCmd := fetchCommand.String("variant", variantOriginal, "Either the original item ('original') or an image of it ('poster')")
+	magickFetchCmd := fetchCommand.String("magick", "magick", "Path to the ImageMagick binary that renders the cards")
+
+	redisMaxConnections := 10
+
+	flag.Parse()
+
+	pluginsdk.SetupLogging()
+
+	if len(os.Args) == 1 {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please use either 'crawl' or 'fetch'")
+	}
+
+	switch os.Args[1] {
+		case "crawl":
+			crawlCommand.Parse(os.Args[2:])
+			paths := []string{}
+			for _, p := range strings.Split(*pathsCrawlCmd, ",") {
+				if strings.TrimSpace(p) != "" {
+					paths = append(paths, strings.TrimSpace(p))
+				}
+			}
+			if len(paths) == 0 {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide at least one path")
+			}
+
+			identities, err := gitlog.NewIdentities(*authorsCrawlCmd)
+			if err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid authors: ", err.Error())
+			}
+
+			if _, err := exec.LookPath(*gitCrawlCmd); err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't find git: ", err.Error())
+			}
+
+			//nil keeps the time zone of the author
+			var location *time.Location
+			if *timezoneCrawlCmd != "" {
+				location, err = time.LoadLocation(*timezoneCrawlCmd)
+				if err != nil {
+					pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid time zone: ", err.Error())
+				}
+			}
+
+			failed := crawl(pluginsdk.GetRedisAddress(), redisMaxConnections, *gitCrawlCmd, paths, identities, location)
+			if failed > 0 {
+				os.Exit(pluginsdk.ExitPartialSuccess)
+			}
+
+		case "fetch":
+			fetchCommand.Parse(os.Args[2:])
+			if *fetchId == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a id")
+			}
+
+			if *destinationFetchCmd == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a destination")
+			}
+
+			if *variantFetchCmd != variantOriginal && *variantFetchCmd != variantPoster {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid variant '", *variantFetchCmd, "'")
+			}
+
+			fetch(pluginsdk.GetRedisAddress(), redisMaxConnections, *fetchId, *destinationFetchCmd, *variantFetchCmd, *magickFetchCmd)
+		default:
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, os.Args[1], " is not valid command.")
+	}
+}
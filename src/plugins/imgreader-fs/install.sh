@@ -1,4 +1,5 @@
 #!/bin/bash
 
 cp meta.yaml ${PLUGIN_DEST}/meta.yaml
-cp imgreader.py ${PLUGIN_DEST}/imgreader.py
+go build -o main .
+cp main ${PLUGIN_DEST}/main
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"github.com/bbernhard/mindfulbytes/pluginsdk"
+	"github.com/bbernhard/mindfulbytes/entrymeta"
+	"github.com/bbernhard/mindfulbytes/imagedate"
+	log "github.com/sirupsen/logrus"
+	"github.com/gomodule/redigo/redis"
+	"github.com/gofrs/uuid"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+var TOPIC string = "imgreader-fs"
+
+//the kind of the entries, as declared in meta.yaml
+const kindImage = "image"
+
+var EXTENSIONS = []string{".jpg", ".jpeg", ".png", ".heic", ".heif", ".webp", ".tif", ".tiff",
+							".dng", ".cr2", ".nef", ".arw", ".orf", ".rw2", ".pef", ".srw", ".raf"}
+
+type DataEntry struct {
+	Uri string `json:"uri"`
+	Uuid string `json:"uuid"`
+	FullDate string `json:"fulldate"`
+	DateSource string `json:"datesource,omitempty"`
+	Kind string `json:"kind,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	MetadataVersion int `json:"metadataversion,omitempty"`
+}
+
+func isSupportedImage(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range EXTENSIONS {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+//returns the number of files and directories that were skipped
+func crawl(redisAddress string, redisMaxConnections int, directory string, workers int, dateExtractor *imagedate.Extractor) int {
+	info, err := os.Stat(directory)
+	if err != nil || !info.IsDir() {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, directory, " doesn't exist or is not a directory")
+	}
+
+	//create redis pool
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	stats := &pluginsdk.CrawlStats{}
+	files := pluginsdk.WalkDirectory(directory, workers, isSupportedImage, stats)
+
+	var mutex sync.Mutex
+	index := pluginsdk.NewIndex(TOPIC, "image")
+	lastProgressReport := time.Time{}
+
+	processors := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		processors.Add(1)
+		go func() {
+			defer processors.Done()
+			for file := range files {
+				log.Debug("Processing file ", file.Path)
+				image := imagedate.NewLocalImage(file.Path, file.Info)
+				result, err := dateExtractor.GetDate(image)
+				if err != nil {
+					log.Error("Couldn't determine date of ", file.Path, ": ", err.Error())
+					stats.AddError()
+					stats.AddProcessed()
+					continue
+				}
+
+				u, err := uuid.NewV4()
+				if err != nil {
+					pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't create UUID: ", err.Error())
+				}
+
+				fullDate := result.Time.Format("2006-01-02")
+				//description, location and tags from the sidecar files (e.g of a Google Takeout export), camera and dimensions from the EXIF data
+				dataEntry := DataEntry{Uri: file.Path, Uuid: u.String(), Kind: kindImage, FullDate: fullDate, DateSource: result.Source,
+										Metadata: dateExtractor.GetMetadata(image), MetadataVersion: entrymeta.Version}
+
+				mutex.Lock()
+				index.Add(dataEntry.Uuid, result.Time, dataEntry, dataEntry.Uri)
+				stats.AddProcessed()
+				if time.Since(lastProgressReport) > 500 * time.Millisecond {
+					lastProgressReport = time.Now()
+					pluginsdk.ReportProgress(stats.Progress(file.Path))
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	processors.Wait()
+
+	pluginsdk.DeleteAllKeys(redisConn, TOPIC)
+
+	err = index.Write(redisConn)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't set data in redis: ", err.Error())
+	}
+
+	pluginsdk.ReportProgress(stats.Progress(""))
+	return stats.Errors()
+}
+
+func fetch(redisAddress string, redisMaxConnections int, id string, destination string) {
+	//create redis pool
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	path, err := redis.String(redisConn.Do("GET", TOPIC+":image:"+id))
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read data from redis: ", err.Error())
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't open file ", path, ": ", err.Error())
+	}
+	defer src.Close()
+
+	dest, err := os.Create(destination)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't create file ", destination, ": ", err.Error())
+	}
+	defer dest.Close()
+
+	_, err = io.Copy(dest, src)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't write file ", destination, ": ", err.Error())
+	}
+}
+
+func main() {
+	crawlCommand := flag.NewFlagSet("crawl", flag.ExitOnError)
+	directoryCrawlCmd := crawlCommand.String("directory", "", "Path to the image directory")
+	workersCrawlCmd := crawlCommand.Int("workers", runtime.NumCPU(), "Number of images that are processed in parallel")
+	dateStrategiesCrawlCmd := crawlCommand.String("date-strategies", strings.Join(imagedate.DefaultStrategies, ","), "Comma separated list of sources the date of an image is taken from")
+	filenamePatternCrawlCmd := crawlCommand.String("filename-pattern", "", "Regular expression with the named groups 'year', 'month' and 'day' to extract the date from the filename")
+
+	fetchCommand := flag.NewFlagSet("fetch", flag.ExitOnError)
+	fetchId := fetchCommand.String("id", "", "Identifier")
+	destinationFetchCmd := fetchCommand.String("destination", "", "Destination")
+
+	redisMaxConnections := 10
+
+	flag.Parse()
+
+	pluginsdk.SetupLogging()
+
+	if len(os.Args) == 1 {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please use either 'crawl' or 'fetch'")
+	}
+
+	switch os.Args[1] {
+		case "crawl":
+			crawlCommand.Parse(os.Args[2:])
+			if *directoryCrawlCmd == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a directory")
+			}
+
+			if *workersCrawlCmd <= 0 {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a valid number of workers")
+			}
+
+			dateStrategies, err := imagedate.ParseStrategies(*dateStrategiesCrawlCmd)
+			if err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, err.Error())
+			}
+
+			dateExtractor := imagedate.NewExtractor(dateStrategies)
+			if *filenamePatternCrawlCmd != "" {
+				err = dateExtractor.SetFilenamePattern(*filenamePatternCrawlCmd)
+				if err != nil {
+					pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid filename pattern: ", err.Error())
+				}
+			}
+
+			skipped := crawl(pluginsdk.GetRedisAddress(), redisMaxConnections, *directoryCrawlCmd, *workersCrawlCmd, dateExtractor)
+			if skipped > 0 {
+				os.Exit(pluginsdk.ExitPartialSuccess)
+			}
+
+		case "fetch":
+			fetchCommand.Parse(os.Args[2:])
+			if *fetchId == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a id")
+			}
+
+			if *destinationFetchCmd == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a destination")
+			}
+
+			fetch(pluginsdk.GetRedisAddress(), redisMaxConnections, *fetchId, *destinationFetchCmd)
+		default:
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, os.Args[1], " is not valid command.")
+	}
+}
@@ -1,5 +1,5 @@
 #!/bin/bash
 
 cp meta.yaml ${PLUGIN_DEST}/meta.yaml
-go build main.go
+go build -o main .
 cp main ${PLUGIN_DEST}/main
@@ -1,192 +1,139 @@
 package main
 
 import (
-	"github.com/studio-b12/gowebdav"
+	"github.com/bbernhard/mindfulbytes/pluginsdk"
+	"github.com/bbernhard/mindfulbytes/entrymeta"
+	"github.com/bbernhard/mindfulbytes/imagedate"
+	"github.com/bbernhard/mindfulbytes/webdavimages"
 	log "github.com/sirupsen/logrus"
-	"strings"
-	"time"
+	"path/filepath"
 	"flag"
 	"github.com/gomodule/redigo/redis"
 	"github.com/gofrs/uuid"
-	"encoding/json"
 	"encoding/binary"
-	"bytes"
 	"os"
 )
 
 var TOPIC string = "imgreader-nc"
 
-type FileInfo struct {
-	Path string
-	ModificationTime time.Time
-}
+//the kind of the entries, as declared in meta.yaml
+const kindImage = "image"
+
+const defaultDateStrategies = "exif,xmp,sidecar-json,filename,mtime"
+
+//the extracted EXIF dates are kept in the plugin's cache directory, keyed by the ETag of the image
+const exifDateCacheFile = "exif-dates.json"
+
+//the folder listings of the last crawl are kept in the plugin's cache directory
+const folderCacheFile = "folders.json"
 
 type DataEntry struct {
 	Uri string `json:"uri"`
 	Uuid string `json:"uuid"`
 	FullDate string `json:"fulldate"`
+	DateSource string `json:"datesource,omitempty"`
+	Kind string `json:"kind,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	MetadataVersion int `json:"metadataversion,omitempty"`
 }
 
-type OutputSplitter struct{}
-
-func (splitter *OutputSplitter) Write(p []byte) (n int, err error) {
-	if bytes.Contains(p, []byte("level=error")) {
-		return os.Stderr.Write(p)
-	}
-	return os.Stdout.Write(p)
-}
-
-func getRedisAddress() string {
-	redisAddress := os.Getenv("REDIS_ADDRESS")
-	if redisAddress == "" {
-		return ":6379"
-	}
-
-	return redisAddress
-}
-
-func getFilesRecursively(client *gowebdav.Client, dir string, totalFiles *[]FileInfo) error {
-	files, err := client.ReadDir(dir)
-	if err != nil {
-		return err
-	}
-
-	for _, file := range files {
-		fullPath := dir 
-		if !strings.HasSuffix(fullPath, "/") {
-			fullPath += "/"
-		}
-		fullPath += file.Name()
-
-		log.Debug("Fetching file ", fullPath)
-		
-		if file.IsDir() {
-			getFilesRecursively(client, fullPath, totalFiles)
-		} else {
-			//we are only interested in images
-			contentType := file.(gowebdav.File).ContentType()
-			contentTypeParts := strings.Split(contentType, "/")
-			if len(contentTypeParts) < 2 {
-				log.Debug("Skipping ", fullPath, " as we've got an invalid content type (content type: ", contentType, ")")
-				continue
-			}
-
-			if contentTypeParts[0] == "image" {
-				*totalFiles = append(*totalFiles, FileInfo{Path: fullPath, ModificationTime: file.ModTime()})
-			} else {
-				log.Debug("Skipping ", fullPath, " as we've got an invalid content type (content type: ", contentType, ")")
-			}
-		}
-	}
-
-	return nil
-}
-
-
-func crawl(redisAddress string, redisMaxConnections int, nextcloudWebDavUrl string, nextcloudAppToken string, nextcloudRootDir string) {
+//returns the number of skipped directories and files and false in case nothing changed since the last crawl
+func crawl(redisAddress string, redisMaxConnections int, nextcloudWebDavUrl string, nextcloudAppToken string, nextcloudRootDir string,
+			filter *webdavimages.PathFilter, workers int, folderCachePath string, crawlSettings string,
+			dateExtractor *imagedate.Extractor) (int, bool) {
 	//create redis pool
-	redisPool := redis.NewPool(func() (redis.Conn, error) {
-		c, err := redis.Dial("tcp", redisAddress)
-
-		if err != nil {
-			log.Fatal("[Main] Couldn't dial redis: ", err.Error())
-		}
-
-		return c, err
-	}, redisMaxConnections)
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
 	defer redisPool.Close()
 
 	redisConn := redisPool.Get()
 	defer redisConn.Close()
 
-	c := gowebdav.NewClient(nextcloudWebDavUrl, "", "")
-	c.SetHeader("Authorization", "Bearer " + nextcloudAppToken)
-	
-	files := []FileInfo{}
-	err := getFilesRecursively(c, nextcloudRootDir, &files)
+	server, err := webdavimages.NewServer(nextcloudWebDavUrl, webdavimages.Auth{Token: nextcloudAppToken}, "")
 	if err != nil {
-		log.Fatal("Couldn't get files: ", err.Error())
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't connect to Nextcloud: ", err.Error())
 	}
 
-	//delete all existing keys
-	existingKeys, err := redis.Strings(redisConn.Do("KEYS", TOPIC+":*"))
-	if err != nil {
-		log.Fatal("Couldn't clear existing keys in redis")
-	}
-	for _, existingKey := range existingKeys {
-		_, err = redisConn.Do("DEL", existingKey)
+	walker := webdavimages.NewWalker(server, filter, workers)
+	walker.SetProgressHandler(func(discovered int, failedFolders int, folder string) {
+		pluginsdk.ReportProgress(pluginsdk.Progress{Discovered: discovered, Errors: failedFolders, Path: folder})
+	})
+	if folderCachePath != "" {
+		previousFolders, err := webdavimages.LoadFolderCache(folderCachePath, nextcloudWebDavUrl, crawlSettings)
 		if err != nil {
-			log.Fatal("Couldn't delete key in redis: ", err.Error())
+			log.Warn("Couldn't load folder cache, listing all folders: ", err.Error())
 		}
+		//nextcloud changes the ETag of a folder whenever something below it changes
+		walker.SetFolderCache(previousFolders)
 	}
 
+	err = walker.Walk(nextcloudRootDir)
+	if err != nil {
+		if webdavimages.IsConfigError(err) {
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't get files (please check the Nextcloud URL, token and root directory): ", err.Error())
+		}
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't get files: ", err.Error())
+	}
+	files := walker.Files()
+	sidecars := walker.Sidecars()
+	skipped := walker.FailedFolders()
+	log.Info("Found ", len(files), " images in ", len(walker.Listings()), " folders (", walker.UnchangedFolders(),
+			" unchanged since the last crawl, ", walker.FailedFolders(), " failed)")
+
+	//the entries of the last crawl are still up to date (unless redis was flushed in the meantime)
+	if walker.Unchanged() && pluginsdk.HasKeys(redisConn, TOPIC) {
+		log.Info("Nothing changed since the last crawl")
+		pluginsdk.ReportProgress(pluginsdk.Progress{Discovered: len(files), Processed: len(files)})
+		return 0, false
+	}
 
-	imagesPerDate := make(map[string][]DataEntry)
-	imagesPerFullDate := make(map[string][]DataEntry)
-	for _, file := range files {
-		log.Debug("Processing file ", file.Path) 
+	index := pluginsdk.NewIndex(TOPIC, "image")
+	for i, file := range files {
+		log.Debug("Processing file ", file.Path)
+		pluginsdk.ReportProgress(pluginsdk.Progress{Discovered: len(files), Processed: i, Path: file.Path})
 		u, err := uuid.NewV4()
 		if err != nil {
-			log.Fatal("Couldn't create UUID: ", err.Error())
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't create UUID: ", err.Error())
 		}
 
-		date := file.ModificationTime.Format("01-02")
-		fullDate := file.ModificationTime.Format("2006-01-02")
-		dataEntry := DataEntry{Uri: file.Path, Uuid: u.String(), FullDate: fullDate}
-
-		if _, ok := imagesPerDate[date]; ok {
-			imagesPerDate[date] = append(imagesPerDate[date], dataEntry)
-		} else {
-			imagesPerDate[date] = []DataEntry{dataEntry}
-		}
-
-		if _, ok := imagesPerFullDate[fullDate]; ok {
-			imagesPerFullDate[fullDate] = append(imagesPerFullDate[fullDate], dataEntry)
-		} else {
-			imagesPerFullDate[fullDate] = []DataEntry{dataEntry}
-		}
-		_, err = redisConn.Do("SET", TOPIC+":image:" + u.String(), file.Path)
+		image := server.NewImage(file, sidecars)
+		result, err := dateExtractor.GetDate(image)
 		if err != nil {
-			log.Fatal("Couldn't set data in redis: ", err.Error())
+			log.Error("Skipping ", file.Path, ", couldn't determine date: ", err.Error())
+			skipped += 1
+			continue
 		}
-	}
 
-	for key, value := range imagesPerDate {
-		serializedData, err := json.Marshal(value)
-		if err != nil {
-			log.Fatal("Couldn't marshal entry: ", err.Error())
-		}
+		fullDate := result.Time.Format("2006-01-02")
+		//description, location and tags from the sidecar files (e.g of a Google Takeout export), camera and dimensions from the EXIF data
+		dataEntry := DataEntry{Uri: file.Path, Uuid: u.String(), Kind: kindImage, FullDate: fullDate, DateSource: result.Source,
+								Metadata: dateExtractor.GetMetadata(image), MetadataVersion: entrymeta.Version}
 
-		_, err = redisConn.Do("SET", TOPIC+":date:" + key, serializedData)
-		if err != nil {
-			log.Fatal("Couldn't set data in redis: ", err.Error())
-		}
+		index.Add(dataEntry.Uuid, result.Time, dataEntry, file.Path)
 	}
 
-	for key, value := range imagesPerFullDate {
-		serializedData, err := json.Marshal(value)
-		if err != nil {
-			log.Fatal("Couldn't marshal entry: ", err.Error())
-		}
+	//the existing entries are kept as long as possible, as looking up the dates of the images takes a while
+	pluginsdk.DeleteAllKeys(redisConn, TOPIC)
 
-		_, err = redisConn.Do("SET", TOPIC+":fulldate:" + key, serializedData)
+	err = index.Write(redisConn)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't set data in redis: ", err.Error())
+	}
+
+	//the next crawl only lists the folders that changed in the meantime
+	if folderCachePath != "" {
+		err = webdavimages.SaveFolderCache(folderCachePath, nextcloudWebDavUrl, crawlSettings, walker.Listings())
 		if err != nil {
-			log.Fatal("Couldn't set data in redis: ", err.Error())
+			log.Warn("Couldn't save folder cache: ", err.Error())
 		}
 	}
+
+	pluginsdk.ReportProgress(pluginsdk.Progress{Discovered: len(files), Processed: len(files), Errors: skipped})
+	return skipped, true
 }
 
 func fetch(redisAddress string, redisMaxConnections int, nextcloudWebDavUrl string, nextcloudAppToken string, id string, destination string) {
 	//create redis pool
-	redisPool := redis.NewPool(func() (redis.Conn, error) {
-		c, err := redis.Dial("tcp", redisAddress)
-
-		if err != nil {
-			log.Fatal("[Main] Couldn't dial redis: ", err.Error())
-		}
-
-		return c, err
-	}, redisMaxConnections)
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
 	defer redisPool.Close()
 
 	redisConn := redisPool.Get()
@@ -197,28 +144,30 @@ func fetch(redisAddress string, redisMaxConnections int, nextcloudWebDavUrl stri
 
 	webDavFilePathBytes, err := redis.Bytes(redisConn.Do("GET", key))
 	if err != nil {
-		log.Fatal("Couldn't read data from redis: ", err.Error())
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read data from redis: ", err.Error())
 	}
 
 	webDavFilePath := string(webDavFilePathBytes)
 	log.Info(webDavFilePath)
 	
-	c := gowebdav.NewClient(nextcloudWebDavUrl, "", "")
-	c.SetHeader("Authorization", "Bearer " + nextcloudAppToken)
+	server, err := webdavimages.NewServer(nextcloudWebDavUrl, webdavimages.Auth{Token: nextcloudAppToken}, "")
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't connect to Nextcloud: ", err.Error())
+	}
 
-	bytes, err := c.Read(webDavFilePath)
+	bytes, err := server.Read(webDavFilePath)
 	if err != nil {
-		log.Fatal("Couldn't read file ", webDavFilePath, ": ", err.Error())
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read file ", webDavFilePath, ": ", err.Error())
 	}
 
 	f, err := os.Create(destination)
 	if err != nil {
-		log.Fatal("Couldn't create file ", destination, ": ", err.Error())
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't create file ", destination, ": ", err.Error())
 	}
 
 	err = binary.Write(f, binary.LittleEndian, bytes)
 	if err != nil {
-		log.Fatal("Couldn't write file ", destination, ": ", err.Error())
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't write file ", destination, ": ", err.Error())
 	}
 }
 
@@ -228,6 +177,11 @@ func main() {
 	nextcloudWebDavUrlCrawlCmd := crawlCommand.String("nextcloud-webdav-url", "", "Nextcloud Webdav URL")
 	nextcloudAppTokenCrawlCmd := crawlCommand.String("nextcloud-token", "", "Nextcloud App Token")
 	nextcloudRootDir := crawlCommand.String("nextcloud-root-dir", "", "Nextcloud Root Directory")
+	dateStrategiesCrawlCmd := crawlCommand.String("date-strategies", defaultDateStrategies, "Comma separated list of sources the date of an image is taken from")
+	filenamePatternCrawlCmd := crawlCommand.String("filename-pattern", "", "Regular expression with the named groups 'year', 'month' and 'day' to extract the date from the filename")
+	workersCrawlCmd := crawlCommand.Int("workers", 4, "Number of folders that are listed in parallel")
+	includeCrawlCmd := crawlCommand.String("include", "", "Comma separated list of glob patterns, only matching images are crawled")
+	excludeCrawlCmd := crawlCommand.String("exclude", "", "Comma separated list of glob patterns, matching images and folders are skipped")
 
 	fetchCommand := flag.NewFlagSet("fetch", flag.ExitOnError)
 	fetchId := fetchCommand.String("id", "", "Identifier")
@@ -239,52 +193,98 @@ func main() {
 
 	flag.Parse()
 
-	log.SetLevel(log.DebugLevel)
-	log.SetOutput(&OutputSplitter{})
+	pluginsdk.SetupLogging()
 
 	if len(os.Args) == 1 {
-		log.Fatal("Please use either 'crawl' or 'fetch'")
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please use either 'crawl' or 'fetch'")
 	}
 
 	switch os.Args[1] {
 		case "crawl":
 			crawlCommand.Parse(os.Args[2:])
 			if *nextcloudWebDavUrlCrawlCmd == "" {
-				log.Fatal("Please provide a valid Nextcloud webdav URL")
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a valid Nextcloud webdav URL")
 			}
 
 
 			if *nextcloudAppTokenCrawlCmd == "" {
-				log.Fatal("Please provide a valid Nextcloud App token")
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a valid Nextcloud App token")
 			}
 
 			if *nextcloudRootDir == "" {
-				log.Fatal("Please specify the Nextcloud root directory")
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please specify the Nextcloud root directory")
 			}
 
-			crawl(getRedisAddress(), redisMaxConnections, *nextcloudWebDavUrlCrawlCmd, *nextcloudAppTokenCrawlCmd, *nextcloudRootDir)
+			dateStrategies, err := imagedate.ParseStrategies(*dateStrategiesCrawlCmd)
+			if err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, err.Error())
+			}
+
+			dateExtractor := imagedate.NewExtractor(dateStrategies)
+			if *filenamePatternCrawlCmd != "" {
+				err = dateExtractor.SetFilenamePattern(*filenamePatternCrawlCmd)
+				if err != nil {
+					pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid filename pattern: ", err.Error())
+				}
+			}
+
+			if *workersCrawlCmd <= 0 {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a valid number of workers")
+			}
+
+			filter, err := webdavimages.NewPathFilter(*includeCrawlCmd, *excludeCrawlCmd)
+			if err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, err.Error())
+			}
+
+			var exifDateCache *imagedate.ExifDateCache
+			folderCachePath := ""
+			if cacheDir := os.Getenv("MINDFULBYTES_CACHE_DIR"); cacheDir != "" {
+				folderCachePath = filepath.Join(cacheDir, folderCacheFile)
+				exifDateCache, err = imagedate.LoadExifDateCache(filepath.Join(cacheDir, exifDateCacheFile))
+				if err != nil {
+					log.Warn("Couldn't load EXIF date cache, starting with an empty one: ", err.Error())
+				}
+				dateExtractor.SetExifDateCache(exifDateCache)
+			}
+
+			crawlSettings := pluginsdk.GetFlagsFingerprint(crawlCommand)
+			skipped, changed := crawl(pluginsdk.GetRedisAddress(), redisMaxConnections, *nextcloudWebDavUrlCrawlCmd, *nextcloudAppTokenCrawlCmd, *nextcloudRootDir,
+							filter, *workersCrawlCmd, folderCachePath, crawlSettings, dateExtractor)
+			if exifDateCache != nil {
+				err = exifDateCache.Save()
+				if err != nil {
+					log.Warn("Couldn't save EXIF date cache: ", err.Error())
+				}
+			}
+			if !changed {
+				os.Exit(pluginsdk.ExitNothingChanged)
+			}
+			if skipped > 0 {
+				os.Exit(pluginsdk.ExitPartialSuccess)
+			}
 
 		case "fetch":
 			fetchCommand.Parse(os.Args[2:])
 			if *fetchId == "" {
-				log.Fatal("Please provide a id")
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a id")
 			}
 
 			if *nextcloudWebDavUrlFetchCmd == "" {
-				log.Fatal("Please provide a valid Nextcloud webdav URL")
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a valid Nextcloud webdav URL")
 			}
 
 			if *nextcloudAppTokenFetchCmd == "" {
-				log.Fatal("Please provide a valid Nextcloud App token")
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a valid Nextcloud App token")
 			}
 
 			if *destinationFetchCmd == "" {
-				log.Fatal("Please provide a destination")
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a destination")
 			}
 
-			fetch(getRedisAddress(), redisMaxConnections, *nextcloudWebDavUrlFetchCmd, *nextcloudAppTokenFetchCmd, *fetchId, *destinationFetchCmd)
+			fetch(pluginsdk.GetRedisAddress(), redisMaxConnections, *nextcloudWebDavUrlFetchCmd, *nextcloudAppTokenFetchCmd, *fetchId, *destinationFetchCmd)
 		default:
-			log.Fatal(os.Args[1], " is not valid command.")
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, os.Args[1], " is not valid command.")
 	}
 
 }
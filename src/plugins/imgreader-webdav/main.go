@@ -0,0 +1,322 @@
+package main
+
+import (
+	"github.com/bbernhard/mindfulbytes/pluginsdk"
+	"github.com/bbernhard/mindfulbytes/entrymeta"
+	"github.com/bbernhard/mindfulbytes/imagedate"
+	"github.com/bbernhard/mindfulbytes/webdavimages"
+	log "github.com/sirupsen/logrus"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"flag"
+	"github.com/gomodule/redigo/redis"
+	"github.com/gofrs/uuid"
+	"encoding/binary"
+	"os"
+)
+
+var TOPIC string = "imgreader-webdav"
+
+//the kind of the entries, as declared in meta.yaml
+const kindImage = "image"
+
+const defaultDateStrategies = "exif,xmp,sidecar-json,filename,mtime"
+
+//the extracted EXIF dates are kept in the plugin's cache directory, keyed by the ETag of the image
+const exifDateCacheFile = "exif-dates.json"
+
+//the folder listings of the last crawl are kept in the plugin's cache directory (only with incremental crawls)
+const folderCacheFile = "folders.json"
+
+type DataEntry struct {
+	Uri string `json:"uri"`
+	Uuid string `json:"uuid"`
+	FullDate string `json:"fulldate"`
+	DateSource string `json:"datesource,omitempty"`
+	Kind string `json:"kind,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	MetadataVersion int `json:"metadataversion,omitempty"`
+}
+
+//returns the number of skipped directories and files and false in case nothing changed since the last crawl
+func crawl(redisAddress string, redisMaxConnections int, server *webdavimages.Server, rootDirs []string,
+			filter *webdavimages.PathFilter, workers int, folderCachePath string, crawlSettings string,
+			dateExtractor *imagedate.Extractor) (int, bool) {
+	//create redis pool
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	walker := webdavimages.NewWalker(server, filter, workers)
+	walker.SetProgressHandler(func(discovered int, failedFolders int, folder string) {
+		pluginsdk.ReportProgress(pluginsdk.Progress{Discovered: discovered, Errors: failedFolders, Path: folder})
+	})
+	if folderCachePath != "" {
+		previousFolders, err := webdavimages.LoadFolderCache(folderCachePath, server.Url(), crawlSettings)
+		if err != nil {
+			log.Warn("Couldn't load folder cache, listing all folders: ", err.Error())
+		}
+		walker.SetFolderCache(previousFolders)
+	}
+
+	for _, rootDir := range rootDirs {
+		err := walker.Walk(rootDir)
+		if err != nil {
+			if webdavimages.IsConfigError(err) {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't get files of ", rootDir, " (please check the URL, credentials and root directories): ", err.Error())
+			}
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't get files of ", rootDir, ": ", err.Error())
+		}
+	}
+	files := walker.Files()
+	sidecars := walker.Sidecars()
+	skipped := walker.FailedFolders()
+	log.Info("Found ", len(files), " images in ", len(walker.Listings()), " folders (", walker.UnchangedFolders(),
+			" unchanged since the last crawl, ", walker.FailedFolders(), " failed)")
+
+	//the entries of the last crawl are still up to date (unless redis was flushed in the meantime)
+	if walker.Unchanged() && pluginsdk.HasKeys(redisConn, TOPIC) {
+		log.Info("Nothing changed since the last crawl")
+		pluginsdk.ReportProgress(pluginsdk.Progress{Discovered: len(files), Processed: len(files)})
+		return 0, false
+	}
+
+	index := pluginsdk.NewIndex(TOPIC, "image")
+	for i, file := range files {
+		log.Debug("Processing file ", file.Path)
+		pluginsdk.ReportProgress(pluginsdk.Progress{Discovered: len(files), Processed: i, Path: file.Path})
+		u, err := uuid.NewV4()
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't create UUID: ", err.Error())
+		}
+
+		image := server.NewImage(file, sidecars)
+		result, err := dateExtractor.GetDate(image)
+		if err != nil {
+			log.Error("Skipping ", file.Path, ", couldn't determine date: ", err.Error())
+			skipped += 1
+			continue
+		}
+
+		fullDate := result.Time.Format("2006-01-02")
+		//description, location and tags from the sidecar files (e.g of a Google Takeout export), camera and dimensions from the EXIF data
+		dataEntry := DataEntry{Uri: file.Path, Uuid: u.String(), Kind: kindImage, FullDate: fullDate, DateSource: result.Source,
+								Metadata: dateExtractor.GetMetadata(image), MetadataVersion: entrymeta.Version}
+
+		index.Add(dataEntry.Uuid, result.Time, dataEntry, file.Path)
+	}
+
+	//the existing entries are kept as long as possible, as looking up the dates of the images takes a while
+	pluginsdk.DeleteAllKeys(redisConn, TOPIC)
+
+	err := index.Write(redisConn)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't set data in redis: ", err.Error())
+	}
+
+	//the next crawl only lists the folders that changed in the meantime
+	if folderCachePath != "" {
+		err = webdavimages.SaveFolderCache(folderCachePath, server.Url(), crawlSettings, walker.Listings())
+		if err != nil {
+			log.Warn("Couldn't save folder cache: ", err.Error())
+		}
+	}
+
+	pluginsdk.ReportProgress(pluginsdk.Progress{Discovered: len(files), Processed: len(files), Errors: skipped})
+	return skipped, true
+}
+
+func fetch(redisAddress string, redisMaxConnections int, server *webdavimages.Server, id string, destination string) {
+	//create redis pool
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+
+	key := TOPIC+":image:"+id
+
+	webDavFilePathBytes, err := redis.Bytes(redisConn.Do("GET", key))
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read data from redis: ", err.Error())
+	}
+
+	webDavFilePath := string(webDavFilePathBytes)
+	log.Info(webDavFilePath)
+	
+	bytes, err := server.Read(webDavFilePath)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read file ", webDavFilePath, ": ", err.Error())
+	}
+
+	f, err := os.Create(destination)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't create file ", destination, ": ", err.Error())
+	}
+
+	err = binary.Write(f, binary.LittleEndian, bytes)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't write file ", destination, ": ", err.Error())
+	}
+}
+
+//the connection parameters are the same for crawl and fetch
+type serverFlags struct {
+	url *string
+	username *string
+	password *string
+	token *string
+	caCert *string
+}
+
+func addServerFlags(flagSet *flag.FlagSet) serverFlags {
+	return serverFlags{
+		url: flagSet.String("url", "", "WebDAV URL (e.g https://nas.example.com/webdav)"),
+		username: flagSet.String("username", "", "Username (basic auth)"),
+		password: flagSet.String("password", "", "Password (basic auth)"),
+		token: flagSet.String("token", "", "Bearer token"),
+		caCert: flagSet.String("ca-cert", "", "Path to a PEM encoded CA certificate, in case the server uses a self-signed certificate"),
+	}
+}
+
+func newServer(flags serverFlags) *webdavimages.Server {
+	if *flags.url == "" {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a valid WebDAV URL")
+	}
+
+	//the credentials can also be passed as secrets, so that they don't show up in the process list
+	auth := webdavimages.Auth{Username: *flags.username, Password: *flags.password, Token: *flags.token}
+	if auth.Password == "" {
+		auth.Password = os.Getenv("WEBDAV_PASSWORD")
+	}
+	if auth.Token == "" {
+		auth.Token = os.Getenv("WEBDAV_TOKEN")
+	}
+
+	if auth.Token != "" && auth.Username != "" {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide either a token or username and password")
+	}
+
+	server, err := webdavimages.NewServer(*flags.url, auth, *flags.caCert)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't set up WebDAV connection: ", err.Error())
+	}
+	return server
+}
+
+func main() {
+	crawlCommand := flag.NewFlagSet("crawl", flag.ExitOnError)
+	serverFlagsCrawlCmd := addServerFlags(crawlCommand)
+	rootDirsCrawlCmd := crawlCommand.String("root-dirs", "/", "Comma separated list of folders that contain the images")
+	incrementalCrawlCmd := crawlCommand.String("incremental", "false", "Only list the folders whose ETag changed since the last crawl. Requires a server that changes the ETag of a folder when something below it changes (e.g ownCloud)")
+	dateStrategiesCrawlCmd := crawlCommand.String("date-strategies", defaultDateStrategies, "Comma separated list of sources the date of an image is taken from")
+	filenamePatternCrawlCmd := crawlCommand.String("filename-pattern", "", "Regular expression with the named groups 'year', 'month' and 'day' to extract the date from the filename")
+	workersCrawlCmd := crawlCommand.Int("workers", 4, "Number of folders that are listed in parallel")
+	includeCrawlCmd := crawlCommand.String("include", "", "Comma separated list of glob patterns, only matching images are crawled")
+	excludeCrawlCmd := crawlCommand.String("exclude", "", "Comma separated list of glob patterns, matching images and folders are skipped")
+
+	fetchCommand := flag.NewFlagSet("fetch", flag.ExitOnError)
+	serverFlagsFetchCmd := addServerFlags(fetchCommand)
+	fetchId := fetchCommand.String("id", "", "Identifier")
+	destinationFetchCmd := fetchCommand.String("destination", "", "Destination")
+
+	redisMaxConnections := 10
+
+	flag.Parse()
+
+	pluginsdk.SetupLogging()
+
+	if len(os.Args) == 1 {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please use either 'crawl' or 'fetch'")
+	}
+
+	switch os.Args[1] {
+		case "crawl":
+			crawlCommand.Parse(os.Args[2:])
+			server := newServer(serverFlagsCrawlCmd)
+
+			rootDirs := []string{}
+			for _, rootDir := range strings.Split(*rootDirsCrawlCmd, ",") {
+				rootDir = strings.TrimSpace(rootDir)
+				if rootDir != "" {
+					rootDirs = append(rootDirs, rootDir)
+				}
+			}
+			if len(rootDirs) == 0 {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please specify at least one root directory")
+			}
+
+			incremental, err := strconv.ParseBool(*incrementalCrawlCmd)
+			if err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid value for incremental: ", *incrementalCrawlCmd)
+			}
+
+			dateStrategies, err := imagedate.ParseStrategies(*dateStrategiesCrawlCmd)
+			if err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, err.Error())
+			}
+
+			dateExtractor := imagedate.NewExtractor(dateStrategies)
+			if *filenamePatternCrawlCmd != "" {
+				err = dateExtractor.SetFilenamePattern(*filenamePatternCrawlCmd)
+				if err != nil {
+					pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid filename pattern: ", err.Error())
+				}
+			}
+
+			if *workersCrawlCmd <= 0 {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a valid number of workers")
+			}
+
+			filter, err := webdavimages.NewPathFilter(*includeCrawlCmd, *excludeCrawlCmd)
+			if err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, err.Error())
+			}
+
+			var exifDateCache *imagedate.ExifDateCache
+			folderCachePath := ""
+			if cacheDir := os.Getenv("MINDFULBYTES_CACHE_DIR"); cacheDir != "" {
+				if incremental {
+					folderCachePath = filepath.Join(cacheDir, folderCacheFile)
+				}
+				exifDateCache, err = imagedate.LoadExifDateCache(filepath.Join(cacheDir, exifDateCacheFile))
+				if err != nil {
+					log.Warn("Couldn't load EXIF date cache, starting with an empty one: ", err.Error())
+				}
+				dateExtractor.SetExifDateCache(exifDateCache)
+			}
+
+			crawlSettings := pluginsdk.GetFlagsFingerprint(crawlCommand)
+			skipped, changed := crawl(pluginsdk.GetRedisAddress(), redisMaxConnections, server, rootDirs, filter, *workersCrawlCmd, folderCachePath, crawlSettings, dateExtractor)
+			if exifDateCache != nil {
+				err = exifDateCache.Save()
+				if err != nil {
+					log.Warn("Couldn't save EXIF date cache: ", err.Error())
+				}
+			}
+			if !changed {
+				os.Exit(pluginsdk.ExitNothingChanged)
+			}
+			if skipped > 0 {
+				os.Exit(pluginsdk.ExitPartialSuccess)
+			}
+
+		case "fetch":
+			fetchCommand.Parse(os.Args[2:])
+			if *fetchId == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a id")
+			}
+
+			if *destinationFetchCmd == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a destination")
+			}
+
+			fetch(pluginsdk.GetRedisAddress(), redisMaxConnections, newServer(serverFlagsFetchCmd), *fetchId, *destinationFetchCmd)
+		default:
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, os.Args[1], " is not valid command.")
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"github.com/bbernhard/mindfulbytes/pluginsdk"
+	"github.com/bbernhard/mindfulbytes/entrymeta"
+	"github.com/bbernhard/mindfulbytes/mailarchive"
+	log "github.com/sirupsen/logrus"
+	"github.com/gomodule/redigo/redis"
+	"github.com/gofrs/uuid"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var TOPIC string = "mailreader-fs"
+
+//the kinds of the entries, as declared in meta.yaml
+const (
+	kindText = "text"
+	kindImage = "image"
+)
+
+//the variant is passed by mindfulbytes, the poster is the image of an item (e.g the card of an event)
+const (
+	variantOriginal = "original"
+	variantPoster = "poster"
+)
+
+const (
+	itemMail = "mail"
+	itemAttachment = "attachment"
+)
+
+type DataEntry struct {
+	Uri string `json:"uri"`
+	Uuid string `json:"uuid"`
+	FullDate string `json:"fulldate"`
+	DateSource string `json:"datesource,omitempty"`
+	Kind string `json:"kind,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	MetadataVersion int `json:"metadataversion,omitempty"`
+}
+
+//a mail or one of its image attachments, everything that's needed to fetch it
+type Item struct {
+	Kind string `json:"kind"`
+	Location mailarchive.Location `json:"location"`
+	Attachment int `json:"attachment,omitempty"`
+	Subject string `json:"subject,omitempty"`
+	From string `json:"from,omitempty"`
+	Date string `json:"date,omitempty"`
+	Snippet string `json:"snippet,omitempty"`
+}
+
+type Filter struct {
+	Senders pluginsdk.Patterns
+	Folders pluginsdk.Patterns
+	ExcludedFolders pluginsdk.Patterns
+}
+
+func NewFilter(senders string, folders string, excludedFolders string) (*Filter, error) {
+	filter := &Filter{}
+	var err error
+	filter.Senders, err = pluginsdk.ParsePatterns(senders)
+	if err == nil {
+		filter.Folders, err = pluginsdk.ParsePatterns(folders)
+	}
+	if err == nil {
+		filter.ExcludedFolders, err = pluginsdk.ParsePatterns(excludedFolders)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+//folders are matched by their full name (e.g 'Archive/2019') and by their last component (e.g 'Trash')
+func (f *Filter) includesFolder(name string) bool {
+	if f.ExcludedFolders.MatchesAny(name) || f.ExcludedFolders.MatchesAny(path.Base(name)) {
+		return false
+	}
+	return len(f.Folders) == 0 || f.Folders.MatchesAny(name) || f.Folders.MatchesAny(path.Base(name))
+}
+
+func (f *Filter) includesSender(address string) bool {
+	return len(f.Senders) == 0 || f.Senders.MatchesAny(address)
+}
+
+//messages without a (valid) Date header are dated by the delivery time that is part of the filename in a Maildir
+func getDeliveryTime(location mailarchive.Location) (time.Time, error) {
+	if location.Length != 0 {
+		return time.Time{}, errors.New("No delivery time found")
+	}
+
+	seconds, err := strconv.ParseInt(strings.SplitN(filepath.Base(location.Path), ".", 2)[0], 10, 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}, errors.New("No delivery time found")
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+//returns the number of folders and messages that were skipped
+func crawl(redisAddress string, redisMaxConnections int, paths []string, filter *Filter, attachments bool, location *time.Location) int {
+	folders := []mailarchive.Folder{}
+	for _, p := range paths {
+		f, err := mailarchive.FindFolders(p)
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't find mail folders in ", p, ": ", err.Error())
+		}
+		folders = append(folders, f...)
+	}
+
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	index := pluginsdk.NewIndex(TOPIC, "item")
+	progress := pluginsdk.Progress{Discovered: len(folders)}
+	seen := make(map[string]bool)
+
+	addEntry := func(item Item, date time.Time, metadata map[string]string) {
+		u, err := uuid.NewV4()
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't create UUID: ", err.Error())
+		}
+
+		kind := kindText
+		if item.Kind == itemAttachment {
+			kind = kindImage
+		}
+		dataEntry := DataEntry{Uri: item.Location.Path, Uuid: u.String(), Kind: kind, FullDate: date.Format("2006-01-02"), Metadata: metadata,
+								MetadataVersion: entrymeta.Version}
+		index.Add(dataEntry.Uuid, date, dataEntry, item)
+	}
+
+	for _, folder := range folders {
+		progress.Path = folder.Path
+		if !filter.includesFolder(folder.Name) {
+			log.Debug("Skipping excluded folder ", folder.Name)
+			progress.Processed += 1
+			continue
+		}
+
+		log.Debug("Processing folder ", folder.Name)
+		err := folder.Walk(func(messageLocation mailarchive.Location, data []byte) error {
+			message, err := mailarchive.ParseMessage(data)
+			if message == nil {
+				log.Error("Couldn't parse message in ", messageLocation.Path, " (offset ", messageLocation.Offset, "): ", err.Error())
+				progress.Errors += 1
+				return nil
+			}
+			//the headers could be parsed, but e.g a MIME part is broken
+			if err != nil {
+				log.Debug("Message in ", messageLocation.Path, " (offset ", messageLocation.Offset, ") is incomplete: ", err.Error())
+			}
+
+			if !filter.includesSender(message.FromAddress) {
+				return nil
+			}
+			if message.MessageId != "" {
+				if seen[message.MessageId] {
+					return nil
+				}
+				seen[message.MessageId] = true
+			}
+
+			date := message.Date
+			dateField := "Date"
+			if date.IsZero() {
+				dateField = "delivery time"
+				date, err = getDeliveryTime(messageLocation)
+				if err != nil {
+					log.Debug("Skipping message without date in ", messageLocation.Path, " (offset ", messageLocation.Offset, ")")
+					return nil
+				}
+			}
+			date = date.In(location)
+
+			metadata := map[string]string{"subject": message.Subject, "from": message.From, "to": message.To, "folder": folder.Name,
+											entrymeta.Title: message.Subject, entrymeta.MimeType: "message/rfc822", entrymeta.DateField: dateField}
+			addEntry(Item{Kind: itemMail, Location: messageLocation, Subject: message.Subject, From: message.From,
+							Date: date.Format("2006-01-02T15:04:05"), Snippet: message.Snippet}, date, metadata)
+
+			if attachments {
+				for _, attachment := range message.Attachments {
+					attachmentMetadata := map[string]string{}
+					for key, value := range metadata {
+						attachmentMetadata[key] = value
+					}
+					attachmentMetadata["filename"] = attachment.Filename
+					//the content type of attachments is often just application/octet-stream
+					attachmentMetadata[entrymeta.MimeType] = entrymeta.MimeTypeByExtension(attachment.Filename)
+					if attachmentMetadata[entrymeta.MimeType] == "" {
+						attachmentMetadata[entrymeta.MimeType] = attachment.ContentType
+					}
+					addEntry(Item{Kind: itemAttachment, Location: messageLocation, Attachment: attachment.Index}, date, attachmentMetadata)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Error("Couldn't read folder ", folder.Name, ": ", err.Error())
+			progress.Errors += 1
+		}
+
+		progress.Processed += 1
+		pluginsdk.ReportProgress(progress)
+	}
+
+	pluginsdk.DeleteAllKeys(redisConn, TOPIC)
+
+	err := index.Write(redisConn)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't set data in redis: ", err.Error())
+	}
+
+	progress.Path = ""
+	pluginsdk.ReportProgress(progress)
+	return progress.Errors
+}
+
+//the card of a mail shows the subject, the beginning of the text and the sender
+func (item Item) renderCard(magick string, destination string) error {
+	details := item.From
+	if date, err := time.Parse("2006-01-02T15:04:05", item.Date); err == nil {
+		details += "\n" + date.Format("Monday, 2 January 2006, 15:04")
+	}
+
+	return pluginsdk.RenderCard(magick, pluginsdk.Card{Background: "#f1faee", Texts: []pluginsdk.CardText{
+		{Text: item.Subject, Height: 110, Color: "#1d3557", Align: "west", Position: "north", Offset: 30},
+		{Text: item.Snippet, Height: 200, Color: "#457b9d", Align: "northwest", Position: "center", Offset: 10},
+		{Text: details, Height: 70, Color: "#1d3557", Align: "west", Position: "south", Offset: 30}}}, destination)
+}
+
+func fetch(redisAddress string, redisMaxConnections int, id string, destination string, variant string, magick string) {
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	serializedItem, err := redis.Bytes(redisConn.Do("GET", TOPIC+":item:"+id))
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read data from redis: ", err.Error())
+	}
+
+	var item Item
+	err = json.Unmarshal(serializedItem, &item)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't parse item: ", err.Error())
+	}
+
+	//the original of a mail is the message as stored in the archive, attachments don't have a poster
+	if item.Kind == itemMail && variant == variantOriginal {
+		data, err := mailarchive.ReadMessage(item.Location)
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read message ", item.Location.Path, ": ", err.Error())
+		}
+		err = ioutil.WriteFile(destination, data, 0600)
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't write file ", destination, ": ", err.Error())
+		}
+		return
+	}
+
+	if item.Kind == itemMail {
+		if _, err := exec.LookPath(magick); err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't find ImageMagick: ", err.Error())
+		}
+		err = item.renderCard(magick, destination)
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't render card: ", err.Error())
+		}
+		return
+	}
+
+	data, err := mailarchive.ReadMessage(item.Location)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read message ", item.Location.Path, ": ", err.Error())
+	}
+
+	attachment, err := mailarchive.ExtractAttachment(data, item.Attachment)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't extract attachment of message ", item.Location.Path, ": ", err.Error())
+	}
+
+	err = ioutil.WriteFile(destination, attachment, 0600)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't write file ", destination, ": ", err.Error())
+	}
+}
+
+func main() {
+	crawlCommand := flag.NewFlagSet("crawl", flag.ExitOnError)
+	pathsCrawlCmd := crawlCommand.String("paths", "", "Comma separated list of mbox files, Maildirs or directories that contain them")
+	sendersCrawlCmd := crawlCommand.String("senders", "", "Comma separated list of patterns, only mails from matching senders are indexed (e.g '*@example.com')")
+	foldersCrawlCmd := crawlCommand.String("folders", "", "Comma separated list of patterns, only matching folders are indexed")
+	excludeFoldersCrawlCmd := crawlCommand.String("exclude-folders", "Trash,Junk,Spam,Drafts", "Comma separated list of patterns, matching folders are skipped")
+	attachmentsCrawlCmd := crawlCommand.String("attachments", "true", "Index the image attachments of the mails")
+	timezoneCrawlCmd := crawlCommand.String("timezone", "", "Time zone (e.g Europe/Vienna) the dates of the mails are determined in, defaults to the local time zone")
+
+	fetchCommand := flag.NewFlagSet("fetch", flag.ExitOnError)
+	fetchId := fetchCommand.String("id", "", "Identifier")
+	destinationFetchCmd := fetchCommand.String("destination", "", "Destination")
+	variantFetchCmd := fetchCommand.String("variant", variantOriginal, "Either the original item ('original') or an image of it ('poster')")
+	magickFetchCmd := fetchCommand.String("magick", "magick", "Path to the ImageMagick binary that renders the mails")
+
+	redisMaxConnections := 10
+
+	flag.Parse()
+
+	pluginsdk.SetupLogging()
+
+	if len(os.Args) == 1 {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please use either 'crawl' or 'fetch'")
+	}
+
+	switch os.Args[1] {
+		case "crawl":
+			crawlCommand.Parse(os.Args[2:])
+			paths := pluginsdk.SplitList(*pathsCrawlCmd)
+			if len(paths) == 0 {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide at least one path")
+			}
+
+			filter, err := NewFilter(*sendersCrawlCmd, *foldersCrawlCmd, *excludeFoldersCrawlCmd)
+			if err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, err.Error())
+			}
+
+			attachments, err := strconv.ParseBool(*attachmentsCrawlCmd)
+			if err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid value for attachments: ", *attachmentsCrawlCmd)
+			}
+
+			location := time.Local
+			if *timezoneCrawlCmd != "" {
+				location, err = time.LoadLocation(*timezoneCrawlCmd)
+				if err != nil {
+					pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid time zone: ", err.Error())
+				}
+			}
+
+			skipped := crawl(pluginsdk.GetRedisAddress(), redisMaxConnections, paths, filter, attachments, location)
+			if skipped > 0 {
+				os.Exit(pluginsdk.ExitPartialSuccess)
+			}
+
+		case "fetch":
+			fetchCommand.Parse(os.Args[2:])
+			if *fetchId == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a id")
+			}
+
+			if *destinationFetchCmd == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a destination")
+			}
+
+			if *variantFetchCmd != variantOriginal && *variantFetchCmd != variantPoster {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid variant '", *variantFetchCmd, "'")
+			}
+
+			fetch(pluginsdk.GetRedisAddress(), redisMaxConnections, *fetchId, *destinationFetchCmd, *variantFetchCmd, *magickFetchCmd)
+		default:
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, os.Args[1], " is not valid command.")
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"github.com/bbernhard/mindfulbytes/pluginsdk"
+	"github.com/bbernhard/mindfulbytes/entrymeta"
+	"github.com/bbernhard/mindfulbytes/imagedate"
+	"github.com/bbernhard/mindfulbytes/frontmatter"
+	log "github.com/sirupsen/logrus"
+	"github.com/gomodule/redigo/redis"
+	"github.com/gofrs/uuid"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var TOPIC string = "notereader-fs"
+
+//the kind of the entries, as declared in meta.yaml
+const kindText = "text"
+
+var EXTENSIONS = []string{".md", ".markdown", ".txt"}
+
+var DEFAULT_DATE_STRATEGIES = []string{imagedate.SourceFrontMatter, imagedate.SourceFilename, imagedate.SourceMtime}
+
+//the Markdown syntax that is removed before a note is rendered as image
+var markdownImageRegex = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+var markdownLinkRegex = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+var markdownHeadingRegex = regexp.MustCompile(`(?m)^#{1,6}[ \t]+`)
+var markdownEmphasisRegex = regexp.MustCompile("\\*\\*|__|`")
+
+type DataEntry struct {
+	Uri string `json:"uri"`
+	Uuid string `json:"uuid"`
+	FullDate string `json:"fulldate"`
+	DateSource string `json:"datesource,omitempty"`
+	Kind string `json:"kind,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	MetadataVersion int `json:"metadataversion,omitempty"`
+}
+
+func isSupportedNote(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range EXTENSIONS {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+//returns the number of files and directories that were skipped
+func crawl(redisAddress string, redisMaxConnections int, directory string, workers int, dateExtractor *imagedate.Extractor) int {
+	info, err := os.Stat(directory)
+	if err != nil || !info.IsDir() {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, directory, " doesn't exist or is not a directory")
+	}
+
+	//create redis pool
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	stats := &pluginsdk.CrawlStats{}
+	files := pluginsdk.WalkDirectory(directory, workers, isSupportedNote, stats)
+
+	var mutex sync.Mutex
+	index := pluginsdk.NewIndex(TOPIC, "note")
+	lastProgressReport := time.Time{}
+
+	processors := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		processors.Add(1)
+		go func() {
+			defer processors.Done()
+			for file := range files {
+				log.Debug("Processing file ", file.Path)
+				result, err := dateExtractor.GetDate(imagedate.NewLocalImage(file.Path, file.Info))
+				if err != nil {
+					log.Error("Couldn't determine date of ", file.Path, ": ", err.Error())
+					stats.AddError()
+					stats.AddProcessed()
+					continue
+				}
+
+				u, err := uuid.NewV4()
+				if err != nil {
+					pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't create UUID: ", err.Error())
+				}
+
+				fullDate := result.Time.Format("2006-01-02")
+				dataEntry := DataEntry{Uri: file.Path, Uuid: u.String(), Kind: kindText, FullDate: fullDate, DateSource: result.Source,
+										Metadata: getNoteMetadata(file.Path), MetadataVersion: entrymeta.Version}
+
+				mutex.Lock()
+				index.Add(dataEntry.Uuid, result.Time, dataEntry, dataEntry.Uri)
+				stats.AddProcessed()
+				if time.Since(lastProgressReport) > 500 * time.Millisecond {
+					lastProgressReport = time.Now()
+					pluginsdk.ReportProgress(stats.Progress(file.Path))
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	processors.Wait()
+
+	pluginsdk.DeleteAllKeys(redisConn, TOPIC)
+
+	err = index.Write(redisConn)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't set data in redis: ", err.Error())
+	}
+
+	pluginsdk.ReportProgress(stats.Progress(""))
+	return stats.Errors()
+}
+
+//the title and the tags from the front matter of a note
+func getNoteMetadata(path string) map[string]string {
+	metadata := map[string]string{entrymeta.MimeType: entrymeta.MimeTypeByExtension(path)}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return metadata
+	}
+
+	frontMatter, _ := frontmatter.Parse(data)
+	if frontMatter.Title != "" {
+		metadata[entrymeta.Title] = frontMatter.Title
+	}
+	if len(frontMatter.Tags) > 0 {
+		metadata[entrymeta.Tags] = strings.Join(frontMatter.Tags, ",")
+	}
+	return metadata
+}
+
+//returns the note as plain text, with the title (if there is one in the front matter) as first line.
+//Long notes are cut at the last space before maxLength characters.
+func toPlainText(data []byte, maxLength int) string {
+	frontMatter, content := frontmatter.Parse(data)
+
+	text := string(content)
+	text = markdownImageRegex.ReplaceAllString(text, "")
+	text = markdownLinkRegex.ReplaceAllString(text, "$1")
+	text = markdownHeadingRegex.ReplaceAllString(text, "")
+	text = markdownEmphasisRegex.ReplaceAllString(text, "")
+	text = strings.TrimSpace(text)
+
+	if frontMatter.Title != "" {
+		text = frontMatter.Title + "\n\n" + text
+	}
+
+	if maxLength > 0 && utf8.RuneCountInString(text) > maxLength {
+		runes := []rune(text)[:maxLength]
+		cut := strings.LastIndexAny(string(runes), " \n")
+		if cut <= 0 {
+			cut = len(string(runes))
+		}
+		text = strings.TrimSpace(string(runes)[:cut]) + " …"
+	}
+	return text
+}
+
+func fetch(redisAddress string, redisMaxConnections int, id string, destination string, maxLength int) {
+	//create redis pool
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	path, err := redis.String(redisConn.Do("GET", TOPIC+":note:"+id))
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read data from redis: ", err.Error())
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read file ", path, ": ", err.Error())
+	}
+
+	err = ioutil.WriteFile(destination, []byte(toPlainText(data, maxLength)), 0600)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't write file ", destination, ": ", err.Error())
+	}
+}
+
+func main() {
+	crawlCommand := flag.NewFlagSet("crawl", flag.ExitOnError)
+	directoryCrawlCmd := crawlCommand.String("directory", "", "Path to the notes directory")
+	workersCrawlCmd := crawlCommand.Int("workers", runtime.NumCPU(), "Number of notes that are processed in parallel")
+	dateStrategiesCrawlCmd := crawlCommand.String("date-strategies", strings.Join(DEFAULT_DATE_STRATEGIES, ","), "Comma separated list of sources the date of a note is taken from")
+	filenamePatternCrawlCmd := crawlCommand.String("filename-pattern", "", "Regular expression with the named groups 'year', 'month' and 'day' to extract the date from the filename")
+
+	fetchCommand := flag.NewFlagSet("fetch", flag.ExitOnError)
+	fetchId := fetchCommand.String("id", "", "Identifier")
+	destinationFetchCmd := fetchCommand.String("destination", "", "Destination")
+	maxLengthFetchCmd := fetchCommand.Int("max-length", 500, "Max. number of characters of a note, longer notes are cut (0 = no limit)")
+
+	redisMaxConnections := 10
+
+	flag.Parse()
+
+	pluginsdk.SetupLogging()
+
+	if len(os.Args) == 1 {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please use either 'crawl' or 'fetch'")
+	}
+
+	switch os.Args[1] {
+		case "crawl":
+			crawlCommand.Parse(os.Args[2:])
+			if *directoryCrawlCmd == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a directory")
+			}
+
+			if *workersCrawlCmd <= 0 {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a valid number of workers")
+			}
+
+			dateStrategies, err := imagedate.ParseStrategies(*dateStrategiesCrawlCmd)
+			if err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, err.Error())
+			}
+			if strings.TrimSpace(*dateStrategiesCrawlCmd) == "" {
+				dateStrategies = DEFAULT_DATE_STRATEGIES
+			}
+
+			dateExtractor := imagedate.NewExtractor(dateStrategies)
+			if *filenamePatternCrawlCmd != "" {
+				err = dateExtractor.SetFilenamePattern(*filenamePatternCrawlCmd)
+				if err != nil {
+					pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid filename pattern: ", err.Error())
+				}
+			}
+
+			skipped := crawl(pluginsdk.GetRedisAddress(), redisMaxConnections, *directoryCrawlCmd, *workersCrawlCmd, dateExtractor)
+			if skipped > 0 {
+				os.Exit(pluginsdk.ExitPartialSuccess)
+			}
+
+		case "fetch":
+			fetchCommand.Parse(os.Args[2:])
+			if *fetchId == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a id")
+			}
+
+			if *destinationFetchCmd == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a destination")
+			}
+
+			fetch(pluginsdk.GetRedisAddress(), redisMaxConnections, *fetchId, *destinationFetchCmd, *maxLengthFetchCmd)
+		default:
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, os.Args[1], " is not valid command.")
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"github.com/bbernhard/mindfulbytes/pluginsdk"
+	"github.com/bbernhard/mindfulbytes/entrymeta"
+	"github.com/bbernhard/mindfulbytes/socialarchive"
+	log "github.com/sirupsen/logrus"
+	"github.com/gomodule/redigo/redis"
+	"github.com/gofrs/uuid"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var TOPIC string = "socialreader-fs"
+
+//the kinds of the entries, as declared in meta.yaml
+const (
+	kindText = "text"
+	kindImage = "image"
+)
+
+//the variant is passed by mindfulbytes, the poster is the image of an item (e.g the card of an event)
+const (
+	variantOriginal = "original"
+	variantPoster = "poster"
+)
+
+const (
+	itemPost = "post"
+	itemImage = "image"
+)
+
+//colors of the cards, per network
+var cardColors = map[string]string{socialarchive.NetworkTwitter: "#1da1f2", socialarchive.NetworkMastodon: "#6364ff"}
+
+type DataEntry struct {
+	Uri string `json:"uri"`
+	Uuid string `json:"uuid"`
+	FullDate string `json:"fulldate"`
+	DateSource string `json:"datesource,omitempty"`
+	Kind string `json:"kind,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	MetadataVersion int `json:"metadataversion,omitempty"`
+}
+
+//a post or one of its images, everything that's needed to fetch it
+type Item struct {
+	Kind string `json:"kind"`
+	//the image, empty for posts
+	Path string `json:"path,omitempty"`
+	Network string `json:"network,omitempty"`
+	Date string `json:"date,omitempty"`
+	Text string `json:"text,omitempty"`
+}
+
+//returns the number of archives that couldn't be read
+func crawl(redisAddress string, redisMaxConnections int, paths []string, replies bool, reposts bool, images bool, location *time.Location) int {
+	archives := []socialarchive.Archive{}
+	for _, p := range paths {
+		a, err := socialarchive.FindArchives(p)
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't find social media archives in ", p, ": ", err.Error())
+		}
+		archives = append(archives, a...)
+	}
+
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	index := pluginsdk.NewIndex(TOPIC, "item")
+	progress := pluginsdk.Progress{Discovered: len(archives)}
+	//archives downloaded at different times contain the same posts
+	seen := make(map[string]bool)
+
+	addEntry := func(uri string, item Item, date time.Time, metadata map[string]string) {
+		u, err := uuid.NewV4()
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't create UUID: ", err.Error())
+		}
+
+		kind := kindText
+		if item.Kind == itemImage {
+			kind = kindImage
+		}
+		dataEntry := DataEntry{Uri: uri, Uuid: u.String(), Kind: kind, FullDate: date.Format("2006-01-02"), Metadata: metadata,
+								MetadataVersion: entrymeta.Version}
+		index.Add(dataEntry.Uuid, date, dataEntry, item)
+	}
+
+	for _, archive := range archives {
+		log.Debug("Processing ", archive.Network, " archive ", archive.Path)
+		posts, err := archive.Read()
+		if err != nil {
+			log.Error("Couldn't read ", archive.Network, " archive ", archive.Path, ": ", err.Error())
+			progress.Errors += 1
+			progress.Processed += 1
+			continue
+		}
+
+		for _, post := range posts {
+			if (post.Reply && !replies) || (post.Repost && !reposts) {
+				continue
+			}
+
+			key := post.Network + "\x00" + post.Id
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			date := post.Time.In(location)
+			//the text is available to the caption and notification templates as {{ text }}
+			metadata := map[string]string{"network": post.Network, "text": post.Text, "url": post.Url}
+			if len(post.Tags) > 0 {
+				metadata[entrymeta.Tags] = strings.Join(post.Tags, ",")
+			}
+			if images && len(post.Images) > 0 {
+				for _, image := range post.Images {
+					imageMetadata := map[string]string{"filename": filepath.Base(image), entrymeta.MimeType: entrymeta.MimeTypeByExtension(image)}
+					for key, value := range metadata {
+						imageMetadata[key] = value
+					}
+					addEntry(image, Item{Kind: itemImage, Path: image}, date, imageMetadata)
+				}
+			} else if post.Text != "" {
+				addEntry(post.Url, Item{Kind: itemPost, Network: post.Network, Date: date.Format("2006-01-02T15:04:05"), Text: post.Text},
+							date, metadata)
+			}
+		}
+
+		progress.Processed += 1
+		progress.Path = archive.Path
+		pluginsdk.ReportProgress(progress)
+	}
+
+	pluginsdk.DeleteAllKeys(redisConn, TOPIC)
+
+	err := index.Write(redisConn)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't set data in redis: ", err.Error())
+	}
+
+	progress.Path = ""
+	pluginsdk.ReportProgress(progress)
+	return progress.Errors
+}
+
+//the card of a post shows its text and the network, in the color of the network
+func (item Item) renderCard(magick string, destination string) error {
+	details := strings.Title(item.Network)
+	if date, err := time.Parse("2006-01-02T15:04:05", item.Date); err == nil {
+		details += ", " + date.Format("Monday, 2 January 2006, 15:04")
+	}
+
+	color, ok := cardColors[item.Network]
+	if !ok {
+		color = "#444444"
+	}
+	return pluginsdk.RenderCard(magick, pluginsdk.Card{Background: color, Texts: []pluginsdk.CardText{
+		{Text: item.Text, Height: 340, Color: "white", Align: "center", Position: "north", Offset: 30},
+		{Text: details, Height: 50, Color: "#e8e8e8", Align: "west", Position: "south", Offset: 30}}}, destination)
+}
+
+func fetch(redisAddress string, redisMaxConnections int, id string, destination string, variant string, magick string) {
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	serializedItem, err := redis.Bytes(redisConn.Do("GET", TOPIC+":item:"+id))
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read data from redis: ", err.Error())
+	}
+
+	var item Item
+	err = json.Unmarshal(serializedItem, &item)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't parse item: ", err.Error())
+	}
+
+	//the original of a post is its text, images don't have a poster
+	if item.Kind == itemPost && variant == variantOriginal {
+		err = ioutil.WriteFile(destination, []byte(item.Text), 0600)
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't write file ", destination, ": ", err.Error())
+		}
+		return
+	}
+
+	if item.Kind == itemPost {
+		if _, err := exec.LookPath(magick); err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't find ImageMagick: ", err.Error())
+		}
+		err = item.renderCard(magick, destination)
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't render card: ", err.Error())
+		}
+		return
+	}
+
+	data, err := ioutil.ReadFile(item.Path)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read image ", item.Path, ": ", err.Error())
+	}
+
+	err = ioutil.WriteFile(destination, data, 0600)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't write file ", destination, ": ", err.Error())
+	}
+}
+
+func main() {
+	crawlCommand := flag.NewFlagSet("crawl", flag.ExitOnError)
+	pathsCrawlCmd := crawlCommand.String("paths", "", "Comma separated list of extracted Twitter and Mastodon archives or directories that contain them")
+	repliesCrawlCmd := crawlCommand.String("replies", "true", "Index replies to other posts")
+	repostsCrawlCmd := crawlCommand.String("reposts", "false", "Index retweets")
+	imagesCrawlCmd := crawlCommand.String("images", "true", "Index the images of the posts")
+	timezoneCrawlCmd := crawlCommand.String("timezone", "", "Time zone (e.g Europe/Vienna) the dates of the posts are converted to, defaults to the local time zone")
+
+	fetchCommand := flag.NewFlagSet("fetch", flag.ExitOnError)
+	fetchId := fetchCommand.String("id", "", "Identifier")
+	destinationFetchCmd := fetchCommand.String("destination", "", "Destination")
+	variantFetchCmd := fetchCommand.String("variant", variantOriginal, "Either the original item ('original') or an image of it ('poster')")
+	magickFetchCmd := fetchCommand.String("magick", "magick", "Path to the ImageMagick binary that renders the posts")
+
+	redisMaxConnections := 10
+
+	flag.Parse()
+
+	pluginsdk.SetupLogging()
+
+	if len(os.Args) == 1 {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please use either 'crawl' or 'fetch'")
+	}
+
+	switch os.Args[1] {
+		case "crawl":
+			crawlCommand.Parse(os.Args[2:])
+			paths := pluginsdk.SplitList(*pathsCrawlCmd)
+			if len(paths) == 0 {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide at least one path")
+			}
+
+			replies, err := strconv.ParseBool(*repliesCrawlCmd)
+			if err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid value for replies: ", *repliesCrawlCmd)
+			}
+
+			reposts, err := strconv.ParseBool(*repostsCrawlCmd)
+			if err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid value for reposts: ", *repostsCrawlCmd)
+			}
+
+			images, err := strconv.ParseBool(*imagesCrawlCmd)
+			if err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid value for images: ", *imagesCrawlCmd)
+			}
+
+			location := time.Local
+			if *timezoneCrawlCmd != "" {
+				location, err = time.LoadLocation(*timezoneCrawlCmd)
+				if err != nil {
+					pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid time zone: ", err.Error())
+				}
+			}
+
+			failed := crawl(pluginsdk.GetRedisAddress(), redisMaxConnections, paths, replies, reposts, images, location)
+			if failed > 0 {
+				os.Exit(pluginsdk.ExitPartialSuccess)
+			}
+
+		case "fetch":
+			fetchCommand.Parse(os.Args[2:])
+			if *fetchId == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a id")
+			}
+
+			if *destinationFetchCmd == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a destination")
+			}
+
+			if *variantFetchCmd != variantOriginal && *variantFetchCmd != variantPoster {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid variant '", *variantFetchCmd, "'")
+			}
+
+			fetch(pluginsdk.GetRedisAddress(), redisMaxConnections, *fetchId, *destinationFetchCmd, *variantFetchCmd, *magickFetchCmd)
+		default:
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, os.Args[1], " is not valid command.")
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"github.com/bbernhard/mindfulbytes/pluginsdk"
+	"github.com/bbernhard/mindfulbytes/entrymeta"
+	"github.com/bbernhard/mindfulbytes/imagedate"
+	log "github.com/sirupsen/logrus"
+	"github.com/gomodule/redigo/redis"
+	"github.com/gofrs/uuid"
+	"flag"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+var TOPIC string = "videoreader-fs"
+
+//the kind of the entries, as declared in meta.yaml
+const kindVideo = "video"
+
+var EXTENSIONS = []string{".mp4", ".m4v", ".mov", ".3gp", ".mkv", ".webm"}
+
+//the container creation time is the most reliable source for videos, phones usually don't write sidecar files
+var DEFAULT_DATE_STRATEGIES = []string{imagedate.SourceContainer, imagedate.SourceXmp, imagedate.SourceSidecarJson,
+										imagedate.SourceFilename, imagedate.SourceMtime}
+
+const (
+	variantOriginal = "original"
+	variantPoster = "poster"
+)
+
+type DataEntry struct {
+	Uri string `json:"uri"`
+	Uuid string `json:"uuid"`
+	FullDate string `json:"fulldate"`
+	DateSource string `json:"datesource,omitempty"`
+	Kind string `json:"kind,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	MetadataVersion int `json:"metadataversion,omitempty"`
+}
+
+func isSupportedVideo(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range EXTENSIONS {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+//returns the number of files and directories that were skipped
+func crawl(redisAddress string, redisMaxConnections int, directory string, workers int, dateExtractor *imagedate.Extractor) int {
+	info, err := os.Stat(directory)
+	if err != nil || !info.IsDir() {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, directory, " doesn't exist or is not a directory")
+	}
+
+	//create redis pool
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	stats := &pluginsdk.CrawlStats{}
+	files := pluginsdk.WalkDirectory(directory, workers, isSupportedVideo, stats)
+
+	var mutex sync.Mutex
+	index := pluginsdk.NewIndex(TOPIC, "video")
+	lastProgressReport := time.Time{}
+
+	processors := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		processors.Add(1)
+		go func() {
+			defer processors.Done()
+			for file := range files {
+				log.Debug("Processing file ", file.Path)
+				image := imagedate.NewLocalImage(file.Path, file.Info)
+				result, err := dateExtractor.GetDate(image)
+				if err != nil {
+					log.Error("Couldn't determine date of ", file.Path, ": ", err.Error())
+					stats.AddError()
+					stats.AddProcessed()
+					continue
+				}
+
+				u, err := uuid.NewV4()
+				if err != nil {
+					pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't create UUID: ", err.Error())
+				}
+
+				fullDate := result.Time.Format("2006-01-02")
+				//description and location from the sidecar files (e.g of a Google Takeout export)
+				metadata := imagedate.GetSidecarDetails(image).Metadata()
+				if mimeType := entrymeta.MimeTypeByExtension(file.Path); mimeType != "" {
+					metadata[entrymeta.MimeType] = mimeType
+				}
+				dataEntry := DataEntry{Uri: file.Path, Uuid: u.String(), Kind: kindVideo, FullDate: fullDate, DateSource: result.Source,
+										Metadata: metadata, MetadataVersion: entrymeta.Version}
+
+				mutex.Lock()
+				index.Add(dataEntry.Uuid, result.Time, dataEntry, dataEntry.Uri)
+				stats.AddProcessed()
+				if time.Since(lastProgressReport) > 500 * time.Millisecond {
+					lastProgressReport = time.Now()
+					pluginsdk.ReportProgress(stats.Progress(file.Path))
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	processors.Wait()
+
+	pluginsdk.DeleteAllKeys(redisConn, TOPIC)
+
+	err = index.Write(redisConn)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't set data in redis: ", err.Error())
+	}
+
+	pluginsdk.ReportProgress(stats.Progress(""))
+	return stats.Errors()
+}
+
+func copyFile(path string, destination string) {
+	src, err := os.Open(path)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't open file ", path, ": ", err.Error())
+	}
+	defer src.Close()
+
+	dest, err := os.Create(destination)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't create file ", destination, ": ", err.Error())
+	}
+	defer dest.Close()
+
+	_, err = io.Copy(dest, src)
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't write file ", destination, ": ", err.Error())
+	}
+}
+
+//extracts a single frame as JPEG. Short videos don't have a frame at the given offset, in that
+//case ffmpeg succeeds without writing anything, so we fall back to the first frame.
+func extractPoster(ffmpeg string, path string, destination string, offset string) {
+	if _, err := exec.LookPath(ffmpeg); err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Couldn't find ffmpeg: ", err.Error())
+	}
+
+	for _, o := range []string{offset, "0"} {
+		os.Remove(destination)
+
+		cmd := exec.Command(ffmpeg, "-y", "-loglevel", "error", "-ss", o, "-i", path, "-frames:v", "1",
+							"-f", "image2", "-vcodec", "mjpeg", destination)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't extract poster frame of ", path, ": ", err.Error(), " ", string(output))
+		}
+
+		if info, err := os.Stat(destination); err == nil && info.Size() > 0 {
+			return
+		}
+		log.Debug("No frame found at offset ", o, "s in ", path)
+	}
+	pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't extract poster frame of ", path, ": video has no frames")
+}
+
+func fetch(redisAddress string, redisMaxConnections int, id string, destination string, variant string, ffmpeg string, posterOffset string) {
+	//create redis pool
+	redisPool := pluginsdk.NewRedisPool(redisAddress, redisMaxConnections)
+	defer redisPool.Close()
+
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	path, err := redis.String(redisConn.Do("GET", TOPIC+":video:"+id))
+	if err != nil {
+		pluginsdk.ExitWithError(pluginsdk.ExitTransientFailure, "Couldn't read data from redis: ", err.Error())
+	}
+
+	if variant == variantPoster {
+		extractPoster(ffmpeg, path, destination, posterOffset)
+	} else {
+		copyFile(path, destination)
+	}
+}
+
+func main() {
+	crawlCommand := flag.NewFlagSet("crawl", flag.ExitOnError)
+	directoryCrawlCmd := crawlCommand.String("directory", "", "Path to the video directory")
+	workersCrawlCmd := crawlCommand.Int("workers", runtime.NumCPU(), "Number of videos that are processed in parallel")
+	dateStrategiesCrawlCmd := crawlCommand.String("date-strategies", strings.Join(DEFAULT_DATE_STRATEGIES, ","), "Comma separated list of sources the date of a video is taken from")
+	filenamePatternCrawlCmd := crawlCommand.String("filename-pattern", "", "Regular expression with the named groups 'year', 'month' and 'day' to extract the date from the filename")
+
+	fetchCommand := flag.NewFlagSet("fetch", flag.ExitOnError)
+	fetchId := fetchCommand.String("id", "", "Identifier")
+	destinationFetchCmd := fetchCommand.String("destination", "", "Destination")
+	variantFetchCmd := fetchCommand.String("variant", variantOriginal, "Either the original video ('original') or a still image ('poster')")
+	ffmpegFetchCmd := fetchCommand.String("ffmpeg", "ffmpeg", "Path to the ffmpeg binary")
+	posterOffsetFetchCmd := fetchCommand.String("poster-offset", "1", "Position (in seconds) of the frame that is used as poster")
+
+	redisMaxConnections := 10
+
+	flag.Parse()
+
+	pluginsdk.SetupLogging()
+
+	if len(os.Args) == 1 {
+		pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please use either 'crawl' or 'fetch'")
+	}
+
+	switch os.Args[1] {
+		case "crawl":
+			crawlCommand.Parse(os.Args[2:])
+			if *directoryCrawlCmd == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a directory")
+			}
+
+			if *workersCrawlCmd <= 0 {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a valid number of workers")
+			}
+
+			dateStrategies, err := imagedate.ParseStrategies(*dateStrategiesCrawlCmd)
+			if err != nil {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, err.Error())
+			}
+			if strings.TrimSpace(*dateStrategiesCrawlCmd) == "" {
+				dateStrategies = DEFAULT_DATE_STRATEGIES
+			}
+
+			dateExtractor := imagedate.NewExtractor(dateStrategies)
+			if *filenamePatternCrawlCmd != "" {
+				err = dateExtractor.SetFilenamePattern(*filenamePatternCrawlCmd)
+				if err != nil {
+					pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid filename pattern: ", err.Error())
+				}
+			}
+
+			skipped := crawl(pluginsdk.GetRedisAddress(), redisMaxConnections, *directoryCrawlCmd, *workersCrawlCmd, dateExtractor)
+			if skipped > 0 {
+				os.Exit(pluginsdk.ExitPartialSuccess)
+			}
+
+		case "fetch":
+			fetchCommand.Parse(os.Args[2:])
+			if *fetchId == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a id")
+			}
+
+			if *destinationFetchCmd == "" {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Please provide a destination")
+			}
+
+			if *variantFetchCmd != variantOriginal && *variantFetchCmd != variantPoster {
+				pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, "Invalid variant '", *variantFetchCmd, "'")
+			}
+
+			fetch(pluginsdk.GetRedisAddress(), redisMaxConnections, *fetchId, *destinationFetchCmd, *variantFetchCmd, *ffmpegFetchCmd, *posterOffsetFetchCmd)
+		default:
+			pluginsdk.ExitWithError(pluginsdk.ExitConfigFailure, os.Args[1], " is not valid command.")
+	}
+}
@@ -0,0 +1,80 @@
+package pluginsdk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+//size of the rendered cards and the width of their texts
+const (
+	CardWidth = 800
+	CardHeight = 480
+	cardTextWidth = CardWidth - 80
+)
+
+//a text of a card, it's wrapped (and scaled down) to fit into its box
+type CardText struct {
+	Text string
+	Height int
+	Color string
+	//alignment of the text within its box, e.g "center" or "west"
+	Align string
+	//position of the box on the card ("north", "center" or "south") and its vertical distance to that position
+	Position string
+	Offset int
+}
+
+//the image of an item that isn't an image itself (e.g an event). It's either drawn on a solid background color
+//or on a vector graphic (MVG) of the size of the card.
+type Card struct {
+	Background string
+	Mvg string
+	Texts []CardText
+}
+
+func getCardArgs(card Card, dir string, destination string) []string {
+	args := []string{"-size", fmt.Sprintf("%dx%d", CardWidth, CardHeight), "xc:" + card.Background}
+	if card.Mvg != "" {
+		args = []string{"mvg:" + filepath.Join(dir, "card.mvg")}
+	}
+
+	for i, text := range card.Texts {
+		args = append(args, "(", "-size", fmt.Sprintf("%dx%d", cardTextWidth, text.Height), "-background", "none",
+						"-fill", text.Color, "-gravity", text.Align, "caption:@" + filepath.Join(dir, strconv.Itoa(i) + ".txt"), ")",
+						"-gravity", text.Position, "-geometry", fmt.Sprintf("+0+%d", text.Offset), "-composite")
+	}
+	return append(args, "png:" + destination)
+}
+
+//renders the card with ImageMagick. The texts are passed as files, so that they aren't interpreted by ImageMagick.
+func RenderCard(magick string, card Card, destination string) error {
+	dir, err := ioutil.TempDir("", "card")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	if card.Mvg != "" {
+		err = ioutil.WriteFile(filepath.Join(dir, "card.mvg"), []byte(card.Mvg), 0600)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, text := range card.Texts {
+		err = ioutil.WriteFile(filepath.Join(dir, strconv.Itoa(i) + ".txt"), []byte(text.Text), 0600)
+		if err != nil {
+			return err
+		}
+	}
+
+	output, err := exec.Command(magick, getCardArgs(card, dir, destination)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s", err.Error(), string(output))
+	}
+	return nil
+}
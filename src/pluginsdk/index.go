@@ -0,0 +1,79 @@
+package pluginsdk
+
+import (
+	"github.com/gomodule/redigo/redis"
+	"encoding/json"
+	"time"
+)
+
+//the entries of a plugin per date, together with the items the entries refer to (e.g the path of an image). It's
+//filled during the crawl and written to redis at the end of it. Not safe for concurrent use.
+type Index struct {
+	topic string
+	itemType string
+	items map[string]interface{}
+	entriesPerDate map[string][]interface{}
+	entriesPerFullDate map[string][]interface{}
+}
+
+func NewIndex(topic string, itemType string) *Index {
+	return &Index{topic: topic, itemType: itemType, items: make(map[string]interface{}),
+					entriesPerDate: make(map[string][]interface{}), entriesPerFullDate: make(map[string][]interface{})}
+}
+
+//adds the entry with the given id on the given date. The item is what's needed to fetch the entry later on,
+//strings are stored as they are and everything else as JSON.
+func (i *Index) Add(id string, date time.Time, entry interface{}, item interface{}) {
+	i.items[id] = item
+	i.entriesPerDate[date.Format("01-02")] = append(i.entriesPerDate[date.Format("01-02")], entry)
+	i.entriesPerFullDate[date.Format("2006-01-02")] = append(i.entriesPerFullDate[date.Format("2006-01-02")], entry)
+}
+
+func (i *Index) Len() int {
+	return len(i.items)
+}
+
+//writes the items (<topic>:<item type>:<id>) and the entries per day of the year (<topic>:date:<MM-DD>) and
+//per day (<topic>:fulldate:<YYYY-MM-DD>)
+func (i *Index) Write(redisConn redis.Conn) error {
+	for id, item := range i.items {
+		value, ok := item.(string)
+		if !ok {
+			serializedItem, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			value = string(serializedItem)
+		}
+
+		_, err := redisConn.Do("SET", i.topic+":"+i.itemType+":"+id, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	for key, entries := range i.entriesPerDate {
+		err := setJson(redisConn, i.topic+":date:"+key, entries)
+		if err != nil {
+			return err
+		}
+	}
+
+	for key, entries := range i.entriesPerFullDate {
+		err := setJson(redisConn, i.topic+":fulldate:"+key, entries)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setJson(redisConn redis.Conn, key string, value interface{}) error {
+	serializedValue, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	_, err = redisConn.Do("SET", key, serializedValue)
+	return err
+}
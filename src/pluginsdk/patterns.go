@@ -0,0 +1,41 @@
+package pluginsdk
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+//splits the comma separated list of a flag, empty items are dropped
+func SplitList(s string) []string {
+	items := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if strings.TrimSpace(item) != "" {
+			items = append(items, strings.TrimSpace(item))
+		}
+	}
+	return items
+}
+
+//case insensitive glob patterns (see path.Match), e.g '*@example.com' or 'Archive/*'
+type Patterns []string
+
+//parses a comma separated list of patterns
+func ParsePatterns(s string) (Patterns, error) {
+	patterns := Patterns(SplitList(strings.ToLower(s)))
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.New("Invalid pattern '" + pattern + "'")
+		}
+	}
+	return patterns, nil
+}
+
+func (p Patterns) MatchesAny(s string) bool {
+	for _, pattern := range p {
+		if matched, _ := path.Match(pattern, strings.ToLower(s)); matched {
+			return true
+		}
+	}
+	return false
+}
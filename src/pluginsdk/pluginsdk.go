@@ -0,0 +1,126 @@
+package pluginsdk
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/gomodule/redigo/redis"
+	"encoding/json"
+	"encoding/hex"
+	"crypto/sha256"
+	"bytes"
+	"flag"
+	"os"
+	"fmt"
+)
+
+//exit codes as defined by mindfulbytes' plugin exit code contract (see utils.PluginExit*)
+const (
+	ExitPartialSuccess = 10
+	ExitNothingChanged = 11
+	ExitTransientFailure = 75
+	ExitConfigFailure = 78
+)
+
+const progressPrefix = "mindfulbytes:progress "
+
+//reported to the crawler, see "mindfulbytes:progress" in the plugin protocol
+type Progress struct {
+	Discovered int `json:"discovered"`
+	Processed int `json:"processed"`
+	Errors int `json:"errors"`
+	Path string `json:"path,omitempty"`
+}
+
+func formatProgress(progress Progress) (string, error) {
+	serializedProgress, err := json.Marshal(progress)
+	if err != nil {
+		return "", err
+	}
+	return progressPrefix + string(serializedProgress), nil
+}
+
+func ReportProgress(progress Progress) {
+	line, err := formatProgress(progress)
+	if err != nil {
+		log.Error("Couldn't marshal progress: ", err.Error())
+		return
+	}
+	fmt.Println(line)
+}
+
+func ExitWithError(exitCode int, args ...interface{}) {
+	log.Error(args...)
+	os.Exit(exitCode)
+}
+
+//writes error log lines to stderr and everything else to stdout
+type OutputSplitter struct{}
+
+func (splitter *OutputSplitter) Write(p []byte) (n int, err error) {
+	if bytes.Contains(p, []byte("\"level\":\"error\"")) {
+		return os.Stderr.Write(p)
+	}
+	return os.Stdout.Write(p)
+}
+
+func SetupLogging() {
+	log.SetLevel(log.DebugLevel)
+	//structured log lines are picked up by mindfulbytes and stored in the plugin's log buffer
+	log.SetFormatter(&log.JSONFormatter{})
+	log.SetOutput(&OutputSplitter{})
+}
+
+func GetRedisAddress() string {
+	redisAddress := os.Getenv("REDIS_ADDRESS")
+	if redisAddress == "" {
+		return ":6379"
+	}
+
+	return redisAddress
+}
+
+func NewRedisPool(redisAddress string, redisMaxConnections int) *redis.Pool {
+	return redis.NewPool(func() (redis.Conn, error) {
+		c, err := redis.Dial("tcp", redisAddress)
+
+		if err != nil {
+			ExitWithError(ExitTransientFailure, "[Main] Couldn't dial redis: ", err.Error())
+		}
+
+		return c, err
+	}, redisMaxConnections)
+}
+
+//deletes all existing keys of the plugin. Plugins call it after the source was read, right before
+//the new entries are written, to keep the time without any data short.
+func DeleteAllKeys(redisConn redis.Conn, topic string) {
+	existingKeys, err := redis.Strings(redisConn.Do("KEYS", topic+":*"))
+	if err != nil {
+		ExitWithError(ExitTransientFailure, "Couldn't clear existing keys in redis")
+	}
+	for _, existingKey := range existingKeys {
+		_, err = redisConn.Do("DEL", existingKey)
+		if err != nil {
+			ExitWithError(ExitTransientFailure, "Couldn't delete key in redis: ", err.Error())
+		}
+	}
+}
+
+//returns true in case the plugin has stored any keys, e.g to detect that redis was flushed since the last crawl
+func HasKeys(redisConn redis.Conn, topic string) bool {
+	existingKeys, err := redis.Strings(redisConn.Do("KEYS", topic+":*"))
+	if err != nil {
+		log.Warn("Couldn't get existing keys in redis: ", err.Error())
+		return false
+	}
+	return len(existingKeys) > 0
+}
+
+//returns a fingerprint of all the flags that were set, e.g to discard a cache in case the plugin's config
+//changed. The values are hashed, as they may contain credentials.
+func GetFlagsFingerprint(flagSet *flag.FlagSet) string {
+	hash := sha256.New()
+	flagSet.Visit(func(f *flag.Flag) {
+		hash.Write([]byte(f.Name + "=" + f.Value.String() + "\n"))
+	})
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,174 @@
+package pluginsdk
+
+import (
+	"github.com/gomodule/redigo/redis"
+	"testing"
+	"fmt"
+	"runtime"
+	"path/filepath"
+	"reflect"
+	"flag"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"errors"
+)
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+func TestFormatProgress(t *testing.T) {
+	line, err := formatProgress(Progress{Discovered: 10, Processed: 5, Errors: 1, Path: "/images/2019"})
+	ok(t, err)
+	equals(t, `mindfulbytes:progress {"discovered":10,"processed":5,"errors":1,"path":"/images/2019"}`, line)
+}
+
+func TestFormatProgressWithoutPath(t *testing.T) {
+	line, err := formatProgress(Progress{Discovered: 3, Processed: 3})
+	ok(t, err)
+	equals(t, `mindfulbytes:progress {"discovered":3,"processed":3,"errors":0}`, line)
+}
+
+func TestGetFlagsFingerprint(t *testing.T) {
+	newFlagSet := func(args []string) *flag.FlagSet {
+		flagSet := flag.NewFlagSet("crawl", flag.ContinueOnError)
+		flagSet.String("include", "", "")
+		flagSet.String("exclude", "", "")
+		ok(t, flagSet.Parse(args))
+		return flagSet
+	}
+
+	fingerprint := GetFlagsFingerprint(newFlagSet([]string{"--include", "*.jpg"}))
+	equals(t, fingerprint, GetFlagsFingerprint(newFlagSet([]string{"--include", "*.jpg"})))
+	equals(t, false, fingerprint == GetFlagsFingerprint(newFlagSet([]string{"--include", "*.png"})))
+	equals(t, false, fingerprint == GetFlagsFingerprint(newFlagSet([]string{"--include", "*.jpg", "--exclude", "2019"})))
+}
+
+func TestWalkDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pluginsdk")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, path := range []string{"a.jpg", "b.txt", "2019/c.jpg", "2019/05/d.JPG", "2020/e.png"} {
+		path = filepath.Join(dir, path)
+		ok(t, os.MkdirAll(filepath.Dir(path), 0755))
+		ok(t, ioutil.WriteFile(path, []byte("data"), 0644))
+	}
+
+	isJpeg := func(path string) bool {
+		return strings.ToLower(filepath.Ext(path)) == ".jpg"
+	}
+
+	stats := &CrawlStats{}
+	paths := []string{}
+	for file := range WalkDirectory(dir, 2, isJpeg, stats) {
+		equals(t, filepath.Base(file.Path), file.Info.Name())
+		paths = append(paths, file.Path)
+	}
+	sort.Strings(paths)
+	equals(t, []string{filepath.Join(dir, "2019/05/d.JPG"), filepath.Join(dir, "2019/c.jpg"), filepath.Join(dir, "a.jpg")}, paths)
+	equals(t, Progress{Discovered: 3}, stats.Progress(""))
+}
+
+func TestWalkDirectoryThatDoesNotExist(t *testing.T) {
+	stats := &CrawlStats{}
+	files := 0
+	for range WalkDirectory("/nonexistent/images", 2, func(path string) bool { return true }, stats) {
+		files += 1
+	}
+	equals(t, 0, files)
+	equals(t, 1, stats.Errors())
+}
+
+func TestGetCardArgs(t *testing.T) {
+	card := Card{Background: "#1d3557", Texts: []CardText{
+		{Text: "Birthday", Height: 260, Color: "white", Align: "center", Position: "north", Offset: 40},
+		{Text: "Monday, 20 May 2019", Height: 100, Color: "#a8dadc", Align: "center", Position: "south", Offset: 40}}}
+	equals(t, []string{"-size", "800x480", "xc:#1d3557",
+		"(", "-size", "720x260", "-background", "none", "-fill", "white", "-gravity", "center", "caption:@/tmp/card/0.txt", ")",
+		"-gravity", "north", "-geometry", "+0+40", "-composite",
+		"(", "-size", "720x100", "-background", "none", "-fill", "#a8dadc", "-gravity", "center", "caption:@/tmp/card/1.txt", ")",
+		"-gravity", "south", "-geometry", "+0+40", "-composite",
+		"png:/tmp/card.png"}, getCardArgs(card, "/tmp/card", "/tmp/card.png"))
+
+	card = Card{Mvg: "viewbox 0 0 800 480", Texts: []CardText{{Text: "Morning run", Height: 110, Color: "white", Align: "center", Position: "south", Offset: 10}}}
+	equals(t, []string{"mvg:/tmp/card/card.mvg",
+		"(", "-size", "720x110", "-background", "none", "-fill", "white", "-gravity", "center", "caption:@/tmp/card/0.txt", ")",
+		"-gravity", "south", "-geometry", "+0+10", "-composite",
+		"png:/tmp/card.png"}, getCardArgs(card, "/tmp/card", "/tmp/card.png"))
+}
+
+func TestRenderCardWithoutImageMagick(t *testing.T) {
+	err := RenderCard("/nonexistent/magick", Card{Background: "white"}, "/nonexistent/card.png")
+	equals(t, true, err != nil)
+}
+
+//records the SET commands
+type fakeRedisConn struct {
+	redis.Conn
+	values map[string]string
+}
+
+func (c *fakeRedisConn) Do(command string, args ...interface{}) (interface{}, error) {
+	if command != "SET" {
+		return nil, fmt.Errorf("Command %s not supported", command)
+	}
+	c.values[fmt.Sprint(args[0])] = fmt.Sprintf("%s", args[1])
+	return "OK", nil
+}
+
+func TestWriteIndex(t *testing.T) {
+	type entry struct {
+		Uuid string `json:"uuid"`
+	}
+
+	index := NewIndex("calreader-fs", "event")
+	index.Add("1", time.Date(2019, 5, 20, 23, 30, 0, 0, time.Local), entry{Uuid: "1"}, map[string]string{"summary": "Birthday"})
+	index.Add("2", time.Date(2020, 5, 20, 8, 0, 0, 0, time.Local), entry{Uuid: "2"}, "/calendars/2020.ics")
+	equals(t, 2, index.Len())
+
+	conn := &fakeRedisConn{values: make(map[string]string)}
+	ok(t, index.Write(conn))
+	equals(t, map[string]string{
+		"calreader-fs:event:1": `{"summary":"Birthday"}`,
+		"calreader-fs:event:2": "/calendars/2020.ics",
+		"calreader-fs:date:05-20": `[{"uuid":"1"},{"uuid":"2"}]`,
+		"calreader-fs:fulldate:2019-05-20": `[{"uuid":"1"}]`,
+		"calreader-fs:fulldate:2020-05-20": `[{"uuid":"2"}]`,
+	}, conn.values)
+}
+
+func TestSplitList(t *testing.T) {
+	equals(t, []string{"/mail/archive", "/mail/Maildir"}, SplitList(" /mail/archive, ,/mail/Maildir,"))
+	equals(t, []string{}, SplitList(""))
+}
+
+func TestPatterns(t *testing.T) {
+	patterns, err := ParsePatterns("*@Example.com, Archive/*")
+	ok(t, err)
+	equals(t, Patterns{"*@example.com", "archive/*"}, patterns)
+	equals(t, true, patterns.MatchesAny("Jane@example.com"))
+	equals(t, true, patterns.MatchesAny("archive/2019"))
+	equals(t, false, patterns.MatchesAny("jane@example.org"))
+	equals(t, false, Patterns{}.MatchesAny("jane@example.com"))
+
+	_, err = ParsePatterns("[a-")
+	equals(t, errors.New("Invalid pattern '[a-'"), err)
+}
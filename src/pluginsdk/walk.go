@@ -0,0 +1,83 @@
+package pluginsdk
+
+import (
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+//counters of a crawl, safe for concurrent use
+type CrawlStats struct {
+	discovered int32
+	processed int32
+	errors int32
+}
+
+func (s *CrawlStats) AddDiscovered(n int) {
+	atomic.AddInt32(&s.discovered, int32(n))
+}
+
+func (s *CrawlStats) AddProcessed() {
+	atomic.AddInt32(&s.processed, 1)
+}
+
+func (s *CrawlStats) AddError() {
+	atomic.AddInt32(&s.errors, 1)
+}
+
+func (s *CrawlStats) Errors() int {
+	return int(atomic.LoadInt32(&s.errors))
+}
+
+func (s *CrawlStats) Progress(path string) Progress {
+	return Progress{Discovered: int(atomic.LoadInt32(&s.discovered)), Processed: int(atomic.LoadInt32(&s.processed)),
+					Errors: s.Errors(), Path: path}
+}
+
+type File struct {
+	Path string
+	Info os.FileInfo
+}
+
+//walks the directory tree concurrently and sends every file that is accepted by the filter to the returned channel.
+//At most parallelism directories are read at the same time, the channel is closed once the whole tree was walked.
+//Directories that can't be read are skipped and counted as errors.
+func WalkDirectory(dir string, parallelism int, filter func(path string) bool, stats *CrawlStats) <-chan File {
+	files := make(chan File, 100)
+	walkers := &sync.WaitGroup{}
+	walkers.Add(1)
+	go walkDirectory(dir, files, walkers, make(chan struct{}, parallelism), filter, stats)
+	go func() {
+		walkers.Wait()
+		close(files)
+	}()
+	return files
+}
+
+func walkDirectory(dir string, files chan<- File, walkers *sync.WaitGroup, semaphore chan struct{},
+					filter func(path string) bool, stats *CrawlStats) {
+	defer walkers.Done()
+
+	semaphore <- struct{}{}
+	entries, err := ioutil.ReadDir(dir)
+	<-semaphore
+	if err != nil {
+		log.Error("Skipping directory ", dir, ": ", err.Error())
+		stats.AddError()
+		return
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			walkers.Add(1)
+			go walkDirectory(path, files, walkers, semaphore, filter, stats)
+		} else if filter(path) {
+			stats.AddDiscovered(1)
+			files <- File{Path: path, Info: entry}
+		}
+	}
+}
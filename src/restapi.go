@@ -67,6 +67,9 @@ func main() {
 	redisMaxConnections := flag.Int("redis-max-connections", 500, "Max connections to Redis")
 	baseUrl := flag.String("base-url", "http://127.0.0.1:8085", "Base URL")
 	tmpDir := flag.String("tmp-dir", "/tmp", "Tmp directory")
+	dataDir := flag.String("data-dir", "../data/", "Directory where the plugins store their data")
+	cacheDir := flag.String("cache-dir", "../cache/", "Directory where the plugins store their cache")
+	pluginLogLines := flag.Int("plugin-log-lines", 1000, "Number of log lines that are kept per plugin")
 
 	flag.Parse()
 
@@ -91,7 +94,8 @@ func main() {
 	}, *redisMaxConnections)
 	defer redisPool.Close()
 
-	plugins := utils.NewPlugins("./plugins/", configDir)
+	sandboxOptions := utils.SandboxOptions{RedisAddress: *redisAddress, DataDir: *dataDir, CacheDir: *cacheDir, TmpDir: *tmpDir}
+	plugins := utils.NewPlugins("./plugins/", configDir, sandboxOptions, utils.NewPluginLogBuffer(redisPool, *pluginLogLines))
 	err := plugins.Load()
 	if err != nil {
 		log.Fatal(err)
@@ -140,11 +144,19 @@ func main() {
 		pluginsGroup := v1.Group("/plugins")
 		{
 			pluginsGroup.GET("", requestHandler.GetPlugins)
+			pluginsGroup.GET("/status", requestHandler.GetPluginsStatus)
+			pluginsGroup.GET("/:plugin/status", requestHandler.GetPluginStatus)
+			pluginsGroup.GET("/:plugin/logs", requestHandler.GetPluginLogs)
 			pluginsGroup.GET("/:plugin/dates", requestHandler.GetDatesForPlugin)
 			pluginsGroup.GET("/:plugin/dates/:date", requestHandler.GetDateDataForPlugin)
 			pluginsGroup.GET("/:plugin/fulldates", requestHandler.GetFullDatesForPlugin)
 			pluginsGroup.GET("/:plugin/fulldates/:fulldate", requestHandler.GetFullDateDataForPlugin)
 			pluginsGroup.GET("/:plugin/images/:imageid", requestHandler.GetImageForPlugin)
+			pluginsGroup.GET("/:plugin/items/:itemid", requestHandler.GetItemForPlugin)
+			pluginsGroup.GET("/:plugin/videos/:videoid", requestHandler.GetVideoForPlugin)
+			pluginsGroup.POST("/:plugin/crawl", requestHandler.TriggerCrawlForPlugin)
+			pluginsGroup.GET("/:plugin/crawl", requestHandler.GetCrawlJobsForPlugin)
+			pluginsGroup.GET("/:plugin/crawl/:jobid", requestHandler.GetCrawlJobForPlugin)
 		}
 
 		cacheGroup := v1.Group("/cache")
@@ -0,0 +1,119 @@
+package socialarchive
+
+import (
+	"encoding/json"
+	"html"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var htmlLineBreakRegex = regexp.MustCompile(`(?i)<br\s*/?>`)
+var htmlParagraphRegex = regexp.MustCompile(`(?i)</p>\s*<p[^>]*>`)
+var htmlTagRegex = regexp.MustCompile(`<[^>]+>`)
+
+type mastodonAttachment struct {
+	MediaType string `json:"mediaType"`
+	//relative to the archive, e.g /media_attachments/files/000/000/001/original/abc.jpg
+	Url string `json:"url"`
+}
+
+//mentions and emojis are tags as well
+type mastodonTag struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type mastodonNote struct {
+	Id string `json:"id"`
+	Type string `json:"type"`
+	Url string `json:"url"`
+	Published string `json:"published"`
+	//the content warning
+	Summary string `json:"summary"`
+	Content string `json:"content"`
+	InReplyTo *string `json:"inReplyTo"`
+	Attachment []mastodonAttachment `json:"attachment"`
+	Tag []mastodonTag `json:"tag"`
+}
+
+type mastodonActivity struct {
+	Type string `json:"type"`
+	//the note of a post, the link to the boosted post of a boost
+	Object json.RawMessage `json:"object"`
+}
+
+type mastodonOutbox struct {
+	OrderedItems []mastodonActivity `json:"orderedItems"`
+}
+
+//converts the HTML of a post to plain text, paragraphs and line breaks are kept
+func htmlToText(s string) string {
+	s = htmlParagraphRegex.ReplaceAllString(s, "\n\n")
+	s = htmlLineBreakRegex.ReplaceAllString(s, "\n")
+	s = htmlTagRegex.ReplaceAllString(s, "")
+	return strings.TrimSpace(html.UnescapeString(s))
+}
+
+//the attachments are referenced by their path on the server, which is the same in the archive
+func resolveMastodonAttachment(dir string, attachment mastodonAttachment) (string, bool) {
+	p := attachment.Url
+	if u, err := url.Parse(attachment.Url); err == nil {
+		p = u.Path
+	}
+	return resolveFile(dir, strings.TrimPrefix(p, "/"))
+}
+
+//parses the outbox (outbox.json) of a Mastodon archive. Boosts only link to the boosted post, they are skipped.
+func ParseMastodon(r io.Reader, dir string) ([]Post, error) {
+	var outbox mastodonOutbox
+	err := json.NewDecoder(r).Decode(&outbox)
+	if err != nil {
+		return []Post{}, err
+	}
+
+	posts := []Post{}
+	for _, activity := range outbox.OrderedItems {
+		if activity.Type != "Create" {
+			continue
+		}
+		var note mastodonNote
+		if json.Unmarshal(activity.Object, &note) != nil || note.Type != "Note" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, note.Published)
+		if err != nil {
+			continue
+		}
+
+		post := Post{Network: NetworkMastodon, Id: note.Id, Url: note.Url, Time: t, Text: htmlToText(note.Content),
+					Reply: note.InReplyTo != nil && *note.InReplyTo != ""}
+		if post.Url == "" {
+			post.Url = note.Id
+		}
+		if summary := strings.TrimSpace(note.Summary); summary != "" {
+			post.Text = strings.TrimSpace(summary + "\n\n" + post.Text)
+		}
+		for _, tag := range note.Tag {
+			if tag.Type == "Hashtag" {
+				post.Tags = append(post.Tags, strings.TrimPrefix(tag.Name, "#"))
+			}
+		}
+		for _, attachment := range note.Attachment {
+			if !strings.HasPrefix(attachment.MediaType, "image/") {
+				continue
+			}
+			if p, ok := resolveMastodonAttachment(dir, attachment); ok {
+				post.Images = append(post.Images, p)
+			}
+		}
+
+		if post.Text != "" || len(post.Images) > 0 {
+			posts = append(posts, post)
+		}
+	}
+	return posts, nil
+}
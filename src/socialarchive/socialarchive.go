@@ -0,0 +1,134 @@
+package socialarchive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+//the networks whose archives can be read
+const (
+	NetworkTwitter = "twitter"
+	NetworkMastodon = "mastodon"
+)
+
+var ErrUnknownNetwork = errors.New("Unknown social media archive")
+
+//the tweets of bigger Twitter archives are split into several files (tweets.js, tweets-part1.js, ...), older archives name them tweet.js
+var twitterFileRegex = regexp.MustCompile(`^tweets?(-part[0-9]+)?\.js$`)
+
+type Post struct {
+	Network string
+	Id string
+	//link to the post, empty if it isn't known
+	Url string
+	Time time.Time
+	Text string
+	Reply bool
+	//retweets, they contain the text of someone else
+	Repost bool
+	//paths of the attached images (only those that are part of the archive)
+	Images []string
+	//the hashtags, without '#'
+	Tags []string
+}
+
+//the file of an archive that contains the posts, i.e tweets.js of a Twitter archive or outbox.json of a Mastodon archive
+type Archive struct {
+	Network string
+	Path string
+}
+
+func isImage(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp":
+		return true
+	}
+	return false
+}
+
+//returns the path of a file that's referenced in an archive, if it exists
+func resolveFile(dir string, name string) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+	p := filepath.Join(dir, filepath.FromSlash(name))
+	info, err := os.Stat(p)
+	if err != nil || info.IsDir() {
+		return "", false
+	}
+	return p, true
+}
+
+//determines the network by the name of the file, returns an empty string if it doesn't contain posts
+func detectNetwork(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	if twitterFileRegex.MatchString(name) {
+		return NetworkTwitter
+	}
+	if name == "outbox.json" {
+		return NetworkMastodon
+	}
+	return ""
+}
+
+//returns the (extracted) archives below the given path (a file or a directory)
+func FindArchives(root string) ([]Archive, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return []Archive{}, err
+	}
+
+	if !info.IsDir() {
+		network := detectNetwork(root)
+		if network == "" {
+			return []Archive{}, errors.New(root + " isn't part of a Twitter or Mastodon archive")
+		}
+		return []Archive{Archive{Network: network, Path: root}}, nil
+	}
+
+	archives := []Archive{}
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != root && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if network := detectNetwork(path); network != "" {
+			archives = append(archives, Archive{Network: network, Path: path})
+		}
+		return nil
+	})
+
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].Path < archives[j].Path
+	})
+	return archives, err
+}
+
+//reads the posts of the archive, the images are referenced relative to the archive's directory
+func (a Archive) Read() ([]Post, error) {
+	f, err := os.Open(a.Path)
+	if err != nil {
+		return []Post{}, err
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(a.Path)
+	switch a.Network {
+	case NetworkTwitter:
+		return ParseTwitter(f, dir)
+	case NetworkMastodon:
+		return ParseMastodon(f, dir)
+	}
+	return []Post{}, ErrUnknownNetwork
+}
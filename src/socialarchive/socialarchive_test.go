@@ -0,0 +1,214 @@
+package socialarchive
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error, expected not nil, but got nil: \033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+const twitterTweets = `window.YTD.tweets.part0 = [
+  {
+    "tweet" : {
+      "id_str" : "1146755000000000001",
+      "full_text" : "Sunset at the lake &amp; a swim #summer, see https://t.co/abc https://t.co/img",
+      "created_at" : "Thu Jul 04 18:34:56 +0000 2019",
+      "in_reply_to_status_id_str" : "",
+      "entities" : {
+        "urls" : [ { "url" : "https://t.co/abc", "expanded_url" : "https://example.com/lake" } ],
+        "hashtags" : [ { "text" : "summer", "indices" : [ 29, 36 ] } ],
+        "media" : [ { "url" : "https://t.co/img", "media_url_https" : "https://pbs.twimg.com/media/D-abc.jpg", "type" : "photo" } ]
+      },
+      "extended_entities" : {
+        "media" : [
+          { "url" : "https://t.co/img", "media_url_https" : "https://pbs.twimg.com/media/D-abc.jpg", "type" : "photo" },
+          { "url" : "https://t.co/img", "media_url_https" : "https://pbs.twimg.com/media/D-def.jpg", "type" : "photo" },
+          { "url" : "https://t.co/img", "media_url_https" : "https://pbs.twimg.com/tweet_video_thumb/D-ghi.jpg", "type" : "animated_gif" }
+        ]
+      }
+    }
+  },
+  {
+    "tweet" : {
+      "id_str" : "1146755000000000002",
+      "full_text" : "@ben Thanks!",
+      "created_at" : "Fri Jul 05 08:00:00 +0000 2019",
+      "in_reply_to_status_id_str" : "1146755000000000000"
+    }
+  },
+  {
+    "tweet" : {
+      "id_str" : "1146755000000000003",
+      "full_text" : "RT @ben: Look at this",
+      "created_at" : "Fri Jul 05 09:00:00 +0000 2019"
+    }
+  },
+  {
+    "tweet" : {
+      "id_str" : "1146755000000000004",
+      "full_text" : "No date"
+    }
+  }
+]`
+
+const mastodonExport = `{
+  "@context": "https://www.w3.org/ns/activitystreams",
+  "type": "OrderedCollection",
+  "orderedItems": [
+    {
+      "type": "Create",
+      "object": {
+        "id": "https://mastodon.social/users/anna/statuses/1",
+        "type": "Note",
+        "url": "https://mastodon.social/@anna/1",
+        "published": "2019-07-04T18:34:56Z",
+        "summary": null,
+        "inReplyTo": null,
+        "content": "<p>Sunset at the lake &amp; a swim</p><p>Line one<br />line two <a href=\"https://mastodon.social/tags/summer\">#<span>summer</span></a></p>",
+        "attachment": [
+          { "type": "Document", "mediaType": "image/jpeg", "url": "/media_attachments/files/000/000/001/original/abc.jpg" },
+          { "type": "Document", "mediaType": "video/mp4", "url": "/media_attachments/files/000/000/002/original/def.mp4" }
+        ],
+        "tag": [
+          { "type": "Hashtag", "href": "https://mastodon.social/tags/summer", "name": "#summer" },
+          { "type": "Mention", "href": "https://mastodon.social/users/ben", "name": "@ben" }
+        ]
+      }
+    },
+    {
+      "type": "Create",
+      "object": {
+        "id": "https://mastodon.social/users/anna/statuses/2",
+        "type": "Note",
+        "published": "2019-07-05T08:00:00Z",
+        "summary": "Food",
+        "inReplyTo": "https://mastodon.social/users/ben/statuses/7",
+        "content": "<p>Pizza again</p>",
+        "attachment": []
+      }
+    },
+    {
+      "type": "Announce",
+      "object": "https://mastodon.social/users/ben/statuses/8"
+    }
+  ]
+}`
+
+func writeFile(t *testing.T, path string, content string) {
+	ok(t, os.MkdirAll(filepath.Dir(path), 0755))
+	ok(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func TestParseTwitter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "socialarchive")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "tweets_media", "1146755000000000001-D-abc.jpg"), "image")
+	writeFile(t, filepath.Join(dir, "tweets_media", "1146755000000000001-D-ghi.mp4"), "video")
+
+	posts, err := ParseTwitter(strings.NewReader(twitterTweets), dir)
+	ok(t, err)
+	equals(t, []Post{
+		Post{Network: NetworkTwitter, Id: "1146755000000000001", Url: "https://twitter.com/i/web/status/1146755000000000001",
+			Time: time.Date(2019, 7, 4, 18, 34, 56, 0, time.UTC), Text: "Sunset at the lake & a swim #summer, see https://example.com/lake",
+			Images: []string{filepath.Join(dir, "tweets_media", "1146755000000000001-D-abc.jpg")}, Tags: []string{"summer"}},
+		Post{Network: NetworkTwitter, Id: "1146755000000000002", Url: "https://twitter.com/i/web/status/1146755000000000002",
+			Time: time.Date(2019, 7, 5, 8, 0, 0, 0, time.UTC), Text: "@ben Thanks!", Reply: true},
+		Post{Network: NetworkTwitter, Id: "1146755000000000003", Url: "https://twitter.com/i/web/status/1146755000000000003",
+			Time: time.Date(2019, 7, 5, 9, 0, 0, 0, time.UTC), Text: "RT @ben: Look at this", Repost: true},
+	}, normalizeTimes(posts))
+
+	//older archives don't wrap the tweets
+	posts, err = ParseTwitter(strings.NewReader(`window.YTD.tweet.part0 = [ { "id_str" : "1", "full_text" : "Hello", "created_at" : "Thu Jul 04 18:34:56 +0000 2019" } ]`), dir)
+	ok(t, err)
+	equals(t, 1, len(posts))
+	equals(t, "Hello", posts[0].Text)
+
+	_, err = ParseTwitter(strings.NewReader("window.YTD.tweets.part0 = "), dir)
+	equals(t, ErrInvalidTwitterArchive, err)
+}
+
+//the parsed times have the offset of the archive as zone, they are compared in UTC
+func normalizeTimes(posts []Post) []Post {
+	for i := range posts {
+		posts[i].Time = posts[i].Time.UTC()
+	}
+	return posts
+}
+
+func TestParseMastodon(t *testing.T) {
+	dir, err := ioutil.TempDir("", "socialarchive")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "media_attachments", "files", "000", "000", "001", "original", "abc.jpg"), "image")
+	writeFile(t, filepath.Join(dir, "media_attachments", "files", "000", "000", "002", "original", "def.mp4"), "video")
+
+	posts, err := ParseMastodon(strings.NewReader(mastodonExport), dir)
+	ok(t, err)
+	equals(t, []Post{
+		Post{Network: NetworkMastodon, Id: "https://mastodon.social/users/anna/statuses/1", Url: "https://mastodon.social/@anna/1",
+			Time: time.Date(2019, 7, 4, 18, 34, 56, 0, time.UTC), Text: "Sunset at the lake & a swim\n\nLine one\nline two #summer",
+			Images: []string{filepath.Join(dir, "media_attachments", "files", "000", "000", "001", "original", "abc.jpg")},
+			Tags: []string{"summer"}},
+		Post{Network: NetworkMastodon, Id: "https://mastodon.social/users/anna/statuses/2", Url: "https://mastodon.social/users/anna/statuses/2",
+			Time: time.Date(2019, 7, 5, 8, 0, 0, 0, time.UTC), Text: "Food\n\nPizza again", Reply: true},
+	}, normalizeTimes(posts))
+}
+
+func TestFindArchives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "socialarchive")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "twitter", "data", "tweets.js"), twitterTweets)
+	writeFile(t, filepath.Join(dir, "twitter", "data", "tweets-part1.js"), "window.YTD.tweets.part1 = []")
+	writeFile(t, filepath.Join(dir, "twitter", "data", "like.js"), "window.YTD.like.part0 = []")
+	writeFile(t, filepath.Join(dir, "mastodon", "outbox.json"), mastodonExport)
+	writeFile(t, filepath.Join(dir, ".hidden", "outbox.json"), mastodonExport)
+
+	archives, err := FindArchives(dir)
+	ok(t, err)
+	equals(t, []Archive{
+		Archive{Network: NetworkMastodon, Path: filepath.Join(dir, "mastodon", "outbox.json")},
+		Archive{Network: NetworkTwitter, Path: filepath.Join(dir, "twitter", "data", "tweets-part1.js")},
+		Archive{Network: NetworkTwitter, Path: filepath.Join(dir, "twitter", "data", "tweets.js")},
+	}, archives)
+
+	posts, err := archives[0].Read()
+	ok(t, err)
+	equals(t, 2, len(posts))
+
+	_, err = FindArchives(filepath.Join(dir, "twitter", "data", "like.js"))
+	notOk(t, err)
+}
@@ -0,0 +1,143 @@
+package socialarchive
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"html"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrInvalidTwitterArchive = errors.New("Invalid Twitter archive")
+
+type twitterUrl struct {
+	//the shortened t.co link as it appears in the text
+	Url string `json:"url"`
+	ExpandedUrl string `json:"expanded_url"`
+}
+
+type twitterMedia struct {
+	Url string `json:"url"`
+	MediaUrlHttps string `json:"media_url_https"`
+	Type string `json:"type"`
+}
+
+type twitterHashtag struct {
+	Text string `json:"text"`
+}
+
+type twitterTweet struct {
+	IdStr string `json:"id_str"`
+	FullText string `json:"full_text"`
+	Text string `json:"text"`
+	//e.g "Thu Jul 04 12:34:56 +0000 2019"
+	CreatedAt string `json:"created_at"`
+	InReplyToStatusIdStr string `json:"in_reply_to_status_id_str"`
+	Entities struct {
+		Urls []twitterUrl `json:"urls"`
+		Hashtags []twitterHashtag `json:"hashtags"`
+		Media []twitterMedia `json:"media"`
+	} `json:"entities"`
+	//contains all images of a tweet, entities only the first one
+	ExtendedEntities struct {
+		Media []twitterMedia `json:"media"`
+	} `json:"extended_entities"`
+}
+
+//newer archives wrap every tweet in an object
+type twitterEntry struct {
+	twitterTweet
+	Tweet *twitterTweet `json:"tweet"`
+}
+
+//the images of a tweet are stored as <id of the tweet>-<name of the image>, older archives use tweet_media as directory
+func resolveTwitterImage(dir string, id string, media twitterMedia) (string, bool) {
+	name := id + "-" + path.Base(media.MediaUrlHttps)
+	for _, mediaDir := range []string{"tweets_media", "tweet_media"} {
+		if p, ok := resolveFile(dir, filepath.Join(mediaDir, name)); ok {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+//the text with the shortened links replaced by the actual ones and without the links to the images
+func (t twitterTweet) text(media []twitterMedia) string {
+	text := t.FullText
+	if text == "" {
+		text = t.Text
+	}
+	for _, m := range media {
+		if m.Url != "" {
+			text = strings.Replace(text, m.Url, "", -1)
+		}
+	}
+	for _, u := range t.Entities.Urls {
+		if u.Url != "" && u.ExpandedUrl != "" {
+			text = strings.Replace(text, u.Url, u.ExpandedUrl, -1)
+		}
+	}
+	return strings.TrimSpace(html.UnescapeString(text))
+}
+
+//parses the tweets of a Twitter archive (data/tweets.js). The file is a JavaScript assignment
+//('window.YTD.tweets.part0 = [...]'), the images are stored in data/tweets_media.
+func ParseTwitter(r io.Reader, dir string) ([]Post, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return []Post{}, err
+	}
+	start := bytes.IndexByte(data, '[')
+	if start == -1 {
+		return []Post{}, ErrInvalidTwitterArchive
+	}
+
+	var entries []twitterEntry
+	err = json.Unmarshal(data[start:], &entries)
+	if err != nil {
+		return []Post{}, err
+	}
+
+	posts := []Post{}
+	for _, entry := range entries {
+		tweet := entry.twitterTweet
+		if entry.Tweet != nil {
+			tweet = *entry.Tweet
+		}
+
+		t, err := time.Parse(time.RubyDate, tweet.CreatedAt)
+		if err != nil {
+			continue
+		}
+
+		media := tweet.ExtendedEntities.Media
+		if len(media) == 0 {
+			media = tweet.Entities.Media
+		}
+		post := Post{Network: NetworkTwitter, Id: tweet.IdStr, Time: t, Text: tweet.text(media),
+					Reply: tweet.InReplyToStatusIdStr != "", Url: "https://twitter.com/i/web/status/" + tweet.IdStr}
+		post.Repost = strings.HasPrefix(post.Text, "RT @")
+		for _, hashtag := range tweet.Entities.Hashtags {
+			post.Tags = append(post.Tags, hashtag.Text)
+		}
+		for _, m := range media {
+			//videos and animated GIFs are stored as MP4
+			if m.Type != "photo" {
+				continue
+			}
+			if p, ok := resolveTwitterImage(dir, tweet.IdStr, m); ok && isImage(p) {
+				post.Images = append(post.Images, p)
+			}
+		}
+
+		if post.Text != "" || len(post.Images) > 0 {
+			posts = append(posts, post)
+		}
+	}
+	return posts, nil
+}
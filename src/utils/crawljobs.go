@@ -0,0 +1,335 @@
+package utils
+
+import (
+	"encoding/json"
+	"time"
+	"github.com/gofrs/uuid"
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	CrawlJobQueued = "queued"
+	CrawlJobRunning = "running"
+	CrawlJobSucceeded = "succeeded"
+	CrawlJobFailed = "failed"
+)
+
+const (
+	CrawlTriggerSchedule = "schedule"
+	CrawlTriggerApi = "api"
+)
+
+//the crawler process picks up the jobs from this list
+const crawlJobQueueKey = "crawljobs:queue"
+
+//keep the job details for a week, the per plugin job list only holds the last x jobs
+const crawlJobExpiresInSeconds = 7 * 24 * 60 * 60
+const maxCrawlJobsPerPlugin = 20
+
+type CrawlJob struct {
+	Id string `json:"id"`
+	Plugin string `json:"plugin"`
+	State string `json:"state"`
+	Trigger string `json:"trigger"`
+	Queued int64 `json:"queued"`
+	Started int64 `json:"started,omitempty"`
+	Finished int64 `json:"finished,omitempty"`
+	Duration float64 `json:"duration,omitempty"`
+	Error string `json:"error,omitempty"`
+	ExitCode int `json:"exitcode"`
+	Outcome string `json:"outcome,omitempty"`
+	Stderr []string `json:"stderr,omitempty"`
+	Items int `json:"items"`
+	Progress *CrawlProgress `json:"progress,omitempty"`
+}
+
+func getCrawlJobKey(id string) string {
+	return "crawljob:" + id
+}
+
+func getCrawlJobsForPluginKey(pluginName string) string {
+	return "crawljobs:plugin:" + pluginName
+}
+
+func SetCrawlJob(redisPool *redis.Pool, job CrawlJob) error {
+	redisConnection := redisPool.Get()
+	defer redisConnection.Close()
+
+	serializedJob, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	_, err = redisConnection.Do("SETEX", getCrawlJobKey(job.Id), crawlJobExpiresInSeconds, serializedJob)
+	return err
+}
+
+func GetCrawlJob(redisPool *redis.Pool, id string) (CrawlJob, error) {
+	var job CrawlJob
+
+	redisConnection := redisPool.Get()
+	defer redisConnection.Close()
+
+	bytes, err := redis.Bytes(redisConnection.Do("GET", getCrawlJobKey(id)))
+	if err != nil {
+		return job, err
+	}
+
+	err = json.Unmarshal(bytes, &job)
+	return job, err
+}
+
+//returns the most recent crawl jobs of the given plugin (newest first). jobs
+//that already expired are skipped.
+func GetCrawlJobs(redisPool *redis.Pool, pluginName string) ([]CrawlJob, error) {
+	jobs := []CrawlJob{}
+
+	redisConnection := redisPool.Get()
+	ids, err := redis.Strings(redisConnection.Do("LRANGE", getCrawlJobsForPluginKey(pluginName), 0, -1))
+	redisConnection.Close()
+	if err != nil {
+		if err == redis.ErrNil {
+			return jobs, nil
+		}
+		return jobs, err
+	}
+
+	for _, id := range ids {
+		job, err := GetCrawlJob(redisPool, id)
+		if err != nil {
+			if err == redis.ErrNil {
+				continue
+			}
+			return jobs, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+//creates a new crawl job and adds it to the crawl history of the plugin
+func CreateCrawlJob(redisPool *redis.Pool, pluginName string, trigger string) (CrawlJob, error) {
+	u, err := uuid.NewV4()
+	if err != nil {
+		return CrawlJob{}, err
+	}
+
+	job := CrawlJob{Id: u.String(), Plugin: pluginName, State: CrawlJobQueued, Trigger: trigger, Queued: time.Now().Unix()}
+	err = SetCrawlJob(redisPool, job)
+	if err != nil {
+		return job, err
+	}
+
+	redisConnection := redisPool.Get()
+	defer redisConnection.Close()
+
+	_, err = redisConnection.Do("LPUSH", getCrawlJobsForPluginKey(pluginName), job.Id)
+	if err != nil {
+		return job, err
+	}
+
+	_, err = redisConnection.Do("LTRIM", getCrawlJobsForPluginKey(pluginName), 0, maxCrawlJobsPerPlugin-1)
+	return job, err
+}
+
+func EnqueueCrawlJob(redisPool *redis.Pool, pluginName string) (CrawlJob, error) {
+	job, err := CreateCrawlJob(redisPool, pluginName, CrawlTriggerApi)
+	if err != nil {
+		return job, err
+	}
+
+	redisConnection := redisPool.Get()
+	defer redisConnection.Close()
+
+	_, err = redisConnection.Do("LPUSH", crawlJobQueueKey, job.Id)
+	return job, err
+}
+
+//marks the jobs of the plugin that are still running as failed. Meant to be called when the crawler starts,
+//as a job can't be running at that time (e.g the crawler crashed or was stopped during the crawl).
+//Returns the number of jobs that were marked as failed.
+func FailInterruptedCrawlJobs(redisPool *redis.Pool, pluginName string) (int, error) {
+	jobs, err := GetCrawlJobs(redisPool, pluginName)
+	if err != nil {
+		return 0, err
+	}
+
+	failed := 0
+	for _, job := range jobs {
+		if job.State != CrawlJobRunning {
+			continue
+		}
+
+		job.State = CrawlJobFailed
+		job.Error = "The crawler was stopped while the job was running"
+		job.Finished = time.Now().Unix()
+		job.Progress = nil
+		err = SetCrawlJob(redisPool, job)
+		if err != nil {
+			return failed, err
+		}
+		failed += 1
+	}
+	return failed, nil
+}
+
+//blocks until a crawl job is available or the timeout is reached. In the latter case
+//redis.ErrNil is returned.
+func WaitForCrawlJob(redisPool *redis.Pool, timeout time.Duration) (CrawlJob, error) {
+	redisConnection := redisPool.Get()
+	res, err := redis.Strings(redisConnection.Do("BRPOP", crawlJobQueueKey, int64(timeout.Seconds())))
+	redisConnection.Close()
+	if err != nil {
+		return CrawlJob{}, err
+	}
+
+	//BRPOP returns the name of the list and the popped element
+	return GetCrawlJob(redisPool, res[1])
+}
+
+//the crawl status is not stored with the plugin's prefix, as plugins usually
+//delete all their keys before re-indexing.
+func GetLastSuccessfulCrawlExecutionTimestamp(redisPool *redis.Pool, pluginName string) (time.Time, error) {
+	key := getCrawlJobsForPluginKey(pluginName) + ":lastsuccess"
+	timestamp, err := getUnixTimestampFromRedis(redisPool, key)
+	if err != nil || !timestamp.IsZero() {
+		return timestamp, err
+	}
+
+	return migrateLastSuccessfulCrawlExecutionTimestamp(redisPool, pluginName)
+}
+
+func SetLastSuccessfulCrawlExecutionTimestamp(redisPool *redis.Pool, pluginName string, timestamp time.Time) error {
+	key := getCrawlJobsForPluginKey(pluginName) + ":lastsuccess"
+	return updateUnixTimestampInRedis(redisPool, key, timestamp)
+}
+
+//older versions stored the timestamp with the plugin's prefix, move it (if it survived the last crawl)
+func migrateLastSuccessfulCrawlExecutionTimestamp(redisPool *redis.Pool, pluginName string) (time.Time, error) {
+	legacyKey := pluginName + ":settings:crawl:lastsuccess"
+	timestamp, err := getUnixTimestampFromRedis(redisPool, legacyKey)
+	if err != nil || timestamp.IsZero() {
+		return timestamp, err
+	}
+
+	err = SetLastSuccessfulCrawlExecutionTimestamp(redisPool, pluginName, timestamp)
+	if err != nil {
+		return timestamp, err
+	}
+
+	redisConnection := redisPool.Get()
+	defer redisConnection.Close()
+
+	_, err = redisConnection.Do("DEL", legacyKey)
+	return timestamp, err
+}
+
+func GetLastFailedCrawlExecutionTimestamp(redisPool *redis.Pool, pluginName string) (time.Time, error) {
+	key := getCrawlJobsForPluginKey(pluginName) + ":lastfailure"
+	return getUnixTimestampFromRedis(redisPool, key)
+}
+
+func SetLastFailedCrawlExecutionTimestamp(redisPool *redis.Pool, pluginName string, timestamp time.Time) error {
+	key := getCrawlJobsForPluginKey(pluginName) + ":lastfailure"
+	return updateUnixTimestampInRedis(redisPool, key, timestamp)
+}
+
+//an alert is set when a plugin run failed permanently (e.g because of a config error) and
+//the plugin's schedule is therefore paused. It's cleared with the next successful run.
+func GetPluginAlert(redisPool *redis.Pool, pluginName string) (string, error) {
+	redisConnection := redisPool.Get()
+	defer redisConnection.Close()
+
+	alert, err := redis.String(redisConnection.Do("GET", getCrawlJobsForPluginKey(pluginName) + ":alert"))
+	if err == redis.ErrNil {
+		return "", nil
+	}
+	return alert, err
+}
+
+func SetPluginAlert(redisPool *redis.Pool, pluginName string, alert string) error {
+	redisConnection := redisPool.Get()
+	defer redisConnection.Close()
+
+	_, err := redisConnection.Do("SET", getCrawlJobsForPluginKey(pluginName) + ":alert", alert)
+	return err
+}
+
+func ClearPluginAlert(redisPool *redis.Pool, pluginName string) error {
+	redisConnection := redisPool.Get()
+	defer redisConnection.Close()
+
+	_, err := redisConnection.Do("DEL", getCrawlJobsForPluginKey(pluginName) + ":alert")
+	return err
+}
+
+//the number of indexed items of a plugin, as counted at the end of its last crawl. In case it wasn't
+//counted yet (e.g the plugin was crawled by an older version), it's counted now.
+func GetIndexedItemsCount(redisPool *redis.Pool, pluginName string) (int, error) {
+	redisConnection := redisPool.Get()
+	count, err := redis.Int(redisConnection.Do("GET", getCrawlJobsForPluginKey(pluginName) + ":items"))
+	redisConnection.Close()
+	if err != redis.ErrNil {
+		return count, err
+	}
+
+	return UpdateIndexedItemsCount(redisPool, pluginName)
+}
+
+//counts the indexed items of a plugin and stores the count. Meant to be called at the end of a crawl, as
+//all entries of the plugin need to be read.
+func UpdateIndexedItemsCount(redisPool *redis.Pool, pluginName string) (int, error) {
+	count, err := countIndexedItems(redisPool, pluginName)
+	if err != nil {
+		return count, err
+	}
+
+	redisConnection := redisPool.Get()
+	defer redisConnection.Close()
+
+	_, err = redisConnection.Do("SET", getCrawlJobsForPluginKey(pluginName) + ":items", count)
+	return count, err
+}
+
+//iterates over the keys with SCAN (instead of KEYS), so that redis isn't blocked on large indexes
+func countIndexedItems(redisPool *redis.Pool, pluginName string) (int, error) {
+	redisConnection := redisPool.Get()
+	defer redisConnection.Close()
+
+	count := 0
+	cursor := 0
+	for {
+		res, err := redis.Values(redisConnection.Do("SCAN", cursor, "MATCH", pluginName + ":fulldate:*", "COUNT", 1000))
+		if err != nil {
+			return count, err
+		}
+
+		var keys []string
+		_, err = redis.Scan(res, &cursor, &keys)
+		if err != nil {
+			return count, err
+		}
+
+		for _, key := range keys {
+			bytes, err := redis.Bytes(redisConnection.Do("GET", key))
+			if err != nil {
+				if err == redis.ErrNil {
+					continue
+				}
+				return count, err
+			}
+
+			var entries []json.RawMessage
+			err = json.Unmarshal(bytes, &entries)
+			if err != nil {
+				return count, err
+			}
+			count += len(entries)
+		}
+
+		if cursor == 0 {
+			return count, nil
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package utils
+
+import (
+	"testing"
+	"errors"
+	"time"
+	"fmt"
+	"sort"
+	"strings"
+	"path"
+	"github.com/gomodule/redigo/redis"
+)
+
+//in-memory replacement for the redis commands used by the crawl jobs and the plugin logs
+type fakeRedisConn struct {
+	values map[string][]byte
+	lists map[string][][]byte
+	queued [][]interface{} //commands sent within MULTI
+	failingKeys map[string]bool //transactions touching these keys fail
+}
+
+func newFakeRedisPool() (*redis.Pool, *fakeRedisConn) {
+	conn := &fakeRedisConn{values: make(map[string][]byte), lists: make(map[string][][]byte)}
+	return &redis.Pool{Dial: func() (redis.Conn, error) { return conn, nil }}, conn
+}
+
+func toBytes(arg interface{}) []byte {
+	if b, ok := arg.([]byte); ok {
+		return b
+	}
+	return []byte(fmt.Sprint(arg))
+}
+
+func toInt(arg interface{}) int {
+	var i int
+	fmt.Sscan(fmt.Sprint(arg), &i)
+	return i
+}
+
+func (c *fakeRedisConn) Do(command string, args ...interface{}) (interface{}, error) {
+	switch strings.ToUpper(command) {
+	case "":
+		return nil, nil
+	case "EXEC":
+		for _, queued := range c.queued {
+			if len(queued) > 1 && c.failingKeys[fmt.Sprint(queued[1])] {
+				c.queued = nil
+				return nil, errors.New("EXECABORT Transaction discarded")
+			}
+		}
+		results := []interface{}{}
+		for _, queued := range c.queued {
+			result, err := c.Do(queued[0].(string), queued[1:]...)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, result)
+		}
+		c.queued = nil
+		return results, nil
+	case "GET":
+		value, ok := c.values[fmt.Sprint(args[0])]
+		if !ok {
+			return nil, nil
+		}
+		return value, nil
+	case "SET":
+		c.values[fmt.Sprint(args[0])] = toBytes(args[1])
+		return "OK", nil
+	case "SETEX":
+		c.values[fmt.Sprint(args[0])] = toBytes(args[2])
+		return "OK", nil
+	case "DEL":
+		deleted := int64(0)
+		for _, arg := range args {
+			key := fmt.Sprint(arg)
+			if _, ok := c.values[key]; ok {
+				deleted += 1
+			}
+			if _, ok := c.lists[key]; ok {
+				deleted += 1
+			}
+			delete(c.values, key)
+			delete(c.lists, key)
+		}
+		return deleted, nil
+	case "KEYS":
+		keys := []interface{}{}
+		for _, key := range c.getKeys() {
+			if matched, _ := path.Match(fmt.Sprint(args[0]), key); matched {
+				keys = append(keys, []byte(key))
+			}
+		}
+		return keys, nil
+	case "SCAN":
+		//returns at most COUNT keys per call, the cursor is the position in the sorted keys
+		cursor, pattern, count := toInt(args[0]), fmt.Sprint(args[2]), toInt(args[4])
+		matches := []string{}
+		for _, key := range c.getKeys() {
+			if matched, _ := path.Match(pattern, key); matched {
+				matches = append(matches, key)
+			}
+		}
+		keys := []interface{}{}
+		for cursor < len(matches) && len(keys) < count {
+			keys = append(keys, []byte(matches[cursor]))
+			cursor += 1
+		}
+		if cursor >= len(matches) {
+			cursor = 0
+		}
+		return []interface{}{[]byte(fmt.Sprint(cursor)), keys}, nil
+	case "LPUSH":
+		key := fmt.Sprint(args[0])
+		for _, arg := range args[1:] {
+			c.lists[key] = append([][]byte{toBytes(arg)}, c.lists[key]...)
+		}
+		return int64(len(c.lists[key])), nil
+	case "LTRIM":
+		key := fmt.Sprint(args[0])
+		start, stop := toInt(args[1]), toInt(args[2])
+		list := c.lists[key]
+		if stop < 0 || stop >= len(list) {
+			stop = len(list) - 1
+		}
+		if start > stop {
+			delete(c.lists, key)
+		} else {
+			c.lists[key] = list[start:stop + 1]
+		}
+		return "OK", nil
+	case "LRANGE":
+		elements := []interface{}{}
+		for _, element := range c.lists[fmt.Sprint(args[0])] {
+			elements = append(elements, element)
+		}
+		return elements, nil
+	case "BRPOP":
+		key := fmt.Sprint(args[0])
+		list := c.lists[key]
+		if len(list) == 0 {
+			return nil, nil
+		}
+		c.lists[key] = list[:len(list) - 1]
+		return []interface{}{[]byte(key), list[len(list) - 1]}, nil
+	}
+	return nil, fmt.Errorf("Command %s not supported", command)
+}
+
+func (c *fakeRedisConn) getKeys() []string {
+	keys := []string{}
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	for key := range c.lists {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (c *fakeRedisConn) Close() error { return nil }
+func (c *fakeRedisConn) Err() error { return nil }
+func (c *fakeRedisConn) Send(command string, args ...interface{}) error {
+	if strings.ToUpper(command) != "MULTI" {
+		c.queued = append(c.queued, append([]interface{}{command}, args...))
+	}
+	return nil
+}
+
+func (c *fakeRedisConn) Flush() error { return nil }
+func (c *fakeRedisConn) Receive() (interface{}, error) { return nil, nil }
+
+func TestLastSuccessfulCrawlExecutionTimestamp(t *testing.T) {
+	redisPool, conn := newFakeRedisPool()
+
+	timestamp, err := GetLastSuccessfulCrawlExecutionTimestamp(redisPool, "imgreader-fs")
+	ok(t, err)
+	equals(t, true, timestamp.IsZero())
+
+	now := time.Unix(time.Now().Unix(), 0)
+	ok(t, SetLastSuccessfulCrawlExecutionTimestamp(redisPool, "imgreader-fs", now))
+	timestamp, err = GetLastSuccessfulCrawlExecutionTimestamp(redisPool, "imgreader-fs")
+	ok(t, err)
+	equals(t, now, timestamp)
+
+	//the timestamp must survive a plugin deleting all of its keys
+	equals(t, []string{"crawljobs:plugin:imgreader-fs:lastsuccess"}, conn.getKeys())
+}
+
+func TestMigrateLastSuccessfulCrawlExecutionTimestamp(t *testing.T) {
+	redisPool, conn := newFakeRedisPool()
+	conn.values["imgreader-fs:settings:crawl:lastsuccess"] = []byte("1600000000")
+
+	timestamp, err := GetLastSuccessfulCrawlExecutionTimestamp(redisPool, "imgreader-fs")
+	ok(t, err)
+	equals(t, time.Unix(1600000000, 0), timestamp)
+	equals(t, []string{"crawljobs:plugin:imgreader-fs:lastsuccess"}, conn.getKeys())
+}
+
+func TestCrawlJobLifecycle(t *testing.T) {
+	redisPool, _ := newFakeRedisPool()
+
+	job, err := EnqueueCrawlJob(redisPool, "imgreader-fs")
+	ok(t, err)
+	equals(t, CrawlJobQueued, job.State)
+	equals(t, CrawlTriggerApi, job.Trigger)
+
+	//the crawler picks up the job from the queue
+	queuedJob, err := WaitForCrawlJob(redisPool, time.Second)
+	ok(t, err)
+	equals(t, job, queuedJob)
+	_, err = WaitForCrawlJob(redisPool, time.Second)
+	equals(t, redis.ErrNil, err)
+
+	job.State = CrawlJobRunning
+	job.Started = time.Now().Unix()
+	job.Progress = &CrawlProgress{Discovered: 10, Processed: 5}
+	ok(t, SetCrawlJob(redisPool, job))
+
+	job.State = CrawlJobSucceeded
+	job.Finished = time.Now().Unix()
+	job.Items = 10
+	ok(t, SetCrawlJob(redisPool, job))
+
+	storedJob, err := GetCrawlJob(redisPool, job.Id)
+	ok(t, err)
+	equals(t, job, storedJob)
+}
+
+func TestGetCrawlJobsNewestFirst(t *testing.T) {
+	redisPool, conn := newFakeRedisPool()
+
+	ids := []string{}
+	for i := 0; i < maxCrawlJobsPerPlugin + 2; i++ {
+		job, err := CreateCrawlJob(redisPool, "imgreader-fs", CrawlTriggerSchedule)
+		ok(t, err)
+		ids = append([]string{job.Id}, ids...)
+	}
+	_, err := CreateCrawlJob(redisPool, "imgreader-nc", CrawlTriggerSchedule)
+	ok(t, err)
+
+	jobs, err := GetCrawlJobs(redisPool, "imgreader-fs")
+	ok(t, err)
+	equals(t, maxCrawlJobsPerPlugin, len(jobs))
+	for i, job := range jobs {
+		equals(t, ids[i], job.Id)
+	}
+
+	//expired jobs are skipped
+	delete(conn.values, getCrawlJobKey(ids[0]))
+	jobs, err = GetCrawlJobs(redisPool, "imgreader-fs")
+	ok(t, err)
+	equals(t, maxCrawlJobsPerPlugin - 1, len(jobs))
+	equals(t, ids[1], jobs[0].Id)
+}
+
+func TestFailInterruptedCrawlJobs(t *testing.T) {
+	redisPool, _ := newFakeRedisPool()
+
+	states := []string{CrawlJobSucceeded, CrawlJobRunning, CrawlJobQueued}
+	for _, state := range states {
+		job, err := CreateCrawlJob(redisPool, "imgreader-fs", CrawlTriggerSchedule)
+		ok(t, err)
+		job.State = state
+		if state == CrawlJobRunning {
+			job.Progress = &CrawlProgress{Discovered: 10, Processed: 5}
+		}
+		ok(t, SetCrawlJob(redisPool, job))
+	}
+
+	failed, err := FailInterruptedCrawlJobs(redisPool, "imgreader-fs")
+	ok(t, err)
+	equals(t, 1, failed)
+
+	//newest first, the queued job is still picked up by the crawler
+	jobs, err := GetCrawlJobs(redisPool, "imgreader-fs")
+	ok(t, err)
+	equals(t, CrawlJobQueued, jobs[0].State)
+	equals(t, CrawlJobFailed, jobs[1].State)
+	equals(t, true, jobs[1].Error != "" && jobs[1].Finished > 0)
+	equals(t, (*CrawlProgress)(nil), jobs[1].Progress)
+	equals(t, CrawlJobSucceeded, jobs[2].State)
+
+	failed, err = FailInterruptedCrawlJobs(redisPool, "imgreader-fs")
+	ok(t, err)
+	equals(t, 0, failed)
+}
+
+func TestIndexedItemsCount(t *testing.T) {
+	redisPool, conn := newFakeRedisPool()
+	for i := 1; i <= 1500; i++ {
+		conn.values[fmt.Sprintf("imgreader-fs:fulldate:%04d-01-01", i)] = []byte(`[{"uuid":"1"},{"uuid":"2"}]`)
+	}
+	conn.values["imgreader-fs:date:01-01"] = []byte(`[{"uuid":"1"},{"uuid":"2"}]`)
+	conn.values["imgreader-nc:fulldate:2019-01-01"] = []byte(`[{"uuid":"3"}]`)
+
+	//not counted yet, e.g crawled by an older version
+	count, err := GetIndexedItemsCount(redisPool, "imgreader-fs")
+	ok(t, err)
+	equals(t, 3000, count)
+	equals(t, []byte("3000"), conn.values["crawljobs:plugin:imgreader-fs:items"])
+
+	//the status only reads the count of the last crawl
+	delete(conn.values, "imgreader-fs:fulldate:0001-01-01")
+	count, err = GetIndexedItemsCount(redisPool, "imgreader-fs")
+	ok(t, err)
+	equals(t, 3000, count)
+
+	count, err = UpdateIndexedItemsCount(redisPool, "imgreader-fs")
+	ok(t, err)
+	equals(t, 2998, count)
+	count, err = GetIndexedItemsCount(redisPool, "imgreader-fs")
+	ok(t, err)
+	equals(t, 2998, count)
+
+	count, err = UpdateIndexedItemsCount(redisPool, "imgreader-webdav")
+	ok(t, err)
+	equals(t, 0, count)
+}
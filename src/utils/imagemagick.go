@@ -7,6 +7,8 @@ import (
 	"errors"
 	"os"
 	"image"
+	"strconv"
+	"strings"
 )
 
 type ConvertOptions struct {
@@ -123,3 +125,58 @@ func (w *ImageMagickWrapper) Convert(inPath string, outFilename string, convertO
 
 	return outPath, nil
 }
+
+//used in case no size is requested, text doesn't have a size of its own
+const defaultTextImageSize = "800x480"
+
+func buildRenderTextArgs(inPath string, outPath string, convertOptions ConvertOptions) ([]string, error) {
+	size := convertOptions.Size
+	if size == "" {
+		size = defaultTextImageSize
+	}
+
+	dimensions := strings.Split(size, "x")
+	if len(dimensions) != 2 {
+		return []string{}, errors.New("Invalid size " + size)
+	}
+	width, err := strconv.Atoi(dimensions[0])
+	if err != nil {
+		return []string{}, errors.New("Invalid width " + dimensions[0])
+	}
+	height, err := strconv.Atoi(dimensions[1])
+	if err != nil {
+		return []string{}, errors.New("Invalid height " + dimensions[1])
+	}
+
+	backgroundColor := convertOptions.BackgroundColor
+	if backgroundColor == "" {
+		backgroundColor = "black"
+	}
+	textColor := convertOptions.TextColor
+	if textColor == "" {
+		textColor = "white"
+	}
+
+	//the 'caption' coder picks the largest pointsize at which the text fits into the given size,
+	//the text gets a margin of 5% on every side
+	textSize := strconv.Itoa(width * 9 / 10) + "x" + strconv.Itoa(height * 9 / 10)
+	return []string{"-size", textSize, "-background", backgroundColor, "-fill", textColor, "-gravity", "center",
+				"caption:@" + inPath, "-extent", size, outPath}, nil
+}
+
+//renders a text file (e.g a note) as image, so that it can be converted like every other image afterwards
+func (w *ImageMagickWrapper) RenderText(inPath string, outFilename string, convertOptions ConvertOptions) (string, error) {
+	outPath := w.tempDirectory + "/" + outFilename + ".png"
+
+	args, err := buildRenderTextArgs(inPath, outPath, convertOptions)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = runCommand(w.imageMagickPath, args)
+	if err != nil {
+		return "", err
+	}
+
+	return outPath, nil
+}
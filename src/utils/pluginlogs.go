@@ -0,0 +1,274 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+	"github.com/gomodule/redigo/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	PluginPhaseCrawl = "crawl"
+	PluginPhaseFetch = "fetch"
+)
+
+type PluginLogEntry struct {
+	Time int64 `json:"time"`
+	Plugin string `json:"plugin"`
+	RunId string `json:"runid"`
+	Phase string `json:"phase"`
+	Level string `json:"level"`
+	Message string `json:"message"`
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+//the log lines are written to redis in batches, at the latest after this interval
+const pluginLogFlushInterval = 1 * time.Second
+
+//keeps the last x log lines of every plugin in redis, so that they are available
+//for both the crawler and the REST API.
+type PluginLogBuffer struct {
+	redisPool *redis.Pool
+	maxEntries int
+	flushInterval time.Duration
+
+	mutex sync.Mutex
+	pending map[string][][]byte //serialized entries per plugin, oldest first
+	flushTimer *time.Timer
+}
+
+func NewPluginLogBuffer(redisPool *redis.Pool, maxEntries int) *PluginLogBuffer {
+	return &PluginLogBuffer{
+		redisPool: redisPool,
+		maxEntries: maxEntries,
+		flushInterval: pluginLogFlushInterval,
+		pending: make(map[string][][]byte),
+	}
+}
+
+func getPluginLogsKey(pluginName string) string {
+	return "pluginlogs:" + pluginName
+}
+
+//buffers the entry, it's written to redis with the next flush
+func (b *PluginLogBuffer) Add(entry PluginLogEntry) error {
+	serializedEntry, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	pending := append(b.pending[entry.Plugin], serializedEntry)
+	//the older entries would be trimmed anyway
+	if len(pending) > b.maxEntries {
+		pending = pending[len(pending) - b.maxEntries:]
+	}
+	b.pending[entry.Plugin] = pending
+
+	if b.flushTimer == nil {
+		b.flushTimer = time.AfterFunc(b.flushInterval, func() {
+			err := b.Flush()
+			if err != nil {
+				log.Error("Couldn't store plugin log lines: ", err.Error())
+			}
+		})
+	}
+	return nil
+}
+
+//writes the buffered entries to redis, with a single transaction per plugin
+func (b *PluginLogBuffer) Flush() error {
+	b.mutex.Lock()
+	pending := b.pending
+	b.pending = make(map[string][][]byte)
+	if b.flushTimer != nil {
+		b.flushTimer.Stop()
+		b.flushTimer = nil
+	}
+	b.mutex.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	redisConnection := b.redisPool.Get()
+	defer redisConnection.Close()
+
+	//a failed write doesn't stop the others, the entries of that plugin are kept for the next flush
+	var firstErr error
+	for pluginName, serializedEntries := range pending {
+		args := []interface{}{getPluginLogsKey(pluginName)}
+		for _, serializedEntry := range serializedEntries {
+			args = append(args, serializedEntry)
+		}
+
+		redisConnection.Send("MULTI")
+		redisConnection.Send("LPUSH", args...)
+		redisConnection.Send("LTRIM", getPluginLogsKey(pluginName), 0, b.maxEntries-1)
+		_, err := redisConnection.Do("EXEC")
+		if err != nil {
+			b.restore(pluginName, serializedEntries)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+//puts entries that couldn't be written back in front of the ones added in the meantime
+func (b *PluginLogBuffer) restore(pluginName string, serializedEntries [][]byte) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	pending := append(serializedEntries, b.pending[pluginName]...)
+	if len(pending) > b.maxEntries {
+		pending = pending[len(pending) - b.maxEntries:]
+	}
+	b.pending[pluginName] = pending
+}
+
+//returns the most recent log entries (newest first) of the given plugin. The entries can
+//be filtered by run id and phase; empty filters match everything. A limit <= 0 returns all entries.
+func (b *PluginLogBuffer) Get(pluginName string, runId string, phase string, limit int) ([]PluginLogEntry, error) {
+	entries := []PluginLogEntry{}
+
+	//the buffered entries of this process are included as well
+	err := b.Flush()
+	if err != nil {
+		return entries, err
+	}
+
+	redisConnection := b.redisPool.Get()
+	defer redisConnection.Close()
+
+	serializedEntries, err := redis.ByteSlices(redisConnection.Do("LRANGE", getPluginLogsKey(pluginName), 0, -1))
+	if err != nil {
+		if err == redis.ErrNil {
+			return entries, nil
+		}
+		return entries, err
+	}
+
+	for _, serializedEntry := range serializedEntries {
+		var entry PluginLogEntry
+		err = json.Unmarshal(serializedEntry, &entry)
+		if err != nil {
+			return entries, err
+		}
+
+		if (runId != "" && entry.RunId != runId) || (phase != "" && entry.Phase != phase) {
+			continue
+		}
+
+		entries = append(entries, entry)
+		if limit > 0 && len(entries) >= limit {
+			break
+		}
+	}
+
+	return entries, nil
+}
+
+//plugins can write structured log lines (e.g {"level": "info", "msg": "Processing file x", "path": "x"}).
+//All the keys except the level, the message and the timestamp are treated as fields.
+func parseStructuredLogLine(line string) (string, string, map[string]interface{}, bool) {
+	if !strings.HasPrefix(strings.TrimSpace(line), "{") {
+		return "", "", nil, false
+	}
+
+	var data map[string]interface{}
+	err := json.Unmarshal([]byte(line), &data)
+	if err != nil {
+		return "", "", nil, false
+	}
+
+	level, _ := data["level"].(string)
+	message, ok := data["msg"].(string)
+	if !ok {
+		message, ok = data["message"].(string)
+		if !ok {
+			return "", "", nil, false
+		}
+	}
+
+	fields := make(map[string]interface{})
+	for key, value := range data {
+		if key != "level" && key != "msg" && key != "message" && key != "time" {
+			fields[key] = value
+		}
+	}
+
+	return level, message, fields, true
+}
+
+//builds a log entry out of a line the plugin has written to stdout/stderr
+func newPluginLogEntry(run pluginRun, line string, defaultLevel string) PluginLogEntry {
+	entry := PluginLogEntry{Time: time.Now().Unix(), Plugin: run.Plugin, RunId: run.RunId, Phase: run.Phase,
+							Level: defaultLevel, Message: line}
+
+	level, message, fields, ok := parseStructuredLogLine(line)
+	if ok {
+		if _, err := log.ParseLevel(level); err == nil {
+			entry.Level = level
+		}
+		entry.Message = message
+		if len(fields) > 0 {
+			entry.Fields = fields
+		}
+	}
+
+	return entry
+}
+
+type pluginRun struct {
+	Plugin string
+	RunId string
+	Phase string
+	LogBuffer *PluginLogBuffer
+}
+
+//forwards the log line to logrus (tagged with the plugin, run id and phase) and
+//stores it in the plugin's log buffer.
+func (r pluginRun) log(line string, defaultLevel string) {
+	entry := newPluginLogEntry(r, line, defaultLevel)
+
+	logger := log.WithFields(log.Fields{"plugin": r.Plugin, "run": r.RunId, "phase": r.Phase})
+	if len(entry.Fields) > 0 {
+		logger = logger.WithFields(log.Fields(entry.Fields))
+	}
+
+	level, err := log.ParseLevel(entry.Level)
+	if err != nil {
+		level = log.DebugLevel
+	}
+
+	//a fatal/panic log line of the plugin must not terminate the host
+	if level < log.ErrorLevel {
+		level = log.ErrorLevel
+	}
+	logger.Log(level, entry.Message)
+
+	if r.LogBuffer != nil {
+		err = r.LogBuffer.Add(entry)
+		if err != nil {
+			log.Error("Couldn't store log line of plugin ", r.Plugin, ": ", err.Error())
+		}
+	}
+}
+
+//writes the buffered log lines to redis, e.g at the end of the run
+func (r pluginRun) flushLogs() {
+	if r.LogBuffer == nil {
+		return
+	}
+
+	err := r.LogBuffer.Flush()
+	if err != nil {
+		log.Error("Couldn't store log lines of plugin ", r.Plugin, ": ", err.Error())
+	}
+}
@@ -0,0 +1,438 @@
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"gopkg.in/yaml.v2"
+	log "github.com/sirupsen/logrus"
+)
+
+type InstalledPlugin struct {
+	Name string
+	MetaData PluginMetaData
+	Enabled bool
+	Configured bool
+}
+
+type PluginManager struct {
+	pluginDir string
+	configDir string
+}
+
+func NewPluginManager(pluginDir string, configDir string) *PluginManager {
+	return &PluginManager{
+		pluginDir: pluginDir,
+		configDir: configDir,
+	}
+}
+
+func (m *PluginManager) getPluginConfigPath(name string) string {
+	return filepath.Join(m.configDir, name, "config.yaml")
+}
+
+func (m *PluginManager) List() ([]InstalledPlugin, error) {
+	installedPlugins := []InstalledPlugin{}
+
+	entries, err := ioutil.ReadDir(m.pluginDir)
+	if err != nil {
+		return installedPlugins, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		metaData, err := parsePluginMetaDataFile(filepath.Join(m.pluginDir, entry.Name(), "meta.yaml"))
+		if err != nil {
+			log.Debug("Skipping ", entry.Name(), " as it doesn't contain a valid meta.yaml file: ", err.Error())
+			continue
+		}
+
+		installedPlugin := InstalledPlugin{Name: entry.Name(), MetaData: metaData}
+		pluginConfig, err := parsePluginConfigFile(m.getPluginConfigPath(entry.Name()))
+		if err == nil {
+			installedPlugin.Configured = true
+			installedPlugin.Enabled = pluginConfig.Enabled
+		}
+		installedPlugins = append(installedPlugins, installedPlugin)
+	}
+
+	return installedPlugins, nil
+}
+
+//the plugin name is used as directory name, so it must not point outside of
+//the plugin (or config) directory
+func validatePluginName(name string) error {
+	if name == "" {
+		return errors.New("Plugin name must not be empty")
+	}
+	if strings.ContainsAny(name, "/\\") || strings.Contains(name, "..") || strings.HasPrefix(name, ".") {
+		return errors.New("Invalid plugin name '" + name + "'")
+	}
+	return nil
+}
+
+func (m *PluginManager) GetMetaData(name string) (PluginMetaData, error) {
+	if err := validatePluginName(name); err != nil {
+		return PluginMetaData{}, err
+	}
+	return parsePluginMetaDataFile(filepath.Join(m.pluginDir, name, "meta.yaml"))
+}
+
+//installs the plugin from the given directory or tarball (.tar.gz, .tgz) and
+//creates a (disabled) default config in case the plugin isn't configured yet.
+func (m *PluginManager) Install(source string) (string, error) {
+	sourceDir := source
+	if strings.HasSuffix(source, ".tar.gz") || strings.HasSuffix(source, ".tgz") {
+		tmpDir, err := ioutil.TempDir("", "mindfulbytes-plugin")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(tmpDir)
+
+		sourceDir, err = extractPluginTarball(source, tmpDir)
+		if err != nil {
+			return "", errors.New("Couldn't extract " + source + ": " + err.Error())
+		}
+	}
+
+	metaData, err := parsePluginMetaDataFile(filepath.Join(sourceDir, "meta.yaml"))
+	if err != nil {
+		return "", errors.New("Couldn't parse meta.yaml: " + err.Error())
+	}
+
+	_, err = checkPluginCompatibility(metaData)
+	if err != nil {
+		return "", err
+	}
+
+	name := metaData.Name
+	if name == "" {
+		name = filepath.Base(filepath.Clean(sourceDir))
+	}
+
+	err = validatePluginName(name)
+	if err != nil {
+		return "", err
+	}
+
+	pluginDest, err := filepath.Abs(filepath.Join(m.pluginDir, name))
+	if err != nil {
+		return name, err
+	}
+
+	if _, err := os.Stat(pluginDest); err == nil {
+		return name, errors.New("Plugin " + name + " is already installed")
+	}
+
+	err = os.MkdirAll(pluginDest, 0755)
+	if err != nil {
+		return name, err
+	}
+
+	if _, err := os.Stat(filepath.Join(sourceDir, "install.sh")); err == nil {
+		err = runInstallScript(sourceDir, pluginDest)
+	} else {
+		log.Debug("No install.sh found, copying ", sourceDir, " to ", pluginDest)
+		err = copyDir(sourceDir, pluginDest)
+	}
+	if err != nil {
+		os.RemoveAll(pluginDest) //no need to check return code, it's just cleanup
+		return name, errors.New("Couldn't install plugin " + name + ": " + err.Error())
+	}
+
+	configPath := m.getPluginConfigPath(name)
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		err = writeDefaultPluginConfig(configPath, metaData)
+		if err != nil {
+			return name, errors.New("Couldn't create config for plugin " + name + ": " + err.Error())
+		}
+	}
+
+	return name, nil
+}
+
+func (m *PluginManager) Remove(name string, purgeConfig bool) error {
+	if err := validatePluginName(name); err != nil {
+		return err
+	}
+
+	pluginPath := filepath.Join(m.pluginDir, name)
+	if _, err := os.Stat(filepath.Join(pluginPath, "meta.yaml")); err != nil {
+		return errors.New("Plugin " + name + " is not installed")
+	}
+
+	err := os.RemoveAll(pluginPath)
+	if err != nil {
+		return err
+	}
+
+	if purgeConfig {
+		return os.RemoveAll(filepath.Join(m.configDir, name))
+	}
+	return nil
+}
+
+func (m *PluginManager) SetEnabled(name string, enabled bool) error {
+	if err := validatePluginName(name); err != nil {
+		return err
+	}
+
+	configPath := m.getPluginConfigPath(name)
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	if enabled {
+		metaData, err := m.GetMetaData(name)
+		if err != nil {
+			return err
+		}
+
+		pluginConfig, err := parsePluginConfigFile(configPath)
+		if err != nil {
+			return err
+		}
+
+		pluginConfig.Enabled = true
+		err = ValidatePluginConfig(metaData, pluginConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err = setEnabledInPluginConfig(data, enabled)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(configPath, data, 0644)
+}
+
+func (m *PluginManager) Validate(name string) error {
+	metaData, err := m.GetMetaData(name)
+	if err != nil {
+		return err
+	}
+
+	pluginConfig, err := parsePluginConfigFile(m.getPluginConfigPath(name))
+	if err != nil {
+		return err
+	}
+
+	return ValidatePluginConfig(metaData, pluginConfig)
+}
+
+//returns all arguments of the plugin (crawl-args and fetch-args), sorted by name
+func GetPluginArgNames(metaData PluginMetaData) []string {
+	names := []string{}
+	for name := range metaData.CrawlArgs {
+		names = append(names, name)
+	}
+	for name := range metaData.FetchArgs {
+		if !StringInSlice(name, names) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func ValidatePluginConfig(metaData PluginMetaData, pluginConfig PluginConfig) error {
+	_, err := getCrawlArgs(metaData, pluginConfig)
+	if err != nil {
+		return err
+	}
+
+	_, err = getFetchArgs(metaData, pluginConfig)
+	if err != nil {
+		return err
+	}
+
+	if pluginConfig.Refresh != "" && pluginConfig.Refresh != "daily" && pluginConfig.Refresh != "weekly" && pluginConfig.Refresh != "monthly" {
+		return errors.New("Invalid refresh interval '" + pluginConfig.Refresh + "' (supported intervals: daily, weekly, monthly)")
+	}
+
+	//an enabled plugin needs a value for all the required arguments
+	if pluginConfig.Enabled {
+		for _, name := range GetPluginArgNames(metaData) {
+			arg, ok := metaData.CrawlArgs[name]
+			if !ok {
+				arg = metaData.FetchArgs[name]
+			}
+
+			if arg.Required && pluginConfig.Args[name] == "" {
+				return errors.New("No value specified for required parameter '" + name + "'")
+			}
+		}
+	}
+
+	return nil
+}
+
+func buildDefaultPluginConfig(metaData PluginMetaData) PluginConfig {
+	pluginConfig := PluginConfig{Enabled: false, Refresh: "daily", Args: make(map[string]string)}
+	for _, name := range GetPluginArgNames(metaData) {
+		arg, ok := metaData.CrawlArgs[name]
+		if !ok {
+			arg = metaData.FetchArgs[name]
+		}
+		pluginConfig.Args[name] = arg.Default
+	}
+	return pluginConfig
+}
+
+func writeDefaultPluginConfig(path string, metaData PluginMetaData) error {
+	data, err := yaml.Marshal(buildDefaultPluginConfig(metaData))
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+//changes the enabled flag in the plugin's config file. The config is edited as a generic
+//YAML document, so that the order of the keys and the keys unknown to the host are kept.
+func setEnabledInPluginConfig(data []byte, enabled bool) ([]byte, error) {
+	var pluginConfig yaml.MapSlice
+	err := yaml.Unmarshal(data, &pluginConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	for i := range pluginConfig {
+		if pluginConfig[i].Key == "enabled" {
+			pluginConfig[i].Value = enabled
+			found = true
+		}
+	}
+	if !found {
+		pluginConfig = append(yaml.MapSlice{yaml.MapItem{Key: "enabled", Value: enabled}}, pluginConfig...)
+	}
+
+	return yaml.Marshal(pluginConfig)
+}
+
+func runInstallScript(sourceDir string, pluginDest string) error {
+	c := exec.Command("/bin/bash", "install.sh")
+	c.Dir = sourceDir
+	c.Env = append(os.Environ(), "PLUGIN_DEST=" + pluginDest)
+
+	output, err := c.CombinedOutput()
+	log.Debug(string(output))
+	if err != nil {
+		return errors.New(err.Error() + ": " + string(output))
+	}
+	return nil
+}
+
+func copyDir(source string, destination string) error {
+	return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		destPath := filepath.Join(destination, relPath)
+
+		if info.IsDir() {
+			return os.MkdirAll(destPath, info.Mode())
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(destPath, data, info.Mode())
+	})
+}
+
+//extracts the tarball and returns the directory which contains the meta.yaml file
+//(either the root of the tarball or its only top level directory)
+func extractPluginTarball(tarball string, destination string) (string, error) {
+	f, err := os.Open(tarball)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	gzipReader, err := gzip.NewReader(f)
+	if err != nil {
+		return "", err
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		destPath := filepath.Join(destination, header.Name)
+		if !strings.HasPrefix(destPath, filepath.Clean(destination) + string(os.PathSeparator)) {
+			return "", errors.New("Invalid file path " + header.Name + " in tarball")
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(destPath, 0755)
+			if err != nil {
+				return "", err
+			}
+		case tar.TypeReg:
+			err = os.MkdirAll(filepath.Dir(destPath), 0755)
+			if err != nil {
+				return "", err
+			}
+
+			out, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+			if err != nil {
+				return "", err
+			}
+			_, err = io.Copy(out, tarReader)
+			out.Close()
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(destination, "meta.yaml")); err == nil {
+		return destination, nil
+	}
+
+	entries, err := ioutil.ReadDir(destination)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		dir := filepath.Join(destination, entries[0].Name())
+		if _, err := os.Stat(filepath.Join(dir, "meta.yaml")); err == nil {
+			return dir, nil
+		}
+	}
+
+	return "", errors.New("No meta.yaml found in tarball")
+}
@@ -6,17 +6,63 @@ import (
 	"path/filepath"
 	"os"
 	"github.com/go-cmd/cmd"
+	"github.com/gofrs/uuid"
 	log "github.com/sirupsen/logrus"
 	"errors"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 type Arg struct {
 	Type string `yaml:"type"`
 	Format string `yaml:"format"`
+	Description string `yaml:"description"`
+	Default string `yaml:"default"`
+	Required bool `yaml:"required"`
 }
 
+//range of plugin protocol versions the host supports
+const MinPluginProtocolVersion = 1
+const MaxPluginProtocolVersion = 1
+
+const (
+	CapabilityCrawl = "crawl"
+	CapabilityFetch = "fetch"
+	CapabilityProgress = "progress"
+	CapabilityPoster = "poster"
+	//fetch returns UTF-8 text (e.g a note), which is rendered as image
+	CapabilityText = "text"
+)
+
+var supportedCapabilities = []string{CapabilityCrawl, CapabilityFetch, CapabilityProgress, CapabilityPoster, CapabilityText}
+
+//the kinds of items an entry can refer to, plugins declare the kinds of their items in the meta.yaml file
+const (
+	KindImage = "image"
+	KindVideo = "video"
+	KindText = "text"
+	KindAudio = "audio"
+	KindEvent = "event"
+)
+
+var supportedKinds = []string{KindImage, KindVideo, KindText, KindAudio, KindEvent}
+
+//plugins with the 'poster' capability (e.g video plugins) can either fetch the original item or a
+//still image that represents it. The variant is only passed to plugins that support it.
+const (
+	FetchVariantOriginal = "original"
+	FetchVariantPoster = "poster"
+)
+
 type PluginMetaData struct {
 	Version string `yaml:"version"`
+	ProtocolVersion int `yaml:"protocol-version"`
+	Capabilities []string `yaml:"capabilities"`
+	//the first kind is the one of entries that don't specify a kind
+	Kinds []string `yaml:"kinds"`
 	Name string `yaml:"name"`
 	Description string `yaml:"description"` 
 	Command string `yaml:"command"`
@@ -29,19 +75,25 @@ type PluginConfig struct {
 	Enabled bool `yaml:"enabled"`
 	Refresh string `yaml:"refresh"`
 	Args map[string]string `yaml:"args"`
+	Secrets map[string]string `yaml:"secrets,omitempty"`
+	Sandbox PluginSandboxConfig `yaml:"sandbox,omitempty"`
 }
 
 type CrawlExec struct {
+	PluginName string
 	Command string
 	CommandArgs []string
 	BaseDir string
+	Sandbox Sandbox
 }
 
 type FetchExec struct {
+	PluginName string
 	Command string
 	BaseDir string
 	StaticArgs []string
 	DynamicArgsPrefix string
+	Sandbox Sandbox
 }
 
 type Exec struct {
@@ -56,8 +108,173 @@ type Plugin struct {
 	Name string
 }
 
-func buildDynamicFetchArgs(id string, destination string, argPrefix string) []string {
-	return []string{"fetch", argPrefix+"id", id, argPrefix+"destination", destination}
+type RejectedPlugin struct {
+	MetaData PluginMetaData
+	Name string
+	Reason string
+}
+
+func (p Plugin) HasCapability(capability string) bool {
+	return StringInSlice(capability, p.MetaData.Capabilities)
+}
+
+func (p Plugin) SupportsKind(kind string) bool {
+	return StringInSlice(kind, p.MetaData.Kinds)
+}
+
+//the kind of the plugin's entries that don't specify one
+func (p Plugin) DefaultKind() string {
+	if len(p.MetaData.Kinds) == 0 {
+		return KindImage
+	}
+	return p.MetaData.Kinds[0]
+}
+
+//plugins that don't declare the kinds of their items were written when the capabilities implied them
+func getDefaultKinds(capabilities []string) []string {
+	if StringInSlice(CapabilityText, capabilities) {
+		return []string{KindText}
+	}
+	if StringInSlice(CapabilityPoster, capabilities) {
+		return []string{KindVideo}
+	}
+	return []string{KindImage}
+}
+
+//checks whether the plugin implements a protocol version the host supports. Plugins that
+//were written before the protocol version was introduced do not specify a version in their
+//meta.yaml file; those are treated as version 1 plugins which support crawl and fetch.
+func checkPluginCompatibility(pluginMetaData PluginMetaData) (PluginMetaData, error) {
+	if pluginMetaData.ProtocolVersion == 0 {
+		pluginMetaData.ProtocolVersion = 1
+	}
+
+	if len(pluginMetaData.Capabilities) == 0 {
+		pluginMetaData.Capabilities = []string{CapabilityCrawl, CapabilityFetch}
+	}
+
+	if pluginMetaData.ProtocolVersion < MinPluginProtocolVersion || pluginMetaData.ProtocolVersion > MaxPluginProtocolVersion {
+		return pluginMetaData, errors.New("Plugin " + pluginMetaData.Name + " implements protocol version " +
+			strconv.Itoa(pluginMetaData.ProtocolVersion) + ", but only versions " + strconv.Itoa(MinPluginProtocolVersion) +
+			" to " + strconv.Itoa(MaxPluginProtocolVersion) + " are supported")
+	}
+
+	if !StringInSlice(CapabilityCrawl, pluginMetaData.Capabilities) {
+		return pluginMetaData, errors.New("Plugin " + pluginMetaData.Name + " doesn't support the '" + CapabilityCrawl + "' capability")
+	}
+
+	for _, capability := range pluginMetaData.Capabilities {
+		if !StringInSlice(capability, supportedCapabilities) {
+			log.Warn("Ignoring unknown capability '", capability, "' of plugin ", pluginMetaData.Name)
+		}
+	}
+
+	if len(pluginMetaData.Kinds) == 0 {
+		pluginMetaData.Kinds = getDefaultKinds(pluginMetaData.Capabilities)
+	}
+
+	for _, kind := range pluginMetaData.Kinds {
+		if !StringInSlice(kind, supportedKinds) {
+			return pluginMetaData, errors.New("Plugin " + pluginMetaData.Name + " declares the unknown kind '" + kind + "'")
+		}
+	}
+
+	return pluginMetaData, nil
+}
+
+//number of stderr lines that are kept of a plugin execution
+const maxStderrLines = 20
+
+//plugins can report the progress of a crawl by writing a line in the form
+//"mindfulbytes:progress {"discovered": 10, "processed": 5, "errors": 0, "path": "/images/2019"}" to stdout
+const progressLinePrefix = "mindfulbytes:progress "
+
+type CrawlProgress struct {
+	Discovered int `json:"discovered"`
+	Processed int `json:"processed"`
+	Errors int `json:"errors"`
+	Path string `json:"path,omitempty"`
+}
+
+type progressHandlerFuncDef func(progress CrawlProgress)
+
+func parseProgressLine(line string) (CrawlProgress, bool) {
+	var progress CrawlProgress
+	if !strings.HasPrefix(line, progressLinePrefix) {
+		return progress, false
+	}
+
+	err := json.Unmarshal([]byte(strings.TrimPrefix(line, progressLinePrefix)), &progress)
+	if err != nil {
+		return progress, false
+	}
+	return progress, true
+}
+
+//exit codes a plugin can use to tell the scheduler how a run went. All the other
+//non-zero exit codes are treated like a transient failure.
+const (
+	PluginExitSuccess = 0
+	PluginExitPartialSuccess = 10 //some items were skipped, but the rest was indexed
+	PluginExitNothingChanged = 11 //nothing changed since the last run
+	PluginExitTransientFailure = 75 //e.g the remote server is not reachable, try again later
+	PluginExitConfigFailure = 78 //e.g wrong credentials or a missing directory, retrying doesn't help
+)
+
+const (
+	PluginOutcomeSuccess = "success"
+	PluginOutcomePartialSuccess = "partial-success"
+	PluginOutcomeNothingChanged = "nothing-changed"
+	PluginOutcomeTransientFailure = "transient-failure"
+	PluginOutcomeConfigFailure = "config-failure"
+)
+
+func getPluginOutcome(exitCode int) string {
+	switch exitCode {
+	case PluginExitSuccess:
+		return PluginOutcomeSuccess
+	case PluginExitPartialSuccess:
+		return PluginOutcomePartialSuccess
+	case PluginExitNothingChanged:
+		return PluginOutcomeNothingChanged
+	case PluginExitConfigFailure:
+		return PluginOutcomeConfigFailure
+	default:
+		return PluginOutcomeTransientFailure
+	}
+}
+
+type PluginExecResult struct {
+	ExitCode int
+	Outcome string
+	Stderr []string
+}
+
+type PluginExecError struct {
+	Description string
+	ExitCode int
+	Outcome string
+	Stderr []string
+}
+
+//returns true in case retrying the plugin run without changing the plugin's config is pointless
+func (e *PluginExecError) IsPermanent() bool {
+	return e.Outcome == PluginOutcomeConfigFailure
+}
+
+func (e *PluginExecError) Error() string {
+	if len(e.Stderr) > 0 {
+		return e.Description + ": " + strings.Join(e.Stderr, "\n")
+	}
+	return e.Description
+}
+
+func buildDynamicFetchArgs(id string, destination string, variant string, argPrefix string) []string {
+	args := []string{"fetch", argPrefix+"id", id, argPrefix+"destination", destination}
+	if variant != "" && variant != FetchVariantOriginal {
+		args = append(args, argPrefix+"variant", variant)
+	}
+	return args
 }
 
 //it's not necessary for a plugin to specify the fetch-args in the meta.yml file, in case 
@@ -111,6 +328,10 @@ func getCrawlArgs(pluginMetaData PluginMetaData, pluginConfig PluginConfig) ([]s
 	for key, value := range pluginConfig.Args {
 		argDetails, ok := pluginMetaData.CrawlArgs[key]
 		if !ok {
+			//the arguments that are only passed to fetch
+			if _, ok := pluginMetaData.FetchArgs[key]; ok {
+				continue
+			}
 			return args, errors.New("No format specified for parameter '" + key + "' in plugin " + pluginMetaData.Description)
 		}
 
@@ -162,30 +383,40 @@ func parsePluginConfigFile(path string) (PluginConfig, error) {
 	return t, nil
 }
 
-func execCrawl(crawlExec CrawlExec) error {
-	return execPlugin(crawlExec.Command, crawlExec.CommandArgs, crawlExec.BaseDir)
+func execCrawl(crawlExec CrawlExec, run pluginRun, progressHandler progressHandlerFuncDef) (PluginExecResult, error) {
+	return execPlugin(crawlExec.Command, crawlExec.CommandArgs, crawlExec.BaseDir, crawlExec.Sandbox, run, progressHandler)
 }
 
-func execFetch(id string, destination string, fetchExec FetchExec) error {
-	allArgs := buildDynamicFetchArgs(id, destination, fetchExec.DynamicArgsPrefix)
+func execFetch(id string, destination string, variant string, fetchExec FetchExec, run pluginRun) error {
+	allArgs := buildDynamicFetchArgs(id, destination, variant, fetchExec.DynamicArgsPrefix)
 	allArgs = append(allArgs, fetchExec.StaticArgs...)
 	log.Info("all args = ", allArgs)
-	return execPlugin(fetchExec.Command, allArgs, fetchExec.BaseDir)
+	_, err := execPlugin(fetchExec.Command, allArgs, fetchExec.BaseDir, fetchExec.Sandbox, run, nil)
+	return err
 }
 
-func execPlugin(command string, args []string, baseDir string) error {
+func execPlugin(command string, args []string, baseDir string, sandbox Sandbox, run pluginRun, progressHandler progressHandlerFuncDef) (PluginExecResult, error) {
 	log.Debug("Executing command ", command, " with arguments ", args)
+	defer run.flushLogs()
+
+	sandboxedCommand, cleanup, err := sandbox.prepare(command, args)
+	defer cleanup()
+	if err != nil {
+		return PluginExecResult{ExitCode: -1, Outcome: PluginOutcomeTransientFailure}, errors.New("Couldn't prepare sandbox: " + err.Error())
+	}
 	
 	cmdOptions := cmd.Options{
 		Buffered:  false,
 		Streaming: true,
 	}
 	
-	c := cmd.NewCmdOptions(cmdOptions, command, args...)
+	c := cmd.NewCmdOptions(cmdOptions, sandboxedCommand.Command, sandboxedCommand.Args...)
 	
 	c.Dir = baseDir
+	c.Env = sandboxedCommand.Env
 	statusChannel := c.Start()
 
+	stderrTail := []string{}
 	communicationChanel := make(chan struct{})
 	go func() {
 		defer close(communicationChanel)
@@ -199,28 +430,79 @@ func execPlugin(command string, args []string, baseDir string) error {
 					continue
 				}
 
-				log.Debug(line)
+				if progress, ok := parseProgressLine(line); ok {
+					if progressHandler != nil {
+						progressHandler(progress)
+					}
+					continue
+				}
+
+				run.log(line, "debug")
 			case line, open := <-c.Stderr:
 				if !open {
 					c.Stderr = nil
 					continue
 				}
-				log.Error(line)
-				//log.Error(os.Stderr, line)
+				run.log(line, "error")
+
+				stderrTail = append(stderrTail, line)
+				if len(stderrTail) > maxStderrLines {
+					stderrTail = stderrTail[1:]
+				}
 			}
 		}
 	}()
 	status := <-statusChannel
 	if status.Error != nil {
-		return status.Error
+		return PluginExecResult{ExitCode: status.Exit, Outcome: PluginOutcomeTransientFailure}, status.Error
 	}
 	<-communicationChanel
+
+	result := PluginExecResult{ExitCode: status.Exit, Outcome: getPluginOutcome(status.Exit), Stderr: stderrTail}
+	if result.Outcome == PluginOutcomeTransientFailure || result.Outcome == PluginOutcomeConfigFailure {
+		return result, &PluginExecError{Description: "Command " + command + " exited with code " + strconv.Itoa(status.Exit) + " (" + result.Outcome + ")",
+			ExitCode: status.Exit, Outcome: result.Outcome, Stderr: stderrTail}
+	}
 	log.Debug("Execution of command ", command, " with arguments ", args, " done")
-	return nil
+	return result, nil
 }
 
-func loadPlugins(pluginDir string, configDir string) ([]Plugin, error) {
+func getPluginConfigFilePath(configDir string, pluginName string) string {
+	return configDir + pluginName + "/config.yaml"
+}
+
+func newExec(pluginName string, pluginMetaData PluginMetaData, pluginConfig PluginConfig, baseDir string, sandboxOptions SandboxOptions) (Exec, error) {
+	sandbox, err := newSandbox(pluginName, pluginConfig, sandboxOptions)
+	if err != nil {
+		return Exec{}, errors.New("Couldn't create sandbox for plugin " + pluginName + ": " + err.Error())
+	}
+
+	exec := Exec{}
+	exec.CrawlExec.PluginName = pluginName
+	exec.CrawlExec.Sandbox = sandbox
+	exec.FetchExec.PluginName = pluginName
+	exec.FetchExec.Sandbox = sandbox
+	exec.CrawlExec.CommandArgs, err = getCrawlArgs(pluginMetaData, pluginConfig)
+	if err != nil {
+		return exec, err
+	}
+	exec.CrawlExec.BaseDir = baseDir
+	exec.CrawlExec.Command = pluginMetaData.Command
+
+	exec.FetchExec.BaseDir = baseDir
+	exec.FetchExec.Command = pluginMetaData.Command
+	exec.FetchExec.StaticArgs, err = getFetchArgs(pluginMetaData, pluginConfig)
+	if err != nil {
+		return exec, err
+	}
+
+	exec.FetchExec.DynamicArgsPrefix = getFetchArgPrefix(pluginMetaData)
+	return exec, nil
+}
+
+func loadPlugins(pluginDir string, configDir string, sandboxOptions SandboxOptions) ([]Plugin, []RejectedPlugin, error) {
 	pluginEntries := []Plugin{}
+	rejectedPlugins := []RejectedPlugin{}
 	err := filepath.Walk(pluginDir, func(path string, info os.FileInfo, err error) error {
 		if filepath.Ext(path) == ".yaml" {
 			pluginMetaData, fError := parsePluginMetaDataFile(path)
@@ -235,63 +517,127 @@ func loadPlugins(pluginDir string, configDir string) ([]Plugin, error) {
 
 			pluginDir := filepath.Dir(path)
 			pluginName := filepath.Base(pluginDir)
+
+			pluginMetaData, err = checkPluginCompatibility(pluginMetaData)
+			if err != nil {
+				log.Error("Not loading plugin ", pluginName, ": ", err.Error())
+				rejectedPlugins = append(rejectedPlugins, RejectedPlugin{MetaData: pluginMetaData, Name: pluginName, Reason: err.Error()})
+				return nil
+			}
 			
-			configPath := configDir + pluginName + "/config.yaml"
-			
-			pluginConfig, fError := parsePluginConfigFile(configPath)
+			pluginConfig, fError := parsePluginConfigFile(getPluginConfigFilePath(configDir, pluginName))
 			if fError != nil {
 				return fError
 			}
 
-			exec := Exec{}
-			exec.CrawlExec.CommandArgs, err = getCrawlArgs(pluginMetaData, pluginConfig)
+			err = validateSandboxConfig(pluginConfig.Sandbox)
 			if err != nil {
-				return err
+				log.Error("Not loading plugin ", pluginName, ": ", err.Error())
+				rejectedPlugins = append(rejectedPlugins, RejectedPlugin{MetaData: pluginMetaData, Name: pluginName, Reason: err.Error()})
+				return nil
 			}
-			exec.CrawlExec.BaseDir = pluginMetaDataDir
-			exec.CrawlExec.Command = pluginMetaData.Command
-			
-			exec.FetchExec.BaseDir = pluginMetaDataDir
-			exec.FetchExec.Command = pluginMetaData.Command
-			exec.FetchExec.StaticArgs, err = getFetchArgs(pluginMetaData, pluginConfig)
+
+			exec, err := newExec(pluginName, pluginMetaData, pluginConfig, pluginMetaDataDir, sandboxOptions)
 			if err != nil {
 				return err
 			}
 
-			exec.FetchExec.DynamicArgsPrefix = getFetchArgPrefix(pluginMetaData)
-
 			pluginEntries = append(pluginEntries, Plugin{Config: pluginConfig, MetaData: pluginMetaData, Name: pluginName, Exec: exec})
 		}
 		return nil
 	})
 
-	return pluginEntries, err
+	return pluginEntries, rejectedPlugins, err
 }
 
 type Plugins struct {
 	pluginDir string
 	configDir string
+	sandboxOptions SandboxOptions
+	logBuffer *PluginLogBuffer
+	mutex sync.RWMutex
 	plugins []Plugin
+	rejectedPlugins []RejectedPlugin
 }
 
-func NewPlugins(pluginDir string, configDir string) *Plugins {
+func NewPlugins(pluginDir string, configDir string, sandboxOptions SandboxOptions, logBuffer *PluginLogBuffer) *Plugins {
 	return &Plugins{
 		pluginDir: pluginDir,
 		configDir: configDir,
+		sandboxOptions: sandboxOptions,
+		logBuffer: logBuffer,
 	}
 }
 
 func (p *Plugins) Load() error {
-	var err error
-	p.plugins, err = loadPlugins(p.pluginDir, p.configDir)
+	plugins, rejectedPlugins, err := loadPlugins(p.pluginDir, p.configDir, p.sandboxOptions)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.plugins = plugins
+	p.rejectedPlugins = rejectedPlugins
 	return err
 }
 
+//reads the config of the given plugin again, e.g after it was changed to fix a configuration error
+func (p *Plugins) ReloadConfig(name string) (Plugin, error) {
+	plugin, err := p.GetPlugin(name)
+	if err != nil {
+		return plugin, err
+	}
+
+	pluginConfig, err := parsePluginConfigFile(getPluginConfigFilePath(p.configDir, name))
+	if err != nil {
+		return plugin, err
+	}
+
+	err = ValidatePluginConfig(plugin.MetaData, pluginConfig)
+	if err != nil {
+		return plugin, err
+	}
+
+	exec, err := newExec(name, plugin.MetaData, pluginConfig, plugin.Exec.CrawlExec.BaseDir, p.sandboxOptions)
+	if err != nil {
+		return plugin, err
+	}
+	plugin.Config = pluginConfig
+	plugin.Exec = exec
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for i := range p.plugins {
+		if p.plugins[i].Name == name {
+			p.plugins[i] = plugin
+		}
+	}
+	return plugin, nil
+}
+
+//returns the last modification time of the given plugin's config
+func (p *Plugins) GetConfigModificationTime(name string) (time.Time, error) {
+	info, err := os.Stat(getPluginConfigFilePath(p.configDir, name))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+//returns the plugins that couldn't be loaded as they aren't compatible with the host
+func (p *Plugins) GetRejectedPlugins() []RejectedPlugin {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.rejectedPlugins
+}
+
 func (p *Plugins) GetPlugins() []Plugin {
-	return p.plugins
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return append([]Plugin{}, p.plugins...)
 }
 
 func (p *Plugins) GetPlugin(name string) (Plugin, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
 	for _, plugin := range p.plugins {
 		if plugin.Name == name {
 			return plugin, nil
@@ -302,6 +648,8 @@ func (p *Plugins) GetPlugin(name string) (Plugin, error) {
 }
 
 func (p *Plugins) GetTopics() map[string][]string {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
 	topics := make(map[string][]string)
 	for _, plugin := range p.plugins {
 		for _, topic := range plugin.MetaData.Topics {
@@ -318,10 +666,22 @@ func (p *Plugins) GetTopics() map[string][]string {
 	return topics
 }
 
-func (p *Plugins) ExecFetch(id string, destination string, fetchExec FetchExec) error {
-	return execFetch(id, destination, fetchExec)
+func (p *Plugins) ExecFetch(id string, destination string, variant string, fetchExec FetchExec) error {
+	runId, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	run := pluginRun{Plugin: fetchExec.PluginName, RunId: runId.String(), Phase: PluginPhaseFetch, LogBuffer: p.logBuffer}
+	return execFetch(id, destination, variant, fetchExec, run)
+}
+
+//the run id is used to tag the log lines of the plugin
+func (p *Plugins) ExecCrawl(crawlExec CrawlExec, runId string, progressHandler progressHandlerFuncDef) (PluginExecResult, error) {
+	run := pluginRun{Plugin: crawlExec.PluginName, RunId: runId, Phase: PluginPhaseCrawl, LogBuffer: p.logBuffer}
+	return execCrawl(crawlExec, run, progressHandler)
 }
 
-func (p *Plugins) ExecCrawl(crawlExec CrawlExec) error {
-	return execCrawl(crawlExec)
+func (p *Plugins) GetLogBuffer() *PluginLogBuffer {
+	return p.logBuffer
 }
@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//host settings that are used to build the execution environment of the plugins
+type SandboxOptions struct {
+	RedisAddress string
+	DataDir string
+	CacheDir string
+	TmpDir string
+}
+
+//the memory limit restricts the virtual address space (RLIMIT_AS). The Go runtime reserves a large part of it at
+//startup (~700MB), so Go plugins with a lower limit fail before they do anything.
+const minSandboxMemoryMegabytes = 1024
+
+//per plugin limits, configured in the 'sandbox' section of the plugin's config.yaml
+type PluginSandboxConfig struct {
+	User string `yaml:"user"`
+	CpuSeconds int `yaml:"cpu"`
+	MemoryMegabytes int `yaml:"memory"`
+	OpenFiles int `yaml:"open-files"`
+}
+
+type Sandbox struct {
+	Env []string
+	Config PluginSandboxConfig
+	DataDir string
+	CacheDir string
+	TmpDir string
+}
+
+//checks that the limits can be applied on this host, so that a misconfigured plugin is
+//rejected when it's loaded and not when it's executed
+func validateSandboxConfig(sandboxConfig PluginSandboxConfig) error {
+	if sandboxConfig.MemoryMegabytes > 0 && sandboxConfig.MemoryMegabytes < minSandboxMemoryMegabytes {
+		return errors.New("Memory limit of " + strconv.Itoa(sandboxConfig.MemoryMegabytes) + "MB is too low, it needs to be at least " +
+							strconv.Itoa(minSandboxMemoryMegabytes) + "MB")
+	}
+
+	if sandboxConfig.User != "" {
+		if _, err := exec.LookPath("setpriv"); err != nil {
+			return errors.New("Running the plugin as user " + sandboxConfig.User + " requires setpriv (util-linux), but it wasn't found")
+		}
+	}
+	return nil
+}
+
+//builds a minimal environment for the plugin. Apart from the PATH nothing
+//is inherited from the host's environment.
+func newSandbox(pluginName string, pluginConfig PluginConfig, options SandboxOptions) (Sandbox, error) {
+	sandbox := Sandbox{Config: pluginConfig.Sandbox}
+
+	err := validateSandboxConfig(pluginConfig.Sandbox)
+	if err != nil {
+		return sandbox, err
+	}
+
+	sandbox.DataDir, err = filepath.Abs(filepath.Join(options.DataDir, pluginName))
+	if err != nil {
+		return sandbox, err
+	}
+
+	sandbox.CacheDir, err = filepath.Abs(filepath.Join(options.CacheDir, pluginName))
+	if err != nil {
+		return sandbox, err
+	}
+
+	sandbox.TmpDir = options.TmpDir
+	if sandbox.TmpDir == "" {
+		sandbox.TmpDir = os.TempDir()
+	}
+
+	sandbox.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + sandbox.DataDir,
+		"MINDFULBYTES_PLUGIN=" + pluginName,
+		"MINDFULBYTES_NAMESPACE=" + pluginName,
+		"MINDFULBYTES_DATA_DIR=" + sandbox.DataDir,
+		"MINDFULBYTES_CACHE_DIR=" + sandbox.CacheDir,
+		"REDIS_ADDRESS=" + options.RedisAddress,
+	}
+
+	for key, value := range pluginConfig.Secrets {
+		if key == "" || strings.ContainsAny(key, "= ") {
+			return sandbox, errors.New("Invalid secret name '" + key + "'")
+		}
+		sandbox.Env = append(sandbox.Env, key + "=" + value)
+	}
+
+	return sandbox, nil
+}
+
+func lookupUser(username string) (int, int, error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return -1, -1, err
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return -1, -1, err
+	}
+
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return -1, -1, err
+	}
+
+	return uid, gid, nil
+}
+
+type sandboxedCommand struct {
+	Command string
+	Args []string
+	Env []string
+}
+
+//creates the data and cache directory and a private temp directory for a single
+//plugin run and wraps the command. The returned function removes the temp directory again.
+func (s Sandbox) prepare(command string, args []string) (sandboxedCommand, func(), error) {
+	cleanup := func() {}
+
+	tmpDir, err := ioutil.TempDir(s.TmpDir, "mindfulbytes-plugin")
+	if err != nil {
+		return sandboxedCommand{}, cleanup, err
+	}
+	cleanup = func() {
+		os.RemoveAll(tmpDir) //no need to check return code, it's just cleanup
+	}
+
+	dirs := []string{s.DataDir, s.CacheDir, tmpDir}
+	for _, dir := range dirs {
+		err = os.MkdirAll(dir, 0700)
+		if err != nil {
+			return sandboxedCommand{}, cleanup, err
+		}
+	}
+
+	uid := -1
+	gid := -1
+	if s.Config.User != "" {
+		uid, gid, err = lookupUser(s.Config.User)
+		if err != nil {
+			return sandboxedCommand{}, cleanup, errors.New("Couldn't look up user " + s.Config.User + ": " + err.Error())
+		}
+
+		for _, dir := range dirs {
+			err = os.Chown(dir, uid, gid)
+			if err != nil {
+				return sandboxedCommand{}, cleanup, err
+			}
+		}
+	}
+
+	c := sandboxedCommand{}
+	c.Command, c.Args = buildSandboxedCommand(command, args, s.Config, uid, gid)
+	c.Env = append([]string{}, s.Env...)
+	c.Env = append(c.Env, "TMPDIR=" + tmpDir)
+	return c, cleanup, nil
+}
+
+//wraps the plugin command, so that the configured resource limits are applied
+//(via the shell's ulimit, the memory limit is the RLIMIT_AS) and the privileges
+//are dropped (via setpriv) in case a uid is given.
+func buildSandboxedCommand(command string, args []string, sandboxConfig PluginSandboxConfig, uid int, gid int) (string, []string) {
+	limits := []string{}
+	if sandboxConfig.CpuSeconds > 0 {
+		limits = append(limits, "ulimit -t " + strconv.Itoa(sandboxConfig.CpuSeconds))
+	}
+	if sandboxConfig.MemoryMegabytes > 0 {
+		limits = append(limits, "ulimit -v " + strconv.Itoa(sandboxConfig.MemoryMegabytes * 1024))
+	}
+	if sandboxConfig.OpenFiles > 0 {
+		limits = append(limits, "ulimit -n " + strconv.Itoa(sandboxConfig.OpenFiles))
+	}
+
+	if len(limits) > 0 {
+		script := strings.Join(limits, " && ") + " && exec \"$0\" \"$@\""
+		args = append([]string{"-c", script, command}, args...)
+		command = "/bin/sh"
+	}
+
+	if uid >= 0 {
+		args = append([]string{"--reuid", strconv.Itoa(uid), "--regid", strconv.Itoa(gid), "--clear-groups", "--", command}, args...)
+		command = "setpriv"
+	}
+
+	return command, args
+}
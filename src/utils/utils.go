@@ -16,7 +16,7 @@ import (
 )
 
 type scheduleNotificationFuncDef func(string, config.Notification) error
-type schedulePluginExecFuncDef func(plugin Plugin, plugins *Plugins) error
+type schedulePluginExecFuncDef func(plugin Plugin, plugins *Plugins, redisPool *redis.Pool) error
 
 func GetRandomNumber(max int) int {
 	s1 := rand.NewSource(time.Now().UnixNano())
@@ -91,9 +91,17 @@ func ReplaceTagsInMessage(template string, timestamp time.Time, language string)
 	return s, nil
 }
 
-func GetLastSuccessfulCrawlExecutionTimestamp(redisPool *redis.Pool, pluginName string) (time.Time, error) {
-	key := pluginName + ":settings:crawl:lastsuccess"
-	return getUnixTimestampFromRedis(redisPool, key)
+//replaces the tags of the entry's metadata, e.g {{ text }} with the text of a post. Tags of metadata the entry doesn't
+//have are removed, {{ timeago }} is left as it is.
+func ReplaceMetadataTagsInMessage(template string, metadata map[string]string) string {
+	r := regexp.MustCompile("\\{\\{[ ]*([a-z0-9-]+)[ ]*\\}\\}")
+	return r.ReplaceAllStringFunc(template, func(tag string) string {
+		name := r.FindStringSubmatch(tag)[1]
+		if name == "timeago" {
+			return tag
+		}
+		return metadata[name]
+	})
 }
 
 func getUnixTimestampFromRedis(redisPool *redis.Pool, key string) (time.Time, error) {
@@ -129,11 +137,6 @@ func updateUnixTimestampInRedis(redisPool *redis.Pool, key string, timestamp tim
 	return err
 }
 
-func SetLastSuccessfulCrawlExecutionTimestamp(redisPool *redis.Pool, pluginName string, timestamp time.Time) error {
-	key := pluginName + ":settings:crawl:lastsuccess"
-	return updateUnixTimestampInRedis(redisPool, key, timestamp)
-}
-
 func GetLastSuccessfulNotificationTimestamp(redisPool *redis.Pool, notificationName string) (time.Time, error) {
 	key := notificationName + ":settings:notification:lastsuccess"
 	return getUnixTimestampFromRedis(redisPool, key)
@@ -144,7 +147,9 @@ func SetLastSuccessfulNotificationTimestamp(redisPool *redis.Pool, notificationN
 	return updateUnixTimestampInRedis(redisPool, key, timestamp)
 }
 
-func SchedulePluginExecution(f schedulePluginExecFuncDef, plugin Plugin, plugins *Plugins, redisPool *redis.Pool) (*time.Ticker, error) {
+//schedules the crawls of the given plugin. After a configuration error the crawls are paused until a crawl
+//succeeded (signaled via the resume channel, e.g after a crawl was triggered via the REST API) or the plugin's config changed.
+func SchedulePluginExecution(f schedulePluginExecFuncDef, plugin Plugin, plugins *Plugins, redisPool *redis.Pool, resume <-chan bool) (*time.Ticker, error) {
 	defaultInterval, err := FuzzyTimeToDuration(plugin.Config.Refresh)
 	if err != nil {
 		return &time.Ticker{}, errors.New("Couldn't initialize " + plugin.Name + " crawl: " + err.Error())
@@ -180,32 +185,39 @@ func SchedulePluginExecution(f schedulePluginExecFuncDef, plugin Plugin, plugins
 		}
 	}
 
-	errorInterval, err := time.ParseDuration("1h")
-	if err != nil {
-		return &time.Ticker{}, errors.New("Couldn't trigger crawl for plugin " + plugin.Name + ": " + err.Error())
-	}
-
 	ticker := time.NewTicker(interval)
     go func() {
+		consecutiveFailures := 0
         for {
             select {
             case <-ticker.C:
-                err := f(plugin, plugins)
+                err := f(plugin, plugins, redisPool)
 				ticker.Stop()
 
-				if err != nil { //something went wrong, schedule another run in an hour
-					log.Debug("Schedule another crawl for plugin ", plugin.Name, " in ", errorInterval.Seconds(), " seconds, as the last try failed")
-					ticker = time.NewTicker(errorInterval)
-				} else { //execution was successful
-                	//update last execution timestamp
-					err = SetLastSuccessfulCrawlExecutionTimestamp(redisPool, plugin.Name, time.Now())
-					if err != nil {
-						log.Debug("Schedule another crawl for plugin ", plugin.Name, " in ", errorInterval.Seconds(), " seconds, as last execution failed")
-						ticker = time.NewTicker(errorInterval)
-					} else {
-						log.Debug("Schedule another crawl for plugin ", plugin.Name, " in ", defaultInterval.Seconds(), " seconds")
-						ticker = time.NewTicker(defaultInterval)
+				if err != nil {
+					if execErr, ok := err.(*PluginExecError); ok && execErr.IsPermanent() {
+						//retrying doesn't help, the plugin's config needs to be fixed first
+						log.Error("Pausing the crawls of plugin ", plugin.Name, " as the plugin reported a configuration error: ", err.Error())
+						var nextRun time.Duration
+						plugin, nextRun = waitForCrawlResume(plugin, plugins, resume, defaultInterval)
+						consecutiveFailures = 0
+						if interval, err := FuzzyTimeToDuration(plugin.Config.Refresh); err == nil {
+							defaultInterval = interval
+						}
+						log.Info("Resuming the crawls of plugin ", plugin.Name, ", next crawl in ", nextRun.Seconds(), " seconds")
+						ticker = time.NewTicker(nextRun)
+						continue
 					}
+
+					consecutiveFailures += 1
+					retryInterval := getCrawlRetryInterval(consecutiveFailures, defaultInterval)
+					log.Debug("Schedule another crawl for plugin ", plugin.Name, " in ", retryInterval.Seconds(), " seconds, as the last try failed (",
+								consecutiveFailures, " consecutive failures)")
+					ticker = time.NewTicker(retryInterval)
+				} else { //execution was successful, the timestamp of the last successful crawl is updated by the crawl itself
+					consecutiveFailures = 0
+					log.Debug("Schedule another crawl for plugin ", plugin.Name, " in ", defaultInterval.Seconds(), " seconds")
+					ticker = time.NewTicker(defaultInterval)
 				}
             }
         }
@@ -213,6 +225,62 @@ func SchedulePluginExecution(f schedulePluginExecFuncDef, plugin Plugin, plugins
     return ticker, nil
 }
 
+//the config of a paused plugin is checked for changes in this interval
+const pausedCrawlConfigCheckInterval = 1 * time.Minute
+
+//blocks until a crawl of the plugin succeeded or the plugin's config changed. Returns the (reloaded) plugin and
+//when to run the next crawl.
+func waitForCrawlResume(plugin Plugin, plugins *Plugins, resume <-chan bool, defaultInterval time.Duration) (Plugin, time.Duration) {
+	//only the crawls that succeed from now on resume the schedule
+	select {
+	case <-resume:
+	default:
+	}
+
+	configModificationTime, err := plugins.GetConfigModificationTime(plugin.Name)
+	if err != nil {
+		log.Error("Couldn't get modification time of the config of plugin ", plugin.Name, ": ", err.Error())
+	}
+
+	configCheckTicker := time.NewTicker(pausedCrawlConfigCheckInterval)
+	defer configCheckTicker.Stop()
+	for {
+		select {
+		case <-resume:
+			if p, err := plugins.GetPlugin(plugin.Name); err == nil {
+				plugin = p
+			}
+			return plugin, defaultInterval
+		case <-configCheckTicker.C:
+			modificationTime, err := plugins.GetConfigModificationTime(plugin.Name)
+			if err != nil || modificationTime.Equal(configModificationTime) {
+				continue
+			}
+			configModificationTime = modificationTime
+
+			reloadedPlugin, err := plugins.ReloadConfig(plugin.Name)
+			if err != nil {
+				log.Error("Couldn't reload the changed config of plugin ", plugin.Name, ": ", err.Error())
+				continue
+			}
+			return reloadedPlugin, 1 * time.Second
+		}
+	}
+}
+
+//exponential backoff for failed crawls: 5min, 10min, 20min,... but never longer than the regular crawl interval
+func getCrawlRetryInterval(consecutiveFailures int, maxInterval time.Duration) time.Duration {
+	interval := 5 * time.Minute
+	for i := 1; i < consecutiveFailures && interval < maxInterval; i++ {
+		interval *= 2
+	}
+
+	if interval > maxInterval {
+		return maxInterval
+	}
+	return interval
+}
+
 
 func ScheduleNotification(f scheduleNotificationFuncDef, name string, notification config.Notification,
 		redisPool *redis.Pool) (*time.Ticker, error) {
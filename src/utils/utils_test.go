@@ -7,6 +7,7 @@ import (
 	"runtime"
 	"path/filepath"
 	"reflect"
+	"os"
 )
 
 // ok fails the test if an err is not nil.
@@ -56,3 +57,296 @@ func TestReplaceGermanTimeagoTag(t *testing.T) {
 	ok(t, err)
 	equals(t, out, "Das Foto entstand vor 11 Jahren")
 }
+
+func TestReplaceMetadataTags(t *testing.T) {
+	metadata := map[string]string{"text": "Sunset at the lake", "elevation-gain": "120"}
+	out := ReplaceMetadataTagsInMessage("{{timeago}} you wrote: {{ text }} ({{elevation-gain}}m{{ description }})", metadata)
+	equals(t, out, "{{timeago}} you wrote: Sunset at the lake (120m)")
+
+	out = ReplaceMetadataTagsInMessage("{{ text }}", nil)
+	equals(t, out, "")
+}
+
+func TestParseProgressLine(t *testing.T) {
+	progress, isProgressLine := parseProgressLine(`mindfulbytes:progress {"discovered": 10, "processed": 5, "errors": 1, "path": "/images/2019"}`)
+	equals(t, true, isProgressLine)
+	equals(t, CrawlProgress{Discovered: 10, Processed: 5, Errors: 1, Path: "/images/2019"}, progress)
+}
+
+func TestParseInvalidProgressLine(t *testing.T) {
+	_, isProgressLine := parseProgressLine("Processing file /images/2019/img.jpg")
+	equals(t, false, isProgressLine)
+
+	_, isProgressLine = parseProgressLine("mindfulbytes:progress {invalid")
+	equals(t, false, isProgressLine)
+}
+
+func TestBuildDefaultPluginConfig(t *testing.T) {
+	metaData := PluginMetaData{CrawlArgs: map[string]Arg{"directory": Arg{Type: "string", Format: "long", Default: "/images"}}}
+	pluginConfig := buildDefaultPluginConfig(metaData)
+	equals(t, PluginConfig{Enabled: false, Refresh: "daily", Args: map[string]string{"directory": "/images"}}, pluginConfig)
+}
+
+//the default config contains the fetch arguments as well, it has to be valid so that an installed plugin can be loaded
+func TestValidateDefaultPluginConfigWithFetchArgs(t *testing.T) {
+	metaData := PluginMetaData{CrawlArgs: map[string]Arg{"directory": Arg{Type: "string", Format: "long", Default: "/videos", Required: true}},
+								FetchArgs: map[string]Arg{"ffmpeg": Arg{Type: "string", Format: "long", Default: "ffmpeg"},
+															"poster-offset": Arg{Type: "string", Format: "long", Default: "1"}}}
+	pluginConfig := buildDefaultPluginConfig(metaData)
+	ok(t, ValidatePluginConfig(metaData, pluginConfig))
+
+	pluginConfig.Enabled = true
+	ok(t, ValidatePluginConfig(metaData, pluginConfig))
+}
+
+func TestValidatePluginName(t *testing.T) {
+	ok(t, validatePluginName("imgreader-fs"))
+	for _, name := range []string{"", "../../etc", "a/b", "a\\b", "..", ".hidden", "foo..bar"} {
+		notOk(t, validatePluginName(name))
+	}
+}
+
+func TestRemovePluginWithInvalidName(t *testing.T) {
+	//the name is rejected before any path is built, the directories don't need to exist
+	pluginManager := NewPluginManager("/nonexistent/plugins", "/nonexistent/config")
+	notOk(t, pluginManager.Remove("../../etc", true))
+	notOk(t, pluginManager.SetEnabled("../config", true))
+	_, err := pluginManager.GetMetaData("../plugin")
+	notOk(t, err)
+}
+
+func TestSetEnabledInPluginConfig(t *testing.T) {
+	data := []byte("enabled: false\nrefresh: daily\nargs:\n  directory: /images\nsandbox:\n  cpu: 60\n")
+	out, err := setEnabledInPluginConfig(data, true)
+	ok(t, err)
+	equals(t, "enabled: true\nrefresh: daily\nargs:\n  directory: /images\nsandbox:\n  cpu: 60\n", string(out))
+
+	out, err = setEnabledInPluginConfig([]byte("args:\n  directory: /images\n"), false)
+	ok(t, err)
+	equals(t, "enabled: false\nargs:\n  directory: /images\n", string(out))
+
+	_, err = setEnabledInPluginConfig([]byte("enabled: [true"), true)
+	notOk(t, err)
+}
+
+func TestValidatePluginConfigWithMissingRequiredArg(t *testing.T) {
+	metaData := PluginMetaData{CrawlArgs: map[string]Arg{"directory": Arg{Type: "string", Format: "long", Required: true}}}
+	err := ValidatePluginConfig(metaData, PluginConfig{Enabled: true, Args: map[string]string{"directory": ""}})
+	notOk(t, err)
+
+	err = ValidatePluginConfig(metaData, PluginConfig{Enabled: false, Args: map[string]string{"directory": ""}})
+	ok(t, err)
+}
+
+func TestValidatePluginConfigWithFetchOnlyArg(t *testing.T) {
+	metaData := PluginMetaData{CrawlArgs: map[string]Arg{"directory": Arg{Type: "string", Format: "long", Required: true}},
+								FetchArgs: map[string]Arg{"ffmpeg": Arg{Type: "string", Format: "long"}}}
+	pluginConfig := PluginConfig{Enabled: true, Args: map[string]string{"directory": "/videos", "ffmpeg": "/usr/bin/ffmpeg"}}
+	ok(t, ValidatePluginConfig(metaData, pluginConfig))
+
+	args, err := getCrawlArgs(metaData, pluginConfig)
+	ok(t, err)
+	equals(t, []string{"crawl", "--directory", "/videos"}, args)
+
+	args, err = getFetchArgs(metaData, pluginConfig)
+	ok(t, err)
+	equals(t, []string{"--ffmpeg", "/usr/bin/ffmpeg"}, args)
+
+	//arguments that are neither crawl nor fetch arguments are still rejected
+	pluginConfig.Args["unknown"] = "1"
+	notOk(t, ValidatePluginConfig(metaData, pluginConfig))
+}
+
+func TestCheckPluginCompatibilityOfLegacyPlugin(t *testing.T) {
+	pluginMetaData, err := checkPluginCompatibility(PluginMetaData{Name: "legacy"})
+	ok(t, err)
+	equals(t, 1, pluginMetaData.ProtocolVersion)
+	equals(t, []string{CapabilityCrawl, CapabilityFetch}, pluginMetaData.Capabilities)
+	equals(t, []string{KindImage}, pluginMetaData.Kinds)
+}
+
+func TestCheckPluginCompatibilityWithKinds(t *testing.T) {
+	pluginMetaData, err := checkPluginCompatibility(PluginMetaData{Name: "videos", ProtocolVersion: 1,
+														Capabilities: []string{CapabilityCrawl, CapabilityFetch, CapabilityPoster}})
+	ok(t, err)
+	equals(t, []string{KindVideo}, pluginMetaData.Kinds)
+
+	pluginMetaData, err = checkPluginCompatibility(PluginMetaData{Name: "mails", ProtocolVersion: 1,
+														Capabilities: []string{CapabilityCrawl, CapabilityFetch, CapabilityPoster}, Kinds: []string{KindText, KindImage}})
+	ok(t, err)
+	equals(t, []string{KindText, KindImage}, pluginMetaData.Kinds)
+	equals(t, KindText, Plugin{MetaData: pluginMetaData}.DefaultKind())
+	equals(t, true, Plugin{MetaData: pluginMetaData}.SupportsKind(KindImage))
+
+	_, err = checkPluginCompatibility(PluginMetaData{Name: "podcasts", ProtocolVersion: 1, Capabilities: []string{CapabilityCrawl}, Kinds: []string{"podcast"}})
+	notOk(t, err)
+}
+
+func TestCheckPluginCompatibilityOfUnsupportedProtocolVersion(t *testing.T) {
+	_, err := checkPluginCompatibility(PluginMetaData{Name: "future", ProtocolVersion: MaxPluginProtocolVersion + 1})
+	notOk(t, err)
+}
+
+func TestCheckPluginCompatibilityWithoutCrawlCapability(t *testing.T) {
+	_, err := checkPluginCompatibility(PluginMetaData{Name: "fetchonly", ProtocolVersion: 1, Capabilities: []string{CapabilityFetch}})
+	notOk(t, err)
+}
+
+func TestBuildDynamicFetchArgsWithVariant(t *testing.T) {
+	equals(t, []string{"fetch", "--id", "1", "--destination", "/tmp/a"}, buildDynamicFetchArgs("1", "/tmp/a", FetchVariantOriginal, "--"))
+	equals(t, []string{"fetch", "--id", "1", "--destination", "/tmp/a", "--variant", "poster"}, buildDynamicFetchArgs("1", "/tmp/a", FetchVariantPoster, "--"))
+}
+
+func TestBuildRenderTextArgs(t *testing.T) {
+	args, err := buildRenderTextArgs("/tmp/note", "/tmp/note.png", ConvertOptions{Size: "200x100", TextColor: "black", BackgroundColor: "white"})
+	ok(t, err)
+	equals(t, []string{"-size", "180x90", "-background", "white", "-fill", "black", "-gravity", "center", "caption:@/tmp/note",
+		"-extent", "200x100", "/tmp/note.png"}, args)
+
+	args, err = buildRenderTextArgs("/tmp/note", "/tmp/note.png", ConvertOptions{})
+	ok(t, err)
+	equals(t, []string{"-size", "720x432", "-background", "black", "-fill", "white", "-gravity", "center", "caption:@/tmp/note",
+		"-extent", "800x480", "/tmp/note.png"}, args)
+
+	_, err = buildRenderTextArgs("/tmp/note", "/tmp/note.png", ConvertOptions{Size: "200"})
+	notOk(t, err)
+}
+
+func TestBuildSandboxedCommand(t *testing.T) {
+	command, args := buildSandboxedCommand("./main", []string{"crawl"}, PluginSandboxConfig{}, -1, -1)
+	equals(t, "./main", command)
+	equals(t, []string{"crawl"}, args)
+
+	command, args = buildSandboxedCommand("./main", []string{"crawl"}, PluginSandboxConfig{CpuSeconds: 60, OpenFiles: 100}, 1000, 1000)
+	equals(t, "setpriv", command)
+	equals(t, []string{"--reuid", "1000", "--regid", "1000", "--clear-groups", "--", "/bin/sh", "-c", 
+		"ulimit -t 60 && ulimit -n 100 && exec \"$0\" \"$@\"", "./main", "crawl"}, args)
+}
+
+func TestNewPluginLogEntryFromStructuredLine(t *testing.T) {
+	run := pluginRun{Plugin: "imgreader-nc", RunId: "1234", Phase: PluginPhaseCrawl}
+	entry := newPluginLogEntry(run, `{"level":"info","msg":"Processing file","path":"/a.jpg","time":"2021-01-01T00:00:00Z"}`, "debug")
+	equals(t, "info", entry.Level)
+	equals(t, "Processing file", entry.Message)
+	equals(t, map[string]interface{}{"path": "/a.jpg"}, entry.Fields)
+	equals(t, "1234", entry.RunId)
+}
+
+func TestNewPluginLogEntryFromPlainLine(t *testing.T) {
+	run := pluginRun{Plugin: "imgreader-fs", RunId: "1234", Phase: PluginPhaseFetch}
+	entry := newPluginLogEntry(run, "{not json", "error")
+	equals(t, "error", entry.Level)
+	equals(t, "{not json", entry.Message)
+	equals(t, 0, len(entry.Fields))
+}
+
+func TestValidateSandboxConfig(t *testing.T) {
+	ok(t, validateSandboxConfig(PluginSandboxConfig{}))
+	ok(t, validateSandboxConfig(PluginSandboxConfig{MemoryMegabytes: minSandboxMemoryMegabytes}))
+	notOk(t, validateSandboxConfig(PluginSandboxConfig{MemoryMegabytes: 256}))
+
+	//setpriv is only needed to run the plugin as another user
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", "/nonexistent")
+	ok(t, validateSandboxConfig(PluginSandboxConfig{CpuSeconds: 60}))
+	notOk(t, validateSandboxConfig(PluginSandboxConfig{User: "mindfulbytes"}))
+}
+
+func TestPluginLogBufferWritesInBatches(t *testing.T) {
+	redisPool, conn := newFakeRedisPool()
+	logBuffer := NewPluginLogBuffer(redisPool, 2)
+	logBuffer.flushInterval = time.Hour
+
+	for _, message := range []string{"first", "second", "third"} {
+		ok(t, logBuffer.Add(PluginLogEntry{Plugin: "imgreader-fs", RunId: "1", Phase: PluginPhaseCrawl, Level: "info", Message: message}))
+	}
+	//nothing is written before the flush
+	equals(t, 0, len(conn.lists))
+
+	ok(t, logBuffer.Flush())
+	equals(t, 2, len(conn.lists[getPluginLogsKey("imgreader-fs")]))
+
+	entries, err := logBuffer.Get("imgreader-fs", "1", PluginPhaseCrawl, 0)
+	ok(t, err)
+	equals(t, 2, len(entries))
+	equals(t, "third", entries[0].Message)
+	equals(t, "second", entries[1].Message)
+}
+
+func TestPluginLogBufferFlushesAfterInterval(t *testing.T) {
+	redisPool, _ := newFakeRedisPool()
+	logBuffer := NewPluginLogBuffer(redisPool, 10)
+	logBuffer.flushInterval = 10 * time.Millisecond
+
+	ok(t, logBuffer.Add(PluginLogEntry{Plugin: "imgreader-fs", Level: "info", Message: "first"}))
+	time.Sleep(100 * time.Millisecond)
+
+	logBuffer.mutex.Lock()
+	equals(t, 0, len(logBuffer.pending))
+	logBuffer.mutex.Unlock()
+}
+
+func TestPluginLogBufferKeepsEntriesOfFailedWrites(t *testing.T) {
+	redisPool, conn := newFakeRedisPool()
+	conn.failingKeys = map[string]bool{getPluginLogsKey("imgreader-fs"): true}
+	logBuffer := NewPluginLogBuffer(redisPool, 2)
+	logBuffer.flushInterval = time.Hour
+
+	for _, pluginName := range []string{"imgreader-fs", "calreader-ics", "videoreader-fs"} {
+		ok(t, logBuffer.Add(PluginLogEntry{Plugin: pluginName, Level: "info", Message: "first"}))
+	}
+	notOk(t, logBuffer.Flush())
+
+	//the entries of the other plugins are written nevertheless
+	equals(t, 1, len(conn.lists[getPluginLogsKey("calreader-ics")]))
+	equals(t, 1, len(conn.lists[getPluginLogsKey("videoreader-fs")]))
+	equals(t, 0, len(conn.lists[getPluginLogsKey("imgreader-fs")]))
+
+	//the entries that couldn't be written are kept (older first) and written with the next flush
+	ok(t, logBuffer.Add(PluginLogEntry{Plugin: "imgreader-fs", Level: "info", Message: "second"}))
+	ok(t, logBuffer.Add(PluginLogEntry{Plugin: "imgreader-fs", Level: "info", Message: "third"}))
+	conn.failingKeys = nil
+	entries, err := logBuffer.Get("imgreader-fs", "", "", 0)
+	ok(t, err)
+	equals(t, 2, len(entries))
+	equals(t, "third", entries[0].Message)
+	equals(t, "second", entries[1].Message)
+}
+
+func TestGetPluginOutcome(t *testing.T) {
+	equals(t, PluginOutcomeSuccess, getPluginOutcome(0))
+	equals(t, PluginOutcomePartialSuccess, getPluginOutcome(PluginExitPartialSuccess))
+	equals(t, PluginOutcomeNothingChanged, getPluginOutcome(PluginExitNothingChanged))
+	equals(t, PluginOutcomeConfigFailure, getPluginOutcome(PluginExitConfigFailure))
+	equals(t, PluginOutcomeTransientFailure, getPluginOutcome(PluginExitTransientFailure))
+	equals(t, PluginOutcomeTransientFailure, getPluginOutcome(1))
+}
+
+func TestWaitForCrawlResumeAfterSuccessfulCrawl(t *testing.T) {
+	plugins := &Plugins{configDir: "/nonexistent/", plugins: []Plugin{Plugin{Name: "imgreader-fs"}}}
+	resume := make(chan bool, 1)
+	//a crawl that succeeded before the schedule was paused doesn't resume it
+	resume <- true
+
+	nextRun := make(chan time.Duration)
+	go func() {
+		_, interval := waitForCrawlResume(Plugin{Name: "imgreader-fs"}, plugins, resume, 24 * time.Hour)
+		nextRun <- interval
+	}()
+
+	select {
+	case <-nextRun:
+		t.Fatal("Schedule was resumed without a successful crawl")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	resume <- true
+	equals(t, 24 * time.Hour, <-nextRun)
+}
+
+func TestGetCrawlRetryInterval(t *testing.T) {
+	equals(t, 5 * time.Minute, getCrawlRetryInterval(1, 24 * time.Hour))
+	equals(t, 20 * time.Minute, getCrawlRetryInterval(3, 24 * time.Hour))
+	equals(t, 24 * time.Hour, getCrawlRetryInterval(20, 24 * time.Hour))
+}
@@ -0,0 +1,209 @@
+package videodate
+
+import (
+	"github.com/bbernhard/mindfulbytes/isobmff"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrNoCreationTime = errors.New("No creation date found in container")
+var ErrUnsupportedFormat = errors.New("Unsupported container format")
+
+//MP4/MOV store the creation time in seconds since 1904, Matroska in nanoseconds since 2001
+var isoEpoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+var matroskaEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	ebmlIdHeader = 0x1A45DFA3
+	ebmlIdSegment = 0x18538067
+	ebmlIdInfo = 0x1549A966
+	ebmlIdDateUtc = 0x4461
+	ebmlIdCluster = 0x1F43B675
+)
+
+//returns the creation time that is stored in the container of a video (in UTC). Most phones
+//write the time in UTC, but some older cameras use the local time instead. The extension
+//(lower case, with the leading dot) selects the container format.
+func GetCreationTime(f io.ReadSeeker, ext string) (time.Time, error) {
+	switch ext {
+	case ".mp4", ".m4v", ".mov", ".3gp":
+		return getIsoCreationTime(f)
+	case ".mkv", ".webm":
+		return getMatroskaDateUtc(f)
+	}
+	return time.Time{}, ErrUnsupportedFormat
+}
+
+//the creation time is stored in the movie header ('mvhd') inside the 'moov' box, which is either
+//at the beginning or at the end of the file
+func getIsoCreationTime(f io.ReadSeeker) (time.Time, error) {
+	fileSize, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	parent := isobmff.Box{Type: "", Start: 0, End: fileSize}
+	for _, boxType := range []string{"moov", "mvhd"} {
+		var found *isobmff.Box
+		for offset := parent.Start; offset < parent.End; {
+			box, err := isobmff.ReadBox(f, offset, parent.End)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if box.Type == boxType {
+				found = &box
+				break
+			}
+			offset = box.End
+		}
+		if found == nil {
+			return time.Time{}, ErrNoCreationTime
+		}
+		parent = *found
+	}
+
+	_, err = f.Seek(parent.Start, io.SeekStart)
+	if err != nil {
+		return time.Time{}, err
+	}
+	version, err := isobmff.ReadUint(f, 4) //version (1 byte) + flags (3 bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	timeSize := 4
+	if version >> 24 == 1 {
+		timeSize = 8
+	}
+	creationTime, err := isobmff.ReadUint(f, timeSize)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if creationTime == 0 {
+		return time.Time{}, ErrNoCreationTime
+	}
+	return isoEpoch.Add(time.Duration(creationTime) * time.Second), nil
+}
+
+//reads a variable length integer as used by EBML. In case of an element id the length marker is kept.
+//Returns true in case all data bits are set, which means that the size of the element is unknown.
+func readEbmlVint(f io.Reader, keepMarker bool) (uint64, bool, error) {
+	first, err := isobmff.ReadUint(f, 1)
+	if err != nil {
+		return 0, false, err
+	}
+
+	length := 1
+	for mask := uint64(0x80); mask != 0 && first & mask == 0; mask >>= 1 {
+		length += 1
+	}
+	if length > 8 {
+		return 0, false, errors.New("Invalid EBML variable length integer")
+	}
+
+	rest, err := isobmff.ReadUint(f, length - 1)
+	if err != nil {
+		return 0, false, err
+	}
+
+	value := (first & (0xFF >> uint(length))) << (8 * uint(length - 1)) | rest
+	unknownSize := value == (1 << (7 * uint(length))) - 1
+	if keepMarker {
+		value = first << (8 * uint(length - 1)) | rest
+	}
+	return value, unknownSize, nil
+}
+
+type ebmlElement struct {
+	Id uint64
+	Start int64
+	End int64 //-1 in case the size is unknown (e.g live streams)
+}
+
+func readEbmlElement(f io.ReadSeeker, offset int64) (ebmlElement, error) {
+	_, err := f.Seek(offset, io.SeekStart)
+	if err != nil {
+		return ebmlElement{}, err
+	}
+
+	id, _, err := readEbmlVint(f, true)
+	if err != nil {
+		return ebmlElement{}, err
+	}
+
+	size, unknownSize, err := readEbmlVint(f, false)
+	if err != nil {
+		return ebmlElement{}, err
+	}
+
+	start, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return ebmlElement{}, err
+	}
+
+	element := ebmlElement{Id: id, Start: start, End: -1}
+	if !unknownSize {
+		element.End = start + int64(size)
+	}
+	return element, nil
+}
+
+//the date is stored in the 'DateUTC' element of the segment's 'Info' element
+func getMatroskaDateUtc(f io.ReadSeeker) (time.Time, error) {
+	fileSize, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	header, err := readEbmlElement(f, 0)
+	if err != nil || header.Id != ebmlIdHeader || header.End < 0 {
+		return time.Time{}, ErrNoCreationTime
+	}
+
+	segment, err := readEbmlElement(f, header.End)
+	if err != nil || segment.Id != ebmlIdSegment {
+		return time.Time{}, ErrNoCreationTime
+	}
+	if segment.End < 0 || segment.End > fileSize {
+		segment.End = fileSize
+	}
+
+	parent := segment
+	for _, id := range []uint64{ebmlIdInfo, ebmlIdDateUtc} {
+		var found *ebmlElement
+		for offset := parent.Start; offset < parent.End; {
+			element, err := readEbmlElement(f, offset)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if element.Id == id && element.End >= 0 {
+				found = &element
+				break
+			}
+			//the 'Info' element comes before the clusters, no need to read the whole file
+			if element.End < 0 || element.Id == ebmlIdCluster {
+				return time.Time{}, ErrNoCreationTime
+			}
+			offset = element.End
+		}
+		if found == nil {
+			return time.Time{}, ErrNoCreationTime
+		}
+		parent = *found
+	}
+
+	if parent.End - parent.Start != 8 {
+		return time.Time{}, ErrNoCreationTime
+	}
+	_, err = f.Seek(parent.Start, io.SeekStart)
+	if err != nil {
+		return time.Time{}, err
+	}
+	nanoseconds, err := isobmff.ReadUint(f, 8)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return matroskaEpoch.Add(time.Duration(int64(nanoseconds))), nil
+}
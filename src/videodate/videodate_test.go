@@ -0,0 +1,80 @@
+package videodate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error, expected not nil, but got nil: \033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+func TestGetCreationTimeOfMp4(t *testing.T) {
+	box := func(boxType string, payload []byte) []byte {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint32(b, uint32(8 + len(payload)))
+		copy(b[4:], boxType)
+		return append(b, payload...)
+	}
+
+	//version 0 'mvhd': version/flags, creation time, modification time
+	mvhd := make([]byte, 12)
+	binary.BigEndian.PutUint32(mvhd[4:], uint32(time.Date(2019, 7, 4, 21, 30, 0, 0, time.UTC).Sub(isoEpoch).Seconds()))
+	//the 'moov' box is at the end of the file, after the media data
+	data := append(box("ftyp", []byte("isom")), box("mdat", make([]byte, 1000))...)
+	data = append(data, box("moov", box("mvhd", mvhd))...)
+
+	d, err := GetCreationTime(bytes.NewReader(data), ".mp4")
+	ok(t, err)
+	equals(t, time.Date(2019, 7, 4, 21, 30, 0, 0, time.UTC), d)
+
+	_, err = GetCreationTime(bytes.NewReader(box("ftyp", []byte("isom"))), ".mov")
+	notOk(t, err)
+}
+
+func TestGetCreationTimeOfMatroska(t *testing.T) {
+	element := func(id []byte, payload []byte) []byte {
+		return append(append(id, 0x80 | byte(len(payload))), payload...)
+	}
+
+	dateUtc := make([]byte, 8)
+	binary.BigEndian.PutUint64(dateUtc, uint64(time.Date(2020, 2, 15, 10, 0, 0, 0, time.UTC).Sub(matroskaEpoch)))
+	info := element([]byte{0x15, 0x49, 0xA9, 0x66}, append(element([]byte{0x2A, 0xD7, 0xB1}, []byte{0x0F, 0x42, 0x40}),
+		element([]byte{0x44, 0x61}, dateUtc)...))
+	//segment with unknown size, as written by some live encoders
+	segment := append([]byte{0x18, 0x53, 0x80, 0x67, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, info...)
+	data := append(element([]byte{0x1A, 0x45, 0xDF, 0xA3}, element([]byte{0x42, 0x82}, []byte("webm"))), segment...)
+
+	d, err := GetCreationTime(bytes.NewReader(data), ".webm")
+	ok(t, err)
+	equals(t, time.Date(2020, 2, 15, 10, 0, 0, 0, time.UTC), d)
+}
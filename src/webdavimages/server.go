@@ -0,0 +1,153 @@
+package webdavimages
+
+import (
+	"github.com/bbernhard/mindfulbytes/imagedate"
+	"github.com/studio-b12/gowebdav"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+type FileInfo struct {
+	Path string `json:"path"`
+	ModificationTime time.Time `json:"modtime"`
+	ETag string `json:"etag"`
+	Size int64 `json:"size"`
+}
+
+//credentials for the WebDAV server, either a bearer token (e.g a Nextcloud app token) or username and password (basic auth)
+type Auth struct {
+	Username string
+	Password string
+	Token string
+}
+
+type Server struct {
+	url string
+	auth Auth
+	client *gowebdav.Client
+	httpClient *http.Client
+}
+
+//the CA certificate file is optional, it's needed for servers with a self-signed certificate (e.g a NAS)
+func NewServer(url string, auth Auth, caCertFile string) (*Server, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caCertFile != "" {
+		caCert, err := ioutil.ReadFile(caCertFile)
+		if err != nil {
+			return nil, err
+		}
+
+		certPool, err := x509.SystemCertPool()
+		if err != nil || certPool == nil {
+			certPool = x509.NewCertPool()
+		}
+		if !certPool.AppendCertsFromPEM(caCert) {
+			return nil, errors.New("No PEM encoded certificates found in " + caCertFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: certPool}
+	}
+
+	client := gowebdav.NewClient(url, auth.Username, auth.Password)
+	client.SetTransport(transport)
+	if auth.Token != "" {
+		client.SetHeader("Authorization", "Bearer " + auth.Token)
+	}
+
+	return &Server{
+		url: url,
+		auth: auth,
+		client: client,
+		httpClient: &http.Client{Transport: transport},
+	}, nil
+}
+
+func (s *Server) Url() string {
+	return s.url
+}
+
+func (s *Server) Read(path string) ([]byte, error) {
+	return s.client.Read(path)
+}
+
+func (s *Server) authorize(req *http.Request) {
+	if s.auth.Token != "" {
+		req.Header.Set("Authorization", "Bearer " + s.auth.Token)
+	} else if s.auth.Username != "" {
+		req.SetBasicAuth(s.auth.Username, s.auth.Password)
+	}
+}
+
+//the server answers with 401/403 in case of wrong credentials and with 404 in case
+//the directory doesn't exist. Retrying doesn't help in those cases.
+func IsConfigError(err error) bool {
+	if pathErr, ok := err.(*os.PathError); ok {
+		//either just the status code or e.g "404 Not Found - PROPFIND /Pictures"
+		status := strings.SplitN(pathErr.Err.Error(), " ", 2)[0]
+		return status == "401" || status == "403" || status == "404"
+	}
+	return false
+}
+
+func isSidecar(p string) bool {
+	ext := strings.ToLower(path.Ext(p))
+	return ext == ".xmp" || ext == ".json"
+}
+
+//WebDAV servers usually don't know the capture date, so the sidecar files (XMP, JSON) are collected
+//while walking the folders. That way we only request the sidecar files that actually exist.
+type Image struct {
+	server *Server
+	file FileInfo
+	sidecars map[string]bool
+	//the date and the details are read from the same sidecar files, they are only downloaded once
+	downloadedSidecars map[string][]byte
+}
+
+func (s *Server) NewImage(file FileInfo, sidecars map[string]bool) *Image {
+	return &Image{
+		server: s,
+		file: file,
+		sidecars: sidecars,
+		downloadedSidecars: make(map[string][]byte),
+	}
+}
+
+func (i *Image) Path() string {
+	return i.file.Path
+}
+
+func (i *Image) ModTime() time.Time {
+	return i.file.ModificationTime
+}
+
+func (i *Image) Version() string {
+	return i.file.ETag
+}
+
+//uses range requests, so that only the part of the image that contains the EXIF data is downloaded
+func (i *Image) Open() (imagedate.ReadSeekCloser, error) {
+	url := gowebdav.Join(i.server.url, gowebdav.PathEscape(i.file.Path))
+	return imagedate.NewRangeReader(i.server.httpClient, url, i.file.Size, i.server.authorize), nil
+}
+
+func (i *Image) ReadSidecar(path string) ([]byte, error) {
+	if !i.sidecars[path] {
+		return nil, os.ErrNotExist
+	}
+	if data, ok := i.downloadedSidecars[path]; ok {
+		return data, nil
+	}
+
+	data, err := i.server.client.Read(path)
+	if err == nil {
+		i.downloadedSidecars[path] = data
+	}
+	return data, err
+}
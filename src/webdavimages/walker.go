@@ -0,0 +1,309 @@
+package webdavimages
+
+import (
+	"github.com/studio-b12/gowebdav"
+	log "github.com/sirupsen/logrus"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//listing of a single folder (not filtered by the include/exclude patterns). Nextcloud and ownCloud change the
+//ETag of a folder whenever something below it changes, so the listing of an unchanged folder can be reused.
+//Other servers (e.g Apache's mod_dav) only change it when the folder itself changes.
+type FolderListing struct {
+	ETag string `json:"etag"`
+	Files []FileInfo `json:"files,omitempty"`
+	Sidecars []string `json:"sidecars,omitempty"`
+	//subfolders with their ETags
+	Folders map[string]string `json:"folders,omitempty"`
+}
+
+type folderCache struct {
+	Url string `json:"url"`
+	//the crawl settings (e.g the filter) the listings were made with
+	Settings string `json:"settings,omitempty"`
+	Folders map[string]FolderListing `json:"folders"`
+}
+
+//returns an empty cache in case the listings belong to a different server or were made with different settings
+func LoadFolderCache(path string, webDavUrl string, settings string) (map[string]FolderListing, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(map[string]FolderListing), nil
+		}
+		return make(map[string]FolderListing), err
+	}
+
+	var cache folderCache
+	err = json.Unmarshal(data, &cache)
+	if err != nil {
+		return make(map[string]FolderListing), err
+	}
+
+	if cache.Url != webDavUrl || cache.Settings != settings || cache.Folders == nil {
+		return make(map[string]FolderListing), nil
+	}
+	return cache.Folders, nil
+}
+
+func SaveFolderCache(path string, webDavUrl string, settings string, folders map[string]FolderListing) error {
+	data, err := json.Marshal(folderCache{Url: webDavUrl, Settings: settings, Folders: folders})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+//include and exclude patterns (see path.Match). Patterns without a slash are matched against the name
+//of a file or folder, all others against the path relative to the root directory (e.g "2019/*/*.jpg").
+//Excluded folders aren't walked at all, the include patterns only apply to files.
+type PathFilter struct {
+	include []string
+	exclude []string
+}
+
+func parsePatterns(s string) ([]string, error) {
+	patterns := []string{}
+	for _, pattern := range strings.Split(s, ",") {
+		pattern = strings.Trim(strings.TrimSpace(pattern), "/")
+		if pattern == "" {
+			continue
+		}
+
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return patterns, errors.New("Invalid pattern '" + pattern + "'")
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+func NewPathFilter(include string, exclude string) (*PathFilter, error) {
+	includePatterns, err := parsePatterns(include)
+	if err != nil {
+		return nil, err
+	}
+
+	excludePatterns, err := parsePatterns(exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PathFilter{include: includePatterns, exclude: excludePatterns}, nil
+}
+
+func matchesAny(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		name := relPath
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(relPath)
+		}
+
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *PathFilter) includesFolder(relPath string) bool {
+	return !matchesAny(f.exclude, relPath)
+}
+
+func (f *PathFilter) includesFile(relPath string) bool {
+	if matchesAny(f.exclude, relPath) {
+		return false
+	}
+	return len(f.include) == 0 || matchesAny(f.include, relPath)
+}
+
+//walks the folders concurrently, the semaphore limits the number of folders that are listed at the same time
+type Walker struct {
+	server *Server
+	filter *PathFilter
+	semaphore chan struct{}
+	walkers sync.WaitGroup
+	previous map[string]FolderListing
+	progressHandler func(discovered int, failedFolders int, folder string)
+
+	mutex sync.Mutex
+	current map[string]FolderListing
+	files []FileInfo
+	sidecars map[string]bool
+	failedFolders int
+	unchangedFolders int
+	rootErr error
+	lastProgressReport time.Time
+}
+
+func NewWalker(server *Server, filter *PathFilter, workers int) *Walker {
+	return &Walker{
+		server: server,
+		filter: filter,
+		semaphore: make(chan struct{}, workers),
+		previous: make(map[string]FolderListing),
+		current: make(map[string]FolderListing),
+		sidecars: make(map[string]bool),
+	}
+}
+
+//the listings of the folders whose ETag didn't change are reused instead of listing the folders again.
+//Only use it with servers that change the ETag of a folder when something below it changes.
+func (w *Walker) SetFolderCache(previous map[string]FolderListing) {
+	w.previous = previous
+}
+
+func (w *Walker) SetProgressHandler(progressHandler func(discovered int, failedFolders int, folder string)) {
+	w.progressHandler = progressHandler
+}
+
+//the images found so far, sorted by path
+func (w *Walker) Files() []FileInfo {
+	return w.files
+}
+
+func (w *Walker) Sidecars() map[string]bool {
+	return w.sidecars
+}
+
+//the listings of all folders that were walked, to be passed to SetFolderCache on the next crawl
+func (w *Walker) Listings() map[string]FolderListing {
+	return w.current
+}
+
+func (w *Walker) FailedFolders() int {
+	return w.failedFolders
+}
+
+func (w *Walker) UnchangedFolders() int {
+	return w.unchangedFolders
+}
+
+//returns true in case all folders were taken from the folder cache, i.e nothing changed since the last crawl
+func (w *Walker) Unchanged() bool {
+	return w.failedFolders == 0 && len(w.current) > 0 && w.unchangedFolders == len(w.current)
+}
+
+//walks the whole tree below the root directory and returns the error in case the root directory couldn't
+//be listed. Errors in subfolders are logged and counted instead, see FailedFolders. Can be called for several
+//root directories, the found images are accumulated.
+func (w *Walker) Walk(rootDir string) error {
+	rootDir = strings.TrimSuffix(rootDir, "/")
+	root, err := w.server.client.Stat(rootDir)
+	if err != nil {
+		return err
+	}
+
+	rootETag := ""
+	if f, ok := root.(*gowebdav.File); ok && f != nil {
+		rootETag = f.ETag()
+	}
+
+	w.rootErr = nil
+	w.walkers.Add(1)
+	go w.walkFolder(rootDir, rootDir, rootETag)
+	w.walkers.Wait()
+
+	//the folders are walked concurrently, sort the files to process them in a stable order
+	sort.Slice(w.files, func(i, j int) bool {
+		return w.files[i].Path < w.files[j].Path
+	})
+	return w.rootErr
+}
+
+func relPath(rootDir string, fullPath string) string {
+	return strings.Trim(strings.TrimPrefix(fullPath, rootDir), "/")
+}
+
+func (w *Walker) walkFolder(rootDir string, dir string, etag string) {
+	defer w.walkers.Done()
+
+	listing, ok := w.previous[dir]
+	unchanged := ok && etag != "" && listing.ETag == etag
+	if !unchanged {
+		var err error
+		listing, err = w.listFolder(dir, etag)
+		if err != nil {
+			w.mutex.Lock()
+			if dir == rootDir {
+				w.rootErr = err
+			} else {
+				log.Error("Skipping folder ", dir, ": ", err.Error())
+				w.failedFolders += 1
+			}
+			w.mutex.Unlock()
+			return
+		}
+	} else {
+		log.Debug("Folder ", dir, " didn't change since the last crawl")
+	}
+
+	w.mutex.Lock()
+	w.current[dir] = listing
+	if unchanged {
+		w.unchangedFolders += 1
+	}
+	for _, file := range listing.Files {
+		if w.filter.includesFile(relPath(rootDir, file.Path)) {
+			w.files = append(w.files, file)
+		}
+	}
+	for _, sidecar := range listing.Sidecars {
+		w.sidecars[sidecar] = true
+	}
+	if w.progressHandler != nil && time.Since(w.lastProgressReport) > 500 * time.Millisecond {
+		w.lastProgressReport = time.Now()
+		w.progressHandler(len(w.files), w.failedFolders, dir)
+	}
+	w.mutex.Unlock()
+
+	for folder, folderETag := range listing.Folders {
+		if !w.filter.includesFolder(relPath(rootDir, folder)) {
+			log.Debug("Skipping excluded folder ", folder)
+			continue
+		}
+
+		w.walkers.Add(1)
+		go w.walkFolder(rootDir, folder, folderETag)
+	}
+}
+
+func (w *Walker) listFolder(dir string, etag string) (FolderListing, error) {
+	w.semaphore <- struct{}{}
+	files, err := w.server.client.ReadDir(dir)
+	<-w.semaphore
+	if err != nil {
+		return FolderListing{}, err
+	}
+
+	listing := FolderListing{ETag: etag, Folders: make(map[string]string)}
+	for _, file := range files {
+		fullPath := dir + "/" + file.Name()
+		webDavFile := file.(gowebdav.File)
+
+		if file.IsDir() {
+			listing.Folders[fullPath] = webDavFile.ETag()
+		} else if isSidecar(fullPath) {
+			listing.Sidecars = append(listing.Sidecars, fullPath)
+		} else {
+			//we are only interested in images
+			contentType := webDavFile.ContentType()
+			if strings.HasPrefix(contentType, "image/") {
+				listing.Files = append(listing.Files, FileInfo{Path: fullPath, ModificationTime: file.ModTime(),
+												ETag: webDavFile.ETag(), Size: file.Size()})
+			} else {
+				log.Debug("Skipping ", fullPath, " as we've got an invalid content type (content type: ", contentType, ")")
+			}
+		}
+	}
+	return listing, nil
+}
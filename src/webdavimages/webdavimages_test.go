@@ -0,0 +1,304 @@
+package webdavimages
+
+import (
+	"github.com/bbernhard/mindfulbytes/imagedate"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error, expected not nil, but got nil: \033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+type testNode struct {
+	etag string
+	children []string //nil for files
+}
+
+//stand-in for a WebDAV server, which answers PROPFIND requests from a static tree and counts the listings per folder
+type testServer struct {
+	mutex sync.Mutex
+	tree map[string]*testNode
+	listings map[string]int
+	failing map[string]bool
+}
+
+func (s *testServer) entry(path string, node *testNode) string {
+	if node.children != nil {
+		return `<d:response><d:href>` + path + `/</d:href><d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype>` +
+				`<d:getetag>"` + node.etag + `"</d:getetag></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`
+	}
+
+	contentType := "image/jpeg"
+	if strings.HasSuffix(path, ".xmp") {
+		contentType = "application/octet-stream"
+	}
+	return `<d:response><d:href>` + path + `</d:href><d:propstat><d:prop><d:resourcetype/><d:getcontenttype>` + contentType +
+			`</d:getcontenttype><d:getcontentlength>10</d:getcontentlength><d:getetag>"` + node.etag + `"</d:getetag></d:prop>` +
+			`<d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	username, password, _ := r.BasicAuth()
+	if username != "user" || password != "secret" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	node, ok := s.tree[path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Header.Get("Depth") == "1" {
+		s.listings[path] += 1
+	}
+	if s.failing[path] {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body := s.entry(path, node)
+	if r.Header.Get("Depth") == "1" {
+		for _, child := range node.children {
+			body += s.entry(path + "/" + child, s.tree[path + "/" + child])
+		}
+	}
+	w.WriteHeader(207)
+	fmt.Fprint(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:">` + body + `</d:multistatus>`)
+}
+
+func newTestServer() *testServer {
+	return &testServer{
+		tree: map[string]*testNode{
+			"/photos": &testNode{etag: "root", children: []string{"2019", "2020", ".trash", "a.jpg"}},
+			"/photos/a.jpg": &testNode{etag: "a"},
+			"/photos/2019": &testNode{etag: "2019", children: []string{"b.jpg", "b.xmp"}},
+			"/photos/2019/b.jpg": &testNode{etag: "b"},
+			"/photos/2019/b.xmp": &testNode{etag: "bx"},
+			"/photos/2020": &testNode{etag: "2020", children: []string{"c.jpg", "broken"}},
+			"/photos/2020/c.jpg": &testNode{etag: "c"},
+			"/photos/2020/broken": &testNode{etag: "broken", children: []string{}},
+			"/photos/.trash": &testNode{etag: "trash", children: []string{"t.jpg"}},
+			"/photos/.trash/t.jpg": &testNode{etag: "t"},
+			"/family": &testNode{etag: "family", children: []string{"d.jpg"}},
+			"/family/d.jpg": &testNode{etag: "d"},
+		},
+		listings: make(map[string]int),
+		failing: map[string]bool{"/photos/2020/broken": true},
+	}
+}
+
+func getPaths(files []FileInfo) []string {
+	paths := []string{}
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	return paths
+}
+
+func TestWalkerReportsFailedFolders(t *testing.T) {
+	testServer := newTestServer()
+	httpServer := httptest.NewServer(testServer)
+	defer httpServer.Close()
+
+	server, err := NewServer(httpServer.URL, Auth{Username: "user", Password: "secret"}, "")
+	ok(t, err)
+	filter, err := NewPathFilter("", ".trash")
+	ok(t, err)
+
+	walker := NewWalker(server, filter, 2)
+	ok(t, walker.Walk("/photos"))
+	ok(t, walker.Walk("/family/"))
+	equals(t, []string{"/family/d.jpg", "/photos/2019/b.jpg", "/photos/2020/c.jpg", "/photos/a.jpg"}, getPaths(walker.Files()))
+	equals(t, map[string]bool{"/photos/2019/b.xmp": true}, walker.Sidecars())
+	equals(t, 1, walker.FailedFolders())
+
+	notOk(t, walker.Walk("/videos"))
+	equals(t, true, IsConfigError(walker.Walk("/videos")))
+}
+
+func TestWalkerSkipsUnchangedFolders(t *testing.T) {
+	testServer := newTestServer()
+	httpServer := httptest.NewServer(testServer)
+	defer httpServer.Close()
+
+	server, err := NewServer(httpServer.URL, Auth{Username: "user", Password: "secret"}, "")
+	ok(t, err)
+	filter, err := NewPathFilter("", ".trash")
+	ok(t, err)
+
+	walker := NewWalker(server, filter, 2)
+	ok(t, walker.Walk("/photos"))
+
+	dir, err := ioutil.TempDir("", "webdavimages")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	cachePath := filepath.Join(dir, "folders.json")
+	ok(t, SaveFolderCache(cachePath, server.Url(), "", walker.Listings()))
+
+	//a new image in 2019 changes the ETags of 2019 and all of its parents
+	testServer.tree["/photos/2019/e.jpg"] = &testNode{etag: "e"}
+	testServer.tree["/photos/2019"].children = append(testServer.tree["/photos/2019"].children, "e.jpg")
+	testServer.tree["/photos/2019"].etag = "2019-2"
+	testServer.tree["/photos"].etag = "root-2"
+	testServer.listings = make(map[string]int)
+
+	previous, err := LoadFolderCache(cachePath, server.Url(), "")
+	ok(t, err)
+	walker = NewWalker(server, filter, 2)
+	walker.SetFolderCache(previous)
+	ok(t, walker.Walk("/photos"))
+	equals(t, []string{"/photos/2019/b.jpg", "/photos/2019/e.jpg", "/photos/2020/c.jpg", "/photos/a.jpg"}, getPaths(walker.Files()))
+	equals(t, 1, walker.UnchangedFolders())
+	equals(t, false, walker.Unchanged())
+	//the folder that failed during the last crawl is listed again
+	equals(t, map[string]int{"/photos": 1, "/photos/2019": 1, "/photos/2020/broken": 1}, testServer.listings)
+
+	//the listings of a different server are ignored
+	previous, err = LoadFolderCache(cachePath, "https://example.com", "")
+	ok(t, err)
+	equals(t, 0, len(previous))
+}
+
+func TestWalkerWithoutChanges(t *testing.T) {
+	testServer := newTestServer()
+	httpServer := httptest.NewServer(testServer)
+	defer httpServer.Close()
+
+	server, err := NewServer(httpServer.URL, Auth{Username: "user", Password: "secret"}, "")
+	ok(t, err)
+	filter, err := NewPathFilter("", ".trash,broken")
+	ok(t, err)
+
+	walker := NewWalker(server, filter, 2)
+	ok(t, walker.Walk("/photos"))
+	equals(t, false, walker.Unchanged())
+
+	dir, err := ioutil.TempDir("", "webdavimages")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	cachePath := filepath.Join(dir, "folders.json")
+	ok(t, SaveFolderCache(cachePath, server.Url(), "exclude=.trash,broken", walker.Listings()))
+
+	previous, err := LoadFolderCache(cachePath, server.Url(), "exclude=.trash,broken")
+	ok(t, err)
+	walker = NewWalker(server, filter, 2)
+	walker.SetFolderCache(previous)
+	ok(t, walker.Walk("/photos"))
+	equals(t, true, walker.Unchanged())
+	equals(t, []string{"/photos/2019/b.jpg", "/photos/2020/c.jpg", "/photos/a.jpg"}, getPaths(walker.Files()))
+
+	//the listings that were made with different settings are ignored
+	previous, err = LoadFolderCache(cachePath, server.Url(), "exclude=.trash")
+	ok(t, err)
+	equals(t, 0, len(previous))
+}
+
+func TestPathFilter(t *testing.T) {
+	filter, err := NewPathFilter("*.jpg, 2019/*/*.png", "@eaDir,2018")
+	ok(t, err)
+	equals(t, true, filter.includesFile("2020/a.jpg"))
+	equals(t, true, filter.includesFile("2019/07/a.png"))
+	equals(t, false, filter.includesFile("2020/07/a.png"))
+	equals(t, false, filter.includesFolder("2020/@eaDir"))
+	equals(t, false, filter.includesFolder("2018"))
+	equals(t, true, filter.includesFolder("2019"))
+
+	_, err = NewPathFilter("[", "")
+	notOk(t, err)
+}
+
+func TestServerWithCustomCaCert(t *testing.T) {
+	httpServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		equals(t, "Bearer token", r.Header.Get("Authorization"))
+		http.ServeContent(w, r, "a.jpg", time.Time{}, strings.NewReader("0123456789"))
+	}))
+	defer httpServer.Close()
+
+	dir, err := ioutil.TempDir("", "webdavimages")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	caCertFile := filepath.Join(dir, "ca.pem")
+	ok(t, ioutil.WriteFile(caCertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: httpServer.Certificate().Raw}), 0600))
+
+	//without the CA certificate the server isn't trusted
+	server, err := NewServer(httpServer.URL, Auth{Token: "token"}, "")
+	ok(t, err)
+	f, err := server.NewImage(FileInfo{Path: "/a.jpg", Size: 10}, nil).Open()
+	ok(t, err)
+	_, err = ioutil.ReadAll(f)
+	notOk(t, err)
+
+	server, err = NewServer(httpServer.URL, Auth{Token: "token"}, caCertFile)
+	ok(t, err)
+	f, err = server.NewImage(FileInfo{Path: "/a.jpg", Size: 10}, nil).Open()
+	ok(t, err)
+	data, err := ioutil.ReadAll(f)
+	ok(t, err)
+	equals(t, "0123456789", string(data))
+
+	_, err = NewServer(httpServer.URL, Auth{}, filepath.Join(dir, "missing.pem"))
+	notOk(t, err)
+}
+
+func TestSidecarsAreOnlyDownloadedOnce(t *testing.T) {
+	requests := 0
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests += 1
+		w.Write([]byte(`{"photoTakenTime": {"timestamp": "1562243696"}, "description": "Lake"}`))
+	}))
+	defer httpServer.Close()
+
+	server, err := NewServer(httpServer.URL, Auth{}, "")
+	ok(t, err)
+	image := server.NewImage(FileInfo{Path: "/a.jpg"}, map[string]bool{"/a.jpg.json": true})
+
+	_, err = imagedate.NewExtractor([]string{imagedate.SourceSidecarJson}).GetDate(image)
+	ok(t, err)
+	equals(t, "Lake", imagedate.GetSidecarDetails(image).Description)
+	equals(t, 1, requests)
+
+	_, err = image.ReadSidecar("/b.jpg.json")
+	notOk(t, err)
+	equals(t, 1, requests)
+}